@@ -0,0 +1,110 @@
+package rpionewire
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Alarm is raised when a device reads a temperature outside of its
+// alarm thresholds
+type Alarm struct {
+	Device string
+	Value  float64
+	// Threshold is the threshold crossed, High telling whether it is
+	// the upper one
+	Threshold float64
+	High      bool
+	Time      time.Time
+}
+
+func (a Alarm) String() string {
+	op := "<"
+	if a.High {
+		op = ">"
+	}
+	return fmt.Sprintf("%v: %v %v %v", a.Device, a.Value, op, a.Threshold)
+}
+
+// alarmThresholds are the TL and TH registers of a device
+type alarmThresholds struct {
+	low, high int
+}
+
+// SubscribeAlarms returns a channel receiving the alarms raised by the
+// devices of the bus and a function ending the subscription. Devices
+// are checked against their thresholds on every successful read, so an
+// alarm is delivered within the read cycle that observed it. Alarms are
+// also published as AlarmRaised events.
+func (b *Bus) SubscribeAlarms(buffer int) (<-chan Alarm, func()) {
+	return b.alarms.subscribe(buffer)
+}
+
+// SubscribeAlarms subscribes to the alarms of the default bus
+func SubscribeAlarms(buffer int) (<-chan Alarm, func()) {
+	return defaultBus.SubscribeAlarms(buffer)
+}
+
+// SetAlarms writes the low and high alarm thresholds, in whole degrees
+// Celsius, to the TL and TH registers of the device
+func (d *DS1820) SetAlarms(low, high int) error {
+	if low > high {
+		return fmt.Errorf("Error setting alarms of %v: low %v above high %v", d.Name, low, high)
+	}
+	if err := writeAttr(d.backend(), d.Name, "alarms", fmt.Sprintf("%d %d", low, high)); err != nil {
+		return fmt.Errorf("Error setting alarms of %v: %w", d.Name, err)
+	}
+
+	d.mu.Lock()
+	d.alarms = &alarmThresholds{low: low, high: high}
+	d.mu.Unlock()
+	return nil
+}
+
+// Alarms reads the low and high alarm thresholds of the device
+func (d *DS1820) Alarms() (low, high int, err error) {
+	b, err := readRawAttr(d.backend(), d.Name, "alarms")
+	if err != nil {
+		return 0, 0, fmt.Errorf("Error reading alarms of %v: %w", d.Name, err)
+	}
+	fields := strings.Fields(string(b))
+	if len(fields) != 2 {
+		return 0, 0, fmt.Errorf("Error decoding alarms of %v: %q", d.Name, b)
+	}
+	if low, err = strconv.Atoi(fields[0]); err != nil {
+		return 0, 0, fmt.Errorf("Error decoding alarms of %v: %w", d.Name, err)
+	}
+	if high, err = strconv.Atoi(fields[1]); err != nil {
+		return 0, 0, fmt.Errorf("Error decoding alarms of %v: %w", d.Name, err)
+	}
+
+	d.mu.Lock()
+	d.alarms = &alarmThresholds{low: low, high: high}
+	d.mu.Unlock()
+	return low, high, nil
+}
+
+// checkAlarms raises an alarm if the temperature v read from the device
+// is outside of thresholds set or read through SetAlarms or Alarms
+func (d *DS1820) checkAlarms(v Temperature) {
+	d.mu.Lock()
+	th := d.alarms
+	d.mu.Unlock()
+	if th == nil {
+		return
+	}
+
+	a := Alarm{Device: d.Name, Value: float64(v), Time: d.now()}
+	switch {
+	case a.Value > float64(th.high):
+		a.Threshold, a.High = float64(th.high), true
+	case a.Value < float64(th.low):
+		a.Threshold = float64(th.low)
+	default:
+		return
+	}
+
+	d.bus.alarms.send(a)
+	d.bus.publish(Event{Type: AlarmRaised, Device: d.Name, Value: a.Value, Time: a.Time})
+}
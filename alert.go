@@ -0,0 +1,300 @@
+package rpionewire
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Condition is the test an AlertRule applies to a value
+type Condition int
+
+const (
+	// Above fires when the value exceeds High
+	Above Condition = iota
+	// Below fires when the value drops under Low
+	Below
+	// Outside fires when the value leaves the [Low, High] range
+	Outside
+)
+
+func (c Condition) String() string {
+	switch c {
+	case Above:
+		return "above"
+	case Below:
+		return "below"
+	case Outside:
+		return "outside"
+	}
+	return fmt.Sprintf("Condition(%d)", int(c))
+}
+
+// ParseCondition returns the Condition named name: above, below or
+// outside
+func ParseCondition(name string) (Condition, error) {
+	for _, c := range []Condition{Above, Below, Outside} {
+		if c.String() == name {
+			return c, nil
+		}
+	}
+	return 0, fmt.Errorf("Error parsing condition %q: expected above, below or outside", name)
+}
+
+// AlertRule describes when a device is in alert
+type AlertRule struct {
+	Name string
+	// Device is the name, or the alias, of the device the rule applies
+	// to
+	Device string
+	// Group, if set instead of Device, applies the rule to every device
+	// of the group, each of them being in alert on its own
+	Group     string
+	Condition Condition
+	Low       float64
+	High      float64
+	// For is how long the condition must hold before the alert fires
+	For time.Duration
+	// Hysteresis is how far back inside the thresholds a value must be
+	// for a firing alert to clear, so values hovering around a threshold
+	// do not flap the alert
+	Hysteresis float64
+	// ClearFor is how long a firing alert must see clearing values
+	// before going back to ok
+	ClearFor time.Duration
+}
+
+// appliesTo reports whether the rule applies to device d
+func (r *AlertRule) appliesTo(d *DS1820) bool {
+	if r.Group != "" {
+		return d.InGroup(r.Group)
+	}
+	return r.Device == d.Name || (d.Alias != "" && r.Device == d.Alias)
+}
+
+// matches reports whether v meets the condition of the rule
+func (r *AlertRule) matches(v float64) bool {
+	switch r.Condition {
+	case Above:
+		return v > r.High
+	case Below:
+		return v < r.Low
+	case Outside:
+		return v < r.Low || v > r.High
+	}
+	return false
+}
+
+// clears reports whether v is far enough inside the thresholds to clear
+// a firing alert
+func (r *AlertRule) clears(v float64) bool {
+	h := r.Hysteresis
+	switch r.Condition {
+	case Above:
+		return v <= r.High-h
+	case Below:
+		return v >= r.Low+h
+	case Outside:
+		return v >= r.Low+h && v <= r.High-h
+	}
+	return true
+}
+
+// AlertState is the state of an alert rule
+type AlertState int
+
+const (
+	// AlertOK is the state of a rule whose condition does not hold, or
+	// no longer does
+	AlertOK AlertState = iota
+	// AlertFiring is the state of a rule whose condition held for For
+	AlertFiring
+)
+
+func (s AlertState) String() string {
+	switch s {
+	case AlertOK:
+		return "ok"
+	case AlertFiring:
+		return "firing"
+	}
+	return fmt.Sprintf("AlertState(%d)", int(s))
+}
+
+// AlertTransition reports an alert rule changing state
+type AlertTransition struct {
+	Rule   string
+	Device string
+	From   AlertState
+	To     AlertState
+	// Value is the reading that caused the transition
+	Value float64
+	Time  time.Time
+}
+
+func (t AlertTransition) String() string {
+	return fmt.Sprintf("%v %v: %v -> %v (%v)", t.Rule, t.Device, t.From, t.To, t.Value)
+}
+
+// Notifier is told about alert transitions
+type Notifier interface {
+	Notify(t AlertTransition) error
+}
+
+// AlertSink is implemented by sinks taking the alert transitions of a
+// cycle on top of its readings: a Poller hands them the transitions of
+// the Alerters among its sinks once every sink has the readings
+type AlertSink interface {
+	WriteTransitions(transitions []AlertTransition) error
+}
+
+// alertState tracks the evaluation of a rule
+type alertState struct {
+	state AlertState
+	// since is when the condition started to hold, zero if it does not
+	since time.Time
+	// clearSince is when a firing alert started to see clearing values
+	clearSince time.Time
+}
+
+// Alerter evaluates alert rules against readings. It is a Sink, so it
+// is evaluated by a Poller by adding it to the poller sinks, and tells
+// its notifiers, and the AlertSinks of the poller, about every state
+// transition. For and ClearFor are timed by the readings, on the clock
+// of the bus they were read on.
+type Alerter struct {
+	rules     []AlertRule
+	notifiers []Notifier
+
+	mu sync.Mutex
+	// states are the states of the rules for each of their devices
+	states []map[string]*alertState
+	// last are the transitions of the last WriteReadings
+	last []AlertTransition
+}
+
+// NewAlerter returns an Alerter evaluating rules and notifying notifiers
+func NewAlerter(rules []AlertRule, notifiers ...Notifier) *Alerter {
+	return &Alerter{
+		rules:     rules,
+		notifiers: notifiers,
+		states:    make([]map[string]*alertState, len(rules)),
+	}
+}
+
+// WriteReadings evaluates the rules against the temperature readings.
+// Failed readings leave the rules of their device untouched.
+func (a *Alerter) WriteReadings(readings []Reading) error {
+	a.mu.Lock()
+	var transitions []AlertTransition
+	for _, r := range readings {
+		if r.Err != nil || r.Device == nil || !r.IsTemperature() {
+			continue
+		}
+		for i := range a.rules {
+			if !a.rules[i].appliesTo(r.Device) {
+				continue
+			}
+			if t, ok := a.evaluate(i, r.Device.Name, float64(r.Value), readingTime(r)); ok {
+				transitions = append(transitions, t)
+			}
+		}
+	}
+	a.last = transitions
+	a.mu.Unlock()
+
+	var errs []error
+	for _, t := range transitions {
+		for _, n := range a.notifiers {
+			if err := n.Notify(t); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// readingTime is the time r was read at, now on the clock of its device
+// for readings without one
+func readingTime(r Reading) time.Time {
+	switch {
+	case !r.Time.IsZero():
+		return r.Time
+	case r.Device != nil:
+		return r.Device.now()
+	}
+	return defaultBus.clock.Now()
+}
+
+// lastTransitions returns the transitions of the last WriteReadings
+func (a *Alerter) lastTransitions() []AlertTransition {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.last
+}
+
+// evaluate updates the state of rule i for device with value v
+// observed at now and returns the transition it caused, if any
+func (a *Alerter) evaluate(i int, device string, v float64, now time.Time) (AlertTransition, bool) {
+	if a.states[i] == nil {
+		a.states[i] = map[string]*alertState{}
+	}
+	st, ok := a.states[i][device]
+	if !ok {
+		st = new(alertState)
+		a.states[i][device] = st
+	}
+	rule := &a.rules[i]
+
+	next := st.state
+	if st.state == AlertOK {
+		if rule.matches(v) {
+			if st.since.IsZero() {
+				st.since = now
+			}
+			if now.Sub(st.since) >= rule.For {
+				next = AlertFiring
+			}
+		} else {
+			st.since = time.Time{}
+		}
+	} else {
+		if rule.clears(v) {
+			if st.clearSince.IsZero() {
+				st.clearSince = now
+			}
+			if now.Sub(st.clearSince) >= rule.ClearFor {
+				next = AlertOK
+			}
+		} else {
+			st.clearSince = time.Time{}
+		}
+	}
+
+	if next == st.state {
+		return AlertTransition{}, false
+	}
+	t := AlertTransition{Rule: rule.Name, Device: device, From: st.state, To: next, Value: v, Time: now}
+	st.state = next
+	st.since, st.clearSince = time.Time{}, time.Time{}
+	return t, true
+}
+
+// State returns the current state of the rule named name, firing if it
+// fires for any device of its group
+func (a *Alerter) State(name string) (AlertState, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for i := range a.rules {
+		if a.rules[i].Name == name {
+			for _, st := range a.states[i] {
+				if st.state == AlertFiring {
+					return AlertFiring, true
+				}
+			}
+			return AlertOK, true
+		}
+	}
+	return AlertOK, false
+}
@@ -0,0 +1,114 @@
+package rpionewire
+
+import (
+	"testing"
+	"time"
+)
+
+// notifications records the transitions it is notified of
+type notifications struct {
+	transitions []AlertTransition
+}
+
+func (n *notifications) Notify(t AlertTransition) error {
+	n.transitions = append(n.transitions, t)
+	return nil
+}
+
+func TestAlerterFakeClock(t *testing.T) {
+	clock := newFakeClock()
+	backend := &fakeBackend{names: []string{"28-000000000001"}}
+	devices, err := NewBus(WithBackend(backend), WithClock(clock)).LoadDevices()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rule := AlertRule{Name: "hot", Device: "28-000000000001", Condition: Above, High: 30, For: 5 * time.Minute, ClearFor: time.Minute}
+	n := new(notifications)
+	p := NewPoller(devices, time.Minute, WithSinks(NewAlerter([]AlertRule{rule}, n)), WithPollerClock(clock))
+
+	steps := []struct {
+		advance time.Duration
+		temp    float64
+		want    int
+	}{
+		{0, 35, 0},
+		{4 * time.Minute, 35, 0},
+		{time.Minute, 35, 1},
+		{time.Minute, 20, 1},
+		{30 * time.Second, 20, 1},
+		{30 * time.Second, 20, 2},
+	}
+	for i, s := range steps {
+		clock.Sleep(s.advance)
+		backend.set(s.temp, nil)
+		if err := p.Poll(); err != nil {
+			t.Fatal(err)
+		}
+		if len(n.transitions) != s.want {
+			t.Fatalf("step %d: got %d transitions, want %d", i, len(n.transitions), s.want)
+		}
+	}
+
+	if tr := n.transitions[0]; tr.To != AlertFiring || !tr.Time.Equal(clock.now.Add(-2*time.Minute)) {
+		t.Errorf("got %v at %v, want firing at %v", tr, tr.Time, clock.now.Add(-2*time.Minute))
+	}
+	if tr := n.transitions[1]; tr.To != AlertOK || !tr.Time.Equal(clock.now) {
+		t.Errorf("got %v at %v, want ok at %v", tr, tr.Time, clock.now)
+	}
+}
+
+// transitionSink records the alert transitions its poller hands it
+type transitionSink struct {
+	transitions []AlertTransition
+}
+
+func (s *transitionSink) WriteReadings([]Reading) error { return nil }
+
+func (s *transitionSink) WriteTransitions(ts []AlertTransition) error {
+	s.transitions = append(s.transitions, ts...)
+	return nil
+}
+
+func TestPollerAlertSinks(t *testing.T) {
+	clock := newFakeClock()
+	backend := &fakeBackend{names: []string{"28-000000000001"}, temp: 35}
+	devices, err := NewBus(WithBackend(backend), WithClock(clock)).LoadDevices()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rule := AlertRule{Name: "hot", Device: "28-000000000001", Condition: Above, High: 30}
+	sink := new(transitionSink)
+	p := NewPoller(devices, time.Minute, WithSinks(sink, NewAlerter([]AlertRule{rule})), WithPollerClock(clock))
+	for i := 0; i < 2; i++ {
+		if err := p.Poll(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(sink.transitions) != 1 || sink.transitions[0].To != AlertFiring {
+		t.Fatalf("got transitions %v, want the rule firing once", sink.transitions)
+	}
+}
+
+func TestAlertRuleAppliesTo(t *testing.T) {
+	freezer := &DS1820{Name: "28-000000000001", Alias: "freezer", Groups: []string{"kitchen"}}
+	other := &DS1820{Name: "28-000000000002"}
+	tests := []struct {
+		rule AlertRule
+		d    *DS1820
+		want bool
+	}{
+		{AlertRule{Device: "28-000000000001"}, freezer, true},
+		{AlertRule{Device: "freezer"}, freezer, true},
+		{AlertRule{Device: "freezer"}, other, false},
+		{AlertRule{Device: ""}, other, false},
+		{AlertRule{Group: "kitchen"}, freezer, true},
+		{AlertRule{Group: "kitchen"}, other, false},
+	}
+	for _, tt := range tests {
+		if got := tt.rule.appliesTo(tt.d); got != tt.want {
+			t.Errorf("rule on %q/%q applies to %v = %v, want %v", tt.rule.Device, tt.rule.Group, tt.d.Name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,280 @@
+package rpionewire
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ErrUnsupported is returned for operations the backend of a device
+// cannot perform
+var ErrUnsupported = errors.New("operation not supported by the backend")
+
+// Backend is how a Bus reaches its devices. The default backend reads
+// the local kernel sysfs tree; others reach buses managed elsewhere,
+// such as by an owserver.
+type Backend interface {
+	// Devices returns the names of the devices present on the bus, in
+	// the kernel format such as 28-0316a2794bff
+	Devices() ([]string, error)
+	// ReadTemperature performs a conversion on the device name and
+	// returns its temperature in °C
+	ReadTemperature(name string) (float64, error)
+}
+
+// AttrBackend is implemented by backends giving access to the raw w1
+// sysfs attributes of devices, such as resolution or alarms
+type AttrBackend interface {
+	Backend
+	ReadAttr(name, attr string) ([]byte, error)
+	WriteAttr(name, attr string, value []byte) error
+}
+
+// ContextBackend is implemented by backends whose device listing can
+// be aborted, such as those reaching a remote bus
+type ContextBackend interface {
+	Backend
+	DevicesContext(ctx context.Context) ([]string, error)
+}
+
+// RawBackend is implemented by backends exposing the raw data of the
+// conversions, for applications doing their own linearization or
+// diagnostics
+type RawBackend interface {
+	Backend
+	// ReadRaw performs a conversion on the device name and returns its
+	// temperature in millidegrees Celsius and the scratchpad bytes it
+	// was decoded from, nil if they are not available
+	ReadRaw(name string) (int64, []byte, error)
+}
+
+// SearchBackend is implemented by backends able to ask their bus
+// masters for a new search, so that devices appearing on the bus, such
+// as behind a coupler branch just switched on, are listed without
+// waiting for the periodic search of the kernel
+type SearchBackend interface {
+	Backend
+	Search() error
+}
+
+// Sysfs is the backend reading the devices of the kernel w1 subsystem
+// from the sysfs tree at Dir.
+//
+// Depending on the kernel version, temperatures are exposed by the
+// temperature attribute of the devices, their w1_slave file, or only
+// through hwmon. ReadTemperature tries them in this order and remembers
+// the first one found, so the same program works across Raspberry Pi OS
+// versions. ReadRaw, which the devices of a Bus read through, tries
+// w1_slave first: only it carries the scratchpad and the CRC check that
+// the DS18S20 extended resolution and the CRC retries rely on.
+type Sysfs struct {
+	Dir string
+	// Modules loads the kernel modules before the first discovery, nil
+	// leaving them to the system
+	Modules *ModuleLoader
+
+	mu sync.Mutex
+	// method and rawMethod are the methods found by ReadTemperature and
+	// ReadRaw
+	method    *readMethod
+	rawMethod *readMethod
+	loaded    bool
+}
+
+// readMethod is a way of reading the temperature of a device, returning
+// it in millidegrees Celsius with the scratchpad when available
+type readMethod struct {
+	name string
+	read func(dir, name string) (int64, []byte, error)
+}
+
+var (
+	temperatureMethod = &readMethod{"temperature", readTemperatureAttr}
+	w1SlaveMethod     = &readMethod{"w1_slave", func(dir, name string) (int64, []byte, error) {
+		return readW1Slave(filepath.Join(dir, name, "w1_slave"))
+	}}
+	hwmonMethod = &readMethod{"hwmon", readHwmon}
+)
+
+// readMethods are the methods tried by ReadTemperature, rawMethods
+// those tried by ReadRaw, in order
+var (
+	readMethods = []*readMethod{temperatureMethod, w1SlaveMethod, hwmonMethod}
+	rawMethods  = []*readMethod{w1SlaveMethod, temperatureMethod, hwmonMethod}
+)
+
+// ReadMethod returns how the temperatures are read by ReadRaw, or by
+// ReadTemperature if ReadRaw was not used: "temperature", "w1_slave" or
+// "hwmon", empty until a device was read
+func (s *Sysfs) ReadMethod() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, m := range []*readMethod{s.rawMethod, s.method} {
+		if m != nil {
+			return m.name
+		}
+	}
+	return ""
+}
+
+// Devices lists the devices of the sysfs tree, loading the kernel
+// modules first if s has a ModuleLoader
+func (s *Sysfs) Devices() ([]string, error) {
+	if err := s.loadModules(); err != nil {
+		return nil, err
+	}
+	return findDevices(s.Dir)
+}
+
+// loadModules loads the kernel modules once, unless running in a
+// container where the host loads them
+func (s *Sysfs) loadModules() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.Modules == nil || s.loaded || InContainer() {
+		return nil
+	}
+	if err := s.Modules.Load(); err != nil {
+		// Off Linux, a directory other than the sysfs one is a test
+		// tree that needs no module
+		if s.Dir == devicesDir || !errors.Is(err, ErrUnsupportedPlatform) {
+			return err
+		}
+	}
+	s.loaded = true
+	return nil
+}
+
+// ReadTemperature reads the temperature of the device
+func (s *Sysfs) ReadTemperature(name string) (float64, error) {
+	millis, _, err := s.read(name, readMethods, &s.method)
+	if err != nil {
+		return 0, err
+	}
+	return float64(millis) / 1000, nil
+}
+
+// ReadRaw reads the temperature of the device name with its scratchpad,
+// through w1_slave unless the kernel lacks it, the scratchpad being nil
+// then
+func (s *Sysfs) ReadRaw(name string) (int64, []byte, error) {
+	return s.read(name, rawMethods, &s.rawMethod)
+}
+
+// read reads the device name with the method stored in cached, finding
+// it among methods on the first read
+func (s *Sysfs) read(name string, methods []*readMethod, cached **readMethod) (int64, []byte, error) {
+	s.mu.Lock()
+	m := *cached
+	s.mu.Unlock()
+	if m != nil {
+		return m.read(s.Dir, name)
+	}
+
+	var firstErr error
+	for _, m := range methods {
+		v, scratchpad, err := m.read(s.Dir, name)
+		// A method whose files are missing is not supported by the
+		// kernel, or the device is gone; any other outcome tells the
+		// method is supported
+		if errors.Is(err, fs.ErrNotExist) {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		s.mu.Lock()
+		*cached = m
+		s.mu.Unlock()
+		return v, scratchpad, err
+	}
+	return 0, nil, firstErr
+}
+
+// readTemperatureAttr reads the temperature attribute of the device
+// name, added to w1_therm in Linux 5.9
+func readTemperatureAttr(dir, name string) (int64, []byte, error) {
+	return readMillis(filepath.Join(dir, name, "temperature"), name, "temperature")
+}
+
+// readHwmon reads the temperature the device name exposes through the
+// hwmon subsystem
+func readHwmon(dir, name string) (int64, []byte, error) {
+	inputs, err := filepath.Glob(filepath.Join(dir, name, "hwmon", "hwmon*", "temp1_input"))
+	if err != nil {
+		return 0, nil, err
+	}
+	if len(inputs) == 0 {
+		return 0, nil, fmt.Errorf("Error reading hwmon of %v: %w", name, fs.ErrNotExist)
+	}
+	return readMillis(inputs[0], name, "hwmon temperature")
+}
+
+// readMillis reads the file at path holding the temperature of the
+// device name in millidegrees Celsius
+func readMillis(path, name, what string) (int64, []byte, error) {
+	var v int64
+	var ok bool
+	err := readFile(path, os.O_RDONLY, func(content []byte) {
+		v, ok = parseInt(content)
+	})
+	if err != nil {
+		return 0, nil, err
+	}
+	if !ok {
+		return 0, nil, fmt.Errorf("Error decoding %v of %v: %w", what, name, strconv.ErrSyntax)
+	}
+	return v, nil, nil
+}
+
+// Search starts a single search cycle on every bus master of the tree
+func (s *Sysfs) Search() error {
+	return triggerSearch(s.Dir)
+}
+
+// ReadAttr reads a sysfs attribute of the device
+func (s *Sysfs) ReadAttr(name, attr string) ([]byte, error) {
+	return os.ReadFile(filepath.Join(s.Dir, name, attr))
+}
+
+// WriteAttr writes a sysfs attribute of the device
+func (s *Sysfs) WriteAttr(name, attr string, value []byte) error {
+	return os.WriteFile(filepath.Join(s.Dir, name, attr), value, 0644)
+}
+
+// readAttr reads an integer attribute of the device name through b
+func readAttr(b Backend, name, attr string) (int64, error) {
+	raw, err := readRawAttr(b, name, attr)
+	if err != nil {
+		return 0, err
+	}
+	v, err := strconv.ParseInt(strings.TrimSpace(string(raw)), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("Error decoding %v of %v: %w", attr, name, err)
+	}
+	return v, nil
+}
+
+// readRawAttr reads an attribute of the device name through b
+func readRawAttr(b Backend, name, attr string) ([]byte, error) {
+	ab, ok := b.(AttrBackend)
+	if !ok {
+		return nil, fmt.Errorf("Error reading %v of %v: %w", attr, name, ErrUnsupported)
+	}
+	return ab.ReadAttr(name, attr)
+}
+
+// writeAttr writes value to an attribute of the device name through b
+func writeAttr(b Backend, name, attr, value string) error {
+	ab, ok := b.(AttrBackend)
+	if !ok {
+		return fmt.Errorf("Error writing %v of %v: %w", attr, name, ErrUnsupported)
+	}
+	return ab.WriteAttr(name, attr, []byte(value))
+}
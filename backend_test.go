@@ -0,0 +1,108 @@
+package rpionewire
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// writeDevice creates the device name in the sysfs tree at dir with the
+// given files
+func writeDevice(t *testing.T, dir, name string, files map[string]string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Join(dir, name), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for file, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name, file), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestSysfsReadMethods(t *testing.T) {
+	dir := t.TempDir()
+	// A kernel from 5.9 exposes both files
+	writeDevice(t, dir, "28-000000000001", map[string]string{
+		"temperature": "23125\n",
+		"w1_slave":    w1SlaveSamples[0].content,
+	})
+	writeDevice(t, dir, "28-000000000002", map[string]string{"temperature": "19500\n"})
+
+	s := &Sysfs{Dir: dir}
+	if v, err := s.ReadTemperature("28-000000000001"); err != nil || v != 23.125 {
+		t.Fatalf("ReadTemperature = %v, %v", v, err)
+	}
+	if m := s.ReadMethod(); m != "temperature" {
+		t.Fatalf("ReadTemperature read through %q, want temperature", m)
+	}
+
+	millis, scratchpad, err := s.ReadRaw("28-000000000001")
+	if err != nil || millis != 23125 || len(scratchpad) != 9 {
+		t.Fatalf("ReadRaw = %v, %x, %v, want the scratchpad of w1_slave", millis, scratchpad, err)
+	}
+	if m := s.ReadMethod(); m != "w1_slave" {
+		t.Fatalf("ReadRaw read through %q, want w1_slave", m)
+	}
+
+	// Without w1_slave, ReadRaw falls back to the temperature attribute
+	s = &Sysfs{Dir: dir}
+	if millis, scratchpad, err := s.ReadRaw("28-000000000002"); err != nil || millis != 19500 || scratchpad != nil {
+		t.Fatalf("ReadRaw = %v, %x, %v", millis, scratchpad, err)
+	}
+}
+
+func TestSysfsScratchpadReads(t *testing.T) {
+	dir := t.TempDir()
+	// COUNT_REMAIN 0x0c and COUNT_PER_C 0x10 make 22.5 °C read as 22 °C
+	// at extended resolution
+	writeDevice(t, dir, "10-000000000001", map[string]string{
+		"temperature": "22500\n",
+		"w1_slave":    "2d 00 4b 46 ff ff 0c 10 1c : crc=1c YES\n2d 00 4b 46 ff ff 0c 10 1c t=22500\n",
+	})
+	writeDevice(t, dir, "28-000000000002", map[string]string{
+		"temperature": "23125\n",
+		"w1_slave":    w1SlaveSamples[1].content,
+	})
+
+	devices, err := NewBus(WithBackend(&Sysfs{Dir: dir}), WithCRCRetries(2)).LoadDevices()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, d := range devices {
+		r, err := d.Read()
+		switch d.Name {
+		case "10-000000000001":
+			if err != nil || r.Raw != 22000 || r.Scratchpad == nil {
+				t.Errorf("DS18S20 read %v, %x, %v, want 22000 at extended resolution", r.Raw, r.Scratchpad, err)
+			}
+		case "28-000000000002":
+			if !errors.Is(err, ErrCRCMismatch) {
+				t.Errorf("read %v, want a CRC mismatch", err)
+			}
+			if h := d.Health(); h.CRCErrors != 3 || h.CRCRetries != 2 {
+				t.Errorf("counted %v CRC errors and %v retries, want 3 and 2", h.CRCErrors, h.CRCRetries)
+			}
+		}
+	}
+}
+
+func TestBusModuleLoading(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []Option
+		want *ModuleLoader
+	}{
+		{"default", nil, nil},
+		{"zero loader", []Option{WithModuleLoading(ModuleLoader{})}, &ModuleLoader{}},
+		{"configured", []Option{WithModuleLoading(ModuleLoader{Masters: []string{"ds2490"}})}, &ModuleLoader{Masters: []string{"ds2490"}}},
+	}
+	for _, tt := range tests {
+		s := NewBus(tt.opts...).Backend().(*Sysfs)
+		if !reflect.DeepEqual(s.Modules, tt.want) {
+			t.Errorf("%v: got module loader %+v, want %+v", tt.name, s.Modules, tt.want)
+		}
+	}
+}
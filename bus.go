@@ -0,0 +1,362 @@
+package rpionewire
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Bus is the one wire bus exposed by the kernel w1 subsystem. The
+// package level functions use a default Bus; applications that need a
+// different behavior create their own with NewBus.
+type Bus struct {
+	// root is where the sysfs tree is mounted, dir its w1 devices
+	// directory
+	root           string
+	dir            string
+	backend        Backend
+	modules        *ModuleLoader
+	rediscover     bool
+	rediscoverWait time.Duration
+	failoverWait   time.Duration
+	crcRetries     int
+	clock          Clock
+	metrics        Metrics
+	tracer         Tracer
+	// exclude are the names of the devices discovery ignores, allow
+	// those it keeps, all devices if empty
+	exclude map[string]bool
+	allow   map[string]bool
+
+	events fanout[Event]
+	alarms fanout[Alarm]
+
+	mu    sync.Mutex
+	known map[string]bool
+	// masters are the bus masters returned by Masters, deviceMasters
+	// the master of each device read, nil if it has none
+	masters       map[string]*Master
+	deviceMasters map[string]*Master
+	// capabilities are those probed by Capabilities, nil until a probe
+	// succeeded
+	capabilities *Capabilities
+}
+
+// Option configures a Bus
+type Option func(*Bus)
+
+// WithRediscovery makes a read that fails because its device dropped
+// off the bus trigger a search on the bus masters. If the device shows
+// up again within wait it is re-bound and the read is retried once.
+func WithRediscovery(wait time.Duration) Option {
+	return func(b *Bus) {
+		b.rediscover = true
+		b.rediscoverWait = wait
+	}
+}
+
+// WithBackend makes the bus reach its devices through backend instead
+// of the local kernel sysfs tree
+func WithBackend(backend Backend) Option {
+	return func(b *Bus) {
+		b.backend = backend
+	}
+}
+
+// WithSysfsRoot makes the bus use the sysfs tree mounted at root
+// instead of /sys, such as /host/sys when the host tree is bind mounted
+// elsewhere in a container. It applies to the default backend and to
+// the bus masters and couplers.
+func WithSysfsRoot(root string) Option {
+	return func(b *Bus) {
+		b.root = root
+		b.dir = filepath.Join(root, "bus", "w1", "devices")
+	}
+}
+
+// WithModuleLoading makes the default backend load the w1 kernel
+// modules with l before its first discovery. Without it, the modules
+// must be loaded by the system, at boot by the w1-gpio overlay or
+// /etc/modules.
+func WithModuleLoading(l ModuleLoader) Option {
+	return func(b *Bus) {
+		b.modules = &l
+	}
+}
+
+// WithCRCRetries makes a read rejected because of a CRC mismatch be
+// retried up to n times before failing. Mismatches are only detected by
+// backends reading the w1_slave file, as Sysfs does when the kernel has
+// it; the readings of the others are never retried.
+func WithCRCRetries(n int) Option {
+	return func(b *Bus) {
+		b.crcRetries = n
+	}
+}
+
+// WithExclude makes the bus ignore the devices named names, by sysfs
+// name such as 28-0316a2794bff: they are left out of discovery, and so
+// of polling, and no event is published for them. It is meant for
+// devices on the bus that are not part of the installation, a faulty
+// probe left in a wall or the iButton of a neighbor.
+func WithExclude(names ...string) Option {
+	return func(b *Bus) {
+		if b.exclude == nil {
+			b.exclude = map[string]bool{}
+		}
+		for _, name := range names {
+			b.exclude[name] = true
+		}
+	}
+}
+
+// WithAllowlist makes the bus only manage the devices named names, by
+// sysfs name, for installations with a fixed and audited set of
+// sensors. Other devices are left out of discovery like those of
+// WithExclude, and the error of a discovery missing any of the devices
+// listed joins a DeviceError wrapping ErrMissing for each of them.
+func WithAllowlist(names ...string) Option {
+	return func(b *Bus) {
+		if b.allow == nil {
+			b.allow = map[string]bool{}
+		}
+		for _, name := range names {
+			b.allow[name] = true
+		}
+	}
+}
+
+// ErrMissing is the error of a device of the allowlist that discovery
+// did not find
+var ErrMissing = errors.New("expected device not found")
+
+// WithClock makes the bus time its retries with clock instead of the
+// system clock
+func WithClock(clock Clock) Option {
+	return func(b *Bus) {
+		b.clock = clock
+	}
+}
+
+// NewBus returns a Bus configured with opts
+func NewBus(opts ...Option) *Bus {
+	b := &Bus{root: "/sys", dir: devicesDir, clock: SystemClock, metrics: nopMetrics{}, tracer: nopTracer{}}
+	for _, opt := range opts {
+		opt(b)
+	}
+	if b.backend == nil {
+		b.backend = &Sysfs{Dir: b.dir, Modules: b.modules}
+	}
+	return b
+}
+
+var defaultBus = NewBus()
+
+// Backend returns the backend the bus reaches its devices through
+func (b *Bus) Backend() Backend {
+	return b.backend
+}
+
+// LoadDevices builds a list of the devices available on the bus.
+// Devices that cannot be opened are left out of the list and the
+// returned error joins the failure of each of them.
+func (b *Bus) LoadDevices() ([]*DS1820, error) {
+	return b.LoadDevicesContext(context.Background())
+}
+
+// LoadDevicesContext is LoadDevices stopping early when ctx is done,
+// which matters on large or partially shorted buses and on remote
+// backends where discovery takes many seconds. Once ctx is done, the
+// devices identified so far are returned along with an error wrapping
+// ctx.Err(); no DeviceAdded or DeviceRemoved event is published for an
+// interrupted discovery.
+func (b *Bus) LoadDevicesContext(ctx context.Context) ([]*DS1820, error) {
+	ctx, span := b.tracer.Start(ctx, "rpionewire.discover")
+	devices, err := b.loadDevices(ctx)
+	span.End(err)
+	return devices, err
+}
+
+func (b *Bus) loadDevices(ctx context.Context) ([]*DS1820, error) {
+	var names []string
+	var err error
+	if cb, ok := b.backend.(ContextBackend); ok {
+		names, err = cb.DevicesContext(ctx)
+	} else {
+		names, err = b.backend.Devices()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Error finding one wire devices: %w", err)
+	}
+	names = b.filter(names)
+
+	devices := make([]*DS1820, 0, len(names))
+	var errs []error
+	for i := range names {
+		if err := ctx.Err(); err != nil {
+			errs = append(errs, fmt.Errorf("Error finding one wire devices: interrupted after %d of %d devices: %w", i, len(names), err))
+			return devices, errors.Join(errs...)
+		}
+		// couplers, pots and the other devices have their own loaders
+		if !isThermometer(names[i]) {
+			continue
+		}
+		device, err := newDS1820(b.backend, names[i])
+		if err != nil {
+			errs = append(errs, &DeviceError{Name: names[i], Err: err})
+			continue
+		}
+		device.bus = b
+		devices = append(devices, device)
+	}
+	b.updateKnown(names)
+	b.metrics.Gauge("rpionewire_devices", float64(len(devices)))
+	if len(b.allow) > 0 {
+		missing := b.missing(names)
+		for _, name := range missing {
+			errs = append(errs, &DeviceError{Name: name, Err: ErrMissing})
+		}
+		b.metrics.Gauge("rpionewire_devices_missing", float64(len(missing)))
+	}
+
+	return devices, errors.Join(errs...)
+}
+
+// filter returns the names of the devices discovery keeps, in place
+func (b *Bus) filter(names []string) []string {
+	if len(b.exclude) == 0 && len(b.allow) == 0 {
+		return names
+	}
+	kept := names[:0]
+	for _, name := range names {
+		if !b.exclude[name] && (len(b.allow) == 0 || b.allow[name]) {
+			kept = append(kept, name)
+		}
+	}
+	return kept
+}
+
+// missing returns the devices of the allowlist absent from names, in
+// order
+func (b *Bus) missing(names []string) []string {
+	found := make(map[string]bool, len(names))
+	for _, name := range names {
+		found[name] = true
+	}
+	var missing []string
+	for name := range b.allow {
+		if !found[name] && !b.exclude[name] {
+			missing = append(missing, name)
+		}
+	}
+	sort.Strings(missing)
+	return missing
+}
+
+// updateKnown publishes DeviceAdded and DeviceRemoved events for the
+// differences between names and the devices found by the previous
+// discovery
+func (b *Bus) updateKnown(names []string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	found := make(map[string]bool, len(names))
+	for _, name := range names {
+		found[name] = true
+		if !b.known[name] {
+			b.publish(Event{Type: DeviceAdded, Device: name})
+		}
+	}
+	for name := range b.known {
+		if !found[name] {
+			b.publish(Event{Type: DeviceRemoved, Device: name})
+		}
+	}
+	b.known = found
+}
+
+// rebind asks the bus masters to search for devices and waits for d to
+// reappear, checking that it is still the same device once it does.
+// The backend of the bus must be a SearchBackend.
+func (b *Bus) rebind(d *DS1820) error {
+	sb, ok := b.backend.(SearchBackend)
+	if !ok {
+		return fmt.Errorf("Error rediscovering %v: %w", d.Name, ErrUnsupported)
+	}
+	if err := sb.Search(); err != nil {
+		return err
+	}
+
+	deadline := b.clock.Now().Add(b.rediscoverWait)
+	for {
+		names, err := b.backend.Devices()
+		if err != nil {
+			return fmt.Errorf("Error rediscovering %v: %w", d.Name, err)
+		}
+		if containsName(names, d.Name) {
+			break
+		}
+		if b.clock.Now().After(deadline) {
+			return fmt.Errorf("Error rediscovering %v: device did not reappear", d.Name)
+		}
+		b.clock.Sleep(100 * time.Millisecond)
+	}
+
+	ab, ok := b.backend.(AttrBackend)
+	if !ok {
+		return nil
+	}
+	family, id, err := readID(ab, d.Name)
+	// Devices without an id attribute, or wrapped backends without
+	// attributes, keep the identity their name encodes
+	if errors.Is(err, fs.ErrNotExist) || errors.Is(err, ErrUnsupported) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	d.mu.Lock()
+	oldID, oldType := d.ID, d.DeviceType
+	d.mu.Unlock()
+	if id != oldID || knownFamilies[family] != oldType {
+		return fmt.Errorf("Error rediscovering %v: id changed from %x to %x", d.Name, oldID, id)
+	}
+
+	return nil
+}
+
+// containsName tells whether names holds name
+func containsName(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// triggerSearch starts a single search cycle on every bus master of the
+// devices directory dir
+func triggerSearch(dir string) error {
+	masters, err := filepath.Glob(filepath.Join(dir, "w1_bus_master*"))
+	if err != nil {
+		return err
+	}
+	if len(masters) == 0 {
+		return errors.New("Error triggering search: no bus master found")
+	}
+
+	for _, m := range masters {
+		if err := os.WriteFile(filepath.Join(m, "w1_master_search"), []byte("1"), 0644); err != nil {
+			return fmt.Errorf("Error triggering search on %v: %w", filepath.Base(m), err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,84 @@
+package rpionewire
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// rebindBackend is a sysfs tree whose device comes back on the next
+// search with the id attribute id
+type rebindBackend struct {
+	*Sysfs
+	t    *testing.T
+	name string
+	id   string
+}
+
+func (b *rebindBackend) Search() error {
+	writeDevice(b.t, b.Dir, b.name, map[string]string{
+		"temperature": "21000\n",
+		"id":          b.id,
+	})
+	return nil
+}
+
+func TestRediscovery(t *testing.T) {
+	tests := []struct {
+		name string
+		id   string
+		ok   bool
+	}{
+		{"same device", "\x28\x01\x00\x00\x00\x00\x00\xff", true},
+		{"other device", "\x28\x02\x00\x00\x00\x00\x00\xff", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeDevice(t, dir, "28-000000000001", map[string]string{"temperature": "20000\n"})
+			backend := &rebindBackend{Sysfs: &Sysfs{Dir: dir}, t: t, name: "28-000000000001", id: tt.id}
+			devices, err := NewBus(WithBackend(backend), WithClock(newFakeClock()), WithRediscovery(0)).LoadDevices()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := os.RemoveAll(filepath.Join(dir, "28-000000000001")); err != nil {
+				t.Fatal(err)
+			}
+
+			r, err := devices[0].Read()
+			if tt.ok && (err != nil || r.Value != 21 || r.Flags&FlagRetried == 0) {
+				t.Errorf("read %v, %v, %v, want 21 once rediscovered", r.Value, r.Flags, err)
+			}
+			if !tt.ok && !errors.Is(err, fs.ErrNotExist) {
+				t.Errorf("read %v, want the read error of the device gone", err)
+			}
+			if devices[0].ID != 1 {
+				t.Errorf("device id changed to %x", devices[0].ID)
+			}
+		})
+	}
+}
+
+func TestRediscoveryUnsupported(t *testing.T) {
+	backend := &fakeBackend{names: []string{"28-000000000001"}, err: fs.ErrNotExist}
+	devices, err := NewBus(WithBackend(backend), WithRediscovery(0)).LoadDevices()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r, err := devices[0].Read(); !errors.Is(err, fs.ErrNotExist) || r.Flags&FlagRetried != 0 {
+		t.Errorf("read %v, %v, want the read error without retry", r.Flags, err)
+	}
+}
+
+func TestLoadHumiditySensorsFilter(t *testing.T) {
+	b := NewBus(WithBackend(&fakeBackend{names: []string{"26-000000000001", "26-000000000002", "28-000000000003"}}), WithExclude("26-000000000002"))
+	sensors, err := b.LoadHumiditySensors(HIH4000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sensors) != 1 || sensors[0].Name != "26-000000000001" {
+		t.Fatalf("LoadHumiditySensors = %v, want the sensor not excluded", sensors)
+	}
+}
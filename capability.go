@@ -0,0 +1,59 @@
+package rpionewire
+
+// TemperatureReader is implemented by devices sensing a temperature.
+// Application code can depend on it rather than on a device type, and
+// tests can stub it with a function returning a fixed value.
+type TemperatureReader interface {
+	ReadTemperature() (Temperature, error)
+}
+
+// Identifier is implemented by every device on the bus
+type Identifier interface {
+	// DeviceName returns the kernel name of the device, such as
+	// 28-0316a2794bff
+	DeviceName() string
+	// DeviceID returns the 48 bit serial number of the device
+	DeviceID() uint64
+}
+
+// Configurer is implemented by devices whose conversion resolution can
+// be changed
+type Configurer interface {
+	Resolution() (int, error)
+	SetResolution(bits int) error
+	SaveEEPROM() error
+}
+
+// ReadTemperature reads the device and returns its temperature
+func (d *DS1820) ReadTemperature() (Temperature, error) {
+	r, err := d.Read()
+	return r.Value, err
+}
+
+// DeviceName returns the kernel name of the device
+func (d *DS1820) DeviceName() string { return d.Name }
+
+// DeviceID returns the serial number of the device
+func (d *DS1820) DeviceID() uint64 { return d.ID }
+
+// ReadTemperature reads the temperature sensed by the DS2438 of the
+// module
+func (h *HumiditySensor) ReadTemperature() (Temperature, error) {
+	raw, err := readAttr(h.bus.backend, h.Name, "temperature")
+	if err != nil {
+		return 0, err
+	}
+	return Temperature(raw) / 256, nil
+}
+
+// DeviceName returns the kernel name of the DS2438 of the module
+func (h *HumiditySensor) DeviceName() string { return h.Name }
+
+// DeviceID returns the serial number of the DS2438 of the module
+func (h *HumiditySensor) DeviceID() uint64 { return h.ID }
+
+// DeviceName returns the kernel name of the coupler
+func (c *Coupler) DeviceName() string { return c.Name }
+
+// DeviceID returns the serial number of the coupler
+func (c *Coupler) DeviceID() uint64 { return c.ID }
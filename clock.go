@@ -0,0 +1,22 @@
+package rpionewire
+
+import "time"
+
+// Clock is the source of time of the poller and of the retry logic.
+// The system clock is used by default; tests can supply a fake one to
+// drive scheduling deterministically.
+type Clock interface {
+	Now() time.Time
+	// After returns a channel receiving the time once d has elapsed
+	After(d time.Duration) <-chan time.Time
+	Sleep(d time.Duration)
+}
+
+// SystemClock is the Clock backed by the time package
+var SystemClock Clock = systemClock{}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time                         { return time.Now() }
+func (systemClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+func (systemClock) Sleep(d time.Duration)                  { time.Sleep(d) }
@@ -0,0 +1,162 @@
+// Package cluster links agents, polling the sensors of each Raspberry
+// Pi of a fleet, to a collector receiving their readings and exporting
+// them from a single place.
+//
+// Agents POST batches of readings as JSON to the /v1/readings endpoint
+// of the collector, authenticating with a shared bearer token, in the
+// versioned protocol described at ProtocolVersion. Both advertise
+// themselves with mDNS, so agents find the collector, and tools find
+// the agents, without configuration.
+package cluster
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fredcarle/rpionewire"
+	"github.com/fredcarle/rpionewire/server"
+)
+
+// ReadingsPath is the collector endpoint agents push readings to
+const ReadingsPath = "/v1/readings"
+
+// Batch is the document an agent pushes after each poll cycle
+type Batch struct {
+	// Version is the protocol version of the batch, absent in version 1
+	Version  int              `json:"version,omitempty"`
+	Host     string           `json:"host"`
+	Time     time.Time        `json:"time"`
+	Readings []server.Reading `json:"readings"`
+}
+
+// Agent is a rpionewire.Sink pushing the readings of every poll cycle
+// to a collector
+type Agent struct {
+	// Collector is the base URL of the collector, such as
+	// http://collector:9200
+	Collector string
+	// Token authenticates the agent to the collector
+	Token string
+	// Host labels the readings of this agent
+	Host string
+	// Client sends the requests, a client with a 10 second timeout if nil
+	Client *http.Client
+
+	mu sync.Mutex
+	// protocol is the outcome of the negotiation with the collector,
+	// nil until negotiated
+	protocol *negotiated
+}
+
+// WriteReadings pushes readings to the collector, negotiating the
+// protocol first if needed
+func (a *Agent) WriteReadings(rs []rpionewire.Reading) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.protocol == nil {
+		p, err := a.negotiate()
+		if err != nil {
+			return err
+		}
+		a.protocol = &p
+	}
+
+	now := time.Now()
+	batch := Batch{Host: a.Host, Time: now, Readings: make([]server.Reading, len(rs))}
+	if a.protocol.version > 1 {
+		batch.Version = a.protocol.version
+	}
+	for i, r := range rs {
+		batch.Readings[i] = server.NewReading(r, now)
+		batch.Readings[i].Host = a.Host
+	}
+	body, err := json.Marshal(batch)
+	if err != nil {
+		return err
+	}
+	if a.protocol.gzip {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		zw.Write(body)
+		if err := zw.Close(); err != nil {
+			return err
+		}
+		body = buf.Bytes()
+	}
+
+	req, err := a.request(http.MethodPost, ReadingsPath, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if a.protocol.gzip {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	resp, err := a.client().Do(req)
+	if err != nil {
+		return fmt.Errorf("Error pushing readings: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+		if renegotiate(resp.StatusCode) {
+			a.protocol = nil
+		}
+		return fmt.Errorf("Error pushing readings: collector answered %v", resp.Status)
+	}
+	return nil
+}
+
+// negotiate fetches the Protocol of the collector and picks the version
+// and capabilities of the pushes, version 1 if the collector predates
+// negotiation
+func (a *Agent) negotiate() (negotiated, error) {
+	req, err := a.request(http.MethodGet, ProtocolPath, nil)
+	if err != nil {
+		return negotiated{}, err
+	}
+	resp, err := a.client().Do(req)
+	if err != nil {
+		return negotiated{}, fmt.Errorf("Error negotiating protocol: %w", err)
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		io.Copy(io.Discard, resp.Body)
+		return negotiated{version: 1}, nil
+	default:
+		io.Copy(io.Discard, resp.Body)
+		return negotiated{}, fmt.Errorf("Error negotiating protocol: collector answered %v", resp.Status)
+	}
+	var p Protocol
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxBatch)).Decode(&p); err != nil {
+		return negotiated{}, fmt.Errorf("Error negotiating protocol: %w", err)
+	}
+	return negotiate(p)
+}
+
+// request returns an authenticated request to the collector endpoint
+// path
+func (a *Agent) request(method, path string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequest(method, strings.TrimSuffix(a.Collector, "/")+path, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+a.Token)
+	return req, nil
+}
+
+func (a *Agent) client() *http.Client {
+	if a.Client != nil {
+		return a.Client
+	}
+	return &http.Client{Timeout: 10 * time.Second}
+}
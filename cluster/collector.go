@@ -0,0 +1,185 @@
+package cluster
+
+import (
+	"compress/gzip"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fredcarle/rpionewire/server"
+)
+
+// maxBatch bounds the size of the batches accepted from agents
+const maxBatch = 1 << 20
+
+// Collector receives the batches of agents and re-exports them through
+// a server.Server, so the readings of the whole fleet are served as
+// JSON and Prometheus metrics from one place. Readings of an agent that
+// stopped pushing, or of a device an agent stopped reading, are dropped
+// after Expiry.
+type Collector struct {
+	// Token is the token agents must present
+	Token string
+	// Expiry is how long the readings of a silent agent, or of a device
+	// no longer read, are kept, 5 minutes if zero
+	Expiry time.Duration
+
+	srv *server.Server
+
+	mu      sync.Mutex
+	batches map[string]Batch
+}
+
+// NewCollector returns a Collector accepting agents presenting token and
+// exporting the Prometheus metrics at metricsPath
+func NewCollector(token, metricsPath string) *Collector {
+	c := &Collector{
+		Token:   token,
+		srv:     server.New(metricsPath),
+		batches: make(map[string]Batch),
+	}
+	c.srv.Handle(ReadingsPath, http.HandlerFunc(c.handlePush))
+	c.srv.Handle(ProtocolPath, http.HandlerFunc(c.handleProtocol))
+	return c
+}
+
+// ServeHTTP serves the agent endpoint and the re-exported readings
+func (c *Collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c.mu.Lock()
+	c.publish()
+	c.mu.Unlock()
+	c.srv.ServeHTTP(w, r)
+}
+
+// Hosts returns the hosts currently reporting, with the time of their
+// last batch
+func (c *Collector) Hosts() map[string]time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	hosts := make(map[string]time.Time, len(c.batches))
+	for h, b := range c.batches {
+		hosts[h] = b.Time
+	}
+	return hosts
+}
+
+func (c *Collector) handlePush(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !c.authorized(r) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var body io.Reader = r.Body
+	switch r.Header.Get("Content-Encoding") {
+	case "", "identity":
+	case "gzip":
+		zr, err := gzip.NewReader(r.Body)
+		if err != nil {
+			http.Error(w, "invalid batch: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		defer zr.Close()
+		body = zr
+	default:
+		http.Error(w, "unsupported content encoding", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	var batch Batch
+	if err := json.NewDecoder(io.LimitReader(body, maxBatch)).Decode(&batch); err != nil {
+		http.Error(w, "invalid batch: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if batch.Version == 0 {
+		batch.Version = 1
+	}
+	if batch.Version < minProtocolVersion || batch.Version > ProtocolVersion {
+		http.Error(w, fmt.Sprintf("unsupported protocol version %v, expected %v to %v", batch.Version, minProtocolVersion, ProtocolVersion), http.StatusBadRequest)
+		return
+	}
+	if batch.Host == "" {
+		http.Error(w, "invalid batch: missing host", http.StatusBadRequest)
+		return
+	}
+	for i := range batch.Readings {
+		batch.Readings[i].Host = batch.Host
+	}
+	// Readings are timed by the agent clock, so the devices no longer
+	// read are expired against the time the agent sent the batch
+	since := batch.Time.Add(-c.expiry())
+	// The time of the collector is used to expire batches, so agent
+	// clocks need not be in sync
+	batch.Time = time.Now()
+
+	c.mu.Lock()
+	// Agents polling on per-device schedules only push the devices due,
+	// so the other devices of the host keep their previous reading
+	// until it expires
+	if previous, ok := c.batches[batch.Host]; ok {
+		batch.Readings = server.ExpireReadings(server.MergeReadings(previous.Readings, batch.Readings), since)
+	}
+	c.batches[batch.Host] = batch
+	c.publish()
+	c.mu.Unlock()
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleProtocol serves the Protocol of the collector to the agents
+func (c *Collector) handleProtocol(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !c.authorized(r) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(localProtocol())
+}
+
+// authorized checks the bearer token of r in constant time
+func (c *Collector) authorized(r *http.Request) bool {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return c.Token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(c.Token)) == 1
+}
+
+// expiry returns Expiry, or its default
+func (c *Collector) expiry() time.Duration {
+	if c.Expiry == 0 {
+		return 5 * time.Minute
+	}
+	return c.Expiry
+}
+
+// publish expires silent agents and hands the readings of the others to
+// the server, sorted by host. The collector lock must be held.
+func (c *Collector) publish() {
+	expiry := c.expiry()
+	hosts := make([]string, 0, len(c.batches))
+	for h, b := range c.batches {
+		if time.Since(b.Time) > expiry {
+			delete(c.batches, h)
+			continue
+		}
+		hosts = append(hosts, h)
+	}
+	sort.Strings(hosts)
+
+	var readings []server.Reading
+	for _, h := range hosts {
+		readings = append(readings, c.batches[h].Readings...)
+	}
+	c.srv.SetReadings(readings)
+}
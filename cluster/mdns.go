@@ -0,0 +1,98 @@
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/grandcat/zeroconf"
+)
+
+// mDNS service types advertised by agents and collectors
+const (
+	AgentService     = "_rpionewire._tcp"
+	CollectorService = "_rpionewire-collector._tcp"
+)
+
+// Service is an agent or collector found on the local network
+type Service struct {
+	// Instance is the advertised name, the host label for agents
+	Instance string
+	// URL is the base URL of the HTTP server of the service
+	URL  string
+	Text map[string]string
+}
+
+// Advertise announces the service on the local network under instance
+// until the returned function is called. port is the port of the HTTP
+// server of the service and text key=value pairs published with it.
+func Advertise(service, instance string, port int, text map[string]string) (func(), error) {
+	var txt []string
+	for k, v := range text {
+		txt = append(txt, k+"="+v)
+	}
+	srv, err := zeroconf.Register(instance, service, "local.", port, txt, nil)
+	if err != nil {
+		return nil, fmt.Errorf("Error advertising %v: %w", service, err)
+	}
+	return srv.Shutdown, nil
+}
+
+// Discover browses the local network for timeout and returns the
+// instances of service found
+func Discover(ctx context.Context, service string, timeout time.Duration) ([]Service, error) {
+	resolver, err := zeroconf.NewResolver(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	entries := make(chan *zeroconf.ServiceEntry)
+	if err := resolver.Browse(ctx, service, "local.", entries); err != nil {
+		return nil, err
+	}
+
+	seen := map[string]bool{}
+	var services []Service
+	for {
+		select {
+		case <-ctx.Done():
+			return services, nil
+		case e, ok := <-entries:
+			if !ok {
+				return services, nil
+			}
+			if seen[e.Instance] {
+				continue
+			}
+			seen[e.Instance] = true
+			services = append(services, newService(e))
+		}
+	}
+}
+
+func newService(e *zeroconf.ServiceEntry) Service {
+	s := Service{Instance: e.Instance, Text: map[string]string{}}
+	host := strings.TrimSuffix(e.HostName, ".")
+	if len(e.AddrIPv4) > 0 {
+		host = e.AddrIPv4[0].String()
+	} else if len(e.AddrIPv6) > 0 {
+		host = e.AddrIPv6[0].String()
+	}
+	for _, kv := range e.Text {
+		if k, v, ok := strings.Cut(kv, "="); ok {
+			s.Text[k] = v
+		}
+	}
+	scheme := "http"
+	if s.Text["scheme"] == "https" {
+		// Certificates name hosts rather than addresses
+		scheme, host = "https", strings.TrimSuffix(e.HostName, ".")
+	}
+	s.URL = scheme + "://" + net.JoinHostPort(host, fmt.Sprint(e.Port))
+	return s
+}
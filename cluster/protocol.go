@@ -0,0 +1,97 @@
+package cluster
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+)
+
+// The agent to collector protocol is versioned so that a fleet can be
+// upgraded a machine at a time: collectors accept every version from 1
+// to ProtocolVersion, and agents speak the highest version the
+// collector supports.
+//
+// Version 1 is the original protocol: an agent POSTs a Batch to
+// ReadingsPath after every poll cycle, as JSON, with the cluster token
+// as bearer token, and the collector answers 204 No Content. The batch
+// has no version field.
+//
+// Version 2 adds negotiation. Before its first push, an agent GETs
+// ProtocolPath, with the same token, and the collector answers with a
+// Protocol listing the versions and capabilities it supports. A 404
+// tells a collector speaking version 1 only. The agent then sets the
+// version it picked in its batches, and uses the capabilities both
+// sides support:
+//
+//	gzip  batches are sent gzip compressed, with Content-Encoding: gzip
+//
+// A collector answers 400 Bad Request to a batch of a version it does
+// not support, or 415 Unsupported Media Type to an encoding it does not
+// accept, and the agent negotiates again before its next push, in case
+// the collector was downgraded. Fields unknown to either side are
+// ignored, so later versions can add fields to the batches and to the
+// Protocol document.
+const (
+	// ProtocolVersion is the highest protocol version of this package
+	ProtocolVersion = 2
+	// ProtocolPath is the collector endpoint describing the protocol
+	// versions and capabilities it supports, from version 2
+	ProtocolPath = "/v1/protocol"
+)
+
+// minProtocolVersion is the lowest protocol version collectors accept
+const minProtocolVersion = 1
+
+// Capabilities of the protocol, see ProtocolVersion
+const (
+	CapabilityGzip = "gzip"
+)
+
+// capabilities are those of this package
+var capabilities = []string{CapabilityGzip}
+
+// Protocol is the document served by collectors at ProtocolPath
+type Protocol struct {
+	// Versions are the protocol versions supported, ascending
+	Versions     []int    `json:"versions"`
+	Capabilities []string `json:"capabilities"`
+}
+
+// localProtocol returns the Protocol of this package
+func localProtocol() Protocol {
+	p := Protocol{Capabilities: capabilities}
+	for v := minProtocolVersion; v <= ProtocolVersion; v++ {
+		p.Versions = append(p.Versions, v)
+	}
+	return p
+}
+
+// negotiated is the outcome of the negotiation of an agent with its
+// collector
+type negotiated struct {
+	version int
+	gzip    bool
+}
+
+// negotiate picks the highest version and the capabilities this package
+// shares with the remote Protocol p
+func negotiate(p Protocol) (negotiated, error) {
+	versions := append([]int(nil), p.Versions...)
+	sort.Sort(sort.Reverse(sort.IntSlice(versions)))
+	for _, v := range versions {
+		if v >= minProtocolVersion && v <= ProtocolVersion {
+			n := negotiated{version: v}
+			for _, c := range p.Capabilities {
+				n.gzip = n.gzip || c == CapabilityGzip
+			}
+			return n, nil
+		}
+	}
+	return negotiated{}, fmt.Errorf("Error negotiating protocol: collector supports versions %v, agent %v to %v", p.Versions, minProtocolVersion, ProtocolVersion)
+}
+
+// renegotiate tells whether the status of a push asks for a new
+// negotiation
+func renegotiate(status int) bool {
+	return status == http.StatusBadRequest || status == http.StatusUnsupportedMediaType
+}
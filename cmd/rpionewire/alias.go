@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+	"time"
+
+	"github.com/fredcarle/rpionewire"
+)
+
+func runAlias(a *app, args []string) error {
+	fs := flag.NewFlagSet("alias", flag.ExitOnError)
+	remove := fs.Bool("remove", false, "remove the alias of the device")
+	identify := fs.Bool("identify", false, "find the device being warmed up and give it the alias")
+	rise := fs.Float64("rise", 0.5, "temperature rise, in °C, identifying the warmed device")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, `Usage:
+  rpionewire alias                       list aliases
+  rpionewire alias <device> <name>       set the alias of a device
+  rpionewire alias -remove <device>      remove the alias of a device
+  rpionewire alias -identify <name>      warm a probe with your fingers to name it
+
+`)
+		fs.PrintDefaults()
+	}
+	pos := parseInterspersed(fs, args)
+
+	path := a.writableConfigPath()
+	c, err := loadForUpdate(path)
+	if err != nil && path != "" {
+		return err
+	}
+
+	switch {
+	case len(pos) == 0 && !*remove && !*identify:
+		names := make([]string, 0, len(a.config.Aliases))
+		for name := range a.config.Aliases {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Printf("%v\t%v\n", name, a.config.Aliases[name])
+		}
+		return nil
+	case path == "":
+		return fmt.Errorf("no configuration file to write to, use -config or RPIONEWIRE_CONFIG")
+	}
+
+	devices, err := a.loadDevices()
+	if err != nil {
+		return err
+	}
+
+	var d *rpionewire.DS1820
+	var alias string
+	switch {
+	case *remove && len(pos) == 1:
+		if d = findDevice(devices, pos[0]); d == nil {
+			return fmt.Errorf("no device %q", pos[0])
+		}
+	case *identify && len(pos) == 1:
+		alias = pos[0]
+		if d, err = warmedDevice(devices, *rise); err != nil {
+			return err
+		}
+		fmt.Printf("%v is %v\n", d.Name, alias)
+	case !*remove && !*identify && len(pos) == 2:
+		alias = pos[1]
+		if d = findDevice(devices, pos[0]); d == nil {
+			return fmt.Errorf("no device %q", pos[0])
+		}
+	default:
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	if c.Aliases == nil {
+		c.Aliases = map[string]string{}
+	}
+	if alias == "" {
+		delete(c.Aliases, d.Name)
+	} else {
+		c.Aliases[d.Name] = alias
+	}
+	return c.Save(path)
+}
+
+// warmedDevice reads every device until one rises rise degrees above
+// the temperature it had when the search started
+func warmedDevice(devices []*rpionewire.DS1820, rise float64) (*rpionewire.DS1820, error) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	baseline, _ := rpionewire.ReadEach(devices)
+
+	fmt.Printf("Warm the probe to name with your fingers (%v devices watched, ^C to abort)\n", len(devices))
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(time.Second):
+		}
+
+		readings, _ := rpionewire.ReadEach(devices)
+		best, bestRise := -1, 0.0
+		for i, r := range readings {
+			if r.Err != nil || baseline[i].Err != nil {
+				continue
+			}
+			if delta := float64(r.Value - baseline[i].Value); delta > bestRise {
+				best, bestRise = i, delta
+			}
+		}
+		if best >= 0 {
+			fmt.Printf("\r%v +%.2f °C ", devices[best].Name, bestRise)
+		}
+		if bestRise >= rise {
+			fmt.Println()
+			return devices[best], nil
+		}
+	}
+}
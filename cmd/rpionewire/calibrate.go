@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"math"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/fredcarle/rpionewire"
+	"github.com/fredcarle/rpionewire/config"
+)
+
+func runCalibrate(a *app, args []string) error {
+	flags := flag.NewFlagSet("calibrate", flag.ExitOnError)
+	samples := flags.Int("samples", 10, "number of reads averaged at each reference point")
+	boil := flags.Bool("boil", false, "also measure the boiling point, to correct the scale")
+	boilTemp := flags.Float64("boil-temp", 100, "boiling point of water at your altitude, in °C")
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: rpionewire calibrate [-samples n] [-boil [-boil-temp t]] [device...]\n\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	path := a.writableConfigPath()
+	if path == "" {
+		return errors.New("no configuration file to write to, use -config or RPIONEWIRE_CONFIG")
+	}
+
+	devices, err := a.loadDevices()
+	if err != nil {
+		return err
+	}
+	if devices, err = selectDevices(devices, flags.Args()); err != nil {
+		return err
+	}
+	// Reference points are measured on raw temperatures
+	for _, d := range devices {
+		d.Calibration = rpionewire.Calibration{}
+	}
+
+	in := bufio.NewReader(os.Stdin)
+	fmt.Printf("Place the probes of %v devices in a stirred ice bath and wait for them to settle.\n", len(devices))
+	prompt(in, "Press Enter to measure...")
+	ice, err := average(devices, *samples)
+	if err != nil {
+		return err
+	}
+
+	var hot []float64
+	if *boil {
+		fmt.Printf("Now place the probes in boiling water (%v °C).\n", *boilTemp)
+		prompt(in, "Press Enter to measure...")
+		if hot, err = average(devices, *samples); err != nil {
+			return err
+		}
+	}
+
+	cals := make([]config.Calibration, len(devices))
+	for i, d := range devices {
+		cals[i] = config.Calibration{Offset: -ice[i], Scale: 1}
+		if hot != nil {
+			if hot[i] == ice[i] {
+				return fmt.Errorf("%v read the same temperature at both reference points", d.Name)
+			}
+			scale := *boilTemp / (hot[i] - ice[i])
+			cals[i] = config.Calibration{Offset: -ice[i] * scale, Scale: scale}
+		}
+		fmt.Printf("%v: ice %.3f °C", d.Name, ice[i])
+		if hot != nil {
+			fmt.Printf(", boil %.3f °C", hot[i])
+		}
+		fmt.Printf(" -> offset %+.3f, scale %.4f\n", cals[i].Offset, cals[i].Scale)
+	}
+
+	if answer := prompt(in, fmt.Sprintf("Write the calibration to %v? [Y/n] ", path)); strings.HasPrefix(strings.ToLower(answer), "n") {
+		return nil
+	}
+
+	c, err := loadForUpdate(path)
+	if err != nil {
+		return err
+	}
+	if c.Calibration == nil {
+		c.Calibration = map[string]config.Calibration{}
+	}
+	for i, d := range devices {
+		// Keep the self-heating compensation, which is not measured here
+		cals[i].SelfHeating = c.Calibration[d.Name].SelfHeating
+		c.Calibration[d.Name] = cals[i]
+	}
+	return c.Save(path)
+}
+
+// average reads devices samples times and returns the mean temperature
+// of each
+func average(devices []*rpionewire.DS1820, samples int) ([]float64, error) {
+	sums := make([]float64, len(devices))
+	for n := 0; n < samples; n++ {
+		readings, err := rpionewire.ReadEach(devices)
+		if err != nil {
+			return nil, err
+		}
+		for i, r := range readings {
+			sums[i] += float64(r.Value)
+		}
+		fmt.Printf("\r%v/%v", n+1, samples)
+		time.Sleep(time.Second)
+	}
+	fmt.Println()
+
+	for i := range sums {
+		sums[i] = math.Round(sums[i]/float64(samples)*1000) / 1000
+	}
+	return sums, nil
+}
+
+// prompt prints msg and returns the line typed in answer
+func prompt(in *bufio.Reader, msg string) string {
+	fmt.Print(msg)
+	line, _ := in.ReadString('\n')
+	return strings.TrimSpace(line)
+}
+
+// writableConfigPath returns the configuration file commands persist
+// their changes to
+func (a *app) writableConfigPath() string {
+	if a.configPath != "" {
+		return a.configPath
+	}
+	return os.Getenv(config.EnvPrefix + "CONFIG")
+}
+
+// loadForUpdate loads the file at path, without environment overrides,
+// so that only the changes of a command are written back. A missing
+// file starts from the default configuration.
+func loadForUpdate(path string) (*config.Config, error) {
+	c, err := config.Load(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return config.Default(), nil
+	}
+	return c, err
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/fredcarle/rpionewire"
+	"github.com/fredcarle/rpionewire/cluster"
+	"github.com/fredcarle/rpionewire/server"
+)
+
+func runAgent(a *app, args []string) error {
+	fs := flag.NewFlagSet("agent", flag.ExitOnError)
+	collector := fs.String("collector", a.config.Cluster.Collector, "collector `URL`, discovered with mDNS if empty")
+	host := fs.String("host", a.config.Cluster.Host, "host label of the readings, the hostname if empty")
+	listen := fs.String("listen", a.config.Server.Listen, "listen `address` of the local readings server, disabled if empty")
+	fs.Parse(args)
+
+	if *host == "" {
+		*host, _ = os.Hostname()
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if *collector == "" {
+		found, err := cluster.Discover(ctx, cluster.CollectorService, 5*time.Second)
+		if err != nil {
+			return err
+		}
+		if len(found) == 0 {
+			return errors.New("no collector configured nor found on the network")
+		}
+		*collector = found[0].URL
+		log.Printf("rpionewire: found collector %v at %v", found[0].Instance, *collector)
+	}
+
+	devices, err := a.loadDevices()
+	if err != nil {
+		return err
+	}
+
+	agent := &cluster.Agent{Collector: *collector, Token: a.config.Cluster.Token, Host: *host}
+	if t := a.config.Cluster.TLS; t != nil {
+		tlsConfig, err := (&server.ClientTLS{CAFile: t.CA, CertFile: t.Cert, KeyFile: t.Key}).Config()
+		if err != nil {
+			return err
+		}
+		agent.Client = &http.Client{Timeout: 10 * time.Second, Transport: &http.Transport{TLSClientConfig: tlsConfig}}
+	}
+	sinks := []rpionewire.Sink{agent}
+	if *listen != "" {
+		srv := server.New(a.config.Server.MetricsPath)
+		sinks = append(sinks, srv)
+		tlsConfig, err := a.serverTLS()
+		if err != nil {
+			return err
+		}
+		stopServing, err := serveAndAdvertise(*listen, a.handler(srv), tlsConfig, cluster.AgentService, *host)
+		if err != nil {
+			return err
+		}
+		defer stopServing()
+	}
+
+	log.Printf("rpionewire: pushing the readings of %v devices to %v as %v", len(devices), *collector, *host)
+	p := rpionewire.NewPoller(devices, a.config.Polling.Interval.Duration, append(a.config.PollerOptions(), rpionewire.WithSinks(sinks...))...)
+	if err := p.Run(ctx); err != nil && ctx.Err() == nil {
+		return err
+	}
+	return nil
+}
+
+func runCollector(a *app, args []string) error {
+	fs := flag.NewFlagSet("collector", flag.ExitOnError)
+	listen := fs.String("listen", a.config.Cluster.Listen, "listen `address`")
+	fs.Parse(args)
+
+	if a.config.Cluster.Token == "" {
+		return errors.New("no cluster token configured")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	c := cluster.NewCollector(a.config.Cluster.Token, a.config.Server.MetricsPath)
+	host, _ := os.Hostname()
+	// Agents push with the cluster token, which the server auth must let
+	// through
+	h := a.handler(c, a.config.Cluster.Token)
+	tlsConfig, err := a.serverTLS()
+	if err != nil {
+		return err
+	}
+	stopServing, err := serveAndAdvertise(*listen, h, tlsConfig, cluster.CollectorService, host)
+	if err != nil {
+		return err
+	}
+	defer stopServing()
+	log.Printf("rpionewire: collecting on %v", *listen)
+
+	<-ctx.Done()
+	return nil
+}
+
+func runDiscover(a *app, args []string) error {
+	fs := flag.NewFlagSet("discover", flag.ExitOnError)
+	timeout := fs.Duration("timeout", 3*time.Second, "how long to browse the network")
+	fs.Parse(args)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "KIND\tNAME\tURL")
+	for _, kind := range []struct{ name, service string }{
+		{"collector", cluster.CollectorService},
+		{"agent", cluster.AgentService},
+	} {
+		found, err := cluster.Discover(context.Background(), kind.service, *timeout)
+		if err != nil {
+			return err
+		}
+		for _, s := range found {
+			fmt.Fprintf(w, "%v\t%v\t%v\n", kind.name, s.Instance, s.URL)
+		}
+	}
+	return w.Flush()
+}
+
+// serveAndAdvertise serves h on listen, over TLS if tlsConfig is not
+// nil, and advertises it on the local network as instance of service.
+// The returned function stops both.
+func serveAndAdvertise(listen string, h http.Handler, tlsConfig *tls.Config, service, instance string) (func(), error) {
+	l, err := net.Listen("tcp", listen)
+	if err != nil {
+		return nil, err
+	}
+	text := map[string]string{"version": strconv.Itoa(cluster.ProtocolVersion)}
+	if tlsConfig != nil {
+		l = tls.NewListener(l, tlsConfig)
+		text["scheme"] = "https"
+	}
+	httpServer := &http.Server{Handler: h}
+	go func() {
+		if err := httpServer.Serve(l); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("rpionewire: %v", err)
+		}
+	}()
+
+	port := l.Addr().(*net.TCPAddr).Port
+	unadvertise, err := cluster.Advertise(service, instance, port, text)
+	if err != nil {
+		log.Printf("rpionewire: %v", err)
+		unadvertise = func() {}
+	}
+
+	return func() {
+		unadvertise()
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		httpServer.Shutdown(ctx)
+	}, nil
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/fredcarle/rpionewire"
+)
+
+func runSetFeatures(a *app, args []string) error {
+	fs := flag.NewFlagSet("set-features", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: rpionewire set-features <device> <check-conversion,poll-completion|none>\n")
+	}
+	pos := parseInterspersed(fs, args)
+	if len(pos) != 2 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	features, err := rpionewire.ParseFeatures(pos[1])
+	if err != nil {
+		return err
+	}
+
+	devices, err := a.loadDevices()
+	if err != nil {
+		return err
+	}
+	d := findDevice(devices, pos[0])
+	if d == nil {
+		return fmt.Errorf("no device %q", pos[0])
+	}
+
+	before, err := d.Features()
+	if err != nil {
+		return err
+	}
+	if err := d.SetFeatures(features); err != nil {
+		return err
+	}
+	after, err := d.Features()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%v: %v -> %v\n", d.Name, before, after)
+	if after != features {
+		return errors.New("the kernel did not accept the new features")
+	}
+	return nil
+}
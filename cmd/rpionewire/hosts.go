@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+
+	"github.com/fredcarle/rpionewire"
+	"github.com/fredcarle/rpionewire/config"
+	"github.com/fredcarle/rpionewire/owserver"
+	"github.com/fredcarle/rpionewire/remote"
+)
+
+// registry builds a registry of the configured hosts
+func (a *app) registry() (*rpionewire.Registry, error) {
+	reg := rpionewire.NewRegistry()
+	for i, h := range a.config.Hosts {
+		opts := append(a.config.BusOptions(), a.busOptions...)
+		if h.Backend != "local" {
+			backend, err := hostBackend(h)
+			if err != nil {
+				return nil, fmt.Errorf("hosts[%d] %v: %w", i, h.Name, err)
+			}
+			opts = append(opts, rpionewire.WithBackend(backend))
+		}
+		reg.Add(h.Name, rpionewire.NewBus(opts...))
+	}
+	return reg, nil
+}
+
+// hostBackend returns the backend of the bus of a remote host, which
+// connects on its first use so that an unreachable host does not stop
+// the others
+func hostBackend(h config.Host) (rpionewire.Backend, error) {
+	switch h.Backend {
+	case "owserver":
+		return &owserver.Client{Addr: h.Addr}, nil
+	case "ssh":
+		key, err := os.ReadFile(h.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		signer, err := ssh.ParsePrivateKey(key)
+		if err != nil {
+			return nil, err
+		}
+		known := h.KnownHosts
+		if known == "" {
+			home, _ := os.UserHomeDir()
+			known = filepath.Join(home, ".ssh", "known_hosts")
+		}
+		hostKeys, err := knownhosts.New(known)
+		if err != nil {
+			return nil, err
+		}
+		return remote.Open(h.Addr, &ssh.ClientConfig{
+			User:            h.User,
+			Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
+			HostKeyCallback: hostKeys,
+			Timeout:         remote.DialTimeout,
+		}), nil
+	}
+	return nil, fmt.Errorf("unknown backend %q", h.Backend)
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+)
+
+// deviceInfo is the inventory entry of a device
+type deviceInfo struct {
+	Name       string `json:"name"`
+	ID         string `json:"id"`
+	Family     string `json:"family"`
+	Alias      string `json:"alias,omitempty"`
+	Resolution int    `json:"resolution,omitempty"`
+	Power      string `json:"power,omitempty"`
+}
+
+func runList(a *app, args []string) error {
+	fs := flag.NewFlagSet("list", flag.ExitOnError)
+	format := fs.String("format", "table", "output `format`: table or json")
+	fs.Parse(args)
+
+	devices, err := a.loadDevices()
+	if err != nil {
+		return err
+	}
+
+	infos := make([]deviceInfo, len(devices))
+	for i, d := range devices {
+		infos[i] = deviceInfo{
+			Name:   d.Name,
+			ID:     fmt.Sprintf("%012x", d.ID),
+			Family: d.DeviceType,
+			Alias:  d.Alias,
+		}
+		if res, err := d.Resolution(); err == nil {
+			infos[i].Resolution = res
+		}
+		if power, err := d.PowerMode(); err == nil {
+			infos[i].Power = power.String()
+		}
+	}
+
+	switch *format {
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(infos)
+	case "table":
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "NAME\tID\tFAMILY\tALIAS\tRESOLUTION\tPOWER")
+		for _, info := range infos {
+			res := "-"
+			if info.Resolution != 0 {
+				res = fmt.Sprintf("%d bits", info.Resolution)
+			}
+			fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\t%v\n", info.Name, info.ID, info.Family, orDash(info.Alias), res, orDash(info.Power))
+		}
+		return w.Flush()
+	}
+	return fmt.Errorf("unknown format %q", *format)
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,167 @@
+// Command rpionewire inspects and exports the one wire devices of a
+// Raspberry Pi.
+//
+// Usage:
+//
+//	rpionewire [-config file] <command> [arguments]
+//
+// Without -config, the configuration is read from the RPIONEWIRE_
+// environment variables, RPIONEWIRE_CONFIG naming an optional file.
+package main
+
+import (
+	"crypto/tls"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+
+	"github.com/fredcarle/rpionewire"
+	"github.com/fredcarle/rpionewire/config"
+	"github.com/fredcarle/rpionewire/server"
+)
+
+// command is a subcommand of the tool
+type command struct {
+	summary string
+	run     func(app *app, args []string) error
+}
+
+var commands = map[string]command{
+	"agent":          {"push the readings of the local devices to a collector", runAgent},
+	"alias":          {"manage device aliases", runAlias},
+	"calibrate":      {"compute calibration offsets from reference temperatures", runCalibrate},
+	"collector":      {"receive and export the readings pushed by agents", runCollector},
+	"discover":       {"find agents and collectors on the local network", runDiscover},
+	"list":           {"list the discovered devices", runList},
+	"masters":        {"show the statistics of the bus masters", runMasters},
+	"preflight":      {"check that the local bus is set up and report what is missing", runPreflight},
+	"read":           {"read devices and print their temperature", runRead},
+	"set-features":   {"change the w1_therm features of a device", runSetFeatures},
+	"set-resolution": {"change the conversion resolution of a device", runSetResolution},
+	"serve":          {"poll devices and serve their readings over HTTP, MQTT and webhooks", runServe},
+	"soak":           {"read devices continuously and report their error statistics", runSoak},
+	"top":            {"show a live dashboard of the devices", runTop},
+	"udev":           {"print udev rules giving a group access to the bus, or check access", runUdev},
+	"watch":          {"continuously print the temperature of devices", runWatch},
+}
+
+// app holds the state shared by the subcommands
+type app struct {
+	configPath string
+	config     *config.Config
+	// bus is the local bus loadDevices read, nil when aggregating hosts
+	bus *rpionewire.Bus
+	// busOptions are added to the configured options of every bus
+	busOptions []rpionewire.Option
+}
+
+func main() {
+	a := new(app)
+	flag.StringVar(&a.configPath, "config", "", "configuration `file` (YAML or TOML)")
+	flag.Usage = usage
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		usage()
+		os.Exit(2)
+	}
+	cmd, ok := commands[flag.Arg(0)]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "rpionewire: unknown command %q\n", flag.Arg(0))
+		usage()
+		os.Exit(2)
+	}
+
+	var err error
+	if a.configPath != "" {
+		a.config, err = config.Load(a.configPath)
+	} else {
+		a.config, err = config.FromEnv()
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "rpionewire: %v\n", err)
+		os.Exit(1)
+	}
+
+	if err := cmd.run(a, flag.Args()[1:]); err != nil {
+		fmt.Fprintf(os.Stderr, "rpionewire %v: %v\n", flag.Arg(0), err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: rpionewire [-config file] <command> [arguments]\n\nCommands:\n")
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-16v %v\n", name, commands[name].summary)
+	}
+	fmt.Fprintf(os.Stderr, "\nFlags:\n")
+	flag.PrintDefaults()
+}
+
+// loadDevices discovers the devices of the configured hosts, the local
+// bus by default, and applies their aliases and calibration. Devices
+// and hosts that fail to open are reported on stderr and left out.
+func (a *app) loadDevices() ([]*rpionewire.DS1820, error) {
+	var devices []*rpionewire.DS1820
+	var err error
+	if len(a.config.Hosts) == 0 {
+		a.bus = rpionewire.NewBus(append(a.config.BusOptions(), a.busOptions...)...)
+		devices, err = a.bus.LoadDevices()
+	} else {
+		var reg *rpionewire.Registry
+		if reg, err = a.registry(); err != nil {
+			return nil, err
+		}
+		devices, err = reg.LoadDevices()
+	}
+	if err != nil {
+		if len(devices) == 0 {
+			return nil, err
+		}
+		fmt.Fprintf(os.Stderr, "rpionewire: %v\n", err)
+	}
+	a.config.Apply(devices)
+	return devices, nil
+}
+
+// auth returns the authentication of the HTTP servers, accepting the
+// tokens given on top of those configured, nil if none is configured
+func (a *app) auth(tokens ...string) *server.Auth {
+	c := a.config.Server.Auth
+	if c == nil {
+		return nil
+	}
+	return &server.Auth{
+		Tokens: append(append([]string(nil), c.Tokens...), tokens...),
+		Users:  c.Users,
+		Public: []string{"/healthz", "/readyz"},
+	}
+}
+
+// handler returns h wrapped in the configured CORS and authentication,
+// the authentication accepting the tokens given on top of those
+// configured
+func (a *app) handler(h http.Handler, tokens ...string) http.Handler {
+	h = a.auth(tokens...).Handler(h)
+	if c := a.config.Server.CORS; c != nil {
+		h = (&server.CORS{Origins: c.Origins, MaxAge: c.MaxAge.Duration}).Handler(h)
+	}
+	return h
+}
+
+// serverTLS returns the TLS configuration of the HTTP servers, nil if
+// they serve plain HTTP
+func (a *app) serverTLS() (*tls.Config, error) {
+	t := a.config.Server.TLS
+	if t == nil {
+		return nil, nil
+	}
+	return (&server.TLS{CertFile: t.Cert, KeyFile: t.Key, ClientCAFile: t.CA}).Config()
+}
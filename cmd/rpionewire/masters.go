@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/fredcarle/rpionewire"
+	"github.com/fredcarle/rpionewire/server"
+)
+
+func runMasters(a *app, args []string) error {
+	fs := flag.NewFlagSet("masters", flag.ExitOnError)
+	format := fs.String("format", "table", "output `format`: table or json")
+	reads := fs.Int("reads", 1, "read every device `n` times to measure the read statistics")
+	fs.Parse(args)
+
+	if len(a.config.Hosts) > 0 {
+		return errors.New("bus masters are only available on the local bus")
+	}
+	devices, err := a.loadDevices()
+	if err != nil {
+		return err
+	}
+	for i := 0; i < *reads; i++ {
+		rpionewire.ReadEach(devices)
+	}
+	masters, err := a.bus.Masters()
+	if err != nil {
+		return err
+	}
+
+	stats := make([]server.MasterStats, len(masters))
+	for i, m := range masters {
+		stats[i] = server.NewMasterStats(m)
+	}
+
+	switch *format {
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(stats)
+	case "table":
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "MASTER\tDRIVER\tSEARCHES\tDEVICES\tREADS\tFAILURES\tAVG LATENCY")
+		for _, s := range stats {
+			if s.Error != "" {
+				fmt.Fprintf(w, "%v\terror: %v\n", s.Name, s.Error)
+				continue
+			}
+			latency := time.Duration(s.AvgLatency * float64(time.Second)).Round(time.Millisecond)
+			fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\t%v\t%v\n", s.Name, orDash(s.Driver), s.Searches, s.Devices, s.Reads, s.Failures, latency)
+		}
+		return w.Flush()
+	}
+	return fmt.Errorf("unknown format %q", *format)
+}
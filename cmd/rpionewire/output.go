@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/fredcarle/rpionewire"
+	"github.com/fredcarle/rpionewire/server"
+)
+
+// formats are the values accepted by the --format flags of the readings
+// commands
+const formats = "table, json, csv or prometheus"
+
+// writeReadings writes readings taken at t to w in format
+func writeReadings(w io.Writer, format string, readings []rpionewire.Reading, t time.Time) error {
+	infos := make([]server.Reading, len(readings))
+	for i, r := range readings {
+		infos[i] = server.NewReading(r, t)
+	}
+
+	switch format {
+	case "table":
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "NAME\tALIAS\tTEMPERATURE")
+		for i, info := range infos {
+			value := readings[i].Value.String()
+			if !readings[i].IsTemperature() {
+				value = readings[i].Format(rpionewire.Celsius, 3)
+			}
+			if info.Error != "" {
+				value = "error: " + info.Error
+			}
+			fmt.Fprintf(tw, "%v\t%v\t%v\n", info.Name, orDash(info.Alias), value)
+		}
+		return tw.Flush()
+
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(infos)
+
+	case "csv":
+		cw := csv.NewWriter(w)
+		cw.Write([]string{"time", "name", "id", "alias", "temp", "error"})
+		for i, info := range infos {
+			if !readings[i].IsTemperature() {
+				continue
+			}
+			temp := ""
+			if info.Temp != nil {
+				temp = strconv.FormatFloat(*info.Temp, 'f', -1, 64)
+			}
+			cw.Write([]string{info.Time.Format(time.RFC3339), info.Name, info.ID, info.Alias, temp, info.Error})
+		}
+		cw.Flush()
+		return cw.Error()
+
+	case "prometheus":
+		return server.WriteMetrics(w, infos)
+	}
+	return fmt.Errorf("unknown format %q, expected %v", format, formats)
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+
+	"github.com/fredcarle/rpionewire"
+)
+
+func runPreflight(a *app, args []string) error {
+	fs := flag.NewFlagSet("preflight", flag.ExitOnError)
+	expected := fs.Int("expected", len(a.config.Devices.Allow), "number of devices expected on the bus, the allowed devices by default")
+	fs.Parse(args)
+
+	report := rpionewire.NewBus(append(a.config.BusOptions(), a.busOptions...)...).Preflight(*expected)
+	fmt.Print(report)
+	if !report.OK() {
+		return errors.New("the bus is not ready")
+	}
+	return nil
+}
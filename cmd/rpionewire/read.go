@@ -0,0 +1,81 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/fredcarle/rpionewire"
+)
+
+func runRead(a *app, args []string) error {
+	fs := flag.NewFlagSet("read", flag.ExitOnError)
+	format := fs.String("format", "table", "output `format`: "+formats)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: rpionewire read [-format format] [device...]\n\nDevices are given by name, alias, ID or group; all are read by default.\n\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	devices, err := a.loadDevices()
+	if err != nil {
+		return err
+	}
+	if devices, err = selectDevices(devices, fs.Args()); err != nil {
+		return err
+	}
+
+	readings := make([]rpionewire.Reading, 0, len(devices))
+	for _, c := range rpionewire.ReadAsync(devices) {
+		readings = append(readings, <-c)
+	}
+	return writeReadings(os.Stdout, *format, readings, time.Now())
+}
+
+// selectDevices returns the devices matching names, by sysfs name, alias
+// or hexadecimal ID, or belonging to the groups they name, in the order
+// of names. All devices are returned when names is empty.
+func selectDevices(devices []*rpionewire.DS1820, names []string) ([]*rpionewire.DS1820, error) {
+	if len(names) == 0 {
+		return devices, nil
+	}
+
+	selected := make([]*rpionewire.DS1820, 0, len(names))
+	for _, name := range names {
+		if d := findDevice(devices, name); d != nil {
+			selected = append(selected, d)
+			continue
+		}
+		group := groupDevices(devices, name)
+		if len(group) == 0 {
+			return nil, fmt.Errorf("no device or group %q", name)
+		}
+		selected = append(selected, group...)
+	}
+	return selected, nil
+}
+
+// groupDevices returns the devices of the group named name
+func groupDevices(devices []*rpionewire.DS1820, name string) []*rpionewire.DS1820 {
+	var group []*rpionewire.DS1820
+	for _, d := range devices {
+		if d.InGroup(name) {
+			group = append(group, d)
+		}
+	}
+	return group
+}
+
+// findDevice returns the device matching name, by sysfs name, alias or
+// hexadecimal ID, or nil
+func findDevice(devices []*rpionewire.DS1820, name string) *rpionewire.DS1820 {
+	id, idErr := strconv.ParseUint(name, 16, 64)
+	for _, d := range devices {
+		if d.Name == name || (d.Alias != "" && d.Alias == name) || (idErr == nil && d.ID == id) {
+			return d
+		}
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+)
+
+func runSetResolution(a *app, args []string) error {
+	fs := flag.NewFlagSet("set-resolution", flag.ExitOnError)
+	persist := fs.Bool("persist", false, "commit the resolution to the device EEPROM")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: rpionewire set-resolution <device> <bits> [-persist]\n\n")
+		fs.PrintDefaults()
+	}
+	pos := parseInterspersed(fs, args)
+	if len(pos) != 2 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	bits, err := strconv.Atoi(pos[1])
+	if err != nil {
+		return fmt.Errorf("invalid resolution %q", pos[1])
+	}
+
+	devices, err := a.loadDevices()
+	if err != nil {
+		return err
+	}
+	d := findDevice(devices, pos[0])
+	if d == nil {
+		return fmt.Errorf("no device %q", pos[0])
+	}
+
+	before, err := d.Resolution()
+	if err != nil {
+		return err
+	}
+	if err := d.SetResolution(bits); err != nil {
+		return err
+	}
+	after, err := d.Resolution()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%v: %v bits -> %v bits\n", d.Name, before, after)
+	if after != bits {
+		return errors.New("the device did not accept the new resolution")
+	}
+
+	if *persist {
+		if err := d.SaveEEPROM(); err != nil {
+			return err
+		}
+		fmt.Printf("%v: resolution saved to EEPROM\n", d.Name)
+	}
+	return nil
+}
+
+// parseInterspersed parses the flags of args wherever they appear among
+// the positional arguments, which it returns
+func parseInterspersed(fs *flag.FlagSet, args []string) []string {
+	var pos []string
+	fs.Parse(args)
+	for fs.NArg() > 0 {
+		pos = append(pos, fs.Arg(0))
+		fs.Parse(fs.Args()[1:])
+	}
+	return pos
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/fredcarle/rpionewire"
+	"github.com/fredcarle/rpionewire/config"
+	"github.com/fredcarle/rpionewire/expvars"
+	"github.com/fredcarle/rpionewire/filesink"
+	"github.com/fredcarle/rpionewire/gpio"
+	"github.com/fredcarle/rpionewire/history"
+	"github.com/fredcarle/rpionewire/mqtt"
+	"github.com/fredcarle/rpionewire/notify"
+	"github.com/fredcarle/rpionewire/owserver"
+	"github.com/fredcarle/rpionewire/server"
+)
+
+func runServe(a *app, args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	listen := fs.String("listen", a.config.Server.Listen, "HTTP listen `address`")
+	owListen := fs.String("owserver", a.config.Server.OWServerListen, "owserver protocol listen `address`, disabled if empty")
+	fs.Parse(args)
+
+	vars := expvars.Publish("rpionewire")
+	a.busOptions = append(a.busOptions, rpionewire.WithMetrics(vars))
+	devices, err := a.loadDevices()
+	if err != nil {
+		return err
+	}
+
+	sinks, notifiers, closers, err := buildSinks(a.config)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		for _, c := range closers {
+			c.Close()
+		}
+	}()
+	if dd := a.config.DegreeDays; dd != nil {
+		degreeDays, err := rpionewire.NewDegreeDays(dd.Base, dd.Path)
+		if err != nil {
+			return err
+		}
+		sinks = append(sinks, degreeDays)
+	}
+	var store *history.Store
+	if h := a.config.History; h != nil {
+		tiers := make([]history.Tier, len(h.Tiers))
+		for i, t := range h.Tiers {
+			tiers[i] = history.Tier{Resolution: t.Resolution.Duration, Retention: t.Retention.Duration}
+		}
+		if store, err = history.NewStore(h.Path, tiers...); err != nil {
+			return err
+		}
+		sinks = append(sinks, store)
+	}
+	for i, t := range a.config.Thermostats {
+		out, err := gpio.Open(gpio.Config{Chip: t.GPIO.Chip, Line: t.GPIO.Line, ActiveLow: t.GPIO.ActiveLow})
+		if err != nil {
+			return fmt.Errorf("thermostats[%d]: %w", i, err)
+		}
+		closers = append(closers, out)
+		mode := rpionewire.Heating
+		if t.Mode == "cooling" {
+			mode = rpionewire.Cooling
+		}
+		sinks = append(sinks, &rpionewire.Thermostat{
+			Device:     t.Device,
+			Setpoint:   t.Setpoint,
+			Hysteresis: t.Hysteresis,
+			Mode:       mode,
+			Output:     out,
+			MinCycle:   t.MinCycle.Duration,
+		})
+	}
+	var pwmOpts []gpio.PWMOption
+	if root := a.config.Devices.SysfsRoot; root != "" {
+		pwmOpts = append(pwmOpts, gpio.WithSysfsRoot(root))
+	}
+	for i, f := range a.config.Fans {
+		freq := f.PWM.Frequency
+		if freq == 0 {
+			freq = 25000
+		}
+		out, err := gpio.OpenPWM(f.PWM.Chip, f.PWM.Channel, freq, pwmOpts...)
+		if err != nil {
+			return fmt.Errorf("fans[%d]: %w", i, err)
+		}
+		closers = append(closers, out)
+		curve := make(rpionewire.FanCurve, len(f.Curve))
+		for j, p := range f.Curve {
+			curve[j] = rpionewire.CurvePoint{Temp: p.Temp, Duty: p.Duty}
+		}
+		sinks = append(sinks, &rpionewire.Fan{Device: f.Device, Curve: curve, Output: out})
+	}
+	if rules := a.config.AlertRules(); len(rules) > 0 {
+		sinks = append(sinks, rpionewire.NewAlerter(rules, notifiers...))
+	}
+
+	srv := server.New(a.config.Server.MetricsPath)
+	srv.Handle("/debug/vars", expvar.Handler())
+	if a.config.Server.Dashboard {
+		srv.Handle("/dashboard/", server.Dashboard())
+	}
+	if store != nil {
+		srv.SetHistory(store)
+	}
+	sinks = append(sinks, srv, vars)
+	if a.bus != nil {
+		if masters, err := a.bus.Masters(); err == nil {
+			srv.SetMasters(masters)
+		}
+		bus := a.bus
+		srv.AddCheck("masters", func() error {
+			_, err := bus.Masters()
+			return err
+		})
+	}
+	staleAfter := a.config.Server.StaleAfter.Duration
+	if staleAfter == 0 && a.config.Polling.Schedule == "" {
+		staleAfter = 3 * a.config.Polling.Interval.Duration
+	}
+	srv.SetStaleAfter(staleAfter)
+	// Per-device schedules may read some devices far less often than
+	// the interval, so only the plain interval gives a safe default
+	expireAfter := a.config.Server.ExpireAfter.Duration
+	if expireAfter == 0 && a.config.Polling.Schedule == "" && len(a.config.Polling.Devices) == 0 {
+		expireAfter = 10 * a.config.Polling.Interval.Duration
+	}
+	srv.SetExpireAfter(expireAfter)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	tlsConfig, err := a.serverTLS()
+	if err != nil {
+		return err
+	}
+	httpServer := &http.Server{Addr: *listen, Handler: a.handler(srv), TLSConfig: tlsConfig}
+	errc := make(chan error, 2)
+	go func() {
+		if tlsConfig != nil {
+			errc <- httpServer.ListenAndServeTLS("", "")
+		} else {
+			errc <- httpServer.ListenAndServe()
+		}
+	}()
+	log.Printf("rpionewire: serving %v devices on %v", len(devices), *listen)
+
+	if *owListen != "" {
+		// The owserver endpoint reads the local bus as configured, its
+		// sysfs root or simulator included
+		bus := a.bus
+		if bus == nil {
+			bus = rpionewire.NewBus(append(a.config.BusOptions(), a.busOptions...)...)
+		}
+		ow := &owserver.Server{Backend: bus.Backend()}
+		go func() {
+			errc <- ow.ListenAndServe(*owListen)
+		}()
+		defer ow.Close()
+		log.Printf("rpionewire: serving owserver protocol on %v", *owListen)
+	}
+
+	p := rpionewire.NewPoller(devices, a.config.Polling.Interval.Duration, append(a.config.PollerOptions(), rpionewire.WithSinks(sinks...), rpionewire.WithPollerMetrics(vars))...)
+	go p.Run(ctx)
+	defer func() {
+		if err := p.Stop(); err != nil {
+			log.Printf("rpionewire: %v", err)
+		}
+	}()
+
+	select {
+	case err = <-errc:
+		return err
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := httpServer.Shutdown(shutdownCtx); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// buildSinks creates the sinks of the configuration and the notifiers
+// told about alerts, the webhooks and push services, returning those
+// that need closing on shutdown separately
+func buildSinks(c *config.Config) ([]rpionewire.Sink, []rpionewire.Notifier, []io.Closer, error) {
+	var sinks []rpionewire.Sink
+	var notifiers []rpionewire.Notifier
+	var closers []io.Closer
+	for i, s := range c.Sinks {
+		switch s.Type {
+		case "webhook":
+			hook := &notify.Webhook{
+				URLs:    []string{s.URL},
+				Secret:  []byte(s.Secret),
+				Retries: s.Retries,
+				Backoff: time.Second,
+			}
+			notifiers = append(notifiers, hook)
+			if s.Readings {
+				sinks = append(sinks, hook)
+			}
+		case "telegram":
+			notifiers = append(notifiers, &notify.Telegram{Token: s.Token, ChatID: s.ChatID, APIURL: s.URL})
+		case "pushover":
+			notifiers = append(notifiers, &notify.Pushover{
+				Token:    s.Token,
+				User:     s.User,
+				Priority: s.Priority,
+				Retry:    s.Retry.Duration,
+				Expire:   s.Expire.Duration,
+				APIURL:   s.URL,
+			})
+		case "mqtt":
+			clientID := s.ClientID
+			if clientID == "" {
+				host, _ := os.Hostname()
+				clientID = "rpionewire-" + host
+			}
+			topic := s.Topic
+			if topic == "" {
+				topic = "rpionewire"
+			}
+			sink, err := mqtt.NewSink(s.URL, clientID, topic)
+			if err != nil {
+				for _, c := range closers {
+					c.Close()
+				}
+				return nil, nil, nil, fmt.Errorf("sinks[%d]: %w", i, err)
+			}
+			sinks = append(sinks, sink)
+			closers = append(closers, sink)
+		case "jsonl", "csv", "parquet":
+			rotation := filesink.Rotation{
+				MaxSize:  s.MaxSize,
+				Interval: s.Rotate.Duration,
+				Daily:    s.Daily,
+				Compress: s.Compress,
+				MaxAge:   s.MaxAge.Duration,
+			}
+			var sink interface {
+				rpionewire.Sink
+				io.Closer
+			}
+			var err error
+			switch s.Type {
+			case "csv":
+				sink, err = filesink.NewCSV(s.Path, rotation)
+			case "parquet":
+				var pq *filesink.Parquet
+				if pq, err = filesink.NewParquet(s.Path); err == nil {
+					pq.MaxRows = s.MaxRows
+					sink = pq
+				}
+			default:
+				sink, err = filesink.NewJSONL(s.Path, rotation)
+			}
+			if err != nil {
+				for _, c := range closers {
+					c.Close()
+				}
+				return nil, nil, nil, fmt.Errorf("sinks[%d]: %w", i, err)
+			}
+			sinks = append(sinks, sink)
+			closers = append(closers, sink)
+		}
+	}
+	return sinks, notifiers, closers, nil
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/fredcarle/rpionewire"
+)
+
+func runSoak(a *app, args []string) error {
+	fs := flag.NewFlagSet("soak", flag.ExitOnError)
+	duration := fs.Duration("duration", time.Hour, "how long to read the devices")
+	interval := fs.Duration("interval", 0, "time between read cycles, 0 reading back to back")
+	progress := fs.Duration("progress", time.Minute, "time between progress lines on stderr, 0 disabling them")
+	maxFailures := fs.Float64("max-failures", 0.001, "failure `rate` above which a device fails the test")
+	format := fs.String("format", "table", "report `format`: table or json")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: rpionewire soak [-duration d] [-interval d] [-max-failures rate] [-format format] [device...]\n\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if *format != "table" && *format != "json" {
+		return fmt.Errorf("unknown format %q", *format)
+	}
+
+	devices, err := a.loadDevices()
+	if err != nil {
+		return err
+	}
+	if devices, err = selectDevices(devices, fs.Args()); err != nil {
+		return err
+	}
+	if len(devices) == 0 {
+		return errors.New("no device to soak")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	ctx, cancel := context.WithTimeout(ctx, *duration)
+	defer cancel()
+
+	s := newSoak(devices)
+	if *progress > 0 {
+		go s.reportProgress(ctx, os.Stderr, *progress)
+	}
+	p := rpionewire.NewPoller(devices, *interval, rpionewire.WithSinks(s))
+	if err := p.Run(ctx); err != nil && ctx.Err() == nil {
+		return err
+	}
+
+	report := s.report(*maxFailures)
+	if *format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(report)
+	} else {
+		err = report.write(os.Stdout)
+	}
+	if err != nil {
+		return err
+	}
+	if !report.Passed {
+		return errors.New("the bus failed the soak test")
+	}
+	return nil
+}
+
+// soak accumulates the statistics of the readings of a soak test
+type soak struct {
+	start   time.Time
+	devices []*rpionewire.DS1820
+
+	mu     sync.Mutex
+	cycles int
+	stats  map[*rpionewire.DS1820]*soakStats
+}
+
+// soakStats are the statistics of a device during a soak test
+type soakStats struct {
+	Name  string `json:"name"`
+	Alias string `json:"alias,omitempty"`
+	Reads uint64 `json:"reads"`
+	// Failures are the reads that failed, FailureRate their share
+	Failures    uint64  `json:"failures"`
+	FailureRate float64 `json:"failure_rate"`
+	// MaxConsecutiveFailures is the longest run of failed reads
+	MaxConsecutiveFailures int `json:"max_consecutive_failures"`
+	// CRCErrors are the conversions rejected by the CRC check,
+	// including those a retry recovered
+	CRCErrors     uint64   `json:"crc_errors"`
+	PowerOnResets uint64   `json:"power_on_resets"`
+	Min           *float64 `json:"min,omitempty"`
+	Max           *float64 `json:"max,omitempty"`
+	LastError     string   `json:"last_error,omitempty"`
+	Passed        bool     `json:"passed"`
+
+	consecutive int
+}
+
+// soakReport is the outcome of a soak test
+type soakReport struct {
+	Start    time.Time    `json:"start"`
+	Duration float64      `json:"duration_seconds"`
+	Cycles   int          `json:"cycles"`
+	Devices  []*soakStats `json:"devices"`
+	Passed   bool         `json:"passed"`
+}
+
+func newSoak(devices []*rpionewire.DS1820) *soak {
+	s := &soak{start: time.Now(), devices: devices, stats: map[*rpionewire.DS1820]*soakStats{}}
+	for _, d := range devices {
+		s.stats[d] = &soakStats{Name: d.Name, Alias: d.Alias}
+	}
+	return s
+}
+
+func (s *soak) WriteReadings(readings []rpionewire.Reading) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cycles++
+	for _, r := range readings {
+		st := s.stats[r.Device]
+		if st == nil {
+			continue
+		}
+		st.Reads++
+		if r.Err != nil {
+			st.Failures++
+			st.consecutive++
+			if st.consecutive > st.MaxConsecutiveFailures {
+				st.MaxConsecutiveFailures = st.consecutive
+			}
+			st.LastError = r.Err.Error()
+			continue
+		}
+		st.consecutive = 0
+		if r.Flags&rpionewire.FlagPowerOnReset != 0 {
+			st.PowerOnResets++
+		}
+		v := float64(r.Value)
+		if st.Min == nil || v < *st.Min {
+			lo := v
+			st.Min = &lo
+		}
+		if st.Max == nil || v > *st.Max {
+			hi := v
+			st.Max = &hi
+		}
+	}
+	return nil
+}
+
+// reportProgress writes a line of totals to w every interval until ctx
+// is done
+func (s *soak) reportProgress(ctx context.Context, w io.Writer, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		s.mu.Lock()
+		var reads, failures uint64
+		for _, st := range s.stats {
+			reads += st.Reads
+			failures += st.Failures
+		}
+		cycles := s.cycles
+		s.mu.Unlock()
+		var crc uint64
+		for _, d := range s.devices {
+			crc += d.Health().CRCErrors
+		}
+		fmt.Fprintf(w, "rpionewire soak: %v elapsed, %v cycles, %v reads, %v failures, %v CRC errors\n", time.Since(s.start).Round(time.Second), cycles, reads, failures, crc)
+	}
+}
+
+// report returns the statistics gathered so far, a device failing when
+// its failure rate exceeds maxFailures, it powered on during the test
+// or it was never read successfully
+func (s *soak) report(maxFailures float64) soakReport {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r := soakReport{Start: s.start, Duration: time.Since(s.start).Seconds(), Cycles: s.cycles, Passed: true}
+	for _, d := range s.devices {
+		st := s.stats[d]
+		st.CRCErrors = d.Health().CRCErrors
+		if st.Reads > 0 {
+			st.FailureRate = float64(st.Failures) / float64(st.Reads)
+		}
+		st.Passed = st.Reads > st.Failures && st.FailureRate <= maxFailures && st.PowerOnResets == 0
+		r.Passed = r.Passed && st.Passed
+		r.Devices = append(r.Devices, st)
+	}
+	return r
+}
+
+// write writes the report as a table followed by the verdict
+func (r soakReport) write(w io.Writer) error {
+	fmt.Fprintf(w, "Soak test from %v for %v, %v cycles\n\n", r.Start.Format("2006-01-02 15:04:05"), time.Duration(r.Duration*float64(time.Second)).Round(time.Second), r.Cycles)
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tALIAS\tREADS\tFAILURES\tRATE\tMAX RUN\tCRC\tRESETS\tMIN\tMAX\tRESULT")
+	for _, st := range r.Devices {
+		result := "PASS"
+		if !st.Passed {
+			result = "FAIL"
+		}
+		fmt.Fprintf(tw, "%v\t%v\t%v\t%v\t%.3f%%\t%v\t%v\t%v\t%v\t%v\t%v\n", st.Name, orDash(st.Alias), st.Reads, st.Failures, st.FailureRate*100, st.MaxConsecutiveFailures, st.CRCErrors, st.PowerOnResets, formatBound(st.Min), formatBound(st.Max), result)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	for _, st := range r.Devices {
+		if st.LastError != "" {
+			fmt.Fprintf(w, "%v: last error: %v\n", st.Name, st.LastError)
+		}
+	}
+	if r.Passed {
+		_, err := fmt.Fprintln(w, "\nPASS")
+		return err
+	}
+	_, err := fmt.Fprintln(w, "\nFAIL")
+	return err
+}
+
+// formatBound formats a temperature bound, a dash if no value was read
+func formatBound(v *float64) string {
+	if v == nil || math.IsNaN(*v) {
+		return "-"
+	}
+	return fmt.Sprintf("%.2f", *v)
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/fredcarle/rpionewire"
+	"github.com/fredcarle/rpionewire/history"
+)
+
+const (
+	enterAltScreen = "\033[?1049h\033[?25l"
+	exitAltScreen  = "\033[?25h\033[?1049l"
+	colorGreen     = "\033[32m"
+	colorYellow    = "\033[33m"
+	colorRed       = "\033[31m"
+	colorReset     = "\033[0m"
+)
+
+var sparks = []rune("▁▂▃▄▅▆▇█")
+
+func runTop(a *app, args []string) error {
+	fs := flag.NewFlagSet("top", flag.ExitOnError)
+	interval := fs.Duration("interval", 2*time.Second, "time between reads")
+	width := fs.Int("width", 30, "number of readings in the sparklines")
+	fs.Parse(args)
+
+	devices, err := a.loadDevices()
+	if err != nil {
+		return err
+	}
+	if devices, err = selectDevices(devices, fs.Args()); err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	fmt.Print(enterAltScreen)
+	defer fmt.Print(exitAltScreen)
+
+	buf := history.NewBuffer(*width)
+	screen := &topScreen{w: os.Stdout, devices: devices, history: buf, interval: *interval, latest: map[*rpionewire.DS1820]rpionewire.Reading{}}
+	p := rpionewire.NewPoller(devices, *interval, rpionewire.WithSinks(buf, screen))
+	if err := p.Run(ctx); err != nil && ctx.Err() == nil {
+		return err
+	}
+	return nil
+}
+
+// topScreen redraws the dashboard after every poll cycle
+type topScreen struct {
+	w        io.Writer
+	devices  []*rpionewire.DS1820
+	history  *history.Buffer
+	interval time.Duration
+	// latest is the latest reading of every device, drawn whether or not
+	// it was read in the last cycle
+	latest map[*rpionewire.DS1820]rpionewire.Reading
+}
+
+func (s *topScreen) WriteReadings(readings []rpionewire.Reading) error {
+	for _, r := range readings {
+		s.latest[r.Device] = r
+	}
+
+	var sb strings.Builder
+	sb.WriteString(clearScreen)
+	fmt.Fprintf(&sb, "rpionewire top - %v devices - every %v - %v\n\n", len(s.devices), s.interval, time.Now().Format("15:04:05"))
+
+	tw := tabwriter.NewWriter(&sb, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tALIAS\tTEMP\tMIN\tMAX\tHISTORY\tCRC\tHEALTH")
+	for _, d := range s.devices {
+		r, ok := s.latest[d]
+		if !ok {
+			continue
+		}
+		temp := r.Value.String()
+		if r.Err != nil {
+			temp = "--"
+		}
+		points := s.history.Values(d.Name)
+		lo, hi := bounds(points)
+		h := d.Health()
+		fmt.Fprintf(tw, "%v\t%v\t%v\t%.1f\t%.1f\t%v\t%v/%v\t%v\n", d.Name, orDash(d.Alias), temp, lo, hi, sparkline(points), h.CRCErrors, h.CRCRetries, healthIndicator(h))
+	}
+	tw.Flush()
+
+	sb.WriteString("\n^C to quit\n")
+	_, err := io.WriteString(s.w, sb.String())
+	return err
+}
+
+// bounds returns the lowest and highest values of points
+func bounds(points []history.Point) (float64, float64) {
+	if len(points) == 0 {
+		return math.NaN(), math.NaN()
+	}
+	lo, hi := points[0].Value, points[0].Value
+	for _, p := range points[1:] {
+		lo = math.Min(lo, p.Value)
+		hi = math.Max(hi, p.Value)
+	}
+	return lo, hi
+}
+
+// sparkline draws points as a line of block characters scaled between
+// their bounds
+func sparkline(points []history.Point) string {
+	lo, hi := bounds(points)
+	var sb strings.Builder
+	for _, p := range points {
+		i := 0
+		if hi > lo {
+			i = int((p.Value - lo) / (hi - lo) * float64(len(sparks)-1))
+		}
+		sb.WriteRune(sparks[i])
+	}
+	return sb.String()
+}
+
+// healthIndicator summarizes h as ok, flaky or failing
+func healthIndicator(h rpionewire.Health) string {
+	switch {
+	case h.ConsecutiveFailures >= 3:
+		return colorRed + "FAIL" + colorReset
+	case h.ConsecutiveFailures > 0 || h.Failures > 0 || h.CRCErrors > 0:
+		return colorYellow + fmt.Sprintf("FLAKY %v/%v", h.Failures, h.Reads) + colorReset
+	}
+	return colorGreen + "OK" + colorReset
+}
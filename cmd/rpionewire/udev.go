@@ -0,0 +1,132 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+)
+
+// udevRulesFile is where the generated rules are meant to be installed
+const udevRulesFile = "/etc/udev/rules.d/99-rpionewire.rules"
+
+func runUdev(a *app, args []string) error {
+	fs := flag.NewFlagSet("udev", flag.ExitOnError)
+	group := fs.String("group", "gpio", "`group` given access to the devices")
+	withGPIO := fs.Bool("gpio", len(a.config.Thermostats) > 0, "include the GPIO chips, needed by thermostats")
+	withPWM := fs.Bool("pwm", len(a.config.Fans) > 0, "include the PWM chips, needed by fans")
+	check := fs.Bool("check", false, "check the access of the current user instead of printing the rules")
+	fs.Parse(args)
+
+	if *check {
+		return a.checkAccess(os.Stdout, *withGPIO, *withPWM)
+	}
+	writeUdevRules(os.Stdout, *group, *withGPIO, *withPWM)
+	return nil
+}
+
+// writeUdevRules writes udev rules giving group the access the daemon
+// needs, followed by the commands installing them
+func writeUdevRules(w io.Writer, group string, withGPIO, withPWM bool) {
+	fmt.Fprintf(w, "# %v: lets the %v group use the one wire bus without root\n", udevRulesFile, group)
+	fmt.Fprintf(w, "# Device files are world readable already; searches, resolutions and\n# couplers need write access to the attributes of the bus and devices.\n")
+	fmt.Fprintf(w, "SUBSYSTEM==\"w1\", ACTION==\"add\", RUN+=\"/bin/chgrp -R %v /sys%%p\", RUN+=\"/bin/chmod -R g+w /sys%%p\"\n", group)
+	if withGPIO {
+		fmt.Fprintf(w, "SUBSYSTEM==\"gpio\", KERNEL==\"gpiochip*\", GROUP=\"%v\", MODE=\"0660\"\n", group)
+	}
+	if withPWM {
+		fmt.Fprintf(w, "SUBSYSTEM==\"pwm\", ACTION==\"add\", RUN+=\"/bin/chgrp -R %v /sys%%p\", RUN+=\"/bin/chmod -R g+w /sys%%p\"\n", group)
+	}
+
+	u, err := user.Current()
+	name := "$USER"
+	if err == nil && u.Username != "root" {
+		name = u.Username
+	}
+	fmt.Fprintf(w, "\n# Install with:\n")
+	fmt.Fprintf(w, "#   rpionewire udev | sudo tee %v\n", udevRulesFile)
+	fmt.Fprintf(w, "#   sudo groupadd --system -f %v\n", group)
+	fmt.Fprintf(w, "#   sudo usermod -aG %v %v\n", group, name)
+	fmt.Fprintf(w, "#   sudo udevadm control --reload && sudo udevadm trigger\n")
+	fmt.Fprintf(w, "# then log in again for the group to apply.\n")
+}
+
+// checkAccess reports whether the current user can use the bus, and
+// the GPIO and PWM chips if asked, failing if any access is missing
+func (a *app) checkAccess(w io.Writer, withGPIO, withPWM bool) error {
+	root := a.config.Devices.SysfsRoot
+	if root == "" {
+		root = "/sys"
+	}
+	dir := filepath.Join(root, "bus", "w1", "devices")
+
+	failed := 0
+	report := func(what, path string, err error) {
+		if err != nil {
+			failed++
+			fmt.Fprintf(w, "FAIL  %v %v: %v\n", what, path, err)
+			return
+		}
+		fmt.Fprintf(w, "ok    %v %v\n", what, path)
+	}
+
+	entries, err := os.ReadDir(dir)
+	report("list", dir, err)
+	for _, e := range entries {
+		name := e.Name()
+		switch {
+		case strings.HasPrefix(name, "w1_bus_master"):
+			report("write", filepath.Join(dir, name, "w1_master_search"), canOpen(filepath.Join(dir, name, "w1_master_search"), os.O_WRONLY))
+		case strings.Contains(name, "-"):
+			report("read", filepath.Join(dir, name, "w1_slave"), canOpen(filepath.Join(dir, name, "w1_slave"), os.O_RDONLY))
+			if path := filepath.Join(dir, name, "resolution"); exists(path) {
+				report("write", path, canOpen(path, os.O_WRONLY))
+			}
+		}
+	}
+
+	if withGPIO {
+		for _, t := range a.config.Thermostats {
+			path := t.GPIO.Chip
+			if !strings.HasPrefix(path, "/") {
+				path = filepath.Join("/dev", path)
+			}
+			report("read/write", path, canOpen(path, os.O_RDWR))
+		}
+	}
+	if withPWM {
+		for _, f := range a.config.Fans {
+			path := filepath.Join(root, "class", "pwm", fmt.Sprintf("pwmchip%d", f.PWM.Chip), "export")
+			report("write", path, canOpen(path, os.O_WRONLY))
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%v of the checks failed, see rpionewire udev", failed)
+	}
+	return nil
+}
+
+// canOpen opens the file at path with flag and closes it, which
+// checks the access without reading or writing sysfs attributes
+func canOpen(path string, flag int) error {
+	f, err := os.OpenFile(path, flag, 0)
+	if err != nil {
+		var pe *os.PathError
+		if errors.As(err, &pe) {
+			return pe.Err
+		}
+		return err
+	}
+	return f.Close()
+}
+
+// exists tells whether a file exists at path
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/fredcarle/rpionewire"
+)
+
+// clearScreen moves the cursor home and clears the terminal
+const clearScreen = "\033[H\033[2J"
+
+func runWatch(a *app, args []string) error {
+	fs := flag.NewFlagSet("watch", flag.ExitOnError)
+	interval := fs.Duration("interval", 5*time.Second, "time between reads")
+	clear := fs.Bool("clear", false, "clear the screen before each update")
+	format := fs.String("format", "table", "output `format`: "+formats)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: rpionewire watch [-interval d] [-clear] [-format format] [device...]\n\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if err := writeReadings(io.Discard, *format, nil, time.Now()); err != nil {
+		return err
+	}
+
+	devices, err := a.loadDevices()
+	if err != nil {
+		return err
+	}
+	if devices, err = selectDevices(devices, fs.Args()); err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	out := &printSink{w: os.Stdout, format: *format, clear: *clear}
+	p := rpionewire.NewPoller(devices, *interval, rpionewire.WithSinks(out))
+	if err := p.Run(ctx); err != nil && ctx.Err() == nil {
+		return err
+	}
+	return nil
+}
+
+// printSink prints every poll cycle
+type printSink struct {
+	w      io.Writer
+	format string
+	clear  bool
+}
+
+func (s *printSink) WriteReadings(readings []rpionewire.Reading) error {
+	now := time.Now()
+	if s.clear {
+		fmt.Fprint(s.w, clearScreen)
+	}
+	if s.format == "table" {
+		fmt.Fprintf(s.w, "%v\n", now.Format("2006-01-02 15:04:05"))
+	}
+	if err := writeReadings(s.w, s.format, readings, now); err != nil {
+		return err
+	}
+	if s.format == "table" && !s.clear {
+		fmt.Fprintln(s.w)
+	}
+	return nil
+}
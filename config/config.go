@@ -0,0 +1,1239 @@
+// Package config loads the configuration of rpionewire applications
+// from YAML or TOML files.
+//
+// A configuration looks like this in YAML:
+//
+//	devices:
+//	  rediscover: 10s      # wait for dropped devices to reappear, 0 disables
+//	  failover: 5s         # wait for another master to find a device, 0 disables
+//	  crc_retries: 2       # retries of reads failing the CRC check
+//	  exclude:             # devices ignored by discovery and polling
+//	    - 28-0416a1184baa
+//	  allow:               # if set, the only devices managed, reported when missing
+//	    - 28-0316a2794bff
+//	  sysfs_root: /host/sys  # where the host /sys is mounted in a container
+//	  modules:             # load the kernel modules, left to the system if
+//	                       # omitted; {} loads them without parameters
+//	    masters: [ds2490]  # master drivers, w1_gpio by default, ds2490 for DS9490R USB adapters
+//	    params:
+//	      w1_gpio: [gpiopin=17, pullup=1]
+//	    skip: [w1_gpio]    # modules not loaded, such as w1_gpio behind a DS2482
+//	    dry_run: true      # log the modprobe commands instead of running them
+//	aliases:
+//	  28-0316a2794bff: freezer
+//	groups:
+//	  greenhouse: [28-0316a2794bff, 28-0416a1184baa]
+//	calibration:
+//	  28-0316a2794bff:
+//	    offset: -0.3
+//	    scale: 1
+//	    self_heating: 0.2  # °C of self-heating when converting continuously
+//	polling:
+//	  interval: 30s
+//	  schedule: "* 7-22 * * *; */15 23,0-6 * * *"  # cron, replaces interval
+//	  jitter: 5s           # random delay spreading the cycles of a fleet
+//	  devices:             # per device or group schedules
+//	    28-0316a2794bff: 5s
+//	    greenhouse: 10m
+//	  priority:            # read first each cycle, higher first
+//	    28-0316a2794bff: 10
+//	  drain_timeout: 10s   # wait on shutdown for the last cycle and flushes
+//	  aggregates:          # zone values computed from the devices of groups
+//	    greenhouse: [mean, min, max]
+//	  delta_t:             # differences between devices, alerted on by webhooks
+//	    - name: heating-loop
+//	      hot: 28-0316a2794bff
+//	      cold: 28-0416a1184baa
+//	      low: 5           # alert thresholds, either can be omitted
+//	      high: 20
+//	  heat_meters:         # power and energy carried by delta_t loops
+//	    - delta_t: heating-loop
+//	      flow: 12         # L/min
+//	      specific_heat: 3.8  # kJ/(kg·K), water if omitted
+//	      density: 1.03    # kg/L, water if omitted
+//	alerts:                # threshold alerts, sent to the webhook and push sinks
+//	  - name: freezer-warm
+//	    device: 28-0316a2794bff  # or group, each device alerting on its own
+//	    condition: above   # below or outside
+//	    high: -15          # low for below, both for outside
+//	    for: 5m            # how long the condition must hold
+//	    hysteresis: 1      # °C back inside the threshold to clear
+//	    clear_for: 10m     # how long clearing values must hold
+//	degree_days:           # heating and cooling degree-days of devices and zones
+//	  base: 15.5
+//	  path: /var/lib/rpionewire/degree-days.json
+//	history:               # downsampled history kept on the device
+//	  path: /var/lib/rpionewire/history.gob
+//	  tiers:               # raw readings for 48h, 5 minute averages for 90 days
+//	    - {resolution: 0s, retention: 48h}
+//	    - {resolution: 5m, retention: 2160h}
+//	thermostats:           # on/off control of GPIO outputs
+//	  - device: greenhouse:mean
+//	    setpoint: 12
+//	    hysteresis: 0.5
+//	    mode: heating      # or cooling
+//	    min_cycle: 5m
+//	    gpio: {chip: gpiochip0, line: 17, active_low: true}
+//	fans:                  # PWM fans following a temperature curve
+//	  - device: 28-0516b2295cbb
+//	    curve: [{temp: 35, duty: 20}, {temp: 50, duty: 60}, {temp: 60, duty: 100}]
+//	    pwm: {chip: 0, channel: 0, frequency: 25000}
+//	sinks:
+//	  - type: webhook
+//	    url: https://example.com/hook
+//	    secret: s3cr3t
+//	    retries: 3
+//	    readings: true     # post every reading, not only alerts
+//	  - type: mqtt
+//	    url: tcp://localhost:1883
+//	    topic: home/temperature
+//	    client_id: rpionewire-garage
+//	  - type: telegram     # alerts sent by a Telegram bot
+//	    token: 123456:ABC-DEF
+//	    chat_id: "-1001234567890"
+//	  - type: pushover     # alerts sent as Pushover notifications
+//	    token: azGDORePK8gMaC0QOYAMyEEuzJnyUi
+//	    user: uQiRzpo4DXghDmr9QzzfQu27cmVRsG
+//	    priority: 2        # -2 to 2, 2 repeating until acknowledged
+//	    retry: 1m          # emergency repeats, 1m and 1h if omitted
+//	    expire: 1h
+//	server:
+//	  listen: ":9100"
+//	  metrics_path: /metrics
+//	  owserver_listen: ":4304"  # serve the bus to OWFS clients
+//	  dashboard: true      # web dashboard at /dashboard/, charts need history
+//	  stale_after: 2m      # /healthz fails without readings for this long
+//	  expire_after: 1h     # drop devices not read for this long
+//	  auth:                # required on every HTTP endpoint if set
+//	    tokens: [s3cr3t]   # bearer tokens
+//	    users:             # basic authentication, for browsers
+//	      admin: pa55word
+//	  tls:                 # serve HTTPS, agent and collector included
+//	    cert: /etc/rpionewire/server.pem
+//	    key: /etc/rpionewire/server.key
+//	    ca: /etc/rpionewire/clients.pem  # if set, client certificates are required
+//	  cors:                # browser pages of other origins allowed to query
+//	    origins: [https://dash.example.com]
+//	    max_age: 10m
+//	hosts:                # aggregate several buses, the local one if omitted
+//	  - name: cellar
+//	    backend: local
+//	  - name: garage
+//	    backend: owserver
+//	    addr: garage:4304
+//	  - name: attic
+//	    backend: ssh
+//	    addr: attic:22
+//	    user: pi
+//	    key_file: /etc/rpionewire/id_ed25519
+//	cluster:              # agent and collector modes
+//	  collector: http://collector:9200
+//	  token: s3cr3t
+//	  listen: ":9200"
+//	  tls:                # agents pushing to an HTTPS collector
+//	    ca: /etc/rpionewire/ca.pem
+//	    cert: /etc/rpionewire/agent.pem  # for collectors requiring mutual TLS
+//	    key: /etc/rpionewire/agent.key
+//	simulator:            # virtual sensors replacing the bus, for load tests
+//	  sensors: 500
+//	  mean: 20             # °C, swinging by swing over period
+//	  swing: 5
+//	  period: 24h
+//	  noise: 0.1
+//	  latency: 750ms       # conversion time, 0 converting instantly
+//	  faults:              # injected into the reads, see sim.Faults
+//	    crc_rate: 0.01     # probability of a read failing its CRC check
+//	    slow_rate: 0.05    # probability of a read taking slow_delay longer
+//	    slow_delay: 2s
+//	    drop_rate: 0.001   # probability of a device dropping off the bus
+//	    drop_duration: 1m
+//
+// The same keys are used in TOML, sinks being an array of tables.
+// Devices are referred to by their sysfs name.
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+
+	"github.com/fredcarle/rpionewire"
+	"github.com/fredcarle/rpionewire/sim"
+)
+
+// Config is the configuration of an rpionewire application
+type Config struct {
+	Devices Devices           `yaml:"devices" toml:"devices"`
+	Aliases map[string]string `yaml:"aliases,omitempty" toml:"aliases,omitempty"`
+	// Groups are the devices of each group, see rpionewire.Group
+	Groups      map[string][]string    `yaml:"groups,omitempty" toml:"groups,omitempty"`
+	Calibration map[string]Calibration `yaml:"calibration,omitempty" toml:"calibration,omitempty"`
+	Polling     Polling                `yaml:"polling" toml:"polling"`
+	Alerts      []Alert                `yaml:"alerts,omitempty" toml:"alerts,omitempty"`
+	DegreeDays  *DegreeDays            `yaml:"degree_days,omitempty" toml:"degree_days,omitempty"`
+	History     *History               `yaml:"history,omitempty" toml:"history,omitempty"`
+	Thermostats []Thermostat           `yaml:"thermostats,omitempty" toml:"thermostats,omitempty"`
+	Fans        []Fan                  `yaml:"fans,omitempty" toml:"fans,omitempty"`
+	Sinks       []Sink                 `yaml:"sinks,omitempty" toml:"sinks,omitempty"`
+	Server      Server                 `yaml:"server" toml:"server"`
+	// Hosts are the buses aggregated, the local bus alone if empty
+	Hosts   []Host  `yaml:"hosts,omitempty" toml:"hosts,omitempty"`
+	Cluster Cluster `yaml:"cluster" toml:"cluster"`
+	// Simulator replaces the buses with virtual sensors, see sim.Backend
+	Simulator *Simulator `yaml:"simulator,omitempty" toml:"simulator,omitempty"`
+}
+
+// Simulator configures virtual sensors, see sim.Backend
+type Simulator struct {
+	Sensors int      `yaml:"sensors" toml:"sensors"`
+	Mean    *float64 `yaml:"mean,omitempty" toml:"mean,omitempty"`
+	Swing   *float64 `yaml:"swing,omitempty" toml:"swing,omitempty"`
+	Period  Duration `yaml:"period,omitempty" toml:"period,omitempty"`
+	Noise   *float64 `yaml:"noise,omitempty" toml:"noise,omitempty"`
+	Latency Duration `yaml:"latency,omitempty" toml:"latency,omitempty"`
+	Faults  *Faults  `yaml:"faults,omitempty" toml:"faults,omitempty"`
+}
+
+// Faults configures the faults injected into the reads of virtual
+// sensors, see sim.Faults
+type Faults struct {
+	CRCRate      float64  `yaml:"crc_rate,omitempty" toml:"crc_rate,omitempty"`
+	SlowRate     float64  `yaml:"slow_rate,omitempty" toml:"slow_rate,omitempty"`
+	SlowDelay    Duration `yaml:"slow_delay,omitempty" toml:"slow_delay,omitempty"`
+	DropRate     float64  `yaml:"drop_rate,omitempty" toml:"drop_rate,omitempty"`
+	DropDuration Duration `yaml:"drop_duration,omitempty" toml:"drop_duration,omitempty"`
+}
+
+// Backend returns the backend of the virtual sensors, the defaults of
+// sim.NewBackend applying to the values not set, wrapped in sim.Faults
+// when faults are configured
+func (s *Simulator) Backend() rpionewire.Backend {
+	b := sim.NewBackend(s.Sensors)
+	if s.Mean != nil {
+		b.Mean = *s.Mean
+	}
+	if s.Swing != nil {
+		b.Swing = *s.Swing
+	}
+	if s.Period.Duration > 0 {
+		b.Period = s.Period.Duration
+	}
+	if s.Noise != nil {
+		b.Noise = *s.Noise
+	}
+	b.Latency = s.Latency.Duration
+	if f := s.Faults; f != nil {
+		return &sim.Faults{
+			Backend:      b,
+			CRCRate:      f.CRCRate,
+			SlowRate:     f.SlowRate,
+			SlowDelay:    f.SlowDelay.Duration,
+			DropRate:     f.DropRate,
+			DropDuration: f.DropDuration.Duration,
+		}
+	}
+	return b
+}
+
+// Cluster configures the agent and collector modes
+type Cluster struct {
+	// Collector is the URL agents push their readings to
+	Collector string `yaml:"collector,omitempty" toml:"collector,omitempty"`
+	// Token is shared by the agents and the collector
+	Token string `yaml:"token,omitempty" toml:"token,omitempty"`
+	// Host labels the readings of an agent, the hostname if empty
+	Host string `yaml:"host,omitempty" toml:"host,omitempty"`
+	// Listen is the address the collector listens on
+	Listen string `yaml:"listen,omitempty" toml:"listen,omitempty"`
+	// TLS configures the agents connecting to an HTTPS collector
+	TLS *TLS `yaml:"tls,omitempty" toml:"tls,omitempty"`
+}
+
+// Host configures a bus to aggregate
+type Host struct {
+	// Name labels the devices of the host
+	Name string `yaml:"name" toml:"name"`
+	// Backend is how the bus is reached: local, owserver or ssh
+	Backend string `yaml:"backend" toml:"backend"`
+	// Addr is the host:port of the owserver or SSH server
+	Addr string `yaml:"addr,omitempty" toml:"addr,omitempty"`
+	// User, KeyFile and KnownHosts configure ssh hosts, KnownHosts
+	// defaulting to ~/.ssh/known_hosts
+	User       string `yaml:"user,omitempty" toml:"user,omitempty"`
+	KeyFile    string `yaml:"key_file,omitempty" toml:"key_file,omitempty"`
+	KnownHosts string `yaml:"known_hosts,omitempty" toml:"known_hosts,omitempty"`
+}
+
+// Devices configures how devices are discovered and read
+type Devices struct {
+	// Rediscover is how long to wait for a device that dropped off the
+	// bus to reappear, zero disabling rediscovery
+	Rediscover Duration `yaml:"rediscover,omitempty" toml:"rediscover,omitempty"`
+	// Failover is how long to wait for another bus master to find a
+	// device whose master failed, zero disabling failover
+	Failover   Duration `yaml:"failover,omitempty" toml:"failover,omitempty"`
+	CRCRetries int      `yaml:"crc_retries,omitempty" toml:"crc_retries,omitempty"`
+	// Exclude are the devices ignored, see rpionewire.WithExclude
+	Exclude []string `yaml:"exclude,omitempty" toml:"exclude,omitempty"`
+	// Allow are the only devices managed, see rpionewire.WithAllowlist
+	Allow []string `yaml:"allow,omitempty" toml:"allow,omitempty"`
+	// SysfsRoot is where the sysfs tree is mounted, /sys if empty, see
+	// rpionewire.WithSysfsRoot
+	SysfsRoot string `yaml:"sysfs_root,omitempty" toml:"sysfs_root,omitempty"`
+	// Modules makes the bus load the kernel modules, see
+	// rpionewire.WithModuleLoading
+	Modules *Modules `yaml:"modules,omitempty" toml:"modules,omitempty"`
+}
+
+// Modules configures the loading of the kernel modules
+type Modules struct {
+	Masters []string            `yaml:"masters,omitempty" toml:"masters,omitempty"`
+	Params  map[string][]string `yaml:"params,omitempty" toml:"params,omitempty"`
+	Skip    []string            `yaml:"skip,omitempty" toml:"skip,omitempty"`
+	DryRun  bool                `yaml:"dry_run,omitempty" toml:"dry_run,omitempty"`
+}
+
+// Calibration is the correction applied to the temperatures of a device
+type Calibration struct {
+	Offset float64 `yaml:"offset" toml:"offset"`
+	Scale  float64 `yaml:"scale,omitempty" toml:"scale,omitempty"`
+	// SelfHeating is subtracted in proportion to the conversion duty
+	// cycle, see rpionewire.Calibration
+	SelfHeating float64 `yaml:"self_heating,omitempty" toml:"self_heating,omitempty"`
+}
+
+// Polling configures the poller
+type Polling struct {
+	Interval Duration `yaml:"interval" toml:"interval"`
+	// Schedule, if set, replaces Interval with a schedule in the
+	// syntax of rpionewire.ParseSchedule
+	Schedule string `yaml:"schedule,omitempty" toml:"schedule,omitempty"`
+	// Jitter is the maximum random delay added to every cycle
+	Jitter Duration `yaml:"jitter,omitempty" toml:"jitter,omitempty"`
+	// Devices maps devices, or groups, to their own schedule, overriding
+	// Interval and Schedule
+	Devices map[string]string `yaml:"devices,omitempty" toml:"devices,omitempty"`
+	// Priority ranks devices within a cycle, higher first, devices
+	// defaulting to 0
+	Priority map[string]int `yaml:"priority,omitempty" toml:"priority,omitempty"`
+	// DrainTimeout bounds the wait for the poller to drain on shutdown
+	DrainTimeout Duration `yaml:"drain_timeout,omitempty" toml:"drain_timeout,omitempty"`
+	// Aggregates are the aggregations computed for each group: mean,
+	// min, max or median
+	Aggregates map[string][]string `yaml:"aggregates,omitempty" toml:"aggregates,omitempty"`
+	// DeltaT are the temperature differences computed between devices
+	DeltaT []DeltaT `yaml:"delta_t,omitempty" toml:"delta_t,omitempty"`
+	// HeatMeters meter the loops of temperature differences
+	HeatMeters []HeatMeter `yaml:"heat_meters,omitempty" toml:"heat_meters,omitempty"`
+}
+
+// Sink configures a destination of readings and alerts
+type Sink struct {
+	Type     string `yaml:"type" toml:"type"`
+	URL      string `yaml:"url,omitempty" toml:"url,omitempty"`
+	Secret   string `yaml:"secret,omitempty" toml:"secret,omitempty"`
+	Retries  int    `yaml:"retries,omitempty" toml:"retries,omitempty"`
+	Readings bool   `yaml:"readings,omitempty" toml:"readings,omitempty"`
+	// Topic and ClientID configure mqtt sinks, URL being the broker
+	Topic    string `yaml:"topic,omitempty" toml:"topic,omitempty"`
+	ClientID string `yaml:"client_id,omitempty" toml:"client_id,omitempty"`
+	// Token, ChatID, User, Priority, Retry and Expire configure the
+	// telegram and pushover sinks, see notify.Telegram and
+	// notify.Pushover; URL, if set, overrides their API endpoint
+	Token    string   `yaml:"token,omitempty" toml:"token,omitempty"`
+	ChatID   string   `yaml:"chat_id,omitempty" toml:"chat_id,omitempty"`
+	User     string   `yaml:"user,omitempty" toml:"user,omitempty"`
+	Priority int      `yaml:"priority,omitempty" toml:"priority,omitempty"`
+	Retry    Duration `yaml:"retry,omitempty" toml:"retry,omitempty"`
+	Expire   Duration `yaml:"expire,omitempty" toml:"expire,omitempty"`
+	// Path, MaxSize and Rotate configure file sinks: the file written and
+	// the size in bytes and age at which it is rotated
+	Path    string   `yaml:"path,omitempty" toml:"path,omitempty"`
+	MaxSize int64    `yaml:"max_size,omitempty" toml:"max_size,omitempty"`
+	Rotate  Duration `yaml:"rotate,omitempty" toml:"rotate,omitempty"`
+	// Daily rotates file sinks at midnight, Compress gzips the rotated
+	// files and MaxAge removes those older than it
+	Daily    bool     `yaml:"daily,omitempty" toml:"daily,omitempty"`
+	Compress bool     `yaml:"compress,omitempty" toml:"compress,omitempty"`
+	MaxAge   Duration `yaml:"max_age,omitempty" toml:"max_age,omitempty"`
+	// MaxRows caps the readings of a parquet file, Path being the
+	// directory of the files
+	MaxRows int `yaml:"max_rows,omitempty" toml:"max_rows,omitempty"`
+}
+
+// DeltaT configures a temperature difference between two devices, see
+// rpionewire.DeltaT
+type DeltaT struct {
+	Name string `yaml:"name" toml:"name"`
+	Hot  string `yaml:"hot" toml:"hot"`
+	Cold string `yaml:"cold" toml:"cold"`
+	// Low and High, if set, are alert thresholds of the difference
+	Low  *float64 `yaml:"low,omitempty" toml:"low,omitempty"`
+	High *float64 `yaml:"high,omitempty" toml:"high,omitempty"`
+	// For is how long a threshold must be crossed before alerting
+	For Duration `yaml:"for,omitempty" toml:"for,omitempty"`
+}
+
+// Alert configures an alert rule on a device or on every device of a
+// group, see rpionewire.AlertRule
+type Alert struct {
+	Name string `yaml:"name" toml:"name"`
+	// Device is the name of the device, or its alias
+	Device string `yaml:"device,omitempty" toml:"device,omitempty"`
+	Group  string `yaml:"group,omitempty" toml:"group,omitempty"`
+	// Condition is above, below or outside
+	Condition string `yaml:"condition" toml:"condition"`
+	// Low is required below and outside, High above and outside
+	Low  *float64 `yaml:"low,omitempty" toml:"low,omitempty"`
+	High *float64 `yaml:"high,omitempty" toml:"high,omitempty"`
+	For  Duration `yaml:"for,omitempty" toml:"for,omitempty"`
+	// Hysteresis and ClearFor delay the clearing of a firing alert
+	Hysteresis float64  `yaml:"hysteresis,omitempty" toml:"hysteresis,omitempty"`
+	ClearFor   Duration `yaml:"clear_for,omitempty" toml:"clear_for,omitempty"`
+}
+
+// HeatMeter configures the metering of a fluid loop, see
+// rpionewire.HeatMeter
+type HeatMeter struct {
+	// DeltaT is the name of the temperature difference of the loop
+	DeltaT string `yaml:"delta_t" toml:"delta_t"`
+	// Flow is the flow rate of the loop in litres per minute
+	Flow         float64 `yaml:"flow" toml:"flow"`
+	SpecificHeat float64 `yaml:"specific_heat,omitempty" toml:"specific_heat,omitempty"`
+	Density      float64 `yaml:"density,omitempty" toml:"density,omitempty"`
+}
+
+// DegreeDays configures the accumulation of degree-days, see
+// rpionewire.DegreeDays
+type DegreeDays struct {
+	// Base is the base temperature in °C
+	Base float64 `yaml:"base" toml:"base"`
+	// Path is the file persisting the counters across restarts
+	Path string `yaml:"path,omitempty" toml:"path,omitempty"`
+}
+
+// History configures the history kept by the server, see history.Store
+type History struct {
+	// Path is the file persisting the history across restarts
+	Path string `yaml:"path,omitempty" toml:"path,omitempty"`
+	// Tiers are the resolutions kept, history.DefaultTiers if empty
+	Tiers []HistoryTier `yaml:"tiers,omitempty" toml:"tiers,omitempty"`
+}
+
+// HistoryTier configures a tier of the history, see history.Tier
+type HistoryTier struct {
+	Resolution Duration `yaml:"resolution" toml:"resolution"`
+	Retention  Duration `yaml:"retention" toml:"retention"`
+}
+
+// Thermostat configures a thermostat, see rpionewire.Thermostat
+type Thermostat struct {
+	// Device is a device, by sysfs name, or a derived reading such as a
+	// zone aggregate
+	Device     string   `yaml:"device" toml:"device"`
+	Setpoint   float64  `yaml:"setpoint" toml:"setpoint"`
+	Hysteresis float64  `yaml:"hysteresis,omitempty" toml:"hysteresis,omitempty"`
+	Mode       string   `yaml:"mode,omitempty" toml:"mode,omitempty"`
+	MinCycle   Duration `yaml:"min_cycle,omitempty" toml:"min_cycle,omitempty"`
+	GPIO       GPIO     `yaml:"gpio" toml:"gpio"`
+}
+
+// GPIO identifies a GPIO line, see gpio.Config
+type GPIO struct {
+	Chip      string `yaml:"chip" toml:"chip"`
+	Line      int    `yaml:"line" toml:"line"`
+	ActiveLow bool   `yaml:"active_low,omitempty" toml:"active_low,omitempty"`
+}
+
+// Fan configures a PWM fan, see rpionewire.Fan
+type Fan struct {
+	Device string       `yaml:"device" toml:"device"`
+	Curve  []CurvePoint `yaml:"curve" toml:"curve"`
+	PWM    PWM          `yaml:"pwm" toml:"pwm"`
+}
+
+// CurvePoint maps a temperature to a duty cycle in percent
+type CurvePoint struct {
+	Temp float64 `yaml:"temp" toml:"temp"`
+	Duty float64 `yaml:"duty" toml:"duty"`
+}
+
+// PWM identifies a hardware PWM channel, see gpio.OpenPWM
+type PWM struct {
+	Chip    int `yaml:"chip" toml:"chip"`
+	Channel int `yaml:"channel" toml:"channel"`
+	// Frequency is in Hz, 25 kHz if zero
+	Frequency float64 `yaml:"frequency,omitempty" toml:"frequency,omitempty"`
+}
+
+// Server configures the network servers
+type Server struct {
+	Listen      string `yaml:"listen,omitempty" toml:"listen,omitempty"`
+	MetricsPath string `yaml:"metrics_path,omitempty" toml:"metrics_path,omitempty"`
+	// OWServerListen, if set, is the address serving the bus over the
+	// owserver protocol
+	OWServerListen string `yaml:"owserver_listen,omitempty" toml:"owserver_listen,omitempty"`
+	// Dashboard serves a web dashboard at /dashboard/
+	Dashboard bool `yaml:"dashboard,omitempty" toml:"dashboard,omitempty"`
+	// Auth, if set, protects the HTTP servers, see server.Auth
+	Auth *Auth `yaml:"auth,omitempty" toml:"auth,omitempty"`
+	// TLS, if set, makes the HTTP servers serve TLS, see server.TLS
+	TLS *TLS `yaml:"tls,omitempty" toml:"tls,omitempty"`
+	// CORS lets the pages of other origins query the HTTP servers, see
+	// server.CORS
+	CORS *CORS `yaml:"cors,omitempty" toml:"cors,omitempty"`
+	// StaleAfter is how long without readings fails /healthz, 3 polling
+	// intervals if zero and not polling on a schedule
+	StaleAfter Duration `yaml:"stale_after,omitempty" toml:"stale_after,omitempty"`
+	// ExpireAfter is how long the reading of a device no longer read,
+	// such as an unplugged sensor, is served, 10 polling intervals if
+	// zero and no schedule is set
+	ExpireAfter Duration `yaml:"expire_after,omitempty" toml:"expire_after,omitempty"`
+}
+
+// CORS configures the origins allowed to query the HTTP servers
+type CORS struct {
+	// Origins are the origins allowed, "*" allowing any
+	Origins []string `yaml:"origins" toml:"origins"`
+	// MaxAge is how long browsers cache preflight answers
+	MaxAge Duration `yaml:"max_age,omitempty" toml:"max_age,omitempty"`
+}
+
+// TLS configures the certificates of a TLS server or client, as PEM
+// files
+type TLS struct {
+	// Cert and Key are the certificate and key of the server, or those
+	// of the client for mutual TLS
+	Cert string `yaml:"cert,omitempty" toml:"cert,omitempty"`
+	Key  string `yaml:"key,omitempty" toml:"key,omitempty"`
+	// CA holds the CA certificates trusted: those of the client
+	// certificates required by a server, those of the server for a
+	// client
+	CA string `yaml:"ca,omitempty" toml:"ca,omitempty"`
+}
+
+// Auth configures the credentials accepted by the HTTP servers
+type Auth struct {
+	// Tokens are the bearer tokens accepted
+	Tokens []string `yaml:"tokens,omitempty" toml:"tokens,omitempty"`
+	// Users are the basic authentication passwords, by user name
+	Users map[string]string `yaml:"users,omitempty" toml:"users,omitempty"`
+}
+
+// Duration is a time.Duration written as a string such as "30s"
+type Duration struct {
+	time.Duration
+}
+
+// UnmarshalText parses a duration such as "1m30s"
+func (d *Duration) UnmarshalText(b []byte) error {
+	v, err := time.ParseDuration(string(b))
+	if err != nil {
+		return err
+	}
+	d.Duration = v
+	return nil
+}
+
+// MarshalText formats the duration like time.Duration.String
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(d.Duration.String()), nil
+}
+
+// Default returns the configuration used when no file is given
+func Default() *Config {
+	return &Config{
+		Polling: Polling{Interval: Duration{30 * time.Second}},
+		Server:  Server{Listen: ":9100", MetricsPath: "/metrics"},
+		Cluster: Cluster{Listen: ":9200"},
+	}
+}
+
+// KeyError is a configuration error at a given key, such as
+// "sinks[0].url"
+type KeyError struct {
+	Key string
+	Msg string
+}
+
+func (e *KeyError) Error() string {
+	return e.Key + ": " + e.Msg
+}
+
+// Load reads the configuration file at path, its format being chosen by
+// its extension: .yaml, .yml or .toml. Keys missing from the file keep
+// the values of Default.
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	format, err := formatOf(path)
+	if err != nil {
+		return nil, err
+	}
+	c, err := Parse(data, format)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %w", path, err)
+	}
+	return c, nil
+}
+
+// Parse decodes and validates a configuration in format "yaml" or
+// "toml". Unknown keys are reported as errors.
+func Parse(data []byte, format string) (*Config, error) {
+	c := Default()
+	switch format {
+	case "yaml":
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		if err := dec.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+			return nil, err
+		}
+	case "toml":
+		md, err := toml.Decode(string(data), c)
+		if err != nil {
+			return nil, err
+		}
+		if undecoded := md.Undecoded(); len(undecoded) > 0 {
+			errs := make([]error, len(undecoded))
+			for i, k := range undecoded {
+				errs[i] = &KeyError{Key: k.String(), Msg: "unknown key"}
+			}
+			return nil, errors.Join(errs...)
+		}
+	default:
+		return nil, fmt.Errorf("unknown configuration format %q", format)
+	}
+
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Save writes the configuration to path in the format given by its
+// extension, replacing the file atomically. The file keeps its mode,
+// 0600 for a new file since configurations hold secrets. Save encodes
+// c afresh: the comments and layout of the existing file are lost.
+func (c *Config) Save(path string) error {
+	format, err := formatOf(path)
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	switch format {
+	case "yaml":
+		enc := yaml.NewEncoder(&buf)
+		enc.SetIndent(2)
+		err = enc.Encode(c)
+	case "toml":
+		err = toml.NewEncoder(&buf).Encode(c)
+	}
+	if err != nil {
+		return err
+	}
+
+	mode := os.FileMode(0600)
+	if fi, err := os.Stat(path); err == nil {
+		mode = fi.Mode().Perm()
+	}
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	// the umask applies to OpenFile, not to Chmod
+	if err := f.Chmod(mode); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if _, err := f.Write(buf.Bytes()); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func formatOf(path string) (string, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return "yaml", nil
+	case ".toml":
+		return "toml", nil
+	}
+	return "", fmt.Errorf("%v: unknown configuration format, expected .yaml, .yml or .toml", path)
+}
+
+var deviceName = regexp.MustCompile(`^[0-9a-f]{2}-[0-9a-f]{12}$`)
+
+// hostBackends are the supported values of Host.Backend
+var hostBackends = []string{"local", "owserver", "ssh"}
+
+// sinkTypes are the supported values of Sink.Type
+var sinkTypes = []string{"webhook", "mqtt", "telegram", "pushover", "jsonl", "csv", "parquet"}
+
+// fileSinkTypes are the sink types writing to a file instead of a URL
+var fileSinkTypes = []string{"jsonl", "csv", "parquet"}
+
+// pushSinkTypes are the sink types sending alerts to a push service,
+// whose endpoint needs no URL
+var pushSinkTypes = []string{"telegram", "pushover"}
+
+// Validate checks the configuration, returning a KeyError for every
+// invalid value
+func (c *Config) Validate() error {
+	var errs []error
+	fail := func(key, format string, args ...interface{}) {
+		errs = append(errs, &KeyError{Key: key, Msg: fmt.Sprintf(format, args...)})
+	}
+
+	if c.Devices.Rediscover.Duration < 0 {
+		fail("devices.rediscover", "must not be negative")
+	}
+	if s := c.Simulator; s != nil {
+		if s.Sensors <= 0 {
+			fail("simulator.sensors", "must be positive")
+		}
+		if s.Noise != nil && *s.Noise < 0 {
+			fail("simulator.noise", "must not be negative")
+		}
+		if s.Period.Duration < 0 {
+			fail("simulator.period", "must not be negative")
+		}
+		if s.Latency.Duration < 0 {
+			fail("simulator.latency", "must not be negative")
+		}
+		if f := s.Faults; f != nil {
+			for _, r := range []struct {
+				key  string
+				rate float64
+			}{{"crc_rate", f.CRCRate}, {"slow_rate", f.SlowRate}, {"drop_rate", f.DropRate}} {
+				if r.rate < 0 || r.rate > 1 {
+					fail("simulator.faults."+r.key, "must be between 0 and 1")
+				}
+			}
+			if f.SlowDelay.Duration < 0 {
+				fail("simulator.faults.slow_delay", "must not be negative")
+			}
+			if f.DropDuration.Duration < 0 {
+				fail("simulator.faults.drop_duration", "must not be negative")
+			}
+		}
+	}
+	if c.Devices.Failover.Duration < 0 {
+		fail("devices.failover", "must not be negative")
+	}
+	if c.Devices.CRCRetries < 0 {
+		fail("devices.crc_retries", "must not be negative")
+	}
+	for i, name := range c.Devices.Exclude {
+		if !deviceName.MatchString(name) {
+			fail(fmt.Sprintf("devices.exclude[%d]", i), "%q is not a device name like 28-0316a2794bff", name)
+		}
+	}
+	for i, name := range c.Devices.Allow {
+		if !deviceName.MatchString(name) {
+			fail(fmt.Sprintf("devices.allow[%d]", i), "%q is not a device name like 28-0316a2794bff", name)
+		}
+	}
+	if m := c.Devices.Modules; m != nil {
+		for i, name := range m.Masters {
+			if !knownModule(name) {
+				fail(fmt.Sprintf("devices.modules.masters[%d]", i), "unknown module %q, expected one of %v", name, strings.Join(rpionewire.KernelModules(), ", "))
+			}
+		}
+		for name := range m.Params {
+			if !knownModule(name) {
+				fail("devices.modules.params."+name, "unknown module, expected one of %v", strings.Join(rpionewire.KernelModules(), ", "))
+			}
+		}
+		for i, name := range m.Skip {
+			if !knownModule(name) {
+				fail(fmt.Sprintf("devices.modules.skip[%d]", i), "unknown module %q, expected one of %v", name, strings.Join(rpionewire.KernelModules(), ", "))
+			}
+		}
+	}
+	for name, alias := range c.Aliases {
+		if !deviceName.MatchString(name) {
+			fail("aliases."+name, "not a device name like 28-0316a2794bff")
+		}
+		if alias == "" {
+			fail("aliases."+name, "alias must not be empty")
+		}
+	}
+	for group, names := range c.Groups {
+		if group == "" {
+			fail("groups", "group name must not be empty")
+		}
+		for i, name := range names {
+			if !deviceName.MatchString(name) {
+				fail(fmt.Sprintf("groups.%v[%d]", group, i), "%q is not a device name like 28-0316a2794bff", name)
+			}
+		}
+	}
+	for name, cal := range c.Calibration {
+		if !deviceName.MatchString(name) {
+			fail("calibration."+name, "not a device name like 28-0316a2794bff")
+		}
+		if cal.Scale < 0 {
+			fail("calibration."+name+".scale", "must not be negative")
+		}
+		if cal.SelfHeating < 0 {
+			fail("calibration."+name+".self_heating", "must not be negative")
+		}
+	}
+	if c.Polling.Interval.Duration <= 0 {
+		fail("polling.interval", "must be positive")
+	}
+	if c.Polling.DrainTimeout.Duration < 0 {
+		fail("polling.drain_timeout", "must not be negative")
+	}
+	if c.Polling.Jitter.Duration < 0 {
+		fail("polling.jitter", "must not be negative")
+	}
+	if c.Polling.Schedule != "" {
+		if _, err := rpionewire.ParseSchedule(c.Polling.Schedule); err != nil {
+			fail("polling.schedule", "%v", err)
+		}
+	}
+	for name, sched := range c.Polling.Devices {
+		if _, ok := c.Groups[name]; !ok && !deviceName.MatchString(name) {
+			fail("polling.devices."+name, "neither a group nor a device name like 28-0316a2794bff")
+		}
+		if _, err := rpionewire.ParseSchedule(sched); err != nil {
+			fail("polling.devices."+name, "%v", err)
+		}
+	}
+	for name := range c.Polling.Priority {
+		if !deviceName.MatchString(name) {
+			fail("polling.priority."+name, "not a device name like 28-0316a2794bff")
+		}
+	}
+	for group, fns := range c.Polling.Aggregates {
+		if _, ok := c.Groups[group]; !ok {
+			fail("polling.aggregates."+group, "unknown group")
+		}
+		for i, fn := range fns {
+			if _, err := rpionewire.ParseAggregation(fn); err != nil {
+				fail(fmt.Sprintf("polling.aggregates.%v[%d]", group, i), "%v", err)
+			}
+		}
+	}
+	for i, dt := range c.Polling.DeltaT {
+		key := fmt.Sprintf("polling.delta_t[%d]", i)
+		if dt.Name == "" {
+			fail(key+".name", "required")
+		}
+		if !deviceName.MatchString(dt.Hot) {
+			fail(key+".hot", "%q is not a device name like 28-0316a2794bff", dt.Hot)
+		}
+		if !deviceName.MatchString(dt.Cold) {
+			fail(key+".cold", "%q is not a device name like 28-0316a2794bff", dt.Cold)
+		}
+		if dt.Low != nil && dt.High != nil && *dt.Low > *dt.High {
+			fail(key, "low above high")
+		}
+	}
+	for i, h := range c.Polling.HeatMeters {
+		key := fmt.Sprintf("polling.heat_meters[%d]", i)
+		found := false
+		for _, dt := range c.Polling.DeltaT {
+			found = found || dt.Name == h.DeltaT
+		}
+		if !found {
+			fail(key+".delta_t", "unknown delta_t %q", h.DeltaT)
+		}
+		if h.Flow < 0 {
+			fail(key+".flow", "must not be negative")
+		}
+		if h.SpecificHeat < 0 {
+			fail(key+".specific_heat", "must not be negative")
+		}
+		if h.Density < 0 {
+			fail(key+".density", "must not be negative")
+		}
+	}
+	aliases := map[string]bool{}
+	for _, alias := range c.Aliases {
+		aliases[alias] = true
+	}
+	alerts := map[string]bool{}
+	for i, a := range c.Alerts {
+		key := fmt.Sprintf("alerts[%d]", i)
+		if a.Name == "" {
+			fail(key+".name", "required")
+		} else if alerts[a.Name] {
+			fail(key+".name", "duplicate alert %q", a.Name)
+		}
+		alerts[a.Name] = true
+		switch {
+		case (a.Device == "") == (a.Group == ""):
+			fail(key, "either device or group is required")
+		case a.Device != "" && !deviceName.MatchString(a.Device) && !aliases[a.Device]:
+			fail(key+".device", "%q is neither a device name like 28-0316a2794bff nor an alias", a.Device)
+		case a.Group != "":
+			if _, ok := c.Groups[a.Group]; !ok {
+				fail(key+".group", "unknown group %q", a.Group)
+			}
+		}
+		cond, err := rpionewire.ParseCondition(a.Condition)
+		if err != nil {
+			fail(key+".condition", "%v", err)
+		}
+		if a.Low == nil && err == nil && cond != rpionewire.Above {
+			fail(key+".low", "required for %v alerts", cond)
+		}
+		if a.High == nil && err == nil && cond != rpionewire.Below {
+			fail(key+".high", "required for %v alerts", cond)
+		}
+		if a.Low != nil && a.High != nil && *a.Low > *a.High {
+			fail(key, "low above high")
+		}
+		if a.For.Duration < 0 {
+			fail(key+".for", "must not be negative")
+		}
+		if a.Hysteresis < 0 {
+			fail(key+".hysteresis", "must not be negative")
+		}
+		if a.ClearFor.Duration < 0 {
+			fail(key+".clear_for", "must not be negative")
+		}
+	}
+	if h := c.History; h != nil {
+		for i, t := range h.Tiers {
+			key := fmt.Sprintf("history.tiers[%d]", i)
+			if t.Resolution.Duration < 0 {
+				fail(key+".resolution", "must not be negative")
+			}
+			if t.Retention.Duration <= 0 {
+				fail(key+".retention", "must be positive")
+			}
+			if i > 0 && t.Resolution.Duration <= h.Tiers[i-1].Resolution.Duration {
+				fail(key+".resolution", "must be coarser than the tier before")
+			}
+		}
+	}
+	for i, t := range c.Thermostats {
+		key := fmt.Sprintf("thermostats[%d]", i)
+		if t.Device == "" {
+			fail(key+".device", "required")
+		}
+		if t.Hysteresis < 0 {
+			fail(key+".hysteresis", "must not be negative")
+		}
+		if t.Mode != "" && t.Mode != "heating" && t.Mode != "cooling" {
+			fail(key+".mode", "unknown mode %q, expected heating or cooling", t.Mode)
+		}
+		if t.GPIO.Chip == "" {
+			fail(key+".gpio.chip", "required")
+		}
+		if t.GPIO.Line < 0 {
+			fail(key+".gpio.line", "must not be negative")
+		}
+	}
+	for i, f := range c.Fans {
+		key := fmt.Sprintf("fans[%d]", i)
+		if f.Device == "" {
+			fail(key+".device", "required")
+		}
+		if len(f.Curve) == 0 {
+			fail(key+".curve", "required")
+		}
+		for j, p := range f.Curve {
+			if p.Duty < 0 || p.Duty > 100 {
+				fail(fmt.Sprintf("%v.curve[%d].duty", key, j), "must be between 0 and 100")
+			}
+		}
+		if f.PWM.Frequency < 0 {
+			fail(key+".pwm.frequency", "must not be negative")
+		}
+	}
+	if t := c.Server.TLS; t != nil {
+		if t.Cert == "" {
+			fail("server.tls.cert", "required")
+		}
+		if t.Key == "" {
+			fail("server.tls.key", "required")
+		}
+	}
+	if t := c.Cluster.TLS; t != nil && (t.Cert == "") != (t.Key == "") {
+		fail("cluster.tls", "cert and key go together")
+	}
+	if c.Server.StaleAfter.Duration < 0 {
+		fail("server.stale_after", "must not be negative")
+	}
+	if c.Server.ExpireAfter.Duration < 0 {
+		fail("server.expire_after", "must not be negative")
+	}
+	if cors := c.Server.CORS; cors != nil {
+		for i, o := range cors.Origins {
+			if o != "*" && !strings.HasPrefix(o, "http://") && !strings.HasPrefix(o, "https://") {
+				fail(fmt.Sprintf("server.cors.origins[%d]", i), "expected * or an http or https origin, got %q", o)
+			}
+		}
+		if cors.MaxAge.Duration < 0 {
+			fail("server.cors.max_age", "must not be negative")
+		}
+	}
+	if auth := c.Server.Auth; auth != nil {
+		for i, t := range auth.Tokens {
+			if t == "" {
+				fail(fmt.Sprintf("server.auth.tokens[%d]", i), "must not be empty")
+			}
+		}
+		for user, password := range auth.Users {
+			if password == "" {
+				fail("server.auth.users."+user, "must not be empty")
+			}
+		}
+	}
+	for i, s := range c.Sinks {
+		key := fmt.Sprintf("sinks[%d]", i)
+		if !contains(sinkTypes, s.Type) {
+			fail(key+".type", "unknown sink type %q, expected one of %v", s.Type, strings.Join(sinkTypes, ", "))
+		}
+		if contains(fileSinkTypes, s.Type) {
+			if s.Path == "" {
+				fail(key+".path", "required for %v sinks", s.Type)
+			}
+			if s.MaxSize < 0 {
+				fail(key+".max_size", "must not be negative")
+			}
+			if s.Rotate.Duration < 0 {
+				fail(key+".rotate", "must not be negative")
+			}
+			if s.MaxAge.Duration < 0 {
+				fail(key+".max_age", "must not be negative")
+			}
+			if s.MaxRows < 0 {
+				fail(key+".max_rows", "must not be negative")
+			}
+		} else if s.URL == "" && !contains(pushSinkTypes, s.Type) {
+			fail(key+".url", "required for %v sinks", s.Type)
+		}
+		if contains(pushSinkTypes, s.Type) && s.Token == "" {
+			fail(key+".token", "required for %v sinks", s.Type)
+		}
+		if s.Type == "telegram" && s.ChatID == "" {
+			fail(key+".chat_id", "required for telegram sinks")
+		}
+		if s.Type == "pushover" {
+			if s.User == "" {
+				fail(key+".user", "required for pushover sinks")
+			}
+			if s.Priority < -2 || s.Priority > 2 {
+				fail(key+".priority", "must be between -2 and 2")
+			}
+			retry, expire := s.Retry.Duration, s.Expire.Duration
+			if retry == 0 {
+				retry = time.Minute
+			}
+			if expire == 0 {
+				expire = time.Hour
+			}
+			if retry < 30*time.Second {
+				fail(key+".retry", "must be at least 30s")
+			}
+			if expire < retry || expire > 3*time.Hour {
+				fail(key+".expire", "must be between the retry and 3h")
+			}
+		}
+		if s.Retries < 0 {
+			fail(key+".retries", "must not be negative")
+		}
+	}
+
+	names := map[string]bool{}
+	for i, h := range c.Hosts {
+		key := fmt.Sprintf("hosts[%d]", i)
+		if h.Name == "" {
+			fail(key+".name", "required")
+		} else if names[h.Name] {
+			fail(key+".name", "duplicate host %q", h.Name)
+		}
+		names[h.Name] = true
+		if !contains(hostBackends, h.Backend) {
+			fail(key+".backend", "unknown backend %q, expected one of %v", h.Backend, strings.Join(hostBackends, ", "))
+		}
+		if h.Backend != "local" && h.Addr == "" {
+			fail(key+".addr", "required for %v hosts", h.Backend)
+		}
+		if h.Backend == "ssh" && (h.User == "" || h.KeyFile == "") {
+			fail(key, "user and key_file are required for ssh hosts")
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// knownModule tells whether name is a kernel module the bus loads
+func knownModule(name string) bool {
+	for _, m := range rpionewire.KernelModules() {
+		if m == name {
+			return true
+		}
+	}
+	return false
+}
+
+// BusOptions returns the options configuring a rpionewire.Bus
+func (c *Config) BusOptions() []rpionewire.Option {
+	var opts []rpionewire.Option
+	if c.Devices.Rediscover.Duration > 0 {
+		opts = append(opts, rpionewire.WithRediscovery(c.Devices.Rediscover.Duration))
+	}
+	if c.Devices.Failover.Duration > 0 {
+		opts = append(opts, rpionewire.WithMasterFailover(c.Devices.Failover.Duration))
+	}
+	if c.Devices.CRCRetries > 0 {
+		opts = append(opts, rpionewire.WithCRCRetries(c.Devices.CRCRetries))
+	}
+	if len(c.Devices.Exclude) > 0 {
+		opts = append(opts, rpionewire.WithExclude(c.Devices.Exclude...))
+	}
+	if len(c.Devices.Allow) > 0 {
+		opts = append(opts, rpionewire.WithAllowlist(c.Devices.Allow...))
+	}
+	if c.Devices.SysfsRoot != "" {
+		opts = append(opts, rpionewire.WithSysfsRoot(c.Devices.SysfsRoot))
+	}
+	if c.Simulator != nil {
+		opts = append(opts, rpionewire.WithBackend(c.Simulator.Backend()))
+	}
+	if m := c.Devices.Modules; m != nil {
+		opts = append(opts, rpionewire.WithModuleLoading(rpionewire.ModuleLoader{Masters: m.Masters, Params: m.Params, Skip: m.Skip, DryRun: m.DryRun}))
+	}
+	return opts
+}
+
+// PollerOptions returns the options configuring a rpionewire.Poller
+func (c *Config) PollerOptions() []rpionewire.PollerOption {
+	var opts []rpionewire.PollerOption
+	if c.Polling.Schedule != "" {
+		if s, err := rpionewire.ParseSchedule(c.Polling.Schedule); err == nil {
+			opts = append(opts, rpionewire.WithSchedule(s))
+		}
+	}
+	for name, sched := range c.Polling.Devices {
+		if s, err := rpionewire.ParseSchedule(sched); err == nil {
+			opts = append(opts, rpionewire.WithDeviceSchedule(name, s))
+		}
+	}
+	for name, prio := range c.Polling.Priority {
+		opts = append(opts, rpionewire.WithPriority(name, prio))
+	}
+	if c.Polling.DrainTimeout.Duration > 0 {
+		opts = append(opts, rpionewire.WithDrainTimeout(c.Polling.DrainTimeout.Duration))
+	}
+	for group, names := range c.Polling.Aggregates {
+		var fns []rpionewire.Aggregation
+		for _, name := range names {
+			if fn, err := rpionewire.ParseAggregation(name); err == nil {
+				fns = append(fns, fn)
+			}
+		}
+		opts = append(opts, rpionewire.WithZoneAggregates(group, fns...))
+	}
+	for _, dt := range c.Polling.DeltaT {
+		opts = append(opts, rpionewire.WithDeltaT(rpionewire.DeltaT{Name: dt.Name, Hot: dt.Hot, Cold: dt.Cold}))
+	}
+	for _, h := range c.Polling.HeatMeters {
+		meter := &rpionewire.HeatMeter{DeltaT: h.DeltaT, SpecificHeat: h.SpecificHeat, Density: h.Density}
+		meter.SetFlow(h.Flow)
+		opts = append(opts, rpionewire.WithHeatMeter(meter))
+	}
+	if c.Polling.Jitter.Duration > 0 {
+		opts = append(opts, rpionewire.WithJitter(c.Polling.Jitter.Duration))
+	}
+	return opts
+}
+
+// AlertRules returns the alert rules of the configuration, those of the
+// alerts and of the thresholds of the temperature differences
+func (c *Config) AlertRules() []rpionewire.AlertRule {
+	var rules []rpionewire.AlertRule
+	for _, a := range c.Alerts {
+		cond, err := rpionewire.ParseCondition(a.Condition)
+		if err != nil {
+			continue
+		}
+		rule := rpionewire.AlertRule{Name: a.Name, Device: a.Device, Group: a.Group, Condition: cond, For: a.For.Duration, Hysteresis: a.Hysteresis, ClearFor: a.ClearFor.Duration}
+		if a.Low != nil {
+			rule.Low = *a.Low
+		}
+		if a.High != nil {
+			rule.High = *a.High
+		}
+		rules = append(rules, rule)
+	}
+	for _, dt := range c.Polling.DeltaT {
+		rule := rpionewire.AlertRule{Name: dt.Name, Device: dt.Name, For: dt.For.Duration}
+		switch {
+		case dt.Low != nil && dt.High != nil:
+			rule.Condition, rule.Low, rule.High = rpionewire.Outside, *dt.Low, *dt.High
+		case dt.Low != nil:
+			rule.Condition, rule.Low = rpionewire.Below, *dt.Low
+		case dt.High != nil:
+			rule.Condition, rule.High = rpionewire.Above, *dt.High
+		default:
+			continue
+		}
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+// Apply sets the alias, groups and calibration of the configured
+// devices
+func (c *Config) Apply(devices []*rpionewire.DS1820) {
+	groups := map[string][]string{}
+	for group, names := range c.Groups {
+		for _, name := range names {
+			groups[name] = append(groups[name], group)
+		}
+	}
+	for _, d := range devices {
+		if g, ok := groups[d.Name]; ok {
+			sort.Strings(g)
+			d.Groups = g
+		}
+		if alias, ok := c.Aliases[d.Name]; ok {
+			d.Alias = alias
+		}
+		if cal, ok := c.Calibration[d.Name]; ok {
+			d.Calibration = rpionewire.Calibration{Offset: cal.Offset, Scale: cal.Scale, SelfHeating: cal.SelfHeating}
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package config
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/fredcarle/rpionewire"
+)
+
+// keyErrors returns the keys of the KeyErrors joined in err
+func keyErrors(err error) []string {
+	var keys []string
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		for _, e := range joined.Unwrap() {
+			keys = append(keys, keyErrors(e)...)
+		}
+		return keys
+	}
+	var ke *KeyError
+	if errors.As(err, &ke) {
+		keys = append(keys, ke.Key)
+	}
+	return keys
+}
+
+func TestValidatePollingDevices(t *testing.T) {
+	tests := []struct {
+		name    string
+		yaml    string
+		invalid []string
+	}{
+		{"device", "polling:\n  devices:\n    28-0316a2794bff: 5s\n", nil},
+		{"group", "groups:\n  garden: [28-0316a2794bff]\npolling:\n  devices:\n    garden: 10m\n", nil},
+		{"unknown group", "polling:\n  devices:\n    garden: 10m\n", []string{"polling.devices.garden"}},
+		{"invalid schedule", "polling:\n  devices:\n    28-0316a2794bff: often\n", []string{"polling.devices.28-0316a2794bff"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse([]byte(tt.yaml), "yaml")
+			keys := keyErrors(err)
+			if len(keys) != len(tt.invalid) {
+				t.Fatalf("got errors %v, want keys %v", err, tt.invalid)
+			}
+			for i, k := range keys {
+				if k != tt.invalid[i] {
+					t.Errorf("got key %v, want %v", k, tt.invalid[i])
+				}
+			}
+		})
+	}
+}
+
+func TestEnvModules(t *testing.T) {
+	tests := []struct {
+		name    string
+		environ []string
+		load    bool
+	}{
+		{"default", nil, false},
+		{"load", []string{"RPIONEWIRE_DEVICES_MODULES_LOAD=true"}, true},
+		{"masters", []string{"RPIONEWIRE_DEVICES_MODULES_MASTERS=ds2490"}, true},
+		{"not loaded", []string{"RPIONEWIRE_DEVICES_MODULES_LOAD=false"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := Default()
+			if err := c.applyEnv(tt.environ); err != nil {
+				t.Fatal(err)
+			}
+			if load := c.Devices.Modules != nil; load != tt.load {
+				t.Errorf("got module loading %v, want %v", load, tt.load)
+			}
+		})
+	}
+}
+
+func TestValidateAlerts(t *testing.T) {
+	tests := []struct {
+		name    string
+		yaml    string
+		invalid []string
+	}{
+		{"above", "alerts:\n  - {name: warm, device: 28-0316a2794bff, condition: above, high: 25}\n", nil},
+		{"group outside", "groups:\n  garden: [28-0316a2794bff]\nalerts:\n  - {name: garden, group: garden, condition: outside, low: 2, high: 30, for: 5m}\n", nil},
+		{"missing name", "alerts:\n  - {device: 28-0316a2794bff, condition: below, low: 2}\n", []string{"alerts[0].name"}},
+		{"duplicate name", "alerts:\n  - {name: a, device: 28-0316a2794bff, condition: below, low: 2}\n  - {name: a, device: 28-0416a1184baa, condition: below, low: 2}\n", []string{"alerts[1].name"}},
+		{"device and group", "groups:\n  garden: [28-0316a2794bff]\nalerts:\n  - {name: a, device: 28-0316a2794bff, group: garden, condition: below, low: 2}\n", []string{"alerts[0]"}},
+		{"no device", "alerts:\n  - {name: a, condition: below, low: 2}\n", []string{"alerts[0]"}},
+		{"invalid device", "alerts:\n  - {name: a, device: freezer, condition: below, low: 2}\n", []string{"alerts[0].device"}},
+		{"alias", "aliases:\n  28-0316a2794bff: freezer\nalerts:\n  - {name: a, device: freezer, condition: below, low: 2}\n", nil},
+		{"unknown group", "alerts:\n  - {name: a, group: garden, condition: below, low: 2}\n", []string{"alerts[0].group"}},
+		{"unknown condition", "alerts:\n  - {name: a, device: 28-0316a2794bff, condition: over, high: 2}\n", []string{"alerts[0].condition"}},
+		{"missing low", "alerts:\n  - {name: a, device: 28-0316a2794bff, condition: below, high: 2}\n", []string{"alerts[0].low"}},
+		{"missing thresholds", "alerts:\n  - {name: a, device: 28-0316a2794bff, condition: outside}\n", []string{"alerts[0].low", "alerts[0].high"}},
+		{"low above high", "alerts:\n  - {name: a, device: 28-0316a2794bff, condition: outside, low: 5, high: 2}\n", []string{"alerts[0]"}},
+		{"negative for", "alerts:\n  - {name: a, device: 28-0316a2794bff, condition: above, high: 2, for: -1s}\n", []string{"alerts[0].for"}},
+		{"negative hysteresis", "alerts:\n  - {name: a, device: 28-0316a2794bff, condition: above, high: 2, hysteresis: -1}\n", []string{"alerts[0].hysteresis"}},
+		{"negative clear_for", "alerts:\n  - {name: a, device: 28-0316a2794bff, condition: above, high: 2, clear_for: -1s}\n", []string{"alerts[0].clear_for"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse([]byte(tt.yaml), "yaml")
+			keys := keyErrors(err)
+			if len(keys) != len(tt.invalid) {
+				t.Fatalf("got errors %v, want keys %v", err, tt.invalid)
+			}
+			for i, k := range keys {
+				if k != tt.invalid[i] {
+					t.Errorf("got key %v, want %v", k, tt.invalid[i])
+				}
+			}
+		})
+	}
+}
+
+func TestAlertRules(t *testing.T) {
+	c, err := Parse([]byte("groups:\n  garden: [28-0316a2794bff]\nalerts:\n  - {name: garden, group: garden, condition: outside, low: 2, high: 30, for: 5m, hysteresis: 0.5, clear_for: 10m}\n"), "yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := rpionewire.AlertRule{Name: "garden", Group: "garden", Condition: rpionewire.Outside, Low: 2, High: 30, For: 5 * time.Minute, Hysteresis: 0.5, ClearFor: 10 * time.Minute}
+	if rules := c.AlertRules(); len(rules) != 1 || rules[0] != want {
+		t.Errorf("got rules %+v, want %+v", rules, want)
+	}
+
+	c = Default()
+	if err := c.applyEnv([]string{
+		"RPIONEWIRE_ALERTS_0_NAME=freezer-warm",
+		"RPIONEWIRE_ALERTS_0_DEVICE=28-0316a2794bff",
+		"RPIONEWIRE_ALERTS_0_CONDITION=above",
+		"RPIONEWIRE_ALERTS_0_HIGH=-15",
+		"RPIONEWIRE_ALERTS_0_HYSTERESIS=1",
+		"RPIONEWIRE_ALERTS_0_CLEAR_FOR=10m",
+	}); err != nil {
+		t.Fatal(err)
+	}
+	want = rpionewire.AlertRule{Name: "freezer-warm", Device: "28-0316a2794bff", Condition: rpionewire.Above, High: -15, Hysteresis: 1, ClearFor: 10 * time.Minute}
+	if rules := c.AlertRules(); len(rules) != 1 || rules[0] != want {
+		t.Errorf("got rules %+v from the environment, want %+v", rules, want)
+	}
+}
+
+func TestValidatePushSinks(t *testing.T) {
+	tests := []struct {
+		name    string
+		yaml    string
+		invalid []string
+	}{
+		{"telegram", "sinks:\n  - {type: telegram, token: t, chat_id: \"42\"}\n", nil},
+		{"telegram without chat", "sinks:\n  - {type: telegram, token: t}\n", []string{"sinks[0].chat_id"}},
+		{"pushover", "sinks:\n  - {type: pushover, token: t, user: u, priority: 2, retry: 30s, expire: 3h}\n", nil},
+		{"pushover defaults", "sinks:\n  - {type: pushover, token: t, user: u, priority: 2}\n", nil},
+		{"pushover without credentials", "sinks:\n  - {type: pushover}\n", []string{"sinks[0].token", "sinks[0].user"}},
+		{"pushover priority", "sinks:\n  - {type: pushover, token: t, user: u, priority: 3}\n", []string{"sinks[0].priority"}},
+		{"pushover retry", "sinks:\n  - {type: pushover, token: t, user: u, retry: 10s}\n", []string{"sinks[0].retry"}},
+		{"pushover expire", "sinks:\n  - {type: pushover, token: t, user: u, expire: 4h}\n", []string{"sinks[0].expire"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse([]byte(tt.yaml), "yaml")
+			keys := keyErrors(err)
+			if len(keys) != len(tt.invalid) {
+				t.Fatalf("got errors %v, want keys %v", err, tt.invalid)
+			}
+			for i, k := range keys {
+				if k != tt.invalid[i] {
+					t.Errorf("got key %v, want %v", k, tt.invalid[i])
+				}
+			}
+		})
+	}
+}
+
+func TestValidateHeatMeters(t *testing.T) {
+	loop := "polling:\n  delta_t:\n    - {name: loop, hot: 28-0316a2794bff, cold: 28-0416a1184baa}\n  heat_meters:\n"
+	tests := []struct {
+		name    string
+		yaml    string
+		invalid []string
+	}{
+		{"valid", loop + "    - {delta_t: loop, flow: 12}\n", nil},
+		{"unknown delta_t", loop + "    - {delta_t: other, flow: 12}\n", []string{"polling.heat_meters[0].delta_t"}},
+		{"negative flow", loop + "    - {delta_t: loop, flow: -1}\n", []string{"polling.heat_meters[0].flow"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse([]byte(tt.yaml), "yaml")
+			keys := keyErrors(err)
+			if len(keys) != len(tt.invalid) {
+				t.Fatalf("got errors %v, want keys %v", err, tt.invalid)
+			}
+			for i, k := range keys {
+				if k != tt.invalid[i] {
+					t.Errorf("got key %v, want %v", k, tt.invalid[i])
+				}
+			}
+		})
+	}
+}
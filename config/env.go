@@ -0,0 +1,934 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EnvPrefix prefixes the environment variables read by FromEnv
+const EnvPrefix = "RPIONEWIRE_"
+
+// FromEnv builds the configuration from the environment, for
+// deployments where mounting a file is awkward. RPIONEWIRE_CONFIG names
+// an optional file loaded first; the following variables then override
+// its values:
+//
+//	RPIONEWIRE_DEVICES_REDISCOVER               10s
+//	RPIONEWIRE_DEVICES_FAILOVER                 5s
+//	RPIONEWIRE_DEVICES_CRC_RETRIES              2
+//	RPIONEWIRE_DEVICES_EXCLUDE                  28-0416a1184baa,28-0516b2295cbb
+//	RPIONEWIRE_DEVICES_ALLOW                    28-0316a2794bff
+//	RPIONEWIRE_DEVICES_SYSFS_ROOT               /host/sys
+//	RPIONEWIRE_DEVICES_MODULES_LOAD             true
+//	RPIONEWIRE_DEVICES_MODULES_MASTERS          ds2490
+//	RPIONEWIRE_DEVICES_MODULES_PARAMS           w1_gpio=gpiopin=17:pullup=1
+//	RPIONEWIRE_DEVICES_MODULES_SKIP             w1_gpio
+//	RPIONEWIRE_DEVICES_MODULES_DRY_RUN          true
+//	RPIONEWIRE_ALIASES                          28-0316a2794bff=freezer,28-0416a1184baa=fridge
+//	RPIONEWIRE_GROUPS                           greenhouse=28-0316a2794bff:28-0416a1184baa
+//	RPIONEWIRE_CALIBRATION                      28-0316a2794bff=-0.3,28-0416a1184baa=0.1:1.02
+//	RPIONEWIRE_POLLING_INTERVAL                 30s
+//	RPIONEWIRE_POLLING_SCHEDULE                 */5 * * * *
+//	RPIONEWIRE_POLLING_JITTER                   5s
+//	RPIONEWIRE_POLLING_DRAIN_TIMEOUT            10s
+//	RPIONEWIRE_POLLING_DEVICES_<n>              28-0316a2794bff=*/5 * * * *
+//	RPIONEWIRE_POLLING_PRIORITY                 28-0316a2794bff=10,28-0416a1184baa=5
+//	RPIONEWIRE_POLLING_AGGREGATES               greenhouse=mean:min:max
+//	RPIONEWIRE_POLLING_DELTA_T_<n>_NAME         heating-loop
+//	RPIONEWIRE_POLLING_DELTA_T_<n>_HOT          28-0316a2794bff
+//	RPIONEWIRE_POLLING_DELTA_T_<n>_COLD         28-0416a1184baa
+//	RPIONEWIRE_POLLING_DELTA_T_<n>_LOW          5
+//	RPIONEWIRE_POLLING_DELTA_T_<n>_HIGH         20
+//	RPIONEWIRE_POLLING_DELTA_T_<n>_FOR          5m
+//	RPIONEWIRE_POLLING_HEAT_METERS_<n>_DELTA_T  heating-loop
+//	RPIONEWIRE_POLLING_HEAT_METERS_<n>_FLOW     12
+//	RPIONEWIRE_POLLING_HEAT_METERS_<n>_SPECIFIC_HEAT  3.8
+//	RPIONEWIRE_POLLING_HEAT_METERS_<n>_DENSITY  1.03
+//	RPIONEWIRE_ALERTS_<n>_NAME                  freezer-warm
+//	RPIONEWIRE_ALERTS_<n>_DEVICE                28-0316a2794bff
+//	RPIONEWIRE_ALERTS_<n>_GROUP                 greenhouse
+//	RPIONEWIRE_ALERTS_<n>_CONDITION             above
+//	RPIONEWIRE_ALERTS_<n>_LOW                   -25
+//	RPIONEWIRE_ALERTS_<n>_HIGH                  -15
+//	RPIONEWIRE_ALERTS_<n>_FOR                   5m
+//	RPIONEWIRE_ALERTS_<n>_HYSTERESIS            1
+//	RPIONEWIRE_ALERTS_<n>_CLEAR_FOR             10m
+//	RPIONEWIRE_DEGREE_DAYS_BASE                 15.5
+//	RPIONEWIRE_DEGREE_DAYS_PATH                 /var/lib/rpionewire/degree-days.json
+//	RPIONEWIRE_HISTORY_PATH                     /var/lib/rpionewire/history.gob
+//	RPIONEWIRE_HISTORY_TIERS                    0s=48h,5m=2160h
+//	RPIONEWIRE_THERMOSTATS_<n>_DEVICE           greenhouse:mean
+//	RPIONEWIRE_THERMOSTATS_<n>_SETPOINT         12
+//	RPIONEWIRE_THERMOSTATS_<n>_HYSTERESIS       0.5
+//	RPIONEWIRE_THERMOSTATS_<n>_MODE             heating
+//	RPIONEWIRE_THERMOSTATS_<n>_MIN_CYCLE        5m
+//	RPIONEWIRE_THERMOSTATS_<n>_GPIO_CHIP        gpiochip0
+//	RPIONEWIRE_THERMOSTATS_<n>_GPIO_LINE        17
+//	RPIONEWIRE_THERMOSTATS_<n>_GPIO_ACTIVE_LOW  true
+//	RPIONEWIRE_FANS_<n>_DEVICE                  28-0516b2295cbb
+//	RPIONEWIRE_FANS_<n>_CURVE                   35=20,50=60,60=100
+//	RPIONEWIRE_FANS_<n>_PWM_CHIP                0
+//	RPIONEWIRE_FANS_<n>_PWM_CHANNEL             0
+//	RPIONEWIRE_FANS_<n>_PWM_FREQUENCY           25000
+//	RPIONEWIRE_SINKS_<n>_TYPE                   webhook
+//	RPIONEWIRE_SINKS_<n>_URL                    https://example.com/hook
+//	RPIONEWIRE_SINKS_<n>_SECRET                 s3cr3t
+//	RPIONEWIRE_SINKS_<n>_RETRIES                3
+//	RPIONEWIRE_SINKS_<n>_READINGS               true
+//	RPIONEWIRE_SINKS_<n>_TOPIC                  home/temperature
+//	RPIONEWIRE_SINKS_<n>_CLIENT_ID              rpionewire-garage
+//	RPIONEWIRE_SINKS_<n>_TOKEN                  123456:ABC-DEF
+//	RPIONEWIRE_SINKS_<n>_CHAT_ID                -1001234567890
+//	RPIONEWIRE_SINKS_<n>_USER                   uQiRzpo4DXghDmr9QzzfQu27cmVRsG
+//	RPIONEWIRE_SINKS_<n>_PRIORITY               2
+//	RPIONEWIRE_SINKS_<n>_RETRY                  1m
+//	RPIONEWIRE_SINKS_<n>_EXPIRE                 1h
+//	RPIONEWIRE_SINKS_<n>_PATH                   /var/lib/rpionewire/readings.jsonl
+//	RPIONEWIRE_SINKS_<n>_MAX_SIZE               104857600
+//	RPIONEWIRE_SINKS_<n>_ROTATE                 24h
+//	RPIONEWIRE_SINKS_<n>_DAILY                  true
+//	RPIONEWIRE_SINKS_<n>_COMPRESS               true
+//	RPIONEWIRE_SINKS_<n>_MAX_AGE                8760h
+//	RPIONEWIRE_SINKS_<n>_MAX_ROWS               100000
+//	RPIONEWIRE_SERVER_LISTEN                    :9100
+//	RPIONEWIRE_SERVER_METRICS_PATH              /metrics
+//	RPIONEWIRE_SERVER_OWSERVER_LISTEN           :4304
+//	RPIONEWIRE_SERVER_DASHBOARD                 true
+//	RPIONEWIRE_SERVER_STALE_AFTER               2m
+//	RPIONEWIRE_SERVER_EXPIRE_AFTER              1h
+//	RPIONEWIRE_SERVER_AUTH_TOKENS               s3cr3t,0th3r
+//	RPIONEWIRE_SERVER_AUTH_USERS                admin=pa55word
+//	RPIONEWIRE_SERVER_TLS_CERT                  /etc/rpionewire/server.pem
+//	RPIONEWIRE_SERVER_TLS_KEY                   /etc/rpionewire/server.key
+//	RPIONEWIRE_SERVER_TLS_CA                    /etc/rpionewire/clients.pem
+//	RPIONEWIRE_SERVER_CORS_ORIGINS              https://dash.example.com
+//	RPIONEWIRE_SERVER_CORS_MAX_AGE              10m
+//	RPIONEWIRE_HOSTS_<n>_NAME                   attic
+//	RPIONEWIRE_HOSTS_<n>_BACKEND                ssh
+//	RPIONEWIRE_HOSTS_<n>_ADDR                   attic:22
+//	RPIONEWIRE_HOSTS_<n>_USER                   pi
+//	RPIONEWIRE_HOSTS_<n>_KEY_FILE               /etc/rpionewire/id_ed25519
+//	RPIONEWIRE_HOSTS_<n>_KNOWN_HOSTS            /etc/rpionewire/known_hosts
+//	RPIONEWIRE_CLUSTER_COLLECTOR                http://collector:9200
+//	RPIONEWIRE_CLUSTER_TOKEN                    s3cr3t
+//	RPIONEWIRE_CLUSTER_HOST                     garage
+//	RPIONEWIRE_CLUSTER_LISTEN                   :9200
+//	RPIONEWIRE_CLUSTER_TLS_CA                   /etc/rpionewire/ca.pem
+//	RPIONEWIRE_CLUSTER_TLS_CERT                 /etc/rpionewire/agent.pem
+//	RPIONEWIRE_CLUSTER_TLS_KEY                  /etc/rpionewire/agent.key
+//	RPIONEWIRE_SIMULATOR_SENSORS                500
+//	RPIONEWIRE_SIMULATOR_MEAN                   20
+//	RPIONEWIRE_SIMULATOR_SWING                  5
+//	RPIONEWIRE_SIMULATOR_PERIOD                 24h
+//	RPIONEWIRE_SIMULATOR_NOISE                  0.1
+//	RPIONEWIRE_SIMULATOR_LATENCY                750ms
+//	RPIONEWIRE_SIMULATOR_FAULTS_CRC_RATE        0.01
+//	RPIONEWIRE_SIMULATOR_FAULTS_SLOW_RATE       0.05
+//	RPIONEWIRE_SIMULATOR_FAULTS_SLOW_DELAY      2s
+//	RPIONEWIRE_SIMULATOR_FAULTS_DROP_RATE       0.001
+//	RPIONEWIRE_SIMULATOR_FAULTS_DROP_DURATION   1m
+//
+// Every key of the files has its variable. Calibrations are written
+// offset[:scale], history tiers resolution=retention and fan curves
+// temp=duty. Any DEVICES_MODULES_ variable enables module loading, LOAD
+// alone loading the modules without parameters. Lists of tables, such
+// as sinks and hosts, are numbered from 0 and replace those of the file
+// when any of their variables is set; so do the POLLING_DEVICES_<n>
+// schedules, which are not split on commas since cron fields hold them.
+func FromEnv() (*Config, error) {
+	c := Default()
+	if path := os.Getenv(EnvPrefix + "CONFIG"); path != "" {
+		var err error
+		if c, err = Load(path); err != nil {
+			return nil, err
+		}
+	}
+	if err := c.applyEnv(os.Environ()); err != nil {
+		return nil, err
+	}
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// applyEnv overrides the configuration with the RPIONEWIRE_ variables
+// of environ
+func (c *Config) applyEnv(environ []string) error {
+	var errs []error
+	fail := func(key string, err error) {
+		errs = append(errs, &KeyError{Key: key, Msg: err.Error()})
+	}
+
+	sinks := map[int]*Sink{}
+	hosts := map[int]*Host{}
+	thermostats := map[int]*Thermostat{}
+	fans := map[int]*Fan{}
+	deltas := map[int]*DeltaT{}
+	meters := map[int]*HeatMeter{}
+	alerts := map[int]*Alert{}
+	schedules := map[int]string{}
+	for _, kv := range environ {
+		key, value, ok := strings.Cut(kv, "=")
+		if !ok || !strings.HasPrefix(key, EnvPrefix) {
+			continue
+		}
+
+		var err error
+		switch name := strings.TrimPrefix(key, EnvPrefix); name {
+		case "CONFIG":
+		case "DEVICES_REDISCOVER":
+			c.Devices.Rediscover.Duration, err = time.ParseDuration(value)
+		case "DEVICES_FAILOVER":
+			c.Devices.Failover.Duration, err = time.ParseDuration(value)
+		case "DEVICES_CRC_RETRIES":
+			c.Devices.CRCRetries, err = strconv.Atoi(value)
+		case "DEVICES_EXCLUDE":
+			c.Devices.Exclude = splitList(value)
+		case "DEVICES_ALLOW":
+			c.Devices.Allow = splitList(value)
+		case "DEVICES_SYSFS_ROOT":
+			c.Devices.SysfsRoot = value
+		case "DEVICES_MODULES_LOAD":
+			var load bool
+			if load, err = strconv.ParseBool(value); err == nil && load {
+				modulesOf(&c.Devices.Modules)
+			} else if err == nil {
+				c.Devices.Modules = nil
+			}
+		case "DEVICES_MODULES_MASTERS":
+			modulesOf(&c.Devices.Modules).Masters = splitList(value)
+		case "DEVICES_MODULES_PARAMS":
+			modulesOf(&c.Devices.Modules).Params, err = parseModuleParams(value)
+		case "DEVICES_MODULES_SKIP":
+			modulesOf(&c.Devices.Modules).Skip = splitList(value)
+		case "DEVICES_MODULES_DRY_RUN":
+			modulesOf(&c.Devices.Modules).DryRun, err = strconv.ParseBool(value)
+		case "ALIASES":
+			c.Aliases, err = parseAliases(value)
+		case "GROUPS":
+			c.Groups, err = parseGroups(value)
+		case "CALIBRATION":
+			c.Calibration, err = parseCalibration(value)
+		case "POLLING_INTERVAL":
+			c.Polling.Interval.Duration, err = time.ParseDuration(value)
+		case "POLLING_SCHEDULE":
+			c.Polling.Schedule = value
+		case "POLLING_JITTER":
+			c.Polling.Jitter.Duration, err = time.ParseDuration(value)
+		case "POLLING_DRAIN_TIMEOUT":
+			c.Polling.DrainTimeout.Duration, err = time.ParseDuration(value)
+		case "POLLING_PRIORITY":
+			c.Polling.Priority, err = parsePriority(value)
+		case "POLLING_AGGREGATES":
+			c.Polling.Aggregates, err = parseAggregates(value)
+		case "DEGREE_DAYS_BASE":
+			degreeDaysOf(&c.DegreeDays).Base, err = strconv.ParseFloat(value, 64)
+		case "DEGREE_DAYS_PATH":
+			degreeDaysOf(&c.DegreeDays).Path = value
+		case "HISTORY_PATH":
+			historyOf(&c.History).Path = value
+		case "HISTORY_TIERS":
+			historyOf(&c.History).Tiers, err = parseTiers(value)
+		case "SERVER_LISTEN":
+			c.Server.Listen = value
+		case "SERVER_METRICS_PATH":
+			c.Server.MetricsPath = value
+		case "SERVER_OWSERVER_LISTEN":
+			c.Server.OWServerListen = value
+		case "SERVER_DASHBOARD":
+			c.Server.Dashboard, err = strconv.ParseBool(value)
+		case "SERVER_STALE_AFTER":
+			c.Server.StaleAfter.Duration, err = time.ParseDuration(value)
+		case "SERVER_EXPIRE_AFTER":
+			c.Server.ExpireAfter.Duration, err = time.ParseDuration(value)
+		case "SERVER_TLS_CERT":
+			tlsOf(&c.Server.TLS).Cert = value
+		case "SERVER_TLS_KEY":
+			tlsOf(&c.Server.TLS).Key = value
+		case "SERVER_TLS_CA":
+			tlsOf(&c.Server.TLS).CA = value
+		case "SERVER_CORS_ORIGINS":
+			if c.Server.CORS == nil {
+				c.Server.CORS = new(CORS)
+			}
+			c.Server.CORS.Origins = splitList(value)
+		case "SERVER_CORS_MAX_AGE":
+			if c.Server.CORS == nil {
+				c.Server.CORS = new(CORS)
+			}
+			c.Server.CORS.MaxAge.Duration, err = time.ParseDuration(value)
+		case "CLUSTER_TLS_CA":
+			tlsOf(&c.Cluster.TLS).CA = value
+		case "CLUSTER_TLS_CERT":
+			tlsOf(&c.Cluster.TLS).Cert = value
+		case "CLUSTER_TLS_KEY":
+			tlsOf(&c.Cluster.TLS).Key = value
+		case "SERVER_AUTH_TOKENS":
+			if c.Server.Auth == nil {
+				c.Server.Auth = new(Auth)
+			}
+			c.Server.Auth.Tokens = splitList(value)
+		case "SERVER_AUTH_USERS":
+			if c.Server.Auth == nil {
+				c.Server.Auth = new(Auth)
+			}
+			c.Server.Auth.Users, err = parseUsers(value)
+		case "CLUSTER_COLLECTOR":
+			c.Cluster.Collector = value
+		case "CLUSTER_TOKEN":
+			c.Cluster.Token = value
+		case "CLUSTER_HOST":
+			c.Cluster.Host = value
+		case "CLUSTER_LISTEN":
+			c.Cluster.Listen = value
+		case "SIMULATOR_SENSORS":
+			simulatorOf(&c.Simulator).Sensors, err = strconv.Atoi(value)
+		case "SIMULATOR_LATENCY":
+			simulatorOf(&c.Simulator).Latency.Duration, err = time.ParseDuration(value)
+		case "SIMULATOR_MEAN":
+			simulatorOf(&c.Simulator).Mean, err = parseFloatPtr(value)
+		case "SIMULATOR_SWING":
+			simulatorOf(&c.Simulator).Swing, err = parseFloatPtr(value)
+		case "SIMULATOR_PERIOD":
+			simulatorOf(&c.Simulator).Period.Duration, err = time.ParseDuration(value)
+		case "SIMULATOR_NOISE":
+			simulatorOf(&c.Simulator).Noise, err = parseFloatPtr(value)
+		case "SIMULATOR_FAULTS_CRC_RATE":
+			faultsOf(&simulatorOf(&c.Simulator).Faults).CRCRate, err = strconv.ParseFloat(value, 64)
+		case "SIMULATOR_FAULTS_SLOW_RATE":
+			faultsOf(&simulatorOf(&c.Simulator).Faults).SlowRate, err = strconv.ParseFloat(value, 64)
+		case "SIMULATOR_FAULTS_SLOW_DELAY":
+			faultsOf(&simulatorOf(&c.Simulator).Faults).SlowDelay.Duration, err = time.ParseDuration(value)
+		case "SIMULATOR_FAULTS_DROP_RATE":
+			faultsOf(&simulatorOf(&c.Simulator).Faults).DropRate, err = strconv.ParseFloat(value, 64)
+		case "SIMULATOR_FAULTS_DROP_DURATION":
+			faultsOf(&simulatorOf(&c.Simulator).Faults).DropDuration.Duration, err = time.ParseDuration(value)
+		default:
+			switch {
+			case strings.HasPrefix(name, "SINKS_"):
+				err = setSink(sinks, strings.TrimPrefix(name, "SINKS_"), value)
+			case strings.HasPrefix(name, "HOSTS_"):
+				err = setHost(hosts, strings.TrimPrefix(name, "HOSTS_"), value)
+			case strings.HasPrefix(name, "THERMOSTATS_"):
+				err = setThermostat(thermostats, strings.TrimPrefix(name, "THERMOSTATS_"), value)
+			case strings.HasPrefix(name, "FANS_"):
+				err = setFan(fans, strings.TrimPrefix(name, "FANS_"), value)
+			case strings.HasPrefix(name, "POLLING_DELTA_T_"):
+				err = setDeltaT(deltas, strings.TrimPrefix(name, "POLLING_DELTA_T_"), value)
+			case strings.HasPrefix(name, "ALERTS_"):
+				err = setAlert(alerts, strings.TrimPrefix(name, "ALERTS_"), value)
+			case strings.HasPrefix(name, "POLLING_HEAT_METERS_"):
+				err = setHeatMeter(meters, strings.TrimPrefix(name, "POLLING_HEAT_METERS_"), value)
+			case strings.HasPrefix(name, "POLLING_DEVICES_"):
+				err = setSchedule(schedules, strings.TrimPrefix(name, "POLLING_DEVICES_"), value)
+			default:
+				err = errors.New("unknown variable")
+			}
+		}
+		if err != nil {
+			fail(key, err)
+		}
+	}
+
+	if len(sinks) > 0 {
+		indexes := make([]int, 0, len(sinks))
+		for i := range sinks {
+			indexes = append(indexes, i)
+		}
+		sort.Ints(indexes)
+		c.Sinks = make([]Sink, len(indexes))
+		for i, n := range indexes {
+			c.Sinks[i] = *sinks[n]
+		}
+	}
+	if len(hosts) > 0 {
+		indexes := make([]int, 0, len(hosts))
+		for i := range hosts {
+			indexes = append(indexes, i)
+		}
+		sort.Ints(indexes)
+		c.Hosts = make([]Host, len(indexes))
+		for i, n := range indexes {
+			c.Hosts[i] = *hosts[n]
+		}
+	}
+	if len(thermostats) > 0 {
+		indexes := make([]int, 0, len(thermostats))
+		for i := range thermostats {
+			indexes = append(indexes, i)
+		}
+		sort.Ints(indexes)
+		c.Thermostats = make([]Thermostat, len(indexes))
+		for i, n := range indexes {
+			c.Thermostats[i] = *thermostats[n]
+		}
+	}
+	if len(fans) > 0 {
+		indexes := make([]int, 0, len(fans))
+		for i := range fans {
+			indexes = append(indexes, i)
+		}
+		sort.Ints(indexes)
+		c.Fans = make([]Fan, len(indexes))
+		for i, n := range indexes {
+			c.Fans[i] = *fans[n]
+		}
+	}
+	if len(deltas) > 0 {
+		indexes := make([]int, 0, len(deltas))
+		for i := range deltas {
+			indexes = append(indexes, i)
+		}
+		sort.Ints(indexes)
+		c.Polling.DeltaT = make([]DeltaT, len(indexes))
+		for i, n := range indexes {
+			c.Polling.DeltaT[i] = *deltas[n]
+		}
+	}
+	if len(meters) > 0 {
+		indexes := make([]int, 0, len(meters))
+		for i := range meters {
+			indexes = append(indexes, i)
+		}
+		sort.Ints(indexes)
+		c.Polling.HeatMeters = make([]HeatMeter, len(indexes))
+		for i, n := range indexes {
+			c.Polling.HeatMeters[i] = *meters[n]
+		}
+	}
+	if len(alerts) > 0 {
+		indexes := make([]int, 0, len(alerts))
+		for i := range alerts {
+			indexes = append(indexes, i)
+		}
+		sort.Ints(indexes)
+		c.Alerts = make([]Alert, len(indexes))
+		for i, n := range indexes {
+			c.Alerts[i] = *alerts[n]
+		}
+	}
+	if len(schedules) > 0 {
+		c.Polling.Devices = map[string]string{}
+		for _, sched := range schedules {
+			device, spec, _ := strings.Cut(sched, "=")
+			c.Polling.Devices[strings.TrimSpace(device)] = strings.TrimSpace(spec)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// listField splits a variable suffix of a numbered list such as "0_URL"
+// into its index and field
+func listField(list, suffix string) (int, string, error) {
+	n, field, ok := strings.Cut(suffix, "_")
+	i, err := strconv.Atoi(n)
+	if !ok || err != nil || i < 0 {
+		return 0, "", fmt.Errorf("expected RPIONEWIRE_%v_<n>_<field>", list)
+	}
+	return i, field, nil
+}
+
+// setSink sets the field of a numbered sink from a variable suffix such
+// as "0_URL"
+func setSink(sinks map[int]*Sink, suffix, value string) error {
+	i, field, err := listField("SINKS", suffix)
+	if err != nil {
+		return err
+	}
+	s := sinks[i]
+	if s == nil {
+		s = new(Sink)
+		sinks[i] = s
+	}
+
+	switch field {
+	case "TYPE":
+		s.Type = value
+	case "URL":
+		s.URL = value
+	case "SECRET":
+		s.Secret = value
+	case "RETRIES":
+		s.Retries, err = strconv.Atoi(value)
+	case "READINGS":
+		s.Readings, err = strconv.ParseBool(value)
+	case "TOPIC":
+		s.Topic = value
+	case "CLIENT_ID":
+		s.ClientID = value
+	case "TOKEN":
+		s.Token = value
+	case "CHAT_ID":
+		s.ChatID = value
+	case "USER":
+		s.User = value
+	case "PRIORITY":
+		s.Priority, err = strconv.Atoi(value)
+	case "RETRY":
+		s.Retry.Duration, err = time.ParseDuration(value)
+	case "EXPIRE":
+		s.Expire.Duration, err = time.ParseDuration(value)
+	case "PATH":
+		s.Path = value
+	case "MAX_SIZE":
+		s.MaxSize, err = strconv.ParseInt(value, 10, 64)
+	case "ROTATE":
+		s.Rotate.Duration, err = time.ParseDuration(value)
+	case "DAILY":
+		s.Daily, err = strconv.ParseBool(value)
+	case "COMPRESS":
+		s.Compress, err = strconv.ParseBool(value)
+	case "MAX_AGE":
+		s.MaxAge.Duration, err = time.ParseDuration(value)
+	case "MAX_ROWS":
+		s.MaxRows, err = strconv.Atoi(value)
+	default:
+		err = fmt.Errorf("unknown sink field %v", field)
+	}
+	return err
+}
+
+// setHost sets the field of a numbered host from a variable suffix such
+// as "0_ADDR"
+func setHost(hosts map[int]*Host, suffix, value string) error {
+	i, field, err := listField("HOSTS", suffix)
+	if err != nil {
+		return err
+	}
+	h := hosts[i]
+	if h == nil {
+		h = new(Host)
+		hosts[i] = h
+	}
+
+	switch field {
+	case "NAME":
+		h.Name = value
+	case "BACKEND":
+		h.Backend = value
+	case "ADDR":
+		h.Addr = value
+	case "USER":
+		h.User = value
+	case "KEY_FILE":
+		h.KeyFile = value
+	case "KNOWN_HOSTS":
+		h.KnownHosts = value
+	default:
+		err = fmt.Errorf("unknown host field %v", field)
+	}
+	return err
+}
+
+// setThermostat sets the field of a numbered thermostat from a variable
+// suffix such as "0_SETPOINT"
+func setThermostat(thermostats map[int]*Thermostat, suffix, value string) error {
+	i, field, err := listField("THERMOSTATS", suffix)
+	if err != nil {
+		return err
+	}
+	t := thermostats[i]
+	if t == nil {
+		t = new(Thermostat)
+		thermostats[i] = t
+	}
+
+	switch field {
+	case "DEVICE":
+		t.Device = value
+	case "SETPOINT":
+		t.Setpoint, err = strconv.ParseFloat(value, 64)
+	case "HYSTERESIS":
+		t.Hysteresis, err = strconv.ParseFloat(value, 64)
+	case "MODE":
+		t.Mode = value
+	case "MIN_CYCLE":
+		t.MinCycle.Duration, err = time.ParseDuration(value)
+	case "GPIO_CHIP":
+		t.GPIO.Chip = value
+	case "GPIO_LINE":
+		t.GPIO.Line, err = strconv.Atoi(value)
+	case "GPIO_ACTIVE_LOW":
+		t.GPIO.ActiveLow, err = strconv.ParseBool(value)
+	default:
+		err = fmt.Errorf("unknown thermostat field %v", field)
+	}
+	return err
+}
+
+// setFan sets the field of a numbered fan from a variable suffix such as
+// "0_CURVE"
+func setFan(fans map[int]*Fan, suffix, value string) error {
+	i, field, err := listField("FANS", suffix)
+	if err != nil {
+		return err
+	}
+	f := fans[i]
+	if f == nil {
+		f = new(Fan)
+		fans[i] = f
+	}
+
+	switch field {
+	case "DEVICE":
+		f.Device = value
+	case "CURVE":
+		f.Curve, err = parseCurve(value)
+	case "PWM_CHIP":
+		f.PWM.Chip, err = strconv.Atoi(value)
+	case "PWM_CHANNEL":
+		f.PWM.Channel, err = strconv.Atoi(value)
+	case "PWM_FREQUENCY":
+		f.PWM.Frequency, err = strconv.ParseFloat(value, 64)
+	default:
+		err = fmt.Errorf("unknown fan field %v", field)
+	}
+	return err
+}
+
+// setDeltaT sets the field of a numbered temperature difference from a
+// variable suffix such as "0_HOT"
+func setDeltaT(deltas map[int]*DeltaT, suffix, value string) error {
+	i, field, err := listField("POLLING_DELTA_T", suffix)
+	if err != nil {
+		return err
+	}
+	dt := deltas[i]
+	if dt == nil {
+		dt = new(DeltaT)
+		deltas[i] = dt
+	}
+
+	switch field {
+	case "NAME":
+		dt.Name = value
+	case "HOT":
+		dt.Hot = value
+	case "COLD":
+		dt.Cold = value
+	case "LOW":
+		dt.Low, err = parseFloatPtr(value)
+	case "HIGH":
+		dt.High, err = parseFloatPtr(value)
+	case "FOR":
+		dt.For.Duration, err = time.ParseDuration(value)
+	default:
+		err = fmt.Errorf("unknown delta_t field %v", field)
+	}
+	return err
+}
+
+// setHeatMeter sets the field of a numbered heat meter from a variable
+// suffix such as "0_FLOW"
+func setHeatMeter(meters map[int]*HeatMeter, suffix, value string) error {
+	i, field, err := listField("POLLING_HEAT_METERS", suffix)
+	if err != nil {
+		return err
+	}
+	h := meters[i]
+	if h == nil {
+		h = new(HeatMeter)
+		meters[i] = h
+	}
+
+	switch field {
+	case "DELTA_T":
+		h.DeltaT = value
+	case "FLOW":
+		h.Flow, err = strconv.ParseFloat(value, 64)
+	case "SPECIFIC_HEAT":
+		h.SpecificHeat, err = strconv.ParseFloat(value, 64)
+	case "DENSITY":
+		h.Density, err = strconv.ParseFloat(value, 64)
+	default:
+		err = fmt.Errorf("unknown heat meter field %v", field)
+	}
+	return err
+}
+
+// setAlert sets the field of a numbered alert from a variable suffix
+// such as "0_CONDITION"
+func setAlert(alerts map[int]*Alert, suffix, value string) error {
+	i, field, err := listField("ALERTS", suffix)
+	if err != nil {
+		return err
+	}
+	a := alerts[i]
+	if a == nil {
+		a = new(Alert)
+		alerts[i] = a
+	}
+
+	switch field {
+	case "NAME":
+		a.Name = value
+	case "DEVICE":
+		a.Device = value
+	case "GROUP":
+		a.Group = value
+	case "CONDITION":
+		a.Condition = value
+	case "LOW":
+		a.Low, err = parseFloatPtr(value)
+	case "HIGH":
+		a.High, err = parseFloatPtr(value)
+	case "FOR":
+		a.For.Duration, err = time.ParseDuration(value)
+	case "HYSTERESIS":
+		a.Hysteresis, err = strconv.ParseFloat(value, 64)
+	case "CLEAR_FOR":
+		a.ClearFor.Duration, err = time.ParseDuration(value)
+	default:
+		err = fmt.Errorf("unknown alert field %v", field)
+	}
+	return err
+}
+
+// setSchedule sets a numbered device schedule, written
+// device=schedule, from its variable suffix such as "0"
+func setSchedule(schedules map[int]string, suffix, value string) error {
+	i, err := strconv.Atoi(suffix)
+	if err != nil || i < 0 {
+		return errors.New("expected RPIONEWIRE_POLLING_DEVICES_<n>")
+	}
+	if device, _, ok := strings.Cut(value, "="); !ok || strings.TrimSpace(device) == "" {
+		return fmt.Errorf("expected device=schedule, got %q", value)
+	}
+	schedules[i] = value
+	return nil
+}
+
+// parseAliases parses a comma separated list of name=alias pairs
+func parseAliases(value string) (map[string]string, error) {
+	aliases := map[string]string{}
+	for _, pair := range strings.Split(value, ",") {
+		name, alias, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok {
+			return nil, fmt.Errorf("expected device=alias, got %q", pair)
+		}
+		aliases[name] = alias
+	}
+	return aliases, nil
+}
+
+// tlsOf returns *t, allocating it if nil
+func tlsOf(t **TLS) *TLS {
+	if *t == nil {
+		*t = new(TLS)
+	}
+	return *t
+}
+
+// historyOf returns *h, allocating it if nil
+func historyOf(h **History) *History {
+	if *h == nil {
+		*h = new(History)
+	}
+	return *h
+}
+
+// degreeDaysOf returns *d, allocating it if nil
+func degreeDaysOf(d **DegreeDays) *DegreeDays {
+	if *d == nil {
+		*d = new(DegreeDays)
+	}
+	return *d
+}
+
+// faultsOf returns *f, allocating it if nil
+func faultsOf(f **Faults) *Faults {
+	if *f == nil {
+		*f = new(Faults)
+	}
+	return *f
+}
+
+// simulatorOf returns *s, allocating it if nil
+func simulatorOf(s **Simulator) *Simulator {
+	if *s == nil {
+		*s = new(Simulator)
+	}
+	return *s
+}
+
+// modulesOf returns *m, allocating it if nil
+func modulesOf(m **Modules) *Modules {
+	if *m == nil {
+		*m = new(Modules)
+	}
+	return *m
+}
+
+// parseModuleParams parses a comma separated list of
+// module=param[:param...] pairs
+func parseModuleParams(value string) (map[string][]string, error) {
+	params := map[string][]string{}
+	for _, pair := range strings.Split(value, ",") {
+		module, list, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok || module == "" {
+			return nil, fmt.Errorf("expected module=param[:param...], got %q", pair)
+		}
+		params[module] = append(params[module], strings.Split(list, ":")...)
+	}
+	return params, nil
+}
+
+// parseUsers parses a comma separated list of user=password pairs
+func parseUsers(value string) (map[string]string, error) {
+	users := map[string]string{}
+	for _, pair := range strings.Split(value, ",") {
+		user, password, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok || user == "" {
+			return nil, fmt.Errorf("expected user=password, got %q", pair)
+		}
+		users[user] = password
+	}
+	return users, nil
+}
+
+// parseGroups parses a comma separated list of
+// group=device[:device...] pairs
+func parseGroups(value string) (map[string][]string, error) {
+	groups := map[string][]string{}
+	for _, pair := range strings.Split(value, ",") {
+		group, devices, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok {
+			return nil, fmt.Errorf("expected group=device[:device...], got %q", pair)
+		}
+		groups[group] = append(groups[group], strings.Split(devices, ":")...)
+	}
+	return groups, nil
+}
+
+// parseCalibration parses a comma separated list of
+// name=offset[:scale[:self_heating]] pairs
+func parseCalibration(value string) (map[string]Calibration, error) {
+	cals := map[string]Calibration{}
+	for _, pair := range strings.Split(value, ",") {
+		name, spec, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok {
+			return nil, fmt.Errorf("expected device=offset[:scale[:self_heating]], got %q", pair)
+		}
+		offset, scale, hasScale := strings.Cut(spec, ":")
+		scale, heating, hasHeating := strings.Cut(scale, ":")
+		var cal Calibration
+		var err error
+		if cal.Offset, err = strconv.ParseFloat(offset, 64); err != nil {
+			return nil, fmt.Errorf("bad offset for %v: %w", name, err)
+		}
+		if hasScale && scale != "" {
+			if cal.Scale, err = strconv.ParseFloat(scale, 64); err != nil {
+				return nil, fmt.Errorf("bad scale for %v: %w", name, err)
+			}
+		}
+		if hasHeating {
+			if cal.SelfHeating, err = strconv.ParseFloat(heating, 64); err != nil {
+				return nil, fmt.Errorf("bad self-heating for %v: %w", name, err)
+			}
+		}
+		cals[name] = cal
+	}
+	return cals, nil
+}
+
+// parsePriority parses a comma separated list of device=priority pairs
+func parsePriority(value string) (map[string]int, error) {
+	prios := map[string]int{}
+	for _, pair := range strings.Split(value, ",") {
+		device, prio, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok {
+			return nil, fmt.Errorf("expected device=priority, got %q", pair)
+		}
+		v, err := strconv.Atoi(prio)
+		if err != nil {
+			return nil, fmt.Errorf("bad priority for %v: %w", device, err)
+		}
+		prios[device] = v
+	}
+	return prios, nil
+}
+
+// parseAggregates parses a comma separated list of
+// group=aggregation[:aggregation...] pairs
+func parseAggregates(value string) (map[string][]string, error) {
+	aggregates := map[string][]string{}
+	for _, pair := range strings.Split(value, ",") {
+		group, fns, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok {
+			return nil, fmt.Errorf("expected group=aggregation[:aggregation...], got %q", pair)
+		}
+		aggregates[group] = append(aggregates[group], strings.Split(fns, ":")...)
+	}
+	return aggregates, nil
+}
+
+// parseTiers parses a comma separated list of resolution=retention
+// history tiers
+func parseTiers(value string) ([]HistoryTier, error) {
+	var tiers []HistoryTier
+	for _, pair := range strings.Split(value, ",") {
+		resolution, retention, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok {
+			return nil, fmt.Errorf("expected resolution=retention, got %q", pair)
+		}
+		var t HistoryTier
+		var err error
+		if t.Resolution.Duration, err = time.ParseDuration(resolution); err != nil {
+			return nil, fmt.Errorf("bad resolution: %w", err)
+		}
+		if t.Retention.Duration, err = time.ParseDuration(retention); err != nil {
+			return nil, fmt.Errorf("bad retention: %w", err)
+		}
+		tiers = append(tiers, t)
+	}
+	return tiers, nil
+}
+
+// parseCurve parses a comma separated list of temp=duty fan curve
+// points
+func parseCurve(value string) ([]CurvePoint, error) {
+	var curve []CurvePoint
+	for _, pair := range strings.Split(value, ",") {
+		temp, duty, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok {
+			return nil, fmt.Errorf("expected temp=duty, got %q", pair)
+		}
+		var p CurvePoint
+		var err error
+		if p.Temp, err = strconv.ParseFloat(temp, 64); err != nil {
+			return nil, fmt.Errorf("bad temperature: %w", err)
+		}
+		if p.Duty, err = strconv.ParseFloat(duty, 64); err != nil {
+			return nil, fmt.Errorf("bad duty cycle: %w", err)
+		}
+		curve = append(curve, p)
+	}
+	return curve, nil
+}
+
+// parseFloatPtr parses a float for the optional fields
+func parseFloatPtr(value string) (*float64, error) {
+	v, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+// splitList parses a comma separated list, ignoring empty items
+func splitList(value string) []string {
+	var list []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
@@ -0,0 +1,63 @@
+package rpionewire
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+)
+
+// TriggerConversion starts a temperature conversion on every device of
+// the bus at once, through the therm_bulk_read attribute of the bus
+// masters, and returns without waiting for it. The application can do
+// other work during the conversion, up to 750ms at 12 bit resolution,
+// and collect the results with ReadLastConversion.
+//
+// Bulk conversions need a kernel of version 5.10 or later and the
+// local sysfs backend.
+func (b *Bus) TriggerConversion() error {
+	s, ok := b.backend.(*Sysfs)
+	if !ok {
+		return fmt.Errorf("Error triggering conversion: %w", ErrUnsupported)
+	}
+	masters, err := filepath.Glob(filepath.Join(s.Dir, "w1_bus_master*"))
+	if err != nil {
+		return err
+	}
+	if len(masters) == 0 {
+		return errors.New("Error triggering conversion: no bus master found")
+	}
+
+	for _, m := range masters {
+		if err := s.WriteAttr(filepath.Base(m), "therm_bulk_read", []byte("trigger")); err != nil {
+			return fmt.Errorf("Error triggering conversion on %v: %w", filepath.Base(m), err)
+		}
+	}
+	return nil
+}
+
+// TriggerConversion starts a conversion on every device of the default
+// bus
+func TriggerConversion() error {
+	return defaultBus.TriggerConversion()
+}
+
+// ReadLastConversion returns the reading of the conversion started by
+// TriggerConversion, blocking until it completes. Without a pending bulk
+// conversion the kernel converts the device on its own, like Read does:
+// so are devices behind a coupler, whose branch is switched off during
+// the bulk conversion. The reading goes through the retries, alarms and
+// metrics of Read.
+func (d *DS1820) ReadLastConversion() (Reading, error) {
+	ctx, span := d.tracer().Start(context.Background(), "rpionewire.read", d.spanAttrs()...)
+	r, err := d.read(ctx, d.convertLast)
+	span.End(err)
+	return r, err
+}
+
+// convertLast reads the temperature attribute of the device, in
+// millidegrees Celsius
+func (d *DS1820) convertLast(ctx context.Context) (int64, []byte, error) {
+	raw, err := readAttr(d.backend(), d.Name, "temperature")
+	return raw, nil, err
+}
@@ -0,0 +1,188 @@
+package rpionewire
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const familyDS2409 = 0x1f
+
+// DS2409 commands, each followed by the bytes clocking out the coupler
+// confirmation
+var (
+	cmdAllLinesOff  = []byte{0x66, 0xff}
+	cmdDirectOnMain = []byte{0xa5, 0xff}
+	cmdSmartOnAux   = []byte{0x33, 0xff, 0xff}
+)
+
+// Branch is one of the two switched outputs of a DS2409 coupler
+type Branch int
+
+const (
+	BranchMain Branch = iota
+	BranchAux
+)
+
+func (br Branch) String() string {
+	switch br {
+	case BranchMain:
+		return "main"
+	case BranchAux:
+		return "aux"
+	}
+	return fmt.Sprintf("Branch(%d)", int(br))
+}
+
+// Coupler is a DS2409 MicroLAN coupler switching two branches of the
+// bus. The kernel has no driver for it, so commands are sent through
+// the raw rw attribute of the device, which the backend of the bus must
+// give access to. Devices behind a branch are only reachable while it is
+// switched on, which Read does on their behalf.
+type Coupler struct {
+	ID   uint64
+	Name string
+
+	// backend is the backend of the bus of the coupler
+	backend Backend
+
+	mu     sync.Mutex
+	active Branch
+	on     bool
+}
+
+// branchRef locates a device behind a coupler branch
+type branchRef struct {
+	coupler *Coupler
+	branch  Branch
+}
+
+// LoadCouplers builds a list of the DS2409 couplers on the bus
+func (b *Bus) LoadCouplers() ([]*Coupler, error) {
+	names, err := b.backend.Devices()
+	if err != nil {
+		return nil, fmt.Errorf("Error finding one wire devices: %w", err)
+	}
+
+	var couplers []*Coupler
+	for _, name := range names {
+		if !strings.HasPrefix(name, fmt.Sprintf("%02x-", familyDS2409)) {
+			continue
+		}
+		id, err := strconv.ParseUint(name[3:], 16, 64)
+		if err != nil {
+			return nil, fmt.Errorf("Error decoding %v device id: %w", name, err)
+		}
+		couplers = append(couplers, &Coupler{ID: id, Name: name, backend: b.backend})
+	}
+
+	return couplers, nil
+}
+
+// LoadBranch switches on branch br of coupler c, searches the bus and
+// returns the devices that only appeared once the branch was on. The
+// returned devices switch the branch on whenever they are read. Only the
+// thermometers kept by WithExclude and WithAllowlist are returned, and
+// the backend of the bus must be a SearchBackend.
+func (b *Bus) LoadBranch(c *Coupler, br Branch, wait time.Duration) ([]*DS1820, error) {
+	sb, ok := b.backend.(SearchBackend)
+	if !ok {
+		return nil, fmt.Errorf("Error loading branch %v of %v: %w", br, c.Name, ErrUnsupported)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.allOff(); err != nil {
+		return nil, err
+	}
+	trunk, err := b.backend.Devices()
+	if err != nil {
+		return nil, fmt.Errorf("Error finding one wire devices: %w", err)
+	}
+	seen := make(map[string]bool, len(trunk))
+	for _, name := range trunk {
+		seen[name] = true
+	}
+
+	if err := c.selectBranch(br); err != nil {
+		return nil, err
+	}
+	if err := sb.Search(); err != nil {
+		return nil, err
+	}
+	<-b.clock.After(wait)
+
+	names, err := b.backend.Devices()
+	if err != nil {
+		return nil, fmt.Errorf("Error finding one wire devices: %w", err)
+	}
+
+	var devices []*DS1820
+	var errs []error
+	for _, name := range b.filter(names) {
+		// nested couplers and the other devices have their own loaders
+		if seen[name] || !isThermometer(name) {
+			continue
+		}
+		device, err := newDS1820(b.backend, name)
+		if err != nil {
+			errs = append(errs, &DeviceError{Name: name, Err: err})
+			continue
+		}
+		device.bus = b
+		device.branch = &branchRef{coupler: c, branch: br}
+		devices = append(devices, device)
+	}
+
+	return devices, errors.Join(errs...)
+}
+
+// Off switches off both branches of the coupler
+func (c *Coupler) Off() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.allOff()
+}
+
+func (c *Coupler) allOff() error {
+	if err := c.command(cmdAllLinesOff); err != nil {
+		return err
+	}
+	c.on = false
+	return nil
+}
+
+// selectBranch switches br on, the other branch being switched off by
+// the coupler itself. The coupler lock must be held.
+func (c *Coupler) selectBranch(br Branch) error {
+	if c.on && c.active == br {
+		return nil
+	}
+
+	cmd := cmdDirectOnMain
+	if br == BranchAux {
+		cmd = cmdSmartOnAux
+	}
+	if err := c.command(cmd); err != nil {
+		return err
+	}
+	c.active = br
+	c.on = true
+	return nil
+}
+
+// command sends cmd to the coupler through its rw attribute
+func (c *Coupler) command(cmd []byte) error {
+	ab, ok := c.backend.(AttrBackend)
+	if !ok {
+		return fmt.Errorf("Error sending command 0x%02x to coupler %v: %w", cmd[0], c.Name, ErrUnsupported)
+	}
+	if err := ab.WriteAttr(c.Name, "rw", cmd); err != nil {
+		return fmt.Errorf("Error sending command 0x%02x to coupler %v: %w", cmd[0], c.Name, err)
+	}
+	return nil
+}
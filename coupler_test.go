@@ -0,0 +1,67 @@
+package rpionewire
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// branchBackend is a sysfs tree whose devices behind a coupler branch
+// appear on the next search
+type branchBackend struct {
+	*Sysfs
+	t      *testing.T
+	branch []string
+}
+
+func (b *branchBackend) Search() error {
+	for _, name := range b.branch {
+		writeDevice(b.t, b.Dir, name, map[string]string{"temperature": "21000\n"})
+	}
+	return nil
+}
+
+func TestLoadBranch(t *testing.T) {
+	dir := t.TempDir()
+	writeDevice(t, dir, "1f-000000000001", map[string]string{"rw": ""})
+	writeDevice(t, dir, "28-000000000001", map[string]string{"temperature": "20000\n"})
+	backend := &branchBackend{Sysfs: &Sysfs{Dir: dir}, t: t, branch: []string{
+		"28-000000000002",
+		"28-000000000003",
+		"26-000000000004", // DS2438
+		"1f-000000000005", // nested coupler
+	}}
+
+	b := NewBus(WithBackend(backend), WithClock(newFakeClock()), WithExclude("28-000000000003"))
+	couplers, err := b.LoadCouplers()
+	if err != nil || len(couplers) != 1 {
+		t.Fatalf("LoadCouplers = %v, %v, want the coupler", couplers, err)
+	}
+	devices, err := b.LoadBranch(couplers[0], BranchMain, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(devices) != 1 || devices[0].Name != "28-000000000002" {
+		t.Fatalf("LoadBranch = %v, want the thermometer behind the branch", devices)
+	}
+
+	cmd, err := os.ReadFile(filepath.Join(dir, "1f-000000000001", "rw"))
+	if err != nil || string(cmd) != string(cmdDirectOnMain) {
+		t.Errorf("last command %x, %v, want %x", cmd, err, cmdDirectOnMain)
+	}
+}
+
+func TestLoadBranchUnsupported(t *testing.T) {
+	b := NewBus(WithBackend(&fakeBackend{names: []string{"1f-000000000001"}}))
+	couplers, err := b.LoadCouplers()
+	if err != nil || len(couplers) != 1 {
+		t.Fatalf("LoadCouplers = %v, %v, want the coupler", couplers, err)
+	}
+	if _, err := b.LoadBranch(couplers[0], BranchMain, 0); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("LoadBranch = %v, want ErrUnsupported", err)
+	}
+	if err := couplers[0].Off(); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("Off = %v, want ErrUnsupported", err)
+	}
+}
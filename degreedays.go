@@ -0,0 +1,183 @@
+package rpionewire
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// degreeDayMaxGap is the longest interval between two readings of a
+// device integrated into its degree-days, longer gaps, such as a
+// restart, being skipped rather than extrapolated
+const degreeDayMaxGap = time.Hour
+
+// DegreeDays accumulates the heating and cooling degree-days of devices
+// and zones against a base temperature: every day spent 1 °C below the
+// base adds a heating degree-day, every day spent 1 °C above adds a
+// cooling one. Readings are integrated over time, so the result does not
+// depend on the polling interval.
+//
+// DegreeDays is a Sink to add to the poller sinks, derived readings
+// such as zone aggregates included. It persists its counters to a JSON
+// file, every SaveInterval and when flushed by a stopping Poller, and
+// reloads them on creation so that they survive restarts.
+type DegreeDays struct {
+	// Base is the base temperature in °C
+	Base float64
+	// SaveInterval is the minimum time between two saves while polling,
+	// 10 minutes if zero
+	SaveInterval time.Duration
+
+	path string
+
+	mu       sync.Mutex
+	counters map[string]*degreeDayCounter
+	saved    time.Time
+}
+
+// degreeDayCounter is the state of a device, as persisted
+type degreeDayCounter struct {
+	Heating float64 `json:"heating"`
+	Cooling float64 `json:"cooling"`
+	// Time and Temp are those of the last reading integrated
+	Time time.Time `json:"time"`
+	Temp float64   `json:"temp"`
+}
+
+// NewDegreeDays returns DegreeDays accumulated against base, persisted
+// to the file at path, none if empty. The counters of an existing file
+// are loaded.
+func NewDegreeDays(base float64, path string) (*DegreeDays, error) {
+	dd := &DegreeDays{Base: base, path: path, counters: map[string]*degreeDayCounter{}}
+	if path == "" {
+		return dd, nil
+	}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return dd, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Error loading degree-days: %w", err)
+	}
+	if err := json.Unmarshal(b, &dd.counters); err != nil {
+		return nil, fmt.Errorf("Error loading degree-days from %v: %w", path, err)
+	}
+	return dd, nil
+}
+
+// WriteReadings integrates the valid temperature readings into the
+// degree-days of their devices, saving the counters when SaveInterval
+// elapsed
+func (dd *DegreeDays) WriteReadings(readings []Reading) error {
+	dd.mu.Lock()
+	defer dd.mu.Unlock()
+	var now time.Time
+	for _, r := range readings {
+		if r.Device == nil || r.Err != nil || !r.IsTemperature() {
+			continue
+		}
+		if r.Time.After(now) {
+			now = r.Time
+		}
+		c, ok := dd.counters[r.Device.Name]
+		if !ok {
+			c = new(degreeDayCounter)
+			dd.counters[r.Device.Name] = c
+		}
+		if gap := r.Time.Sub(c.Time); !c.Time.IsZero() && gap > 0 && gap <= degreeDayMaxGap {
+			// The mean of the interval against the base, in degree-days
+			days := gap.Hours() / 24
+			mean := (c.Temp + float64(r.Value)) / 2
+			if mean < dd.Base {
+				c.Heating += (dd.Base - mean) * days
+			} else {
+				c.Cooling += (mean - dd.Base) * days
+			}
+		}
+		c.Time, c.Temp = r.Time, float64(r.Value)
+	}
+
+	interval := dd.SaveInterval
+	if interval == 0 {
+		interval = 10 * time.Minute
+	}
+	if !now.IsZero() && now.Sub(dd.saved) >= interval {
+		return dd.save(now)
+	}
+	return nil
+}
+
+// Flush saves the counters
+func (dd *DegreeDays) Flush() error {
+	dd.mu.Lock()
+	defer dd.mu.Unlock()
+	return dd.save(time.Now())
+}
+
+// save writes the counters to the file, replacing it atomically, dd.mu
+// being held
+func (dd *DegreeDays) save(now time.Time) error {
+	if dd.path == "" {
+		return nil
+	}
+	b, err := json.MarshalIndent(dd.counters, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(dd.path), ".degree-days-*")
+	if err != nil {
+		return fmt.Errorf("Error saving degree-days: %w", err)
+	}
+	_, err = tmp.Write(b)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), dd.path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("Error saving degree-days: %w", err)
+	}
+	dd.saved = now
+	return nil
+}
+
+// Get returns the heating and cooling degree-days of the device or zone
+// named name
+func (dd *DegreeDays) Get(name string) (heating, cooling float64, ok bool) {
+	dd.mu.Lock()
+	defer dd.mu.Unlock()
+	c, ok := dd.counters[name]
+	if !ok {
+		return 0, 0, false
+	}
+	return c.Heating, c.Cooling, true
+}
+
+// Names returns the devices and zones with degree-days, sorted
+func (dd *DegreeDays) Names() []string {
+	dd.mu.Lock()
+	defer dd.mu.Unlock()
+	names := make([]string, 0, len(dd.counters))
+	for name := range dd.counters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Reset clears the degree-days of every device, starting a new period
+func (dd *DegreeDays) Reset() {
+	dd.mu.Lock()
+	defer dd.mu.Unlock()
+	for _, c := range dd.counters {
+		c.Heating, c.Cooling = 0, 0
+	}
+}
@@ -0,0 +1,86 @@
+package rpionewire
+
+import (
+	"fmt"
+	"time"
+)
+
+// DeltaT is the temperature difference between two devices, such as the
+// flow and return of a heating loop. A Poller configured WithDeltaT
+// hands it to its sinks as a synthetic reading, flagged FlagDerived, of
+// a device of type "delta-t" named Name, so that an AlertRule on Name
+// gives it alert thresholds of its own.
+type DeltaT struct {
+	Name string
+	// Hot and Cold are the devices, by sysfs name or alias, the
+	// difference being Hot minus Cold
+	Hot, Cold string
+}
+
+// deltaT is a DeltaT computed by a Poller
+type deltaT struct {
+	DeltaT
+	device *DS1820
+}
+
+// WithDeltaT makes the poller compute dt from the latest valid readings
+// of its devices after every cycle
+func WithDeltaT(dt DeltaT) PollerOption {
+	return func(p *Poller) {
+		p.deltas = append(p.deltas, &deltaT{DeltaT: dt, device: &DS1820{Name: dt.Name, DeviceType: "delta-t"}})
+	}
+}
+
+// derive records readings as the latest of their devices and returns
+// the derived readings, zone aggregates, temperature differences, then
+// the power and energy of the heat meters
+func (p *Poller) derive(readings []Reading, now time.Time) []Reading {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.latest == nil {
+		p.latest = map[*DS1820]Reading{}
+	}
+	for _, r := range readings {
+		p.latest[r.Device] = r
+	}
+
+	derived := p.aggregate(now)
+	for _, dt := range p.deltas {
+		r := Reading{Device: dt.device, Time: now, Flags: FlagDerived}
+		hot, err := p.latestOf(dt.Hot)
+		if err == nil {
+			var cold Temperature
+			if cold, err = p.latestOf(dt.Cold); err == nil {
+				r.Value = hot - cold
+			}
+		}
+		if err != nil {
+			r.Err = fmt.Errorf("Error computing %v: %w", dt.Name, err)
+		}
+		derived = append(derived, r)
+	}
+	for _, h := range p.heatMeters {
+		h.WriteReadings(derived)
+		derived = append(derived, h.readings(now)...)
+	}
+	return derived
+}
+
+// latestOf returns the latest valid temperature of the device named
+// name, by sysfs name or alias, p.mu being held
+func (p *Poller) latestOf(name string) (Temperature, error) {
+	for _, d := range p.devices {
+		if d.Name != name && (d.Alias == "" || d.Alias != name) {
+			continue
+		}
+		r, ok := p.latest[d]
+		if !ok {
+			return 0, &DeviceError{Name: name, Err: ErrNoData}
+		}
+		if r.Err != nil {
+			return 0, &DeviceError{Name: name, Err: r.Err}
+		}
+		return r.Value, nil
+	}
+	return 0, &DeviceError{Name: name, Err: ErrMissing}
+}
@@ -0,0 +1,24 @@
+package rpionewire
+
+// extendedResolution computes the temperature of a DS18S20 from its
+// scratchpad with the COUNT_REMAIN and COUNT_PER_C registers, giving
+// about 0.1 °C of resolution instead of the 0.5 °C of its temperature
+// register. It returns false if the scratchpad is not usable.
+//
+// The datasheet formula is
+//
+//	TEMP_READ - 0.25 + (COUNT_PER_C - COUNT_REMAIN) / COUNT_PER_C
+//
+// TEMP_READ being the temperature register with its 0.5 °C bit
+// truncated.
+func extendedResolution(scratchpad []byte) (int64, bool) {
+	if len(scratchpad) < 8 {
+		return 0, false
+	}
+	countRemain, countPerC := int64(scratchpad[6]), int64(scratchpad[7])
+	if countPerC == 0 || countRemain > countPerC {
+		return 0, false
+	}
+	tempRead := int64(int16(uint16(scratchpad[1])<<8|uint16(scratchpad[0])) >> 1)
+	return tempRead*1000 - 250 + 1000*(countPerC-countRemain)/countPerC, true
+}
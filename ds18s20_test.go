@@ -0,0 +1,31 @@
+package rpionewire
+
+import "testing"
+
+func TestExtendedResolution(t *testing.T) {
+	tests := []struct {
+		name       string
+		scratchpad []byte
+		millis     int64
+		ok         bool
+	}{
+		// Temperature register, TH, TL, two reserved bytes, COUNT_REMAIN
+		// and COUNT_PER_C, as in the datasheet
+		{"+25 °C", []byte{0x32, 0x00, 0x4b, 0x46, 0xff, 0xff, 0x0c, 0x10, 0x87}, 25000, true},
+		{"+23.625 °C", []byte{0x2e, 0x00, 0x4b, 0x46, 0xff, 0xff, 0x02, 0x10}, 23625, true},
+		{"+85 °C", []byte{0xaa, 0x00, 0x4b, 0x46, 0xff, 0xff, 0x0c, 0x10}, 85000, true},
+		{"-0.75 °C", []byte{0xff, 0xff, 0x4b, 0x46, 0xff, 0xff, 0x08, 0x10}, -750, true},
+		{"-25 °C", []byte{0xce, 0xff, 0x4b, 0x46, 0xff, 0xff, 0x0c, 0x10}, -25000, true},
+		{"-55.25 °C", []byte{0x92, 0xff, 0x4b, 0x46, 0xff, 0xff, 0x10, 0x10}, -55250, true},
+		{"COUNT_PER_C zero", []byte{0x32, 0x00, 0x4b, 0x46, 0xff, 0xff, 0x0c, 0x00}, 0, false},
+		{"COUNT_REMAIN above COUNT_PER_C", []byte{0x32, 0x00, 0x4b, 0x46, 0xff, 0xff, 0x11, 0x10}, 0, false},
+		{"short", []byte{0x32, 0x00, 0x4b, 0x46, 0xff, 0xff, 0x0c}, 0, false},
+		{"nil", nil, 0, false},
+	}
+	for _, tt := range tests {
+		millis, ok := extendedResolution(tt.scratchpad)
+		if millis != tt.millis || ok != tt.ok {
+			t.Errorf("%v: extendedResolution = %v, %v, want %v, %v", tt.name, millis, ok, tt.millis, tt.ok)
+		}
+	}
+}
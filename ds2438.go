@@ -0,0 +1,117 @@
+package rpionewire
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const familyDS2438 = 0x26
+
+// HumidityCurve converts the output of an analog humidity sensor into
+// relative humidity: RH = (VAD/VDD - Offset) / Slope, compensated for
+// temperature as RH / (TempA - TempB*T).
+type HumidityCurve struct {
+	Offset float64
+	Slope  float64
+	TempA  float64
+	TempB  float64
+}
+
+var (
+	// HIH4000 is the transfer function of the Honeywell HIH-4000 series
+	HIH4000 = HumidityCurve{Offset: 0.16, Slope: 0.0062, TempA: 1.0546, TempB: 0.00216}
+	// HIH5030 is the transfer function of the Honeywell HIH-5030/5031
+	HIH5030 = HumidityCurve{Offset: 0.1515, Slope: 0.00636, TempA: 1.0546, TempB: 0.00216}
+)
+
+// RelativeHumidity returns the relative humidity in percent for a
+// sensor output of vad volts, supplied with vdd volts, at temp °C
+func (c HumidityCurve) RelativeHumidity(vad, vdd, temp float64) float64 {
+	rh := (vad/vdd - c.Offset) / c.Slope
+	if c.TempA != 0 {
+		rh /= c.TempA - c.TempB*temp
+	}
+	if rh < 0 {
+		return 0
+	}
+	if rh > 100 {
+		return 100
+	}
+	return rh
+}
+
+// HumiditySensor is a 1-Wire humidity module built around a DS2438
+// battery monitor, whose VAD input samples an analog humidity sensor
+// and VDD input its supply
+type HumiditySensor struct {
+	ID    uint64
+	Name  string
+	Curve HumidityCurve
+
+	bus *Bus
+}
+
+// LoadHumiditySensors builds a list of the DS2438 based humidity
+// modules on the bus, converting their output with curve. The
+// devices excluded, or not allowed, at discovery are left out.
+func (b *Bus) LoadHumiditySensors(curve HumidityCurve) ([]*HumiditySensor, error) {
+	names, err := b.backend.Devices()
+	if err != nil {
+		return nil, fmt.Errorf("Error finding one wire devices: %w", err)
+	}
+
+	var sensors []*HumiditySensor
+	for _, name := range b.filter(names) {
+		if !strings.HasPrefix(name, fmt.Sprintf("%02x-", familyDS2438)) {
+			continue
+		}
+		id, err := strconv.ParseUint(name[3:], 16, 64)
+		if err != nil {
+			return nil, fmt.Errorf("Error decoding %v device id: %w", name, err)
+		}
+		sensors = append(sensors, &HumiditySensor{ID: id, Name: name, Curve: curve, bus: b})
+	}
+
+	return sensors, nil
+}
+
+// LoadHumiditySensors builds a list of the DS2438 based humidity
+// modules on the default bus
+func LoadHumiditySensors(curve HumidityCurve) ([]*HumiditySensor, error) {
+	return defaultBus.LoadHumiditySensors(curve)
+}
+
+// Measure reads the module and returns its temperature, relative
+// humidity and the VAD and VDD voltages
+func (h *HumiditySensor) Measure() ([]Measurement, error) {
+	t, err := h.ReadTemperature()
+	if err != nil {
+		return nil, err
+	}
+	temp := float64(t)
+
+	raw, err := readAttr(h.bus.backend, h.Name, "vad")
+	if err != nil {
+		return nil, err
+	}
+	vad := float64(raw) / 100
+
+	raw, err = readAttr(h.bus.backend, h.Name, "vdd")
+	if err != nil {
+		return nil, err
+	}
+	vdd := float64(raw) / 100
+	if vdd == 0 {
+		return nil, errors.New("Error reading humidity: VDD is 0")
+	}
+
+	now := h.bus.clock.Now()
+	return []Measurement{
+		{Kind: KindTemperature, Value: temp, Unit: Celsius.Symbol(), Time: now},
+		{Kind: KindHumidity, Value: h.Curve.RelativeHumidity(vad, vdd, temp), Unit: "%RH", Time: now},
+		{Kind: KindVoltage, Value: vad, Unit: "V", Time: now},
+		{Kind: KindVoltage, Value: vdd, Unit: "V", Time: now},
+	}, nil
+}
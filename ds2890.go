@@ -0,0 +1,164 @@
+package rpionewire
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const familyDS2890 = 0x2c
+
+// DS2890 commands and codes
+const (
+	cmdReadPosition  = 0xf0
+	cmdWritePosition = 0x0f
+	cmdWriteControl  = 0x55
+	codeRelease      = 0x96
+	// controlWiper selects the only potentiometer of the DS2890, its
+	// complement bits set as the datasheet requires, controlChargePump
+	// enables the charge pump
+	controlWiper      = 0x0c
+	controlChargePump = 0x40
+)
+
+// Potentiometer is a DS2890 digital potentiometer, a resistor whose
+// wiper is set from the bus in 256 steps, for simple analog control
+// such as dimming or the set point of a fan controller. The kernel has
+// no driver for it: the potentiometer is driven through the raw rw
+// attribute of the w1 subsystem.
+type Potentiometer struct {
+	ID   uint64
+	Name string
+
+	// dir is the devices directory of the potentiometer
+	dir string
+
+	mu sync.Mutex
+}
+
+// LoadPotentiometers builds a list of the DS2890 potentiometers on the
+// bus
+func (b *Bus) LoadPotentiometers() ([]*Potentiometer, error) {
+	names, err := findDevices(b.dir)
+	if err != nil {
+		return nil, fmt.Errorf("Error finding one wire devices: %w", err)
+	}
+
+	var pots []*Potentiometer
+	for _, name := range names {
+		if !strings.HasPrefix(name, fmt.Sprintf("%02x-", familyDS2890)) {
+			continue
+		}
+		id, err := strconv.ParseUint(name[3:], 16, 64)
+		if err != nil {
+			return nil, fmt.Errorf("Error decoding %v device id: %w", name, err)
+		}
+		pots = append(pots, &Potentiometer{ID: id, Name: name, dir: b.dir})
+	}
+
+	return pots, nil
+}
+
+// LoadPotentiometers builds a list of the DS2890 potentiometers on the
+// default bus
+func LoadPotentiometers() ([]*Potentiometer, error) {
+	return defaultBus.LoadPotentiometers()
+}
+
+// DeviceName returns the kernel name of the potentiometer
+func (p *Potentiometer) DeviceName() string { return p.Name }
+
+// DeviceID returns the serial number of the potentiometer
+func (p *Potentiometer) DeviceID() uint64 { return p.ID }
+
+// Position returns the position of the wiper, from 0 to 255
+func (p *Potentiometer) Position() (uint8, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	_, pos, err := p.read()
+	return pos, err
+}
+
+// SetPosition moves the wiper to pos, from 0 to 255, and checks that
+// the potentiometer took it
+func (p *Potentiometer) SetPosition(pos uint8) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err := p.write(cmdWritePosition, pos); err != nil {
+		return fmt.Errorf("Error setting position of %v: %w", p.Name, err)
+	}
+	if _, got, err := p.read(); err != nil {
+		return fmt.Errorf("Error setting position of %v: %w", p.Name, err)
+	} else if got != pos {
+		return fmt.Errorf("Error setting position of %v: wiper at %v after writing %v", p.Name, got, pos)
+	}
+	return nil
+}
+
+// ChargePump tells whether the charge pump of the potentiometer is on,
+// needed to drive the wiper beyond the supply voltage
+func (p *Potentiometer) ChargePump() (bool, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	control, _, err := p.read()
+	return control&controlChargePump != 0, err
+}
+
+// SetChargePump switches the charge pump of the potentiometer on or
+// off
+func (p *Potentiometer) SetChargePump(on bool) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	control := byte(controlWiper)
+	if on {
+		control |= controlChargePump
+	}
+	if err := p.write(cmdWriteControl, control); err != nil {
+		return fmt.Errorf("Error setting charge pump of %v: %w", p.Name, err)
+	}
+	return nil
+}
+
+// read returns the control register and the wiper position
+func (p *Potentiometer) read() (byte, uint8, error) {
+	f, err := os.OpenFile(filepath.Join(p.dir, p.Name, "rw"), os.O_RDWR, 0)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+	if _, err := f.Write([]byte{cmdReadPosition}); err != nil {
+		return 0, 0, fmt.Errorf("Error reading %v: %w", p.Name, err)
+	}
+	buf := make([]byte, 2)
+	if _, err := f.Read(buf); err != nil {
+		return 0, 0, fmt.Errorf("Error reading %v: %w", p.Name, err)
+	}
+	return buf[0], buf[1], nil
+}
+
+// write sends cmd and its value, then the release code committing it.
+// The rw attribute resets the bus on every write, so the echo of the
+// value is clocked by writing ones, which are read slots, in the same
+// block; the byte read afterwards is zero when the device accepted the
+// release.
+func (p *Potentiometer) write(cmd, value byte) error {
+	f, err := os.OpenFile(filepath.Join(p.dir, p.Name, "rw"), os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := f.Write([]byte{cmd, value, 0xff, codeRelease}); err != nil {
+		return err
+	}
+	buf := make([]byte, 1)
+	if _, err := f.Read(buf); err != nil {
+		return err
+	}
+	if buf[0] != 0 {
+		return fmt.Errorf("release rejected with 0x%02x", buf[0])
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package rpionewire
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const familyDS28E17 = 0x19
+
+// I2CBridge is a DS28E17 1-Wire to I2C master bridge, giving access to
+// the I2C peripherals wired to it, such as pressure sensors or small
+// displays, from the 1-Wire bus. The kernel w1_ds28e17 driver exposes
+// it as an I2C adapter, which the bridge drives through its character
+// device.
+type I2CBridge struct {
+	ID   uint64
+	Name string
+
+	// dir is the devices directory of the bridge
+	dir string
+
+	mu sync.Mutex
+}
+
+// LoadI2CBridges builds a list of the DS28E17 bridges on the bus
+func (b *Bus) LoadI2CBridges() ([]*I2CBridge, error) {
+	names, err := findDevices(b.dir)
+	if err != nil {
+		return nil, fmt.Errorf("Error finding one wire devices: %w", err)
+	}
+
+	var bridges []*I2CBridge
+	for _, name := range names {
+		if !strings.HasPrefix(name, fmt.Sprintf("%02x-", familyDS28E17)) {
+			continue
+		}
+		id, err := strconv.ParseUint(name[3:], 16, 64)
+		if err != nil {
+			return nil, fmt.Errorf("Error decoding %v device id: %w", name, err)
+		}
+		bridges = append(bridges, &I2CBridge{ID: id, Name: name, dir: b.dir})
+	}
+
+	return bridges, nil
+}
+
+// LoadI2CBridges builds a list of the DS28E17 bridges on the default
+// bus
+func LoadI2CBridges() ([]*I2CBridge, error) {
+	return defaultBus.LoadI2CBridges()
+}
+
+// DeviceName returns the kernel name of the bridge
+func (c *I2CBridge) DeviceName() string { return c.Name }
+
+// DeviceID returns the serial number of the bridge
+func (c *I2CBridge) DeviceID() uint64 { return c.ID }
+
+// Adapter returns the path of the character device of the I2C adapter
+// of the bridge, such as /dev/i2c-3, for use with other I2C libraries
+func (c *I2CBridge) Adapter() (string, error) {
+	matches, err := filepath.Glob(filepath.Join(c.dir, c.Name, "i2c-*"))
+	if err != nil {
+		return "", err
+	}
+	if len(matches) == 0 {
+		return "", fmt.Errorf("Error finding I2C adapter of %v: is the w1_ds28e17 module loaded?", c.Name)
+	}
+	return filepath.Join("/dev", filepath.Base(matches[0])), nil
+}
+
+// Tx runs a transaction with the I2C peripheral at the 7 bit address
+// addr: it writes w, then reads len(r) bytes into r with a repeated
+// start, either being possibly empty and neither longer than 255 bytes
+func (c *I2CBridge) Tx(addr uint16, w, r []byte) error {
+	if addr > 0x7f {
+		return fmt.Errorf("Error addressing 0x%x through %v: not a 7 bit I2C address", addr, c.Name)
+	}
+	if len(w) > 255 || len(r) > 255 {
+		return fmt.Errorf("Error addressing 0x%02x through %v: transfers are limited to 255 bytes", addr, c.Name)
+	}
+	dev, err := c.Adapter()
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := i2cTransfer(dev, addr, w, r); err != nil {
+		return fmt.Errorf("Error addressing 0x%02x through %v: %w", addr, c.Name, err)
+	}
+	return nil
+}
+
+// Speed returns the I2C clock rate of the bridge in kHz: 100, 400 or
+// 900
+func (c *I2CBridge) Speed() (int, error) {
+	raw, err := os.ReadFile(filepath.Join(c.dir, c.Name, "speed"))
+	if err != nil {
+		return 0, fmt.Errorf("Error reading speed of %v: %w", c.Name, err)
+	}
+	return strconv.Atoi(strings.TrimSpace(string(raw)))
+}
+
+// SetSpeed sets the I2C clock rate of the bridge in kHz, 100, 400 or
+// 900
+func (c *I2CBridge) SetSpeed(khz int) error {
+	switch khz {
+	case 100, 400, 900:
+	default:
+		return fmt.Errorf("Error setting speed of %v: %v kHz is not one of 100, 400 or 900", c.Name, khz)
+	}
+	if err := os.WriteFile(filepath.Join(c.dir, c.Name, "speed"), []byte(strconv.Itoa(khz)), 0200); err != nil {
+		return fmt.Errorf("Error setting speed of %v: %w", c.Name, err)
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+package rpionewire
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// EventType identifies what happened in an Event
+type EventType int
+
+const (
+	// DeviceAdded is published when a device shows up in a discovery
+	DeviceAdded EventType = iota
+	// DeviceRemoved is published when a device previously discovered is
+	// missing from a discovery
+	DeviceRemoved
+	// ReadFailed is published when a device read fails
+	ReadFailed
+	// CRCRetried is published when a read is retried after a CRC mismatch
+	CRCRetried
+	// AlarmRaised is published when a device value crosses an alarm
+	// threshold
+	AlarmRaised
+	// MasterFailover is published when the reads of a device moved to
+	// another bus master, see WithMasterFailover
+	MasterFailover
+)
+
+func (t EventType) String() string {
+	switch t {
+	case DeviceAdded:
+		return "DeviceAdded"
+	case DeviceRemoved:
+		return "DeviceRemoved"
+	case ReadFailed:
+		return "ReadFailed"
+	case CRCRetried:
+		return "CRCRetried"
+	case AlarmRaised:
+		return "AlarmRaised"
+	case MasterFailover:
+		return "MasterFailover"
+	}
+	return fmt.Sprintf("EventType(%d)", int(t))
+}
+
+// Event is a structured notification of something that happened on
+// the bus
+type Event struct {
+	Type EventType
+	// Device is the name of the device the event is about
+	Device string
+	Time   time.Time
+	// Value is the value that raised an alarm
+	Value float64
+	// Err is the error of a failed read, or of the read that made the
+	// device fail over
+	Err error
+	// Master is the bus master a device failed over to
+	Master string
+}
+
+func (e Event) String() string {
+	if e.Type == MasterFailover {
+		return fmt.Sprintf("%v %v to %v: %v", e.Type, e.Device, e.Master, e.Err)
+	}
+	if e.Err != nil {
+		return fmt.Sprintf("%v %v: %v", e.Type, e.Device, e.Err)
+	}
+	return fmt.Sprintf("%v %v", e.Type, e.Device)
+}
+
+// fanout delivers values to a set of subscribers
+type fanout[T any] struct {
+	mu   sync.Mutex
+	subs map[chan T]struct{}
+}
+
+// subscribe adds a subscriber with a buffer of size buffer and returns
+// its channel and the function ending the subscription
+func (f *fanout[T]) subscribe(buffer int) (<-chan T, func()) {
+	c := make(chan T, buffer)
+
+	f.mu.Lock()
+	if f.subs == nil {
+		f.subs = make(map[chan T]struct{})
+	}
+	f.subs[c] = struct{}{}
+	f.mu.Unlock()
+
+	var once sync.Once
+	return c, func() {
+		once.Do(func() {
+			f.mu.Lock()
+			delete(f.subs, c)
+			f.mu.Unlock()
+			close(c)
+		})
+	}
+}
+
+// send delivers v to every subscriber with room for it
+func (f *fanout[T]) send(v T) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for c := range f.subs {
+		select {
+		case c <- v:
+		default:
+		}
+	}
+}
+
+// Subscribe returns a channel receiving the events of the bus and a
+// function ending the subscription and closing the channel. Events are
+// dropped for a subscriber whose buffer of size buffer is full, so a
+// slow subscriber never blocks reads.
+func (b *Bus) Subscribe(buffer int) (<-chan Event, func()) {
+	return b.events.subscribe(buffer)
+}
+
+// Subscribe subscribes to the events of the default bus
+func Subscribe(buffer int) (<-chan Event, func()) {
+	return defaultBus.Subscribe(buffer)
+}
+
+// publish delivers e to the subscribers of the bus
+func (b *Bus) publish(e Event) {
+	if e.Time.IsZero() {
+		e.Time = b.clock.Now()
+	}
+	b.events.send(e)
+}
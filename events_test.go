@@ -0,0 +1,29 @@
+package rpionewire
+
+import (
+	"io"
+	"testing"
+	"time"
+)
+
+func TestEventsFakeClock(t *testing.T) {
+	clock := newFakeClock()
+	backend := &fakeBackend{names: []string{"28-000000000001"}, err: io.ErrUnexpectedEOF}
+	bus := NewBus(WithBackend(backend), WithClock(clock))
+	devices, err := bus.LoadDevices()
+	if err != nil {
+		t.Fatal(err)
+	}
+	events, cancel := bus.Subscribe(4)
+	defer cancel()
+
+	clock.Sleep(time.Hour)
+	r, _ := devices[0].Read()
+	if !r.Time.Equal(clock.Now()) {
+		t.Errorf("reading at %v, want %v", r.Time, clock.Now())
+	}
+	e := <-events
+	if e.Type != ReadFailed || !e.Time.Equal(clock.Now()) {
+		t.Errorf("got %v event at %v, want a read failure at %v", e.Type, e.Time, clock.Now())
+	}
+}
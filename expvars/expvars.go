@@ -0,0 +1,155 @@
+// Package expvars publishes the readings and instrumentation of
+// rpionewire through the expvar package, so Go services embedding
+// rpionewire get them on /debug/vars without further setup.
+//
+//	vars := expvars.Publish("rpionewire")
+//	bus := rpionewire.NewBus(rpionewire.WithMetrics(vars))
+//	devices, _ := bus.LoadDevices()
+//	p := rpionewire.NewPoller(devices, 30*time.Second,
+//		rpionewire.WithSinks(vars), rpionewire.WithPollerMetrics(vars))
+//
+// The published map holds four maps: counters, gauges and histograms,
+// keyed by metric name and labels, and readings, keyed by device name.
+package expvars
+
+import (
+	"encoding/json"
+	"expvar"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fredcarle/rpionewire"
+	"github.com/fredcarle/rpionewire/server"
+)
+
+// Vars is a rpionewire.Metrics and a rpionewire.Sink publishing to an
+// expvar map
+type Vars struct {
+	counters   *expvar.Map
+	gauges     *expvar.Map
+	histograms *expvar.Map
+	readings   *expvar.Map
+
+	mu sync.Mutex
+}
+
+// Publish creates the expvar map name and returns the Vars publishing
+// to it. Like expvar.Publish, it panics if name is already in use.
+func Publish(name string) *Vars {
+	v := &Vars{
+		counters:   new(expvar.Map),
+		gauges:     new(expvar.Map),
+		histograms: new(expvar.Map),
+		readings:   new(expvar.Map),
+	}
+	m := expvar.NewMap(name)
+	m.Set("counters", v.counters)
+	m.Set("gauges", v.gauges)
+	m.Set("histograms", v.histograms)
+	m.Set("readings", v.readings)
+	return v
+}
+
+// Counter adds delta to the counter name
+func (v *Vars) Counter(name string, delta float64, labels ...rpionewire.Label) {
+	v.counters.AddFloat(key(name, labels), delta)
+}
+
+// Gauge sets the gauge name to value
+func (v *Vars) Gauge(name string, value float64, labels ...rpionewire.Label) {
+	k := key(name, labels)
+	v.mu.Lock()
+	f, ok := v.gauges.Get(k).(*expvar.Float)
+	if !ok {
+		f = new(expvar.Float)
+		v.gauges.Set(k, f)
+	}
+	v.mu.Unlock()
+	f.Set(value)
+}
+
+// Histogram records an observation of value in the summary of name
+func (v *Vars) Histogram(name string, value float64, labels ...rpionewire.Label) {
+	k := key(name, labels)
+	v.mu.Lock()
+	s, ok := v.histograms.Get(k).(*summary)
+	if !ok {
+		s = &summary{Min: math.Inf(1), Max: math.Inf(-1)}
+		v.histograms.Set(k, s)
+	}
+	v.mu.Unlock()
+	s.observe(value)
+}
+
+// WriteReadings publishes the readings of a poll cycle
+func (v *Vars) WriteReadings(rs []rpionewire.Reading) error {
+	now := time.Now()
+	for _, r := range rs {
+		info := server.NewReading(r, now)
+		v.readings.Set(info.Name, jsonVar{info})
+	}
+	return nil
+}
+
+// key returns the key of a metric, such as
+// rpionewire_reads_total{device="28-0316a2794bff"}
+func key(name string, labels []rpionewire.Label) string {
+	if len(labels) == 0 {
+		return name
+	}
+	var sb strings.Builder
+	sb.WriteString(name)
+	sb.WriteByte('{')
+	for i, l := range labels {
+		if i > 0 {
+			sb.WriteByte(',')
+		}
+		sb.WriteString(l.Name)
+		sb.WriteString(`="`)
+		sb.WriteString(l.Value)
+		sb.WriteByte('"')
+	}
+	sb.WriteByte('}')
+	return sb.String()
+}
+
+// summary is the expvar form of a histogram: the count, sum and bounds
+// of its observations
+type summary struct {
+	mu    sync.Mutex
+	Count uint64  `json:"count"`
+	Sum   float64 `json:"sum"`
+	Min   float64 `json:"min"`
+	Max   float64 `json:"max"`
+}
+
+func (s *summary) observe(v float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Count++
+	s.Sum += v
+	s.Min = math.Min(s.Min, v)
+	s.Max = math.Max(s.Max, v)
+}
+
+func (s *summary) String() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, _ := json.Marshal(s)
+	return string(b)
+}
+
+// jsonVar is an expvar.Var publishing a value as JSON
+type jsonVar struct {
+	v interface{}
+}
+
+func (j jsonVar) String() string {
+	b, err := json.Marshal(j.v)
+	if err != nil {
+		return "null"
+	}
+	return string(b)
+}
@@ -0,0 +1,90 @@
+package rpionewire
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// WithMasterFailover makes the bus move a device to another bus master
+// when a read through its own master fails, for installations where
+// redundant adapters are wired to the same bus. The kernel binds a
+// device to the first master finding it; on failure the device is
+// removed from that master and the other masters search for it. If
+// one of them finds it within wait, a MasterFailover event is published
+// and the read is retried once through it; otherwise the failed master
+// searches again to take the device back. CRC mismatches, which tell a
+// noisy bus rather than a failed master, do not fail over.
+//
+// Failover needs the local sysfs backend and more than one master.
+func WithMasterFailover(wait time.Duration) Option {
+	return func(b *Bus) {
+		b.failoverWait = wait
+	}
+}
+
+// failover moves d from its master to another one, returning the master
+// now reaching it
+func (b *Bus) failover(d *DS1820) (*Master, error) {
+	if _, ok := b.backend.(*Sysfs); !ok {
+		return nil, fmt.Errorf("Error failing over %v: %w", d.Name, ErrUnsupported)
+	}
+	failed := b.masterOf(d)
+	if failed == nil {
+		return nil, fmt.Errorf("Error failing over %v: no master reaches it", d.Name)
+	}
+	masters, err := b.Masters()
+	if err != nil {
+		return nil, err
+	}
+	var others []*Master
+	for _, m := range masters {
+		if m != failed {
+			others = append(others, m)
+		}
+	}
+	if len(others) == 0 {
+		return nil, fmt.Errorf("Error failing over %v: %v is the only master", d.Name, failed.Name)
+	}
+
+	if err := os.WriteFile(filepath.Join(b.dir, failed.Name, "w1_master_remove"), []byte(d.Name), 0200); err != nil {
+		return nil, fmt.Errorf("Error removing %v from %v: %w", d.Name, failed.Name, err)
+	}
+	for _, m := range others {
+		if err := os.WriteFile(filepath.Join(b.dir, m.Name, "w1_master_search"), []byte("1"), 0644); err != nil {
+			return nil, fmt.Errorf("Error triggering search on %v: %w", m.Name, err)
+		}
+	}
+
+	deadline := b.clock.Now().Add(b.failoverWait)
+	for {
+		for _, m := range others {
+			slaves, err := masterSlaves(b.dir, m.Name)
+			if err != nil {
+				continue
+			}
+			for _, s := range slaves {
+				if s == d.Name {
+					b.mu.Lock()
+					b.deviceMasters[d.Name] = m
+					b.mu.Unlock()
+					return m, nil
+				}
+			}
+		}
+		if b.clock.Now().After(deadline) {
+			break
+		}
+		b.clock.Sleep(100 * time.Millisecond)
+	}
+
+	// Nobody else reaches the device: the bus is down rather than the
+	// master, which is asked to find it again
+	err = fmt.Errorf("Error failing over %v: no other master found it", d.Name)
+	if serr := os.WriteFile(filepath.Join(b.dir, failed.Name, "w1_master_search"), []byte("1"), 0644); serr != nil {
+		err = errors.Join(err, fmt.Errorf("Error triggering search on %v: %w", failed.Name, serr))
+	}
+	return nil, err
+}
@@ -0,0 +1,88 @@
+package rpionewire
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// PWMOutput is an output driven by a duty cycle, such as a fan on a
+// hardware PWM channel
+type PWMOutput interface {
+	// SetDuty sets the duty cycle, from 0 to 100
+	SetDuty(percent float64) error
+}
+
+// CurvePoint maps a temperature, in °C, to a duty cycle in percent
+type CurvePoint struct {
+	Temp float64
+	Duty float64
+}
+
+// FanCurve maps temperatures to duty cycles, interpolating linearly
+// between its points and holding the duty of the first and last points
+// beyond them
+type FanCurve []CurvePoint
+
+// Duty returns the duty cycle for the temperature v
+func (c FanCurve) Duty(v float64) float64 {
+	if len(c) == 0 {
+		return 100
+	}
+	points := append(FanCurve(nil), c...)
+	sort.Slice(points, func(i, j int) bool { return points[i].Temp < points[j].Temp })
+	if v <= points[0].Temp {
+		return points[0].Duty
+	}
+	for i := 1; i < len(points); i++ {
+		a, b := points[i-1], points[i]
+		if v <= b.Temp {
+			return a.Duty + (b.Duty-a.Duty)*(v-a.Temp)/(b.Temp-a.Temp)
+		}
+	}
+	return points[len(points)-1].Duty
+}
+
+// Fan drives a fan from the temperature of a device, such as a case or
+// heatsink sensor, following a curve. It is a Sink to add to the poller
+// sinks. A failed reading runs the fan at full speed, and an empty curve
+// always does.
+type Fan struct {
+	// Device is the device or zone watched, by sysfs name, alias or
+	// name of a derived reading
+	Device string
+	Curve  FanCurve
+	Output PWMOutput
+
+	mu   sync.Mutex
+	duty float64
+}
+
+// WriteReadings sets the duty cycle of the fan from the reading of the
+// device, if readings has one
+func (f *Fan) WriteReadings(readings []Reading) error {
+	for _, r := range readings {
+		if r.Device == nil || !r.IsTemperature() || (r.Device.Name != f.Device && (r.Device.Alias == "" || r.Device.Alias != f.Device)) {
+			continue
+		}
+		duty := 100.0
+		if r.Err == nil {
+			duty = f.Curve.Duty(float64(r.Value))
+		}
+		if err := f.Output.SetDuty(duty); err != nil {
+			return fmt.Errorf("Error driving the %v fan: %w", f.Device, err)
+		}
+		f.mu.Lock()
+		f.duty = duty
+		f.mu.Unlock()
+		return nil
+	}
+	return nil
+}
+
+// Duty returns the duty cycle last set
+func (f *Fan) Duty() float64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.duty
+}
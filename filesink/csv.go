@@ -0,0 +1,63 @@
+package filesink
+
+import (
+	"bytes"
+	"encoding/csv"
+	"strconv"
+	"time"
+
+	"github.com/fredcarle/rpionewire"
+	"github.com/fredcarle/rpionewire/server"
+)
+
+// csvHeader is the first line of every CSV file
+var csvHeader = []string{"time", "name", "id", "alias", "temp", "flags", "error"}
+
+// CSV is a rpionewire.Sink appending every reading to a rotated file as
+// a CSV record, every file starting with a header
+type CSV struct {
+	file *File
+}
+
+// NewCSV returns a CSV sink appending to the file at path
+func NewCSV(path string, rotation Rotation) (*CSV, error) {
+	var header bytes.Buffer
+	cw := csv.NewWriter(&header)
+	cw.Write(csvHeader)
+	cw.Flush()
+	f, err := openFile(path, rotation, header.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	return &CSV{file: f}, nil
+}
+
+// WriteReadings appends the temperature readings in a single write, as
+// JSONL does
+func (s *CSV) WriteReadings(rs []rpionewire.Reading) error {
+	now := time.Now()
+	var buf bytes.Buffer
+	cw := csv.NewWriter(&buf)
+	for _, r := range rs {
+		if !r.IsTemperature() {
+			continue
+		}
+		info := server.NewReading(r, now)
+		temp := ""
+		if info.Temp != nil {
+			temp = strconv.FormatFloat(*info.Temp, 'f', -1, 64)
+		}
+		cw.Write([]string{info.Time.Format(time.RFC3339), info.Name, info.ID, info.Alias, temp, info.Flags, info.Error})
+	}
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		return err
+	}
+	_, err := s.file.Write(buf.Bytes())
+	return err
+}
+
+// Close closes the file
+func (s *CSV) Close() error {
+	return s.file.Close()
+}
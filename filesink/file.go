@@ -0,0 +1,263 @@
+// Package filesink writes the readings of rpionewire devices to local
+// files, rotated by size and age, for later batch ingestion. Rotated
+// files can be compressed and removed once expired so that months of
+// logging fit on an SD card.
+package filesink
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Rotation configures when a file is rotated: renamed with the time of
+// its rotation, such as readings.jsonl.20261014T150405, and replaced by
+// a new file
+type Rotation struct {
+	// MaxSize rotates the file before it grows beyond MaxSize bytes, 0
+	// disabling rotation by size
+	MaxSize int64
+	// Interval rotates the file once it is Interval old, 0 disabling
+	// rotation by age
+	Interval time.Duration
+	// Daily rotates the file at local midnight
+	Daily bool
+	// Compress gzips the rotated files, adding a .gz extension
+	Compress bool
+	// MaxAge removes the rotated files older than MaxAge, 0 keeping them
+	// forever
+	MaxAge time.Duration
+}
+
+// File is a file appended to and rotated according to its Rotation
+type File struct {
+	path     string
+	rotation Rotation
+	// header is written at the start of every new file
+	header []byte
+
+	mu     sync.Mutex
+	f      *os.File
+	size   int64
+	opened time.Time
+
+	// wg and errs track the compression and cleanup of rotated files,
+	// running in the background
+	wg   sync.WaitGroup
+	errs []error
+}
+
+// OpenFile opens the file at path for appending, creating it and its
+// directory if needed
+func OpenFile(path string, rotation Rotation) (*File, error) {
+	return openFile(path, rotation, nil)
+}
+
+// openFile opens a File writing header at the start of every new file
+func openFile(path string, rotation Rotation, header []byte) (*File, error) {
+	f := &File{path: path, rotation: rotation, header: header}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("Error opening %v: %w", path, err)
+	}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// open opens the file, f.mu being held
+func (f *File) open() error {
+	file, err := os.OpenFile(f.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("Error opening %v: %w", f.path, err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("Error opening %v: %w", f.path, err)
+	}
+	f.f, f.size, f.opened = file, info.Size(), info.ModTime()
+	if info.Size() == 0 {
+		f.opened = time.Now()
+		if len(f.header) > 0 {
+			n, err := file.Write(f.header)
+			f.size += int64(n)
+			if err != nil {
+				return fmt.Errorf("Error writing %v: %w", f.path, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Write appends p to the file, rotating it first if p would take it
+// beyond its maximum size or if it is due
+func (f *File) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.f == nil {
+		return 0, os.ErrClosed
+	}
+	if f.due(int64(len(p)), time.Now()) {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := f.f.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// due tells whether the file must be rotated before writing n bytes at
+// now, f.mu being held
+func (f *File) due(n int64, now time.Time) bool {
+	if f.size <= int64(len(f.header)) {
+		return false
+	}
+	if f.rotation.MaxSize > 0 && f.size+n > f.rotation.MaxSize {
+		return true
+	}
+	if f.rotation.Daily {
+		y, m, d := f.opened.Date()
+		if now.After(time.Date(y, m, d+1, 0, 0, 0, 0, f.opened.Location())) {
+			return true
+		}
+	}
+	return f.rotation.Interval > 0 && now.Sub(f.opened) >= f.rotation.Interval
+}
+
+// Rotate rotates the file now
+func (f *File) Rotate() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.f == nil {
+		return os.ErrClosed
+	}
+	return f.rotate()
+}
+
+// rotate renames the file after the current time and opens a new one,
+// f.mu being held
+func (f *File) rotate() error {
+	if err := f.f.Close(); err != nil {
+		return fmt.Errorf("Error rotating %v: %w", f.path, err)
+	}
+	f.f = nil
+	rotated := f.path + "." + time.Now().Format("20060102T150405")
+	for i := 1; exists(rotated) || exists(rotated+".gz"); i++ {
+		rotated = fmt.Sprintf("%v.%v.%d", f.path, time.Now().Format("20060102T150405"), i)
+	}
+	if err := os.Rename(f.path, rotated); err != nil {
+		return fmt.Errorf("Error rotating %v: %w", f.path, err)
+	}
+	if f.rotation.Compress || f.rotation.MaxAge > 0 {
+		f.wg.Add(1)
+		go f.archive(rotated)
+	}
+	return f.open()
+}
+
+// exists tells whether a file exists at path
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// archive compresses the rotated file and removes the expired ones
+func (f *File) archive(rotated string) {
+	defer f.wg.Done()
+	var errs []error
+	if f.rotation.Compress {
+		errs = append(errs, compress(rotated))
+	}
+	if f.rotation.MaxAge > 0 {
+		errs = append(errs, f.expire(time.Now().Add(-f.rotation.MaxAge)))
+	}
+	if err := errors.Join(errs...); err != nil {
+		f.mu.Lock()
+		f.errs = append(f.errs, err)
+		f.mu.Unlock()
+	}
+}
+
+// compress replaces the file at path with its gzipped copy
+func compress(path string) error {
+	in, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("Error compressing %v: %w", path, err)
+	}
+	defer in.Close()
+	tmp := path + ".gz.tmp"
+	out, err := os.Create(tmp)
+	if err != nil {
+		return fmt.Errorf("Error compressing %v: %w", path, err)
+	}
+	zw := gzip.NewWriter(out)
+	_, err = io.Copy(zw, in)
+	if err == nil {
+		err = zw.Close()
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, path+".gz")
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("Error compressing %v: %w", path, err)
+	}
+	return os.Remove(path)
+}
+
+// expire removes the rotated files last modified before t
+func (f *File) expire(t time.Time) error {
+	dir, base := filepath.Split(f.path)
+	if dir == "" {
+		dir = "."
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("Error expiring %v: %w", f.path, err)
+	}
+	var errs []error
+	for _, e := range entries {
+		name := e.Name()
+		if !strings.HasPrefix(name, base+".") || strings.HasSuffix(name, ".tmp") || e.IsDir() {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil || !info.ModTime().Before(t) {
+			continue
+		}
+		if err := os.Remove(filepath.Join(dir, name)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			errs = append(errs, fmt.Errorf("Error expiring %v: %w", name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Close closes the file, waiting for the rotated files to be archived.
+// The returned error joins the errors of their compression and cleanup.
+func (f *File) Close() error {
+	f.mu.Lock()
+	var err error
+	if f.f != nil {
+		err = f.f.Close()
+		f.f = nil
+	}
+	f.mu.Unlock()
+
+	f.wg.Wait()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	err = errors.Join(append([]error{err}, f.errs...)...)
+	f.errs = nil
+	return err
+}
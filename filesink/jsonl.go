@@ -0,0 +1,45 @@
+package filesink
+
+import (
+	"bytes"
+	"encoding/json"
+	"time"
+
+	"github.com/fredcarle/rpionewire"
+	"github.com/fredcarle/rpionewire/server"
+)
+
+// JSONL is a rpionewire.Sink appending every reading to a rotated file
+// as a line of JSON, in the form of server.Reading
+type JSONL struct {
+	file *File
+}
+
+// NewJSONL returns a JSONL sink appending to the file at path
+func NewJSONL(path string, rotation Rotation) (*JSONL, error) {
+	f, err := OpenFile(path, rotation)
+	if err != nil {
+		return nil, err
+	}
+	return &JSONL{file: f}, nil
+}
+
+// WriteReadings appends the readings, in a single write so that a
+// rotation never splits the readings of a cycle
+func (s *JSONL) WriteReadings(rs []rpionewire.Reading) error {
+	now := time.Now()
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, r := range rs {
+		if err := enc.Encode(server.NewReading(r, now)); err != nil {
+			return err
+		}
+	}
+	_, err := s.file.Write(buf.Bytes())
+	return err
+}
+
+// Close closes the file
+func (s *JSONL) Close() error {
+	return s.file.Close()
+}
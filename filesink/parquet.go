@@ -0,0 +1,164 @@
+package filesink
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/fredcarle/rpionewire"
+	"github.com/fredcarle/rpionewire/server"
+	"github.com/parquet-go/parquet-go"
+)
+
+// parquetRow is the schema of the Parquet files
+type parquetRow struct {
+	Time  time.Time `parquet:"time,timestamp(millisecond)"`
+	Name  string    `parquet:"name,dict"`
+	ID    string    `parquet:"id,dict"`
+	Alias string    `parquet:"alias,dict"`
+	Host  string    `parquet:"host,dict"`
+	Seq   uint64    `parquet:"seq"`
+	Temp  *float64  `parquet:"temp,optional"`
+	Flags string    `parquet:"flags,dict"`
+	Error string    `parquet:"error"`
+}
+
+// Parquet is a rpionewire.Sink writing the readings to Parquet files
+// in a directory, a file per day by default, for analysis with tools
+// such as pandas or DuckDB.
+//
+// A Parquet file is only readable once complete, so the file in
+// progress is written with a .tmp extension and renamed when the day
+// ends, when it holds MaxRows readings or when the sink is flushed or
+// closed. Files are named after the time of their first reading, such
+// as readings-20261014T000012.parquet.
+type Parquet struct {
+	// Prefix starts the name of the files, "readings" by default
+	Prefix string
+	// MaxRows, if positive, closes the files once they hold MaxRows
+	// readings, before the day ends
+	MaxRows int
+
+	dir string
+
+	mu     sync.Mutex
+	f      *os.File
+	w      *parquet.GenericWriter[parquetRow]
+	path   string
+	opened time.Time
+	rows   int
+}
+
+// NewParquet returns a Parquet sink writing to dir, which is created if
+// needed
+func NewParquet(dir string) (*Parquet, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("Error creating %v: %w", dir, err)
+	}
+	return &Parquet{Prefix: "readings", dir: dir}, nil
+}
+
+// WriteReadings adds the temperature readings to the file in progress
+func (s *Parquet) WriteReadings(rs []rpionewire.Reading) error {
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.w != nil && s.due(now) {
+		if err := s.finish(); err != nil {
+			return err
+		}
+	}
+	if s.w == nil {
+		if err := s.create(now); err != nil {
+			return err
+		}
+	}
+
+	rows := make([]parquetRow, 0, len(rs))
+	for _, r := range rs {
+		if !r.IsTemperature() {
+			continue
+		}
+		info := server.NewReading(r, now)
+		rows = append(rows, parquetRow{
+			Time:  info.Time,
+			Name:  info.Name,
+			ID:    info.ID,
+			Alias: info.Alias,
+			Host:  info.Host,
+			Seq:   info.Seq,
+			Temp:  info.Temp,
+			Flags: info.Flags,
+			Error: info.Error,
+		})
+	}
+	n, err := s.w.Write(rows)
+	s.rows += n
+	if err != nil {
+		return fmt.Errorf("Error writing %v: %w", s.path, err)
+	}
+	return nil
+}
+
+// due tells whether the file in progress must be finished before
+// writing at now, s.mu being held
+func (s *Parquet) due(now time.Time) bool {
+	if s.MaxRows > 0 && s.rows >= s.MaxRows {
+		return true
+	}
+	y, m, d := s.opened.Date()
+	return !now.Before(time.Date(y, m, d+1, 0, 0, 0, 0, s.opened.Location()))
+}
+
+// create starts a new file, s.mu being held
+func (s *Parquet) create(now time.Time) error {
+	prefix := s.Prefix
+	if prefix == "" {
+		prefix = "readings"
+	}
+	path := filepath.Join(s.dir, prefix+"-"+now.Format("20060102T150405")+".parquet")
+	for i := 1; exists(path) || exists(path+".tmp"); i++ {
+		path = filepath.Join(s.dir, fmt.Sprintf("%v-%v.%d.parquet", prefix, now.Format("20060102T150405"), i))
+	}
+	f, err := os.Create(path + ".tmp")
+	if err != nil {
+		return fmt.Errorf("Error creating %v: %w", path, err)
+	}
+	s.f, s.path, s.opened, s.rows = f, path, now, 0
+	s.w = parquet.NewGenericWriter[parquetRow](f)
+	return nil
+}
+
+// finish completes the file in progress, s.mu being held
+func (s *Parquet) finish() error {
+	err := s.w.Close()
+	if cerr := s.f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(s.path+".tmp", s.path)
+	}
+	s.f, s.w = nil, nil
+	if err != nil {
+		return fmt.Errorf("Error writing %v: %w", s.path, err)
+	}
+	return nil
+}
+
+// Flush completes the file in progress, the next readings starting a
+// new one
+func (s *Parquet) Flush() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.w == nil {
+		return nil
+	}
+	return s.finish()
+}
+
+// Close completes the file in progress
+func (s *Parquet) Close() error {
+	return s.Flush()
+}
@@ -0,0 +1,40 @@
+package rpionewire
+
+import "strings"
+
+// Flags qualify the trust that can be placed in a reading
+type Flags uint
+
+const (
+	// FlagRetried readings succeeded after failed attempts, because of
+	// a CRC mismatch or of the device dropping off the bus
+	FlagRetried Flags = 1 << iota
+	// FlagPowerOnReset readings hold 85 °C, the value of the
+	// temperature register at power on. It is usually a device that
+	// browned out and lost its conversion, but can be a genuine 85 °C.
+	FlagPowerOnReset
+	// FlagReducedResolution readings come from a conversion at less
+	// than 12 bits of resolution
+	FlagReducedResolution
+	// FlagDerived readings are computed from the readings of other
+	// devices, such as the aggregates of a zone, rather than read from
+	// a device of their own
+	FlagDerived
+)
+
+// powerOnReset is the value of the temperature register of a DS18B20 at
+// power on, in millidegrees Celsius
+const powerOnReset = 85000
+
+var flagNames = []string{"retried", "power-on-reset", "reduced-resolution", "derived"}
+
+// String returns the names of the flags set, separated by commas
+func (f Flags) String() string {
+	var names []string
+	for i, name := range flagNames {
+		if f&(1<<i) != 0 {
+			names = append(names, name)
+		}
+	}
+	return strings.Join(names, ",")
+}
@@ -0,0 +1,19 @@
+// Package gpio drives rpionewire outputs, such as the relay of a
+// Thermostat, through the GPIO lines of the Linux GPIO character
+// device, using gpiocdev, formerly gpiod, and the hardware PWM channels
+// exposed in sysfs.
+package gpio
+
+// Config identifies the line driven by an Output. Lines are requested
+// from the GPIO character devices in /dev, not from sysfs.
+type Config struct {
+	// Chip is the GPIO chip, such as gpiochip0, the chip of the header
+	// of a Raspberry Pi
+	Chip string
+	// Line is the offset of the line on the chip, the BCM number on a
+	// Raspberry Pi
+	Line int
+	// ActiveLow inverts the line, for relay boards switching on a low
+	// level
+	ActiveLow bool
+}
@@ -0,0 +1,42 @@
+//go:build linux
+
+package gpio
+
+import (
+	"fmt"
+
+	"github.com/warthog618/go-gpiocdev"
+)
+
+// Output is a GPIO line driven as an rpionewire.Output
+type Output struct {
+	line *gpiocdev.Line
+}
+
+// Open requests the line of c as an output, initially off
+func Open(c Config) (*Output, error) {
+	opts := []gpiocdev.LineReqOption{gpiocdev.WithConsumer("rpionewire"), gpiocdev.AsOutput(0)}
+	if c.ActiveLow {
+		opts = append(opts, gpiocdev.AsActiveLow)
+	}
+	line, err := gpiocdev.RequestLine(c.Chip, c.Line, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("Error requesting GPIO line %v of %v: %w", c.Line, c.Chip, err)
+	}
+	return &Output{line: line}, nil
+}
+
+// Set drives the line active when on
+func (o *Output) Set(on bool) error {
+	v := 0
+	if on {
+		v = 1
+	}
+	return o.line.SetValue(v)
+}
+
+// Close switches the line off and releases it
+func (o *Output) Close() error {
+	o.line.SetValue(0)
+	return o.line.Close()
+}
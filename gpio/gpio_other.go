@@ -0,0 +1,24 @@
+//go:build !linux
+
+package gpio
+
+import "github.com/fredcarle/rpionewire"
+
+// Output is a GPIO line driven as an rpionewire.Output, only available
+// on Linux
+type Output struct{}
+
+// Open fails with rpionewire.ErrUnsupportedPlatform off Linux
+func Open(c Config) (*Output, error) {
+	return nil, rpionewire.ErrUnsupportedPlatform
+}
+
+// Set fails with rpionewire.ErrUnsupportedPlatform
+func (o *Output) Set(on bool) error {
+	return rpionewire.ErrUnsupportedPlatform
+}
+
+// Close does nothing
+func (o *Output) Close() error {
+	return nil
+}
@@ -0,0 +1,95 @@
+package gpio
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// PWMOption configures the channel opened by OpenPWM
+type PWMOption func(*pwmConfig)
+
+type pwmConfig struct {
+	root string
+}
+
+// WithSysfsRoot opens the channel in the sysfs tree mounted at root
+// instead of /sys, for containers mounting the host tree elsewhere
+func WithSysfsRoot(root string) PWMOption {
+	return func(c *pwmConfig) {
+		c.root = root
+	}
+}
+
+// PWM is a hardware PWM channel driven through sysfs, an
+// rpionewire.PWMOutput. On a Raspberry Pi, channels are enabled with the
+// pwm or pwm-2chan overlays, channel 0 being GPIO 18 by default.
+type PWM struct {
+	dir    string
+	period time.Duration
+}
+
+// OpenPWM exports the channel of the PWM chip numbered chip and enables
+// it at frequency, in Hz, with a null duty cycle. Fans usually expect
+// 25 kHz.
+func OpenPWM(chip, channel int, frequency float64, opts ...PWMOption) (*PWM, error) {
+	if frequency <= 0 {
+		return nil, fmt.Errorf("Error opening PWM channel %v: invalid frequency %v", channel, frequency)
+	}
+	c := pwmConfig{root: "/sys"}
+	for _, opt := range opts {
+		opt(&c)
+	}
+	chipDir := filepath.Join(c.root, "class", "pwm", fmt.Sprintf("pwmchip%d", chip))
+	p := &PWM{
+		dir:    filepath.Join(chipDir, fmt.Sprintf("pwm%d", channel)),
+		period: time.Duration(float64(time.Second) / frequency),
+	}
+
+	if _, err := os.Stat(p.dir); errors.Is(err, fs.ErrNotExist) {
+		err := os.WriteFile(filepath.Join(chipDir, "export"), []byte(strconv.Itoa(channel)), 0)
+		if err != nil && !errors.Is(err, syscall.EBUSY) {
+			return nil, fmt.Errorf("Error exporting PWM channel %v: %w", channel, err)
+		}
+	}
+	// The duty cycle must never exceed the period, so it is cleared
+	// before changing the period
+	for _, attr := range []struct{ name, value string }{
+		{"duty_cycle", "0"},
+		{"period", strconv.FormatInt(p.period.Nanoseconds(), 10)},
+		{"enable", "1"},
+	} {
+		if err := p.write(attr.name, attr.value); err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+// SetDuty sets the duty cycle, from 0 to 100
+func (p *PWM) SetDuty(percent float64) error {
+	if percent < 0 {
+		percent = 0
+	} else if percent > 100 {
+		percent = 100
+	}
+	ns := int64(float64(p.period.Nanoseconds()) * percent / 100)
+	return p.write("duty_cycle", strconv.FormatInt(ns, 10))
+}
+
+// Close disables the channel
+func (p *PWM) Close() error {
+	return p.write("enable", "0")
+}
+
+func (p *PWM) write(attr, value string) error {
+	if err := os.WriteFile(filepath.Join(p.dir, attr), []byte(value), 0); err != nil {
+		return fmt.Errorf("Error setting PWM %v: %w", attr, err)
+	}
+	return nil
+}
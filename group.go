@@ -0,0 +1,53 @@
+package rpionewire
+
+import (
+	"sort"
+	"time"
+)
+
+// Group is a named set of devices, such as the sensors of a greenhouse
+// or of a fermenter, read, polled, alerted on and exported as a unit.
+// Devices join groups through their Groups field; a device can belong
+// to several groups.
+type Group struct {
+	Name    string
+	Devices []*DS1820
+}
+
+// GroupDevices returns the groups the devices belong to, sorted by name,
+// their devices in the order of devices
+func GroupDevices(devices []*DS1820) []Group {
+	byName := map[string][]*DS1820{}
+	for _, d := range devices {
+		for _, g := range d.Groups {
+			byName[g] = append(byName[g], d)
+		}
+	}
+	groups := make([]Group, 0, len(byName))
+	for name, members := range byName {
+		groups = append(groups, Group{Name: name, Devices: members})
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].Name < groups[j].Name })
+	return groups
+}
+
+// Read reads the devices of the group, see ReadEach
+func (g Group) Read() ([]Reading, error) {
+	return ReadEach(g.Devices)
+}
+
+// NewPoller returns a Poller reading the devices of the group every
+// interval
+func (g Group) NewPoller(interval time.Duration, opts ...PollerOption) *Poller {
+	return NewPoller(g.Devices, interval, opts...)
+}
+
+// InGroup tells whether the device belongs to the group named group
+func (d *DS1820) InGroup(group string) bool {
+	for _, g := range d.Groups {
+		if g == group {
+			return true
+		}
+	}
+	return false
+}
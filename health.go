@@ -0,0 +1,65 @@
+package rpionewire
+
+import (
+	"errors"
+	"time"
+)
+
+// Health summarizes the read history of a device
+type Health struct {
+	// ConsecutiveFailures is the number of reads that failed since the
+	// last successful one
+	ConsecutiveFailures int
+	// LastSuccess is the time of the last successful read, zero if the
+	// device was never read successfully
+	LastSuccess time.Time
+	// LastFailure is the time of the last failed read
+	LastFailure time.Time
+	// Reads and Failures are the total number of reads attempted and
+	// the number of them that failed
+	Reads    uint64
+	Failures uint64
+	// CRCErrors is the total number of conversions rejected because of
+	// a CRC mismatch, including those retried successfully, and
+	// CRCRetries the number of retries they caused. A climbing CRC rate
+	// on one device is the classic sign of a failing connection.
+	CRCErrors  uint64
+	CRCRetries uint64
+}
+
+// Health returns a snapshot of the read history of the device
+func (d *DS1820) Health() Health {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.health
+}
+
+// recordRead updates the health of the device with the outcome of a read
+func (d *DS1820) recordRead(err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.health.Reads++
+	if err == nil {
+		d.health.ConsecutiveFailures = 0
+		d.health.LastSuccess = d.now()
+		return
+	}
+
+	d.health.Failures++
+	d.health.ConsecutiveFailures++
+	d.health.LastFailure = d.now()
+}
+
+// recordConversion counts the CRC mismatches of a conversion of the
+// device, retry telling whether the conversion retried a previous one
+func (d *DS1820) recordConversion(err error, retry bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if retry {
+		d.health.CRCRetries++
+	}
+	if errors.Is(err, ErrCRCMismatch) {
+		d.health.CRCErrors++
+	}
+}
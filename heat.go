@@ -0,0 +1,148 @@
+package rpionewire
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Water properties used by default by a HeatMeter
+const (
+	waterSpecificHeat = 4.186 // kJ/(kg·K)
+	waterDensity      = 1.0   // kg/L
+)
+
+// HeatMeter computes the thermal power carried by a fluid loop from the
+// temperature difference between its flow and return, computed by a
+// Poller configured WithDeltaT, and from a flow rate supplied by the
+// application, typically read from a flow meter. It accumulates the
+// power into energy, so that a heating loop can be metered.
+//
+// A HeatMeter is a Sink to add to the poller sinks and a Measurer
+// returning the power, in kW, and the energy, in kWh. Given to the
+// poller WithHeatMeter instead, it also publishes them to the sinks.
+type HeatMeter struct {
+	// DeltaT is the name of the DeltaT of the loop
+	DeltaT string
+	// SpecificHeat, in kJ/(kg·K), and Density, in kg/L, are those of the
+	// fluid, water if zero
+	SpecificHeat float64
+	Density      float64
+
+	mu     sync.Mutex
+	flow   float64
+	power  float64
+	energy float64
+	// last is when power was last computed, zero before the first
+	// valid delta-t reading
+	last time.Time
+
+	// powerDevice and energyDevice stand for the power and the energy
+	// in the readings published by a Poller
+	powerDevice  *DS1820
+	energyDevice *DS1820
+}
+
+// WithHeatMeter makes the poller update h from the temperature
+// difference it meters after every cycle, and hand its power and
+// energy to the sinks as synthetic readings flagged FlagDerived. They
+// are readings of devices of type "power" and "energy", named after
+// the DeltaT, such as heating-loop:power, whose Measurement holds the
+// power in kW or the energy in kWh. They are not temperatures, see
+// Reading.IsTemperature.
+func WithHeatMeter(h *HeatMeter) PollerOption {
+	return func(p *Poller) {
+		h.powerDevice = &DS1820{Name: h.DeltaT + ":power", DeviceType: "power"}
+		h.energyDevice = &DS1820{Name: h.DeltaT + ":energy", DeviceType: "energy"}
+		p.heatMeters = append(p.heatMeters, h)
+	}
+}
+
+// SetFlow sets the flow rate of the loop in litres per minute, used
+// from the next delta-t reading on
+func (h *HeatMeter) SetFlow(litresPerMinute float64) {
+	h.mu.Lock()
+	h.flow = litresPerMinute
+	h.mu.Unlock()
+}
+
+// SetEnergy sets the accumulated energy in kWh, to restore it after a
+// restart
+func (h *HeatMeter) SetEnergy(kWh float64) {
+	h.mu.Lock()
+	h.energy = kWh
+	h.mu.Unlock()
+}
+
+// Power returns the last thermal power computed, in kW
+func (h *HeatMeter) Power() float64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.power
+}
+
+// Energy returns the energy accumulated, in kWh
+func (h *HeatMeter) Energy() float64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.energy
+}
+
+// WriteReadings updates the power from the delta-t reading of readings
+// and accumulates the energy since the previous one, integrating the
+// power linearly between them. A failed delta-t reading leaves the
+// meter untouched.
+func (h *HeatMeter) WriteReadings(readings []Reading) error {
+	for _, r := range readings {
+		if r.Device == nil || r.Device.Name != h.DeltaT || r.Err != nil {
+			continue
+		}
+
+		h.mu.Lock()
+		c, rho := h.SpecificHeat, h.Density
+		if c == 0 {
+			c = waterSpecificHeat
+		}
+		if rho == 0 {
+			rho = waterDensity
+		}
+		// kg/s times kJ/(kg·K) times K is kJ/s, kW
+		power := h.flow / 60 * rho * c * float64(r.Value)
+		if !h.last.IsZero() && r.Time.After(h.last) {
+			h.energy += (h.power + power) / 2 * r.Time.Sub(h.last).Hours()
+		}
+		h.power, h.last = power, r.Time
+		h.mu.Unlock()
+	}
+	return nil
+}
+
+// Measure returns the power and the energy of the meter, failing with
+// ErrNoData until a delta-t reading was received
+func (h *HeatMeter) Measure() ([]Measurement, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.last.IsZero() {
+		return nil, ErrNoData
+	}
+	return []Measurement{
+		{Kind: KindPower, Value: h.power, Unit: "kW", Time: h.last},
+		{Kind: KindEnergy, Value: h.energy, Unit: "kWh", Time: h.last},
+	}, nil
+}
+
+// readings returns the power and energy readings of the meter at now,
+// failing with ErrNoData until a delta-t reading was received
+func (h *HeatMeter) readings(now time.Time) []Reading {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	power := Reading{Device: h.powerDevice, Time: now, Flags: FlagDerived,
+		Measurement: &Measurement{Kind: KindPower, Value: h.power, Unit: "kW", Time: now}}
+	energy := Reading{Device: h.energyDevice, Time: now, Flags: FlagDerived,
+		Measurement: &Measurement{Kind: KindEnergy, Value: h.energy, Unit: "kWh", Time: now}}
+	if h.last.IsZero() {
+		power.Measurement.Value, power.Err = 0, fmt.Errorf("Error computing %v: %w", power.Device.Name, ErrNoData)
+		energy.Measurement.Value, energy.Err = 0, fmt.Errorf("Error computing %v: %w", energy.Device.Name, ErrNoData)
+	}
+	return []Reading{power, energy}
+}
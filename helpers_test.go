@@ -0,0 +1,60 @@
+package rpionewire
+
+import (
+	"sync"
+	"time"
+)
+
+// fakeClock is a Clock only moving when told to
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.Sleep(d)
+	ch := make(chan time.Time, 1)
+	ch <- c.Now()
+	return ch
+}
+
+func (c *fakeClock) Sleep(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// fakeBackend reports the temperature, or the error, it is set to for
+// every device
+type fakeBackend struct {
+	mu    sync.Mutex
+	names []string
+	temp  float64
+	err   error
+}
+
+func (b *fakeBackend) Devices() ([]string, error) {
+	return b.names, nil
+}
+
+func (b *fakeBackend) ReadTemperature(name string) (float64, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.temp, b.err
+}
+
+func (b *fakeBackend) set(temp float64, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.temp, b.err = temp, err
+}
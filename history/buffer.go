@@ -0,0 +1,84 @@
+// Package history keeps the past readings of rpionewire devices.
+package history
+
+import (
+	"sync"
+	"time"
+
+	"github.com/fredcarle/rpionewire"
+)
+
+// Point is a temperature observed at a given time
+type Point struct {
+	Time  time.Time
+	Value float64
+}
+
+// Buffer keeps the last readings of each device in memory. It is a
+// rpionewire.Sink to add to a poller.
+type Buffer struct {
+	size int
+
+	mu    sync.RWMutex
+	rings map[string]*ring
+}
+
+// ring is a fixed size circular buffer of points
+type ring struct {
+	points []Point
+	next   int
+	full   bool
+}
+
+func (r *ring) add(p Point) {
+	r.points[r.next] = p
+	r.next = (r.next + 1) % len(r.points)
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+// values returns the points of the ring, oldest first
+func (r *ring) values() []Point {
+	if !r.full {
+		return append([]Point(nil), r.points[:r.next]...)
+	}
+	return append(append([]Point(nil), r.points[r.next:]...), r.points[:r.next]...)
+}
+
+// NewBuffer returns a Buffer keeping the last size readings of each
+// device
+func NewBuffer(size int) *Buffer {
+	return &Buffer{size: size, rings: make(map[string]*ring)}
+}
+
+// WriteReadings adds the successful temperature readings to the
+// history of their device
+func (b *Buffer) WriteReadings(readings []rpionewire.Reading) error {
+	now := time.Now()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, r := range readings {
+		if r.Err != nil || r.Device == nil || !r.IsTemperature() {
+			continue
+		}
+		rg := b.rings[r.Device.Name]
+		if rg == nil {
+			rg = &ring{points: make([]Point, b.size)}
+			b.rings[r.Device.Name] = rg
+		}
+		rg.add(Point{Time: now, Value: float64(r.Value)})
+	}
+	return nil
+}
+
+// Values returns the points kept for the device name, oldest first
+func (b *Buffer) Values(name string) []Point {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if rg := b.rings[name]; rg != nil {
+		return rg.values()
+	}
+	return nil
+}
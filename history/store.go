@@ -0,0 +1,349 @@
+package history
+
+import (
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/fredcarle/rpionewire"
+)
+
+// Tier is a resolution the readings of a Store are kept at, and for how
+// long
+type Tier struct {
+	// Resolution is the width of the buckets the readings are averaged
+	// over, 0 keeping every reading
+	Resolution time.Duration
+	// Retention is how long the buckets are kept
+	Retention time.Duration
+}
+
+// DefaultTiers keep the readings for 48 hours and their 5 minute
+// averages for 90 days
+var DefaultTiers = []Tier{
+	{Resolution: 0, Retention: 48 * time.Hour},
+	{Resolution: 5 * time.Minute, Retention: 90 * 24 * time.Hour},
+}
+
+// Bucket summarizes the readings of a device over a period starting at
+// Time, a single reading in a raw tier
+type Bucket struct {
+	Time  time.Time `json:"time"`
+	Mean  float64   `json:"mean"`
+	Min   float64   `json:"min"`
+	Max   float64   `json:"max"`
+	Count int       `json:"count"`
+}
+
+// add merges the value v into the bucket
+func (b *Bucket) add(v float64) {
+	if b.Count == 0 {
+		b.Mean, b.Min, b.Max, b.Count = v, v, v, 1
+		return
+	}
+	b.Count++
+	b.Mean += (v - b.Mean) / float64(b.Count)
+	if v < b.Min {
+		b.Min = v
+	}
+	if v > b.Max {
+		b.Max = v
+	}
+}
+
+// Store keeps the history of devices in tiers of decreasing resolution,
+// downsampling the readings as they arrive and dropping the buckets past
+// the retention of their tier, so that its size stays bounded however
+// long it runs.
+//
+// Store is a rpionewire.Sink to add to a poller. It persists its tiers
+// to a file, every SaveInterval and when flushed by a stopping Poller,
+// and reloads them on creation so that the history survives restarts.
+type Store struct {
+	// SaveInterval is the minimum time between two saves while polling,
+	// 10 minutes if zero
+	SaveInterval time.Duration
+	// Clock times the readings without a time and the saves of Flush,
+	// rpionewire.SystemClock if nil
+	Clock rpionewire.Clock
+
+	tiers []Tier
+	path  string
+
+	mu sync.RWMutex
+	// series are the buckets of each device, by tier, oldest first
+	series map[string][][]Bucket
+	saved  time.Time
+}
+
+// storeFile is the content of the file of a Store
+type storeFile struct {
+	Tiers  []Tier
+	Series map[string][][]Bucket
+}
+
+// NewStore returns a Store keeping the readings in tiers, DefaultTiers
+// if none, persisted to the file at path, none if empty. The history of
+// an existing file is loaded, its tiers being those of the store.
+func NewStore(path string, tiers ...Tier) (*Store, error) {
+	if len(tiers) == 0 {
+		tiers = DefaultTiers
+	}
+	s := &Store{tiers: tiers, path: path, series: map[string][][]Bucket{}}
+	if path == "" {
+		return s, nil
+	}
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Error loading history: %w", err)
+	}
+	defer f.Close()
+	var saved storeFile
+	if err := gob.NewDecoder(f).Decode(&saved); err != nil {
+		return nil, fmt.Errorf("Error loading history from %v: %w", path, err)
+	}
+	for name, tiers := range saved.Series {
+		s.series[name] = make([][]Bucket, len(s.tiers))
+		for i, t := range saved.Tiers {
+			if j := s.tierOf(t); j >= 0 && i < len(tiers) {
+				s.series[name][j] = tiers[i]
+			}
+		}
+	}
+	return s, nil
+}
+
+// tierOf returns the index of the tier of the store matching t, -1 if
+// none
+func (s *Store) tierOf(t Tier) int {
+	for i, tier := range s.tiers {
+		if tier.Resolution == t.Resolution {
+			return i
+		}
+	}
+	return -1
+}
+
+// Tiers returns the tiers of the store
+func (s *Store) Tiers() []Tier {
+	return append([]Tier(nil), s.tiers...)
+}
+
+// WriteReadings adds the successful temperature readings to every
+// tier, dropping the expired buckets, and saves the store when
+// SaveInterval elapsed
+func (s *Store) WriteReadings(readings []rpionewire.Reading) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var now time.Time
+	for _, r := range readings {
+		if r.Err != nil || r.Device == nil || !r.IsTemperature() {
+			continue
+		}
+		t := r.Time
+		if t.IsZero() {
+			t = s.clock().Now()
+		}
+		if t.After(now) {
+			now = t
+		}
+		series := s.series[r.Device.Name]
+		if series == nil {
+			series = make([][]Bucket, len(s.tiers))
+			s.series[r.Device.Name] = series
+		}
+		for i, tier := range s.tiers {
+			series[i] = tier.add(series[i], t, float64(r.Value))
+		}
+	}
+
+	interval := s.SaveInterval
+	if interval == 0 {
+		interval = 10 * time.Minute
+	}
+	if !now.IsZero() && now.Sub(s.saved) >= interval {
+		return s.save(now)
+	}
+	return nil
+}
+
+// add adds the value v read at t to the buckets of the tier, then drops
+// the buckets older than its retention
+func (tier Tier) add(buckets []Bucket, t time.Time, v float64) []Bucket {
+	start := t
+	if tier.Resolution > 0 {
+		start = t.Truncate(tier.Resolution)
+	}
+	if n := len(buckets); n > 0 && tier.Resolution > 0 && buckets[n-1].Time.Equal(start) {
+		buckets[n-1].add(v)
+	} else {
+		b := Bucket{Time: start}
+		b.add(v)
+		buckets = append(buckets, b)
+	}
+
+	cutoff := t.Add(-tier.Retention)
+	i := sort.Search(len(buckets), func(i int) bool { return !buckets[i].Time.Before(cutoff) })
+	if i > 0 {
+		buckets = buckets[:copy(buckets, buckets[i:])]
+	}
+	return buckets
+}
+
+// Buckets returns the buckets kept for the device name in the tier of
+// the given resolution, oldest first
+func (s *Store) Buckets(name string, resolution time.Duration) []Bucket {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	i := s.tierOf(Tier{Resolution: resolution})
+	if i < 0 || s.series[name] == nil {
+		return nil
+	}
+	return append([]Bucket(nil), s.series[name][i]...)
+}
+
+// merge merges the bucket o into the bucket
+func (b *Bucket) merge(o Bucket) {
+	if b.Count == 0 {
+		o.Time = b.Time
+		*b = o
+		return
+	}
+	n := b.Count + o.Count
+	b.Mean = (b.Mean*float64(b.Count) + o.Mean*float64(o.Count)) / float64(n)
+	b.Count = n
+	if o.Min < b.Min {
+		b.Min = o.Min
+	}
+	if o.Max > b.Max {
+		b.Max = o.Max
+	}
+}
+
+// History returns the history of the device name between from and to,
+// oldest first, in buckets of resolution, the first being the one
+// holding from. It is served by the finest tier still holding from,
+// falling back to the one going back furthest; its buckets are merged
+// when resolution is coarser, resolution 0 returning them as is.
+func (s *Store) History(name string, from, to time.Time, resolution time.Duration) []Bucket {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	series := s.series[name]
+	if series == nil {
+		return nil
+	}
+
+	tier := -1
+	for i, t := range s.tiers {
+		if resolution > 0 && t.Resolution > resolution {
+			continue
+		}
+		if buckets := series[i]; len(buckets) > 0 && !buckets[0].Time.After(from) {
+			if tier < 0 || t.Resolution < s.tiers[tier].Resolution {
+				tier = i
+			}
+		}
+	}
+	if tier < 0 {
+		// No tier goes back to from: the one going back furthest, judged by
+		// the end of their first bucket so that a coarser tier does not win
+		// over the same readings
+		var first time.Time
+		for i, buckets := range series {
+			if len(buckets) == 0 {
+				continue
+			}
+			if end := buckets[0].Time.Add(s.tiers[i].Resolution); tier < 0 || end.Before(first) {
+				tier, first = i, end
+			}
+		}
+		if tier < 0 {
+			return nil
+		}
+	}
+
+	buckets := series[tier]
+	lo := sort.Search(len(buckets), func(i int) bool { return !buckets[i].Time.Before(from) })
+	if lo > 0 && buckets[lo-1].Time.Add(s.tiers[tier].Resolution).After(from) {
+		// The bucket starting before from covers it
+		lo--
+	}
+	hi := sort.Search(len(buckets), func(i int) bool { return buckets[i].Time.After(to) })
+	if lo >= hi {
+		return []Bucket{}
+	}
+	if resolution <= s.tiers[tier].Resolution || resolution == 0 {
+		return append([]Bucket(nil), buckets[lo:hi]...)
+	}
+
+	var merged []Bucket
+	for _, b := range buckets[lo:hi] {
+		start := b.Time.Truncate(resolution)
+		if n := len(merged); n == 0 || !merged[n-1].Time.Equal(start) {
+			merged = append(merged, Bucket{Time: start})
+		}
+		merged[len(merged)-1].merge(b)
+	}
+	return merged
+}
+
+// Names returns the devices with a history, sorted
+func (s *Store) Names() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	names := make([]string, 0, len(s.series))
+	for name := range s.series {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Flush saves the store
+func (s *Store) Flush() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.save(s.clock().Now())
+}
+
+func (s *Store) clock() rpionewire.Clock {
+	if s.Clock != nil {
+		return s.Clock
+	}
+	return rpionewire.SystemClock
+}
+
+// save writes the tiers to the file, replacing it atomically, s.mu
+// being held. Gob keeps months of buckets several times smaller than
+// JSON would.
+func (s *Store) save(now time.Time) error {
+	if s.path == "" {
+		return nil
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), ".history-*")
+	if err != nil {
+		return fmt.Errorf("Error saving history: %w", err)
+	}
+	err = gob.NewEncoder(tmp).Encode(storeFile{s.tiers, s.series})
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), s.path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("Error saving history: %w", err)
+	}
+	s.saved = now
+	return nil
+}
@@ -0,0 +1,105 @@
+package history
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fredcarle/rpionewire"
+)
+
+var epoch = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// write adds a reading of value v at epoch+offset for device to s
+func write(t *testing.T, s *Store, device *rpionewire.DS1820, offset time.Duration, v float64) {
+	t.Helper()
+	r := rpionewire.Reading{Device: device, Value: rpionewire.Temperature(v), Time: epoch.Add(offset)}
+	if err := s.WriteReadings([]rpionewire.Reading{r}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStoreTiers(t *testing.T) {
+	s, err := NewStore("", Tier{Resolution: 0, Retention: time.Hour}, Tier{Resolution: 10 * time.Minute, Retention: 24 * time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	device := &rpionewire.DS1820{Name: "28-000000000001"}
+	for i := 0; i < 12; i++ {
+		write(t, s, device, time.Duration(i)*5*time.Minute, float64(i))
+	}
+
+	raw := s.Buckets(device.Name, 0)
+	if len(raw) != 12 || !raw[0].Time.Equal(epoch) {
+		t.Fatalf("got %v raw buckets from %v", len(raw), raw[0].Time)
+	}
+	write(t, s, device, 65*time.Minute, 13)
+	if raw = s.Buckets(device.Name, 0); !raw[0].Time.Equal(epoch.Add(5 * time.Minute)) {
+		t.Fatalf("raw tier starts at %v past its retention", raw[0].Time)
+	}
+
+	coarse := s.Buckets(device.Name, 10*time.Minute)
+	if len(coarse) != 7 {
+		t.Fatalf("got %v 10m buckets, want 7", len(coarse))
+	}
+	if b := coarse[0]; b.Count != 2 || b.Mean != 0.5 || b.Min != 0 || b.Max != 1 {
+		t.Fatalf("got first 10m bucket %+v", b)
+	}
+}
+
+func TestStoreHistory(t *testing.T) {
+	s, err := NewStore("", Tier{Resolution: 0, Retention: time.Hour}, Tier{Resolution: 10 * time.Minute, Retention: 24 * time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	device := &rpionewire.DS1820{Name: "28-000000000001"}
+	for i := 0; i < 36; i++ {
+		write(t, s, device, time.Duration(i)*5*time.Minute, float64(i))
+	}
+
+	tests := []struct {
+		name       string
+		from, to   time.Duration
+		resolution time.Duration
+		want       []time.Duration
+	}{
+		{"raw tier", 150 * time.Minute, 160 * time.Minute, 0, []time.Duration{150 * time.Minute, 155 * time.Minute, 160 * time.Minute}},
+		{"coarse tier past the raw retention", 10 * time.Minute, 30 * time.Minute, 0, []time.Duration{10 * time.Minute, 20 * time.Minute, 30 * time.Minute}},
+		{"bucket covering from", 15 * time.Minute, 30 * time.Minute, 0, []time.Duration{10 * time.Minute, 20 * time.Minute, 30 * time.Minute}},
+		{"merged", 0, 55 * time.Minute, 30 * time.Minute, []time.Duration{0, 30 * time.Minute}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := s.History(device.Name, epoch.Add(tt.from), epoch.Add(tt.to), tt.resolution)
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %v buckets, want %v", len(got), len(tt.want))
+			}
+			for i, b := range got {
+				if !b.Time.Equal(epoch.Add(tt.want[i])) {
+					t.Errorf("bucket %v starts at %v, want %v", i, b.Time.Sub(epoch), tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestStoreReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.gob")
+	s, err := NewStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	device := &rpionewire.DS1820{Name: "28-000000000001"}
+	write(t, s, device, 0, 21.5)
+	if err := s.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded, err := NewStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := reloaded.Buckets(device.Name, 0); len(got) != 1 || got[0].Mean != 21.5 {
+		t.Fatalf("reloaded %v", got)
+	}
+}
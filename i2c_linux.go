@@ -0,0 +1,60 @@
+//go:build linux
+
+package rpionewire
+
+import (
+	"os"
+	"runtime"
+	"syscall"
+	"unsafe"
+)
+
+// ioctl request and message flag of the Linux I2C character devices
+const (
+	i2cRDWR = 0x0707
+	i2cMRD  = 0x0001
+)
+
+// i2cMsg is the struct i2c_msg of linux/i2c.h
+type i2cMsg struct {
+	addr   uint16
+	flags  uint16
+	length uint16
+	buf    *byte
+}
+
+// i2cRdwrData is the struct i2c_rdwr_ioctl_data of linux/i2c-dev.h
+type i2cRdwrData struct {
+	msgs  *i2cMsg
+	nmsgs uint32
+}
+
+// i2cTransfer writes w and reads r from the peripheral at addr of the
+// I2C adapter dev, in a single combined transaction
+func i2cTransfer(dev string, addr uint16, w, r []byte) error {
+	var msgs []i2cMsg
+	if len(w) > 0 {
+		msgs = append(msgs, i2cMsg{addr: addr, length: uint16(len(w)), buf: &w[0]})
+	}
+	if len(r) > 0 {
+		msgs = append(msgs, i2cMsg{addr: addr, flags: i2cMRD, length: uint16(len(r)), buf: &r[0]})
+	}
+	if len(msgs) == 0 {
+		return nil
+	}
+
+	f, err := os.OpenFile(dev, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	data := i2cRdwrData{msgs: &msgs[0], nmsgs: uint32(len(msgs))}
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), i2cRDWR, uintptr(unsafe.Pointer(&data)))
+	runtime.KeepAlive(msgs)
+	runtime.KeepAlive(w)
+	runtime.KeepAlive(r)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
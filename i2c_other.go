@@ -0,0 +1,8 @@
+//go:build !linux
+
+package rpionewire
+
+// i2cTransfer fails, there are no I2C adapters to drive off Linux
+func i2cTransfer(dev string, addr uint16, w, r []byte) error {
+	return ErrUnsupportedPlatform
+}
@@ -0,0 +1,125 @@
+package rpionewire
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Capabilities are the w1_therm features of the running kernel, which
+// grew over its versions. Applications can check them at startup to
+// pick a way of reading the devices, or to tell their users what to
+// upgrade, rather than relying on the errors of missing attributes.
+type Capabilities struct {
+	// Kernel is the release of the running kernel, empty off Linux
+	Kernel string
+	// Temperature is set when devices expose their temperature in
+	// millidegrees, from Linux 5.8, instead of only through w1_slave
+	Temperature bool
+	// BulkRead is set when bus masters can convert every device at
+	// once, see TriggerConversion, from Linux 5.10
+	BulkRead bool
+	// ConvTime is set when devices expose the conv_time attribute to
+	// read and override the conversion duration
+	ConvTime bool
+	// Features is set when devices expose the features attribute,
+	// enabling the conversion check and the polling of the data line
+	// for conversion completion
+	Features bool
+	// Resolution is set when devices expose the resolution attribute
+	// SetResolution needs
+	Resolution bool
+}
+
+// String lists the capabilities that are supported
+func (c Capabilities) String() string {
+	var supported []string
+	for _, f := range []struct {
+		name string
+		ok   bool
+	}{
+		{"temperature", c.Temperature},
+		{"bulk read", c.BulkRead},
+		{"conv_time", c.ConvTime},
+		{"features", c.Features},
+		{"resolution", c.Resolution},
+	} {
+		if f.ok {
+			supported = append(supported, f.name)
+		}
+	}
+	if len(supported) == 0 {
+		supported = append(supported, "w1_slave only")
+	}
+	kernel := c.Kernel
+	if kernel == "" {
+		kernel = "unknown kernel"
+	}
+	return fmt.Sprintf("%v: %v", kernel, strings.Join(supported, ", "))
+}
+
+// ErrNoThermDevice is returned by Capabilities when the bus has no
+// temperature sensor whose attributes tell the features of the kernel
+var ErrNoThermDevice = errors.New("no temperature sensor to probe")
+
+// Capabilities probes the features of the kernel from the attributes of
+// the bus masters and of the first temperature sensor of the local
+// sysfs tree. The result of a successful probe is kept, later calls
+// returning it without touching the bus.
+func (b *Bus) Capabilities() (Capabilities, error) {
+	b.mu.Lock()
+	caps := b.capabilities
+	b.mu.Unlock()
+	if caps != nil {
+		return *caps, nil
+	}
+
+	if _, ok := b.backend.(*Sysfs); !ok {
+		return Capabilities{}, fmt.Errorf("Error probing kernel capabilities: %w", ErrUnsupported)
+	}
+	c := Capabilities{Kernel: kernelRelease()}
+	masters, err := filepath.Glob(filepath.Join(b.dir, "w1_bus_master*"))
+	if err != nil {
+		return c, err
+	}
+	for _, m := range masters {
+		c.BulkRead = c.BulkRead || exists(filepath.Join(m, "therm_bulk_read"))
+	}
+
+	names, err := findDevices(b.dir)
+	if err != nil {
+		return c, fmt.Errorf("Error probing kernel capabilities: %w", err)
+	}
+	for _, name := range names {
+		if family, _, err := parseName(name); err != nil || !thermFamilies[family] {
+			continue
+		}
+		dir := filepath.Join(b.dir, name)
+		c.Temperature = exists(filepath.Join(dir, "temperature"))
+		c.ConvTime = exists(filepath.Join(dir, "conv_time"))
+		c.Features = exists(filepath.Join(dir, "features"))
+		c.Resolution = exists(filepath.Join(dir, "resolution"))
+
+		b.mu.Lock()
+		b.capabilities = &c
+		b.mu.Unlock()
+		return c, nil
+	}
+	return c, fmt.Errorf("Error probing kernel capabilities: %w", ErrNoThermDevice)
+}
+
+// KernelCapabilities probes the kernel through the default bus
+func KernelCapabilities() (Capabilities, error) {
+	return defaultBus.Capabilities()
+}
+
+// thermFamilies are the families handled by the w1_therm driver
+var thermFamilies = map[uint8]bool{modelDS18S20: true, 0x22: true, modelDS18B20: true, 0x3b: true, 0x42: true}
+
+// exists tells whether the file at path exists
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
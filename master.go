@@ -0,0 +1,211 @@
+package rpionewire
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Master is a bus master of the kernel w1 subsystem, such as the w1-gpio
+// instance driving a GPIO pin or a DS9490R USB adapter. It counts the
+// reads of its devices made through its Bus.
+type Master struct {
+	Name string
+
+	// dir is the devices directory of the master
+	dir string
+
+	mu       sync.Mutex
+	reads    uint64
+	failures uint64
+	latency  time.Duration
+}
+
+// MasterStats are the counters of a Master
+type MasterStats struct {
+	// Driver is the kernel driver of the master, see Master.Driver
+	Driver string
+	// Searches is the number of searches the master performed, as
+	// counted by the kernel
+	Searches int64
+	// Devices is the number of devices the master currently sees
+	Devices int
+	// Reads counts the reads of the devices of the master, Failures
+	// those that failed
+	Reads    uint64
+	Failures uint64
+	// AvgLatency is the average duration of the reads
+	AvgLatency time.Duration
+}
+
+// Masters returns the bus masters of the local sysfs tree. The same
+// Master is returned for a given name on every call, so that its
+// counters keep accumulating.
+func (b *Bus) Masters() ([]*Master, error) {
+	paths, err := filepath.Glob(filepath.Join(b.dir, "w1_bus_master*"))
+	if err != nil {
+		return nil, err
+	}
+	if len(paths) == 0 {
+		return nil, errors.New("Error listing bus masters: no bus master found")
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.masters == nil {
+		b.masters = map[string]*Master{}
+	}
+	masters := make([]*Master, len(paths))
+	for i, p := range paths {
+		name := filepath.Base(p)
+		m, ok := b.masters[name]
+		if !ok {
+			m = &Master{Name: name, dir: b.dir}
+			b.masters[name] = m
+		}
+		masters[i] = m
+	}
+	return masters, nil
+}
+
+// Masters returns the bus masters of the default bus
+func Masters() ([]*Master, error) {
+	return defaultBus.Masters()
+}
+
+// Stats returns the counters of the master
+func (m *Master) Stats() (MasterStats, error) {
+	var s MasterStats
+	searches, err := readMasterAttr(m.dir, m.Name, "w1_master_attempts")
+	if err != nil {
+		return s, err
+	}
+	devices, err := readMasterAttr(m.dir, m.Name, "w1_master_slave_count")
+	if err != nil {
+		return s, err
+	}
+	s.Searches, s.Devices = searches, int(devices)
+	s.Driver, _ = m.Driver()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s.Reads, s.Failures = m.reads, m.failures
+	if m.reads > 0 {
+		s.AvgLatency = m.latency / time.Duration(m.reads)
+	}
+	return s, nil
+}
+
+// Master drivers reported by Driver
+const (
+	DriverGPIO    = "w1-gpio"
+	DriverDS9490R = "DS9490R"
+	DriverDS2482  = "ds2482"
+)
+
+// Driver returns the name of the kernel driver of the device the master
+// belongs to: DriverGPIO for a GPIO pin, DriverDS9490R for a DS9490R
+// USB adapter of the ds2490 module, DriverDS2482 for an I2C bridge
+func (m *Master) Driver() (string, error) {
+	path, err := filepath.EvalSymlinks(filepath.Join(m.dir, m.Name))
+	if err != nil {
+		return "", fmt.Errorf("Error finding driver of %v: %w", m.Name, err)
+	}
+	driver, err := filepath.EvalSymlinks(filepath.Join(filepath.Dir(path), "driver"))
+	if err != nil {
+		return "", fmt.Errorf("Error finding driver of %v: %w", m.Name, err)
+	}
+	return filepath.Base(driver), nil
+}
+
+// record counts a read of one of the devices of the master
+func (m *Master) record(latency time.Duration, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.reads++
+	m.latency += latency
+	if err != nil {
+		m.failures++
+	}
+}
+
+// readMasterAttr reads an integer attribute of the bus master name of
+// the devices directory dir
+func readMasterAttr(dir, name, attr string) (int64, error) {
+	raw, err := os.ReadFile(filepath.Join(dir, name, attr))
+	if err != nil {
+		return 0, fmt.Errorf("Error reading %v of %v: %w", attr, name, err)
+	}
+	v, err := strconv.ParseInt(strings.TrimSpace(string(raw)), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("Error decoding %v of %v: %w", attr, name, err)
+	}
+	return v, nil
+}
+
+// masterOf returns the master the device d is wired to, nil if it is
+// not reachable through a local master. The master found is cached per
+// device; a device no master claims, as while a master restarts, is
+// looked up again on the next call.
+func (b *Bus) masterOf(d *DS1820) *Master {
+	b.mu.Lock()
+	m, ok := b.deviceMasters[d.Name]
+	b.mu.Unlock()
+	if ok {
+		return m
+	}
+
+	if _, local := b.backend.(*Sysfs); local {
+		masters, _ := b.Masters()
+		for _, candidate := range masters {
+			slaves, err := masterSlaves(b.dir, candidate.Name)
+			if err != nil {
+				continue
+			}
+			for _, s := range slaves {
+				if s == d.Name {
+					m = candidate
+				}
+			}
+		}
+	}
+
+	if m == nil {
+		return nil
+	}
+	b.mu.Lock()
+	if b.deviceMasters == nil {
+		b.deviceMasters = map[string]*Master{}
+	}
+	b.deviceMasters[d.Name] = m
+	b.mu.Unlock()
+	return m
+}
+
+// slaveMasters returns the names of the masters listing each device in
+// their w1_master_slaves, by device name, nil if the bus is not local
+func (b *Bus) slaveMasters() map[string][]string {
+	if _, local := b.backend.(*Sysfs); !local {
+		return nil
+	}
+	masters, err := b.Masters()
+	if err != nil {
+		return nil
+	}
+	slaveMasters := map[string][]string{}
+	for _, m := range masters {
+		slaves, err := masterSlaves(b.dir, m.Name)
+		if err != nil {
+			continue
+		}
+		for _, s := range slaves {
+			slaveMasters[s] = append(slaveMasters[s], m.Name)
+		}
+	}
+	return slaveMasters
+}
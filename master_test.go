@@ -0,0 +1,23 @@
+package rpionewire
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestMasterOfAfterHotplug(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "bus", "w1", "devices")
+	writeDevice(t, dir, "28-000000000001", nil)
+	b := NewBus(WithSysfsRoot(root))
+	d := &DS1820{Name: "28-000000000001", bus: b}
+
+	// The master is not listed yet, as while it restarts
+	if m := b.masterOf(d); m != nil {
+		t.Fatalf("masterOf = %v, want none without a master", m.Name)
+	}
+	writeDevice(t, dir, "w1_bus_master1", map[string]string{"w1_master_slaves": "28-000000000001\n"})
+	if m := b.masterOf(d); m == nil || m.Name != "w1_bus_master1" {
+		t.Fatalf("masterOf = %v, want w1_bus_master1 once it is back", m)
+	}
+}
@@ -0,0 +1,80 @@
+package rpionewire
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Kind is the physical quantity a Measurement describes
+type Kind int
+
+const (
+	KindTemperature Kind = iota
+	// KindColdJunction is the reference junction temperature reported by
+	// thermocouple interfaces such as the MAX31850
+	KindColdJunction
+	KindVoltage
+	KindCurrent
+	KindHumidity
+	// KindPower and KindEnergy are the thermal power and energy derived
+	// by a HeatMeter
+	KindPower
+	KindEnergy
+)
+
+func (k Kind) String() string {
+	switch k {
+	case KindTemperature:
+		return "temperature"
+	case KindColdJunction:
+		return "cold junction"
+	case KindVoltage:
+		return "voltage"
+	case KindCurrent:
+		return "current"
+	case KindHumidity:
+		return "humidity"
+	case KindPower:
+		return "power"
+	case KindEnergy:
+		return "energy"
+	}
+	return fmt.Sprintf("Kind(%d)", int(k))
+}
+
+// Measurement is a single value read from a device. Devices sensing
+// several quantities, like the DS2438 or the MAX31850, return one
+// Measurement per quantity for each read.
+type Measurement struct {
+	Kind  Kind
+	Value float64
+	// Unit is the symbol of the unit Value is expressed in, such as
+	// "°C", "V", "A" or "%RH"
+	Unit string
+	Time time.Time
+}
+
+func (m Measurement) String() string {
+	return m.Kind.String() + " " + strconv.FormatFloat(m.Value, 'f', -1, 64) + " " + m.Unit
+}
+
+// Measurer is implemented by devices returning their values as
+// measurements
+type Measurer interface {
+	Measure() ([]Measurement, error)
+}
+
+// Measure reads the device and returns its temperature as a Measurement
+func (d *DS1820) Measure() ([]Measurement, error) {
+	r, err := d.Read()
+	if err != nil {
+		return nil, err
+	}
+	return []Measurement{{
+		Kind:  KindTemperature,
+		Value: float64(r.Value),
+		Unit:  Celsius.Symbol(),
+		Time:  r.Time,
+	}}, nil
+}
@@ -0,0 +1,47 @@
+package rpionewire
+
+// Label is a dimension of a metric, such as the device it is about
+type Label struct {
+	Name  string
+	Value string
+}
+
+// Metrics receives the instrumentation of the package, so applications
+// can plug in Prometheus, OpenTelemetry or expvar without the package
+// depending on them. Implementations must be safe for concurrent use.
+//
+// The package reports:
+//
+//	rpionewire_devices                 gauge      devices found by the last discovery
+//	rpionewire_devices_missing         gauge      devices of the allowlist the last discovery missed
+//	rpionewire_reads_total             counter    reads, per device
+//	rpionewire_read_failures_total     counter    failed reads, per device
+//	rpionewire_crc_retries_total       counter    reads retried after a CRC mismatch, per device
+//	rpionewire_read_duration_seconds   histogram  duration of the reads, per device
+//	rpionewire_temperature_celsius     gauge      last temperature read, per device
+//	rpionewire_poll_duration_seconds   histogram  duration of the poll cycles
+//	rpionewire_sink_errors_total       counter    sink writes that failed
+//
+// Per device metrics carry a "device" label with the sysfs name.
+type Metrics interface {
+	// Counter adds delta to a counter
+	Counter(name string, delta float64, labels ...Label)
+	// Gauge sets a gauge to value
+	Gauge(name string, value float64, labels ...Label)
+	// Histogram records an observation of value
+	Histogram(name string, value float64, labels ...Label)
+}
+
+// nopMetrics discards the instrumentation
+type nopMetrics struct{}
+
+func (nopMetrics) Counter(string, float64, ...Label)   {}
+func (nopMetrics) Gauge(string, float64, ...Label)     {}
+func (nopMetrics) Histogram(string, float64, ...Label) {}
+
+// WithMetrics makes the bus report its instrumentation to m
+func WithMetrics(m Metrics) Option {
+	return func(b *Bus) {
+		b.metrics = m
+	}
+}
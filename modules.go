@@ -0,0 +1,167 @@
+package rpionewire
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+)
+
+// ErrUnsupportedPlatform is returned off Linux when accessing the w1
+// sysfs tree or its kernel modules. The package still builds there, so
+// that applications can be developed and tested against a Backend of
+// their own, an owserver or a Sysfs tree in a test directory.
+var ErrUnsupportedPlatform = errors.New("the w1 subsystem is only available on Linux")
+
+// ErrNoSysfs is returned when the w1 sysfs tree does not exist, the
+// modules not being loaded or, in a container, the tree not being bind
+// mounted
+var ErrNoSysfs = errors.New("w1 sysfs tree not found")
+
+// modules are the kernel modules providing the w1 bus, in load order:
+// the master drivers, w1_gpio unless configured otherwise, then the
+// device drivers
+var modules = []string{"w1_gpio", "w1_therm"}
+
+// masterModules are the modules of the bus masters that can be loaded:
+// w1_gpio for a GPIO pin, ds2490 for DS9490R USB adapters, on hosts
+// other than a Raspberry Pi or on Pis without a free GPIO
+var masterModules = []string{"w1_gpio", "ds2490"}
+
+// KernelModules returns the kernel modules a ModuleLoader can load, the
+// bus master drivers first
+func KernelModules() []string {
+	return append(append([]string(nil), masterModules...), modules[1:]...)
+}
+
+// ModuleLoader loads the kernel modules providing the w1 bus. The bus
+// only loads them when given one with WithModuleLoading, the modules
+// being otherwise left to the system configuration, /etc/modules or the
+// w1-gpio overlay.
+type ModuleLoader struct {
+	// Masters are the modules of the bus masters, w1_gpio if empty;
+	// ds2490 drives DS9490R USB adapters
+	Masters []string
+	// Params are the parameters passed to each module, such as
+	// "w1_gpio": {"gpiopin=17", "pullup=1"}
+	Params map[string][]string
+	// Skip are the modules left alone, such as w1_gpio when the bus
+	// master is a DS2482 bridge rather than a GPIO pin
+	Skip []string
+	// DryRun makes Load and Unload log the commands they would run
+	// instead of running them
+	DryRun bool
+	// Logger receives the commands of a dry run, the standard logger if
+	// nil
+	Logger *log.Logger
+}
+
+// Commands returns the modprobe command lines loading the modules, in
+// load order, leaving out the modules already loaded or built into the
+// kernel
+func (l *ModuleLoader) Commands() [][]string {
+	var cmds [][]string
+	for _, m := range l.pending() {
+		cmds = append(cmds, append([]string{"modprobe", m}, l.Params[m]...))
+	}
+	return cmds
+}
+
+// Load loads the modules, in order, stopping at the first failure.
+// Modules already loaded or built into the kernel are not loaded
+// again, so that images without modprobe, such as Alpine or Buildroot
+// ones, work as long as the modules are there.
+func (l *ModuleLoader) Load() error {
+	for _, m := range l.pending() {
+		if l.DryRun {
+			l.logf("rpionewire: dry run: %v", strings.Join(append([]string{"modprobe", m}, l.Params[m]...), " "))
+			continue
+		}
+		if err := loadModule(m, l.Params[m]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Unload removes the modules, in reverse load order, leaving out the
+// modules built into the kernel, which cannot be removed
+func (l *ModuleLoader) Unload() error {
+	ms := l.modules()
+	for i := len(ms) - 1; i >= 0; i-- {
+		if moduleBuiltin(ms[i]) {
+			continue
+		}
+		if l.DryRun {
+			l.logf("rpionewire: dry run: modprobe -r %v", ms[i])
+			continue
+		}
+		if err := unloadModule(ms[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// modules returns the modules to load, in load order
+func (l *ModuleLoader) modules() []string {
+	all := modules
+	if len(l.Masters) > 0 {
+		all = append(append([]string(nil), l.Masters...), modules[1:]...)
+	}
+	var ms []string
+	for _, m := range all {
+		skip := false
+		for _, s := range l.Skip {
+			skip = skip || s == m
+		}
+		if !skip {
+			ms = append(ms, m)
+		}
+	}
+	return ms
+}
+
+// pending returns the modules to load that are neither loaded nor
+// built in, in load order
+func (l *ModuleLoader) pending() []string {
+	var ms []string
+	for _, m := range l.modules() {
+		if !moduleLoaded(m) && !moduleBuiltin(m) {
+			ms = append(ms, m)
+		}
+	}
+	return ms
+}
+
+func (l *ModuleLoader) logf(format string, args ...interface{}) {
+	if l.Logger != nil {
+		l.Logger.Printf(format, args...)
+	} else {
+		log.Printf(format, args...)
+	}
+}
+
+// InContainer tells whether the process runs in a container, where the
+// kernel modules are the business of the host: the bus does not try to
+// load them there
+func InContainer() bool {
+	for _, path := range []string{"/.dockerenv", "/run/.containerenv"} {
+		if _, err := os.Stat(path); err == nil {
+			return true
+		}
+	}
+	// Set by systemd-nspawn, podman and LXC, and by Kubernetes for its
+	// service discovery
+	return os.Getenv("container") != "" || os.Getenv("KUBERNETES_SERVICE_HOST") != ""
+}
+
+// noSysfs returns the error of the missing devices directory dir, with
+// a hint at the likely fix
+func noSysfs(dir string) error {
+	if InContainer() {
+		return fmt.Errorf("Error opening %v: %w: bind mount the host /sys/bus/w1 into the container, or set the sysfs root to where it is mounted", dir, ErrNoSysfs)
+	}
+	return fmt.Errorf("Error opening %v: %w: is the w1-gpio overlay enabled and are the %v modules loaded?", dir, ErrNoSysfs, strings.Join(modules, " and "))
+}
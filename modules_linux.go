@@ -0,0 +1,86 @@
+//go:build linux
+
+package rpionewire
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// procModules lists the loaded modules, osRelease names the running
+// kernel whose modules.builtin lists the modules built in
+const (
+	procModules = "/proc/modules"
+	osRelease   = "/proc/sys/kernel/osrelease"
+)
+
+// loadModule loads the kernel module m with params
+func loadModule(m string, params []string) error {
+	if out, err := exec.Command("modprobe", append([]string{m}, params...)...).CombinedOutput(); err != nil {
+		return fmt.Errorf("Error loading module %v: %v: %s", m, err, out)
+	}
+	return nil
+}
+
+// unloadModule removes the kernel module m
+func unloadModule(m string) error {
+	if out, err := exec.Command("modprobe", "-r", m).CombinedOutput(); err != nil {
+		return fmt.Errorf("Error unloading module %v: %v: %s", m, err, out)
+	}
+	return nil
+}
+
+// moduleLoaded tells whether /proc/modules lists the module m
+func moduleLoaded(m string) bool {
+	f, err := os.Open(procModules)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		if name, _, _ := strings.Cut(s.Text(), " "); name == m {
+			return true
+		}
+	}
+	return false
+}
+
+// moduleBuiltin tells whether the module m is built into the running
+// kernel, as listed by its modules.builtin
+func moduleBuiltin(m string) bool {
+	release := kernelRelease()
+	if release == "" {
+		return false
+	}
+	f, err := os.Open(filepath.Join("/lib/modules", release, "modules.builtin"))
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		// Files are named with dashes or underscores, the module with
+		// underscores
+		name := strings.TrimSuffix(filepath.Base(s.Text()), ".ko")
+		if strings.ReplaceAll(name, "-", "_") == m {
+			return true
+		}
+	}
+	return false
+}
+
+// kernelRelease returns the release of the running kernel, empty if
+// unknown
+func kernelRelease() string {
+	release, err := os.ReadFile(osRelease)
+	if err != nil {
+		return ""
+	}
+	return string(bytes.TrimSpace(release))
+}
@@ -0,0 +1,28 @@
+//go:build !linux
+
+package rpionewire
+
+// loadModule fails, there are no kernel modules to load off Linux
+func loadModule(m string, params []string) error {
+	return ErrUnsupportedPlatform
+}
+
+// unloadModule fails, there are no kernel modules to unload off Linux
+func unloadModule(m string) error {
+	return ErrUnsupportedPlatform
+}
+
+// moduleLoaded is false, there are no kernel modules off Linux
+func moduleLoaded(m string) bool {
+	return false
+}
+
+// moduleBuiltin is false, there are no kernel modules off Linux
+func moduleBuiltin(m string) bool {
+	return false
+}
+
+// kernelRelease is empty, there is no Linux kernel to report
+func kernelRelease() string {
+	return ""
+}
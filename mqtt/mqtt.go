@@ -0,0 +1,94 @@
+// Package mqtt publishes the readings of rpionewire devices to an MQTT
+// broker.
+package mqtt
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+
+	"github.com/fredcarle/rpionewire"
+	"github.com/fredcarle/rpionewire/server"
+)
+
+// Sink is a rpionewire.Sink publishing every reading as JSON on the
+// topic <prefix>/<device name>, and the alert transitions of its poller
+// on <prefix>/alerts/<rule>
+type Sink struct {
+	client paho.Client
+	prefix string
+	// QoS and Retain are used for every message published
+	QoS    byte
+	Retain bool
+}
+
+// NewSink connects to broker, such as "tcp://localhost:1883", with
+// clientID and returns a Sink publishing under prefix
+func NewSink(broker, clientID, prefix string) (*Sink, error) {
+	opts := paho.NewClientOptions().
+		AddBroker(broker).
+		SetClientID(clientID).
+		SetAutoReconnect(true).
+		SetConnectTimeout(10 * time.Second)
+	client := paho.NewClient(opts)
+	if t := client.Connect(); t.Wait() && t.Error() != nil {
+		return nil, fmt.Errorf("Error connecting to %v: %w", broker, t.Error())
+	}
+	return &Sink{client: client, prefix: prefix}, nil
+}
+
+// WriteReadings publishes each reading on the topic of its device
+func (s *Sink) WriteReadings(rs []rpionewire.Reading) error {
+	now := time.Now()
+	var errs []error
+	for _, r := range rs {
+		msg := server.NewReading(r, now)
+		payload, err := json.Marshal(msg)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		topic := s.prefix + "/" + msg.Name
+		if t := s.client.Publish(topic, s.QoS, s.Retain, payload); t.Wait() && t.Error() != nil {
+			errs = append(errs, fmt.Errorf("Error publishing to %v: %w", topic, t.Error()))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// alert is the JSON message of an alert transition
+type alert struct {
+	Rule   string    `json:"rule"`
+	Device string    `json:"device"`
+	From   string    `json:"from"`
+	To     string    `json:"to"`
+	Value  float64   `json:"value"`
+	Time   time.Time `json:"time"`
+}
+
+// WriteTransitions publishes each alert transition on the topic of its
+// rule
+func (s *Sink) WriteTransitions(ts []rpionewire.AlertTransition) error {
+	var errs []error
+	for _, t := range ts {
+		payload, err := json.Marshal(alert{Rule: t.Rule, Device: t.Device, From: t.From.String(), To: t.To.String(), Value: t.Value, Time: t.Time})
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		topic := s.prefix + "/alerts/" + t.Rule
+		if tok := s.client.Publish(topic, s.QoS, s.Retain, payload); tok.Wait() && tok.Error() != nil {
+			errs = append(errs, fmt.Errorf("Error publishing to %v: %w", topic, tok.Error()))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Close disconnects from the broker
+func (s *Sink) Close() error {
+	s.client.Disconnect(250)
+	return nil
+}
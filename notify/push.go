@@ -0,0 +1,126 @@
+package notify
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/fredcarle/rpionewire"
+)
+
+// Telegram sends alert transitions as messages from a Telegram bot
+type Telegram struct {
+	// Token is the bot token given by BotFather
+	Token string
+	// ChatID is the chat the messages are sent to
+	ChatID string
+	// Client is the client sending the requests, a client with a 10
+	// second timeout if nil
+	Client *http.Client
+	// APIURL overrides the Telegram bot API endpoint
+	APIURL string
+}
+
+// Notify sends t to the chat
+func (tg *Telegram) Notify(t rpionewire.AlertTransition) error {
+	api := tg.APIURL
+	if api == "" {
+		api = "https://api.telegram.org"
+	}
+	return postForm(tg.Client, fmt.Sprintf("%v/bot%v/sendMessage", api, tg.Token), url.Values{
+		"chat_id": {tg.ChatID},
+		"text":    {message(t)},
+	})
+}
+
+// Pushover sends alert transitions as Pushover notifications
+type Pushover struct {
+	// Token is the application API token
+	Token string
+	// User is the user or group key receiving the notifications
+	User string
+	// Priority is the priority of firing alerts, from -2 to 2; cleared
+	// alerts are always sent with normal priority
+	Priority int
+	// Retry and Expire are how often an emergency notification, of
+	// priority 2, is repeated until acknowledged and for how long, 1
+	// minute and 1 hour if zero. Pushover requires Retry to be at least
+	// 30 seconds and Expire at most 3 hours.
+	Retry  time.Duration
+	Expire time.Duration
+	// Client is the client sending the requests, a client with a 10
+	// second timeout if nil
+	Client *http.Client
+	// APIURL overrides the Pushover messages endpoint
+	APIURL string
+}
+
+// Notify sends t to the user
+func (p *Pushover) Notify(t rpionewire.AlertTransition) error {
+	api := p.APIURL
+	if api == "" {
+		api = "https://api.pushover.net/1/messages.json"
+	}
+	priority := 0
+	if t.To == rpionewire.AlertFiring {
+		priority = p.Priority
+	}
+	form := url.Values{
+		"token":    {p.Token},
+		"user":     {p.User},
+		"title":    {"rpionewire: " + t.Rule},
+		"message":  {message(t)},
+		"priority": {fmt.Sprint(priority)},
+	}
+	if priority == 2 {
+		retry, expire := p.Retry, p.Expire
+		if retry == 0 {
+			retry = time.Minute
+		}
+		if expire == 0 {
+			expire = time.Hour
+		}
+		if retry < 30*time.Second || expire < retry || expire > 3*time.Hour {
+			return errors.New("Error sending notification: emergency notifications need a retry of at least 30s and an expiry between the retry and 3h")
+		}
+		form.Set("retry", fmt.Sprint(int(retry.Seconds())))
+		form.Set("expire", fmt.Sprint(int(expire.Seconds())))
+	}
+	return postForm(p.Client, api, form)
+}
+
+// message is the human readable text of an alert transition
+func message(t rpionewire.AlertTransition) string {
+	state := "cleared"
+	if t.To == rpionewire.AlertFiring {
+		state = "firing"
+	}
+	return fmt.Sprintf("%v %v on %v: %v", t.Rule, state, t.Device, rpionewire.Temperature(t.Value))
+}
+
+// postForm posts form to endpoint and checks the response status
+func postForm(client *http.Client, endpoint string, form url.Values) error {
+	if client == nil {
+		client = defaultClient
+	}
+	resp, err := client.Post(endpoint, "application/x-www-form-urlencoded", strings.NewReader(form.Encode()))
+	if err != nil {
+		// The error embeds the URL, which may hold a token
+		if uerr, ok := err.(*url.Error); ok {
+			err = uerr.Err
+		}
+		return fmt.Errorf("Error sending notification: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("Error sending notification: %v: %s", resp.Status, body)
+	}
+	io.Copy(io.Discard, resp.Body)
+	return nil
+}
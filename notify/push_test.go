@@ -0,0 +1,99 @@
+package notify
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/fredcarle/rpionewire"
+)
+
+// formServer records the forms posted to it
+func formServer(t *testing.T) (*httptest.Server, *[]url.Values) {
+	t.Helper()
+	var forms []url.Values
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Error(err)
+		}
+		forms = append(forms, r.PostForm)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &forms
+}
+
+var firing = rpionewire.AlertTransition{Rule: "freezer-warm", Device: "28-0316a2794bff", From: rpionewire.AlertOK, To: rpionewire.AlertFiring, Value: -12.5}
+
+func TestPushoverPriority(t *testing.T) {
+	srv, forms := formServer(t)
+	tests := []struct {
+		name          string
+		pushover      Pushover
+		transition    rpionewire.AlertTransition
+		priority      string
+		retry, expire string
+	}{
+		{"high", Pushover{Priority: 1}, firing, "1", "", ""},
+		{"cleared", Pushover{Priority: 1}, rpionewire.AlertTransition{Rule: "freezer-warm", From: rpionewire.AlertFiring, To: rpionewire.AlertOK}, "0", "", ""},
+		{"emergency defaults", Pushover{Priority: 2}, firing, "2", "60", "3600"},
+		{"emergency", Pushover{Priority: 2, Retry: 30 * time.Second, Expire: 3 * time.Hour}, firing, "2", "30", "10800"},
+	}
+	for _, tt := range tests {
+		*forms = nil
+		tt.pushover.APIURL = srv.URL
+		if err := tt.pushover.Notify(tt.transition); err != nil {
+			t.Fatalf("%v: %v", tt.name, err)
+		}
+		if len(*forms) != 1 {
+			t.Fatalf("%v: sent %v requests", tt.name, len(*forms))
+		}
+		form := (*forms)[0]
+		if got := form.Get("priority"); got != tt.priority {
+			t.Errorf("%v: priority %v, want %v", tt.name, got, tt.priority)
+		}
+		if form.Get("retry") != tt.retry || form.Get("expire") != tt.expire {
+			t.Errorf("%v: retry %q and expire %q, want %q and %q", tt.name, form.Get("retry"), form.Get("expire"), tt.retry, tt.expire)
+		}
+	}
+}
+
+func TestPushoverInvalidEmergency(t *testing.T) {
+	srv, forms := formServer(t)
+	for _, p := range []Pushover{
+		{Priority: 2, Retry: 10 * time.Second},
+		{Priority: 2, Expire: 4 * time.Hour},
+		{Priority: 2, Retry: time.Minute, Expire: 30 * time.Second},
+	} {
+		p.APIURL = srv.URL
+		if err := p.Notify(firing); err == nil {
+			t.Errorf("sent an emergency notification with retry %v and expire %v", p.Retry, p.Expire)
+		}
+	}
+	if len(*forms) != 0 {
+		t.Fatalf("sent %v invalid requests", len(*forms))
+	}
+}
+
+func TestTelegram(t *testing.T) {
+	var path string
+	var form url.Values
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		r.ParseForm()
+		form = r.PostForm
+	}))
+	defer srv.Close()
+
+	tg := &Telegram{Token: "123:abc", ChatID: "42", APIURL: srv.URL}
+	if err := tg.Notify(firing); err != nil {
+		t.Fatal(err)
+	}
+	if path != "/bot123:abc/sendMessage" || form.Get("chat_id") != "42" {
+		t.Fatalf("posted %v to %v", form, path)
+	}
+	if want := "freezer-warm firing on 28-0316a2794bff: -12.5 °C"; form.Get("text") != want {
+		t.Errorf("sent %q, want %q", form.Get("text"), want)
+	}
+}
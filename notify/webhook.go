@@ -0,0 +1,182 @@
+// Package notify delivers rpionewire alert transitions and readings to
+// external services.
+package notify
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/fredcarle/rpionewire"
+)
+
+// SignatureHeader is the header carrying the hex encoded HMAC-SHA256 of
+// the request body when the webhook has a secret
+const SignatureHeader = "X-Rpionewire-Signature"
+
+// defaultClient sends the requests of the notifiers without a client,
+// with a timeout so that a hung endpoint does not stall the poller
+var defaultClient = &http.Client{Timeout: 10 * time.Second}
+
+// Webhook POSTs alert transitions as JSON to a set of URLs. It is a
+// rpionewire.Notifier, and also a rpionewire.Sink posting every reading
+// when added to a poller.
+type Webhook struct {
+	URLs []string
+	// Secret, if set, signs every request body with HMAC-SHA256
+	Secret []byte
+	// Retries is how many times a failed delivery is retried, waiting
+	// Backoff before the first retry and doubling it after each one.
+	// Deliveries rejected with a 4xx status other than 429 are not
+	// retried.
+	Retries int
+	Backoff time.Duration
+	// Client is the client sending the requests, a client with a 10
+	// second timeout if nil
+	Client *http.Client
+	// Clock times the backoff between retries and the readings posted,
+	// rpionewire.SystemClock if nil
+	Clock rpionewire.Clock
+}
+
+// transition is the JSON document posted for an alert transition
+type transition struct {
+	Type   string    `json:"type"`
+	Rule   string    `json:"rule"`
+	Device string    `json:"device"`
+	From   string    `json:"from"`
+	To     string    `json:"to"`
+	Value  float64   `json:"value"`
+	Time   time.Time `json:"time"`
+}
+
+// reading is the JSON form of a rpionewire.Reading
+type reading struct {
+	Device string  `json:"device"`
+	ID     string  `json:"id"`
+	Seq    uint64  `json:"seq,omitempty"`
+	Temp   float64 `json:"temp"`
+	Error  string  `json:"error,omitempty"`
+}
+
+// readings is the JSON document posted for a poll cycle
+type readings struct {
+	Type     string    `json:"type"`
+	Time     time.Time `json:"time"`
+	Readings []reading `json:"readings"`
+}
+
+// Notify posts t to every URL of the webhook
+func (w *Webhook) Notify(t rpionewire.AlertTransition) error {
+	return w.post(transition{
+		Type:   "alert",
+		Rule:   t.Rule,
+		Device: t.Device,
+		From:   t.From.String(),
+		To:     t.To.String(),
+		Value:  t.Value,
+		Time:   t.Time,
+	})
+}
+
+// WriteReadings posts the temperature readings of a poll cycle to every
+// URL of the webhook
+func (w *Webhook) WriteReadings(rs []rpionewire.Reading) error {
+	doc := readings{Type: "readings", Time: w.clock().Now(), Readings: make([]reading, 0, len(rs))}
+	for _, r := range rs {
+		if !r.IsTemperature() {
+			continue
+		}
+		var info reading
+		if r.Device != nil {
+			info.Device = r.Device.Name
+			info.ID = fmt.Sprintf("%012x", r.Device.ID)
+		}
+		info.Seq = r.Seq
+		info.Temp = float64(r.Value)
+		if r.Err != nil {
+			info.Error = r.Err.Error()
+		}
+		doc.Readings = append(doc.Readings, info)
+	}
+	return w.post(doc)
+}
+
+// post sends v as JSON to every URL, retrying failed deliveries
+func (w *Webhook) post(v interface{}) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	var sig string
+	if len(w.Secret) > 0 {
+		mac := hmac.New(sha256.New, w.Secret)
+		mac.Write(body)
+		sig = "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	}
+
+	var errs []error
+	for _, url := range w.URLs {
+		backoff := w.Backoff
+		for attempt := 0; ; attempt++ {
+			var retry bool
+			retry, err = w.send(url, body, sig)
+			if err == nil || !retry || attempt >= w.Retries {
+				break
+			}
+			w.clock().Sleep(backoff)
+			backoff *= 2
+		}
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (w *Webhook) clock() rpionewire.Clock {
+	if w.Clock != nil {
+		return w.Clock
+	}
+	return rpionewire.SystemClock
+}
+
+// send makes a single delivery of body to url, telling whether a failed
+// delivery is worth retrying
+func (w *Webhook) send(url string, body []byte, sig string) (bool, error) {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if sig != "" {
+		req.Header.Set(SignatureHeader, sig)
+	}
+
+	client := w.Client
+	if client == nil {
+		client = defaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return true, fmt.Errorf("Error posting to webhook %v: %w", url, err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		// the endpoint rejects the request itself, sending it again would
+		// not help unless it is rate limiting
+		retry := resp.StatusCode < 400 || resp.StatusCode > 499 || resp.StatusCode == http.StatusTooManyRequests
+		return retry, fmt.Errorf("Error posting to webhook %v: %v", url, resp.Status)
+	}
+	return false, nil
+}
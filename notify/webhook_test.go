@@ -0,0 +1,45 @@
+package notify
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/fredcarle/rpionewire"
+)
+
+// fixedClock is a Clock stopped at a given time
+type fixedClock struct {
+	now time.Time
+}
+
+func (c fixedClock) Now() time.Time { return c.now }
+
+func (c fixedClock) After(d time.Duration) <-chan time.Time {
+	ch := make(chan time.Time, 1)
+	ch <- c.now.Add(d)
+	return ch
+}
+
+func (c fixedClock) Sleep(d time.Duration) {}
+
+func TestWebhookReadingsTime(t *testing.T) {
+	var got readings
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Error(err)
+		}
+	}))
+	defer srv.Close()
+
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	hook := &Webhook{URLs: []string{srv.URL}, Clock: fixedClock{now}}
+	if err := hook.WriteReadings([]rpionewire.Reading{{Value: 21.5}}); err != nil {
+		t.Fatal(err)
+	}
+	if !got.Time.Equal(now) || len(got.Readings) != 1 || got.Readings[0].Temp != 21.5 {
+		t.Errorf("posted %+v, want the reading at %v", got, now)
+	}
+}
@@ -0,0 +1,137 @@
+package owserver
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultPort is the port owserver listens on
+const DefaultPort = "4304"
+
+// Client reads devices from an owserver. It is a rpionewire.Backend, so
+// an OWFS installation is used through the usual device API with:
+//
+//	bus := rpionewire.NewBus(rpionewire.WithBackend(&owserver.Client{Addr: "pi:4304"}))
+type Client struct {
+	// Addr is the host:port of the owserver
+	Addr string
+	// Timeout bounds each request, 10 seconds if zero
+	Timeout time.Duration
+}
+
+// Devices lists the devices of the owserver in the kernel name format
+func (c *Client) Devices() ([]string, error) {
+	return c.DevicesContext(context.Background())
+}
+
+// DevicesContext lists the devices of the owserver, aborting the request
+// if ctx is done first
+func (c *Client) DevicesContext(ctx context.Context) ([]string, error) {
+	entries, err := c.dir(ctx, "/")
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, e := range entries {
+		if name, err := kernelName(strings.Trim(e, "/")); err == nil {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+// ReadTemperature reads the uncached temperature of the device, forcing
+// a new conversion
+func (c *Client) ReadTemperature(name string) (float64, error) {
+	b, err := c.Read("/uncached/" + owfsNameOf(name) + "/temperature")
+	if err != nil {
+		return 0, err
+	}
+	v, err := strconv.ParseFloat(strings.TrimSpace(string(b)), 64)
+	if err != nil {
+		return 0, fmt.Errorf("Error decoding temperature of %v: %w", name, err)
+	}
+	return v, nil
+}
+
+// Dir returns the entries of the OWFS directory path
+func (c *Client) Dir(path string) ([]string, error) {
+	return c.dir(context.Background(), path)
+}
+
+func (c *Client) dir(ctx context.Context, path string) ([]string, error) {
+	b, err := c.request(ctx, msgDirAll, path, 0)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) == 0 {
+		return nil, nil
+	}
+	return strings.Split(cString(b), ","), nil
+}
+
+// Read returns the content of the OWFS file path
+func (c *Client) Read(path string) ([]byte, error) {
+	return c.request(context.Background(), msgRead, path, 8192)
+}
+
+// request sends a single request on a new connection and returns the
+// payload of its response. The connection is closed early if ctx is done.
+func (c *Client) request(ctx context.Context, typ int32, path string, size int32) ([]byte, error) {
+	timeout := c.Timeout
+	if timeout == 0 {
+		timeout = 10 * time.Second
+	}
+	addr := c.Addr
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, DefaultPort)
+	}
+
+	d := net.Dialer{Timeout: timeout}
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+
+	req := header{Type: typ, Flags: flagOwnet, Size: size}
+	if err := writeMessage(conn, req, append([]byte(path), 0)); err != nil {
+		return nil, err
+	}
+
+	for {
+		h, payload, err := readMessage(conn)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			return nil, fmt.Errorf("Error reading %v from %v: %w", path, c.Addr, err)
+		}
+		if h.Payload < 0 {
+			// keepalive while the owserver works on the request
+			continue
+		}
+		if h.Type < 0 {
+			return nil, fmt.Errorf("Error reading %v from %v: owserver error %d", path, c.Addr, -h.Type)
+		}
+		if h.Size >= 0 && int(h.Size) < len(payload) {
+			payload = payload[:h.Size]
+		}
+		return payload, nil
+	}
+}
@@ -0,0 +1,100 @@
+// Package owserver speaks the owserver protocol of OWFS, both as a
+// client reading the devices of an existing OWFS installation and as a
+// server exposing the local kernel bus to OWFS clients.
+package owserver
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// Message types of owserver requests
+const (
+	msgError    = 0
+	msgNop      = 1
+	msgRead     = 2
+	msgWrite    = 3
+	msgDir      = 4
+	msgSize     = 5
+	msgPresence = 6
+	msgDirAll   = 7
+	msgGet      = 8
+)
+
+// flagOwnet is set on every request by ownet clients; the other flags
+// left at zero select °C and the f.i device name format
+const flagOwnet = 0x00000100
+
+// maxPayload bounds the payloads accepted from a peer
+const maxPayload = 65536
+
+// header is the fixed part of every owserver message. For requests the
+// third field is the message type, for responses the return value.
+type header struct {
+	Version int32
+	Payload int32
+	Type    int32
+	Flags   int32
+	Size    int32
+	Offset  int32
+}
+
+func writeMessage(w io.Writer, h header, payload []byte) error {
+	h.Payload = int32(len(payload))
+	if err := binary.Write(w, binary.BigEndian, h); err != nil {
+		return err
+	}
+	_, err := w.Write(payload)
+	return err
+}
+
+// readMessage reads a message. Keepalive pings, which have a negative
+// payload length, are returned as is with a nil payload.
+func readMessage(r io.Reader) (header, []byte, error) {
+	var h header
+	if err := binary.Read(r, binary.BigEndian, &h); err != nil {
+		return h, nil, err
+	}
+	if h.Payload <= 0 {
+		return h, nil, nil
+	}
+	if h.Payload > maxPayload {
+		return h, nil, fmt.Errorf("Error reading message: payload of %v bytes too large", h.Payload)
+	}
+	payload := make([]byte, h.Payload)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return h, nil, err
+	}
+	return h, payload, nil
+}
+
+// cString returns payload up to its first NUL byte
+func cString(payload []byte) string {
+	if i := strings.IndexByte(string(payload), 0); i >= 0 {
+		return string(payload[:i])
+	}
+	return string(payload)
+}
+
+var owfsName = regexp.MustCompile(`^([0-9A-Fa-f]{2})\.([0-9A-Fa-f]{12})$`)
+
+var errBadName = errors.New("not a device name")
+
+// kernelName converts an OWFS device name such as 28.0316A2794BFF to
+// the kernel format 28-0316a2794bff
+func kernelName(owfs string) (string, error) {
+	m := owfsName.FindStringSubmatch(owfs)
+	if m == nil {
+		return "", errBadName
+	}
+	return strings.ToLower(m[1] + "-" + m[2]), nil
+}
+
+// owfsNameOf converts a kernel device name to the OWFS format
+func owfsNameOf(name string) string {
+	return strings.ToUpper(strings.Replace(name, "-", ".", 1))
+}
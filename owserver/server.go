@@ -0,0 +1,270 @@
+package owserver
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/fredcarle/rpionewire"
+)
+
+// properties are the files served in the directory of each device
+var properties = []string{"family", "id", "temperature", "type"}
+
+// Server exposes the devices of a backend, the local kernel bus by
+// default, over the owserver protocol so OWFS clients such as owread,
+// owhttpd or OWFS based home automation can consume them.
+type Server struct {
+	// Backend is where devices are read, the backend of a default
+	// rpionewire.Bus if nil. Give the backend of a bus configured
+	// WithSysfsRoot to serve another sysfs tree.
+	Backend rpionewire.Backend
+	// Logger receives connection errors, the standard logger if nil
+	Logger *log.Logger
+
+	mu       sync.Mutex
+	listener net.Listener
+
+	// defaultBackend is the backend used when Backend is nil, built
+	// once so that its state, such as the read method of each device
+	// of a Sysfs backend, outlives the requests
+	defaultOnce    sync.Once
+	defaultBackend rpionewire.Backend
+}
+
+// ListenAndServe listens on addr, ":4304" if empty, and serves requests
+func (s *Server) ListenAndServe(addr string) error {
+	if addr == "" {
+		addr = ":" + DefaultPort
+	}
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(l)
+}
+
+// Serve serves requests from l until Close is called
+func (s *Server) Serve(l net.Listener) error {
+	s.mu.Lock()
+	s.listener = l
+	s.mu.Unlock()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		go s.serveConn(conn)
+	}
+}
+
+// Close stops the server from accepting connections
+func (s *Server) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.listener == nil {
+		return nil
+	}
+	return s.listener.Close()
+}
+
+// backend returns Backend, or the backend of a default bus
+func (s *Server) backend() rpionewire.Backend {
+	if s.Backend != nil {
+		return s.Backend
+	}
+	s.defaultOnce.Do(func() {
+		s.defaultBackend = rpionewire.NewBus().Backend()
+	})
+	return s.defaultBackend
+}
+
+func (s *Server) logf(format string, args ...interface{}) {
+	logger := s.Logger
+	if logger == nil {
+		logger = log.Default()
+	}
+	logger.Printf(format, args...)
+}
+
+// serveConn answers the requests of a connection. Clients flagging
+// persistence may send several requests on the same connection.
+func (s *Server) serveConn(conn net.Conn) {
+	defer conn.Close()
+	for {
+		conn.SetDeadline(time.Now().Add(30 * time.Second))
+		req, payload, err := readMessage(conn)
+		if err != nil {
+			return
+		}
+		if err := s.handle(conn, req, cString(payload)); err != nil {
+			s.logf("owserver: %v: %v", conn.RemoteAddr(), err)
+			return
+		}
+		if req.Flags&flagPersist == 0 {
+			return
+		}
+	}
+}
+
+// flagPersist asks the server to keep the connection open
+const flagPersist = 0x00000004
+
+func (s *Server) handle(conn net.Conn, req header, path string) error {
+	resp := header{Flags: req.Flags}
+	switch req.Type {
+	case msgNop:
+		return writeMessage(conn, resp, nil)
+
+	case msgDir, msgDirAll, msgGet:
+		entries, err := s.dir(path)
+		if errors.Is(err, errNotDir) && req.Type == msgGet {
+			return s.read(conn, resp, path)
+		}
+		if err != nil {
+			return s.fail(conn, resp, err)
+		}
+		if req.Type == msgDir {
+			for _, e := range entries {
+				if err := writeMessage(conn, header{Flags: req.Flags, Size: int32(len(e))}, append([]byte(e), 0)); err != nil {
+					return err
+				}
+			}
+			return writeMessage(conn, resp, nil)
+		}
+		list := strings.Join(entries, ",")
+		resp.Size = int32(len(list))
+		return writeMessage(conn, resp, append([]byte(list), 0))
+
+	case msgRead:
+		return s.read(conn, resp, path)
+
+	case msgPresence:
+		if _, err := s.dir(path); err != nil && !errors.Is(err, errNotDir) {
+			return s.fail(conn, resp, err)
+		}
+		return writeMessage(conn, resp, nil)
+	}
+
+	return s.fail(conn, resp, syscall.ENOTSUP)
+}
+
+var errNotDir = errors.New("not a directory")
+
+// dir lists the OWFS directory path
+func (s *Server) dir(path string) ([]string, error) {
+	parts := splitPath(path)
+	names, err := s.backend().Devices()
+	if err != nil {
+		return nil, err
+	}
+
+	switch len(parts) {
+	case 0:
+		entries := make([]string, len(names))
+		for i, name := range names {
+			entries[i] = "/" + owfsNameOf(name)
+		}
+		return entries, nil
+	case 1:
+		if !contains(names, parts[0]) {
+			return nil, syscall.ENOENT
+		}
+		entries := make([]string, len(properties))
+		for i, p := range properties {
+			entries[i] = "/" + owfsNameOf(parts[0]) + "/" + p
+		}
+		return entries, nil
+	case 2:
+		if !contains(names, parts[0]) || !contains(properties, parts[1]) {
+			return nil, syscall.ENOENT
+		}
+		return nil, errNotDir
+	}
+	return nil, syscall.ENOENT
+}
+
+// read answers a read of the device property at path
+func (s *Server) read(conn net.Conn, resp header, path string) error {
+	parts := splitPath(path)
+	if len(parts) != 2 {
+		return s.fail(conn, resp, syscall.EISDIR)
+	}
+	name, prop := parts[0], parts[1]
+
+	var value string
+	switch prop {
+	case "family":
+		value = name[:2]
+	case "id":
+		value = strings.ToUpper(name[3:])
+	case "type":
+		family, err := strconv.ParseUint(name[:2], 16, 8)
+		if err != nil {
+			return s.fail(conn, resp, syscall.ENOENT)
+		}
+		value = rpionewire.FamilyName(uint8(family))
+	case "temperature":
+		t, err := s.backend().ReadTemperature(name)
+		if err != nil {
+			return s.fail(conn, resp, err)
+		}
+		value = fmt.Sprintf("%12.4f", t)
+	default:
+		return s.fail(conn, resp, syscall.ENOENT)
+	}
+
+	resp.Type = int32(len(value))
+	resp.Size = int32(len(value))
+	return writeMessage(conn, resp, []byte(value))
+}
+
+// fail answers with the errno matching err
+func (s *Server) fail(conn net.Conn, resp header, err error) error {
+	errno := syscall.EIO
+	var e syscall.Errno
+	if errors.As(err, &e) {
+		errno = e
+	}
+	resp.Type = -int32(errno)
+	return writeMessage(conn, resp, nil)
+}
+
+// splitPath returns the device, in kernel format, and property of an
+// OWFS path, ignoring the /uncached and /bus.N prefixes
+func splitPath(path string) []string {
+	var parts []string
+	for _, p := range strings.Split(path, "/") {
+		if p == "" || p == "uncached" || strings.HasPrefix(p, "bus.") {
+			continue
+		}
+		if len(parts) == 0 {
+			name, err := kernelName(p)
+			if err != nil {
+				return []string{p, "", ""}
+			}
+			p = name
+		}
+		parts = append(parts, p)
+	}
+	return parts
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
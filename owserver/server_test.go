@@ -0,0 +1,96 @@
+package owserver
+
+import (
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/fredcarle/rpionewire"
+)
+
+// staticBackend reports a fixed temperature for its devices
+type staticBackend struct {
+	names []string
+	temp  float64
+}
+
+func (b *staticBackend) Devices() ([]string, error) {
+	return b.names, nil
+}
+
+func (b *staticBackend) ReadTemperature(name string) (float64, error) {
+	for _, n := range b.names {
+		if n == name {
+			return b.temp, nil
+		}
+	}
+	return 0, rpionewire.ErrNoData
+}
+
+// serve starts a Server over backend and returns a Client of it
+func serve(t *testing.T, backend rpionewire.Backend) *Client {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Server{Backend: backend}
+	go s.Serve(l)
+	t.Cleanup(func() { s.Close() })
+	return &Client{Addr: l.Addr().String()}
+}
+
+func TestServerClient(t *testing.T) {
+	names := []string{"28-0316a2794bff", "10-000802f2ab11"}
+	c := serve(t, &staticBackend{names: names, temp: 21.5})
+
+	got, err := c.Devices()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, names) {
+		t.Fatalf("got devices %v, want %v", got, names)
+	}
+
+	temp, err := c.ReadTemperature(names[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if temp != 21.5 {
+		t.Fatalf("got temperature %v, want 21.5", temp)
+	}
+
+	entries, err := c.Dir("/28.0316A2794BFF")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != len(properties) {
+		t.Fatalf("got entries %v, want the %v properties", entries, properties)
+	}
+	for prop, want := range map[string]string{"family": "28", "id": "0316A2794BFF", "type": "DS18B20"} {
+		b, err := c.Read("/28.0316A2794BFF/" + prop)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.TrimSpace(string(b)) != want {
+			t.Errorf("read %v %q, want %q", prop, b, want)
+		}
+	}
+}
+
+func TestServerErrors(t *testing.T) {
+	c := serve(t, &staticBackend{names: []string{"28-0316a2794bff"}})
+	for _, path := range []string{"/28.000000000001/temperature", "/28.0316A2794BFF/humidity", "/28.0316A2794BFF"} {
+		if _, err := c.Read(path); err == nil {
+			t.Errorf("read %v succeeded", path)
+		}
+	}
+}
+
+func TestServerDefaultBackend(t *testing.T) {
+	s := &Server{}
+	if b := s.backend(); b == nil || b != s.backend() {
+		t.Errorf("backend = %v then %v, want the same default backend", b, s.backend())
+	}
+}
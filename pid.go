@@ -0,0 +1,144 @@
+package rpionewire
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// PID is a proportional-integral-derivative controller keeping the
+// temperature of a device or zone at a setpoint by computing a 0 to 100
+// output, for SSRs or PWM driven heaters in sous-vide, fermentation or
+// reflow setups. It is a Sink to add to the poller sinks, computing a
+// new output on every reading of its device.
+//
+// The derivative acts on the measurement rather than on the error, so
+// that a change of setpoint does not kick the output, and the integral
+// stops accumulating while the output is clamped, avoiding windup.
+type PID struct {
+	// Device is the device or zone watched, by sysfs name, alias or
+	// name of a derived reading
+	Device string
+	// Kp, Ki and Kd are the gains, Ki and Kd being per second
+	Kp, Ki, Kd float64
+	// Min and Max clamp the output, 0 and 100 if both are zero
+	Min, Max float64
+	// Output, if set, is told about every output computed with the
+	// reading it was computed from
+	Output func(output float64, r Reading) error
+
+	mu       sync.Mutex
+	setpoint float64
+	integral float64
+	last     Reading
+	output   float64
+	// computed tells whether output was computed, from a first reading
+	computed bool
+}
+
+// NewPID returns a PID controller holding device at setpoint
+func NewPID(device string, setpoint, kp, ki, kd float64) *PID {
+	return &PID{Device: device, Kp: kp, Ki: ki, Kd: kd, setpoint: setpoint}
+}
+
+// SetSetpoint changes the setpoint
+func (c *PID) SetSetpoint(setpoint float64) {
+	c.mu.Lock()
+	c.setpoint = setpoint
+	c.mu.Unlock()
+}
+
+// Setpoint returns the setpoint
+func (c *PID) Setpoint() float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.setpoint
+}
+
+// Value returns the last output computed, the minimum output before the
+// first reading
+func (c *PID) Value() float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.computed {
+		min, _ := c.bounds()
+		return min
+	}
+	return c.output
+}
+
+// bounds returns the range the output is clamped to
+func (c *PID) bounds() (min, max float64) {
+	if c.Min == 0 && c.Max == 0 {
+		return 0, 100
+	}
+	return c.Min, c.Max
+}
+
+// Reset clears the integral and derivative state, as after switching
+// the process being controlled
+func (c *PID) Reset() {
+	c.mu.Lock()
+	c.integral, c.last = 0, Reading{}
+	c.mu.Unlock()
+}
+
+// WriteReadings computes the output from the reading of the device, if
+// readings has one. A failed reading drives the output to its minimum
+// and resets the controller.
+func (c *PID) WriteReadings(readings []Reading) error {
+	for _, r := range readings {
+		if r.Device == nil || !r.IsTemperature() || (r.Device.Name != c.Device && (r.Device.Alias == "" || r.Device.Alias != c.Device)) {
+			continue
+		}
+		output := c.update(r)
+		if c.Output != nil {
+			if err := c.Output(output, r); err != nil {
+				return fmt.Errorf("Error driving the output of the %v PID: %w", c.Device, err)
+			}
+		}
+		return nil
+	}
+	return nil
+}
+
+// update computes the output for r
+func (c *PID) update(r Reading) float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	min, max := c.bounds()
+	c.computed = true
+	if r.Err != nil {
+		c.integral, c.last, c.output = 0, Reading{}, min
+		return c.output
+	}
+
+	v := float64(r.Value)
+	e := c.setpoint - v
+	var dt time.Duration
+	if !c.last.Time.IsZero() {
+		dt = r.Time.Sub(c.last.Time)
+	}
+
+	p := c.Kp * e
+	var d float64
+	if dt > 0 {
+		d = -c.Kd * (v - float64(c.last.Value)) / dt.Seconds()
+	}
+	integral := c.integral
+	if dt > 0 {
+		integral += c.Ki * e * dt.Seconds()
+	}
+
+	out := p + integral + d
+	clamped := math.Max(min, math.Min(max, out))
+	// Anti-windup: keep the integral only when it does not push the
+	// output further into saturation
+	if clamped == out || (out > max && integral < c.integral) || (out < min && integral > c.integral) {
+		c.integral = integral
+	}
+	c.last, c.output = r, clamped
+	return clamped
+}
@@ -0,0 +1,30 @@
+package rpionewire
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestPIDValue(t *testing.T) {
+	d := &DS1820{Name: "28-000000000001"}
+	c := NewPID(d.Name, 60, 10, 0, 0)
+	c.Min, c.Max = 10, 90
+	if v := c.Value(); v != 10 {
+		t.Errorf("Value before the first reading = %v, want the minimum", v)
+	}
+
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	c.WriteReadings([]Reading{{Device: d, Value: 57, Time: now}})
+	if v := c.Value(); v != 30 {
+		t.Errorf("Value = %v, want 30", v)
+	}
+	c.WriteReadings([]Reading{{Device: d, Time: now.Add(time.Minute), Err: errors.New("bus wedged")}})
+	if v := c.Value(); v != 10 {
+		t.Errorf("Value after a failed reading = %v, want the minimum", v)
+	}
+
+	if v := NewPID(d.Name, 60, 10, 0, 0).Value(); v != 0 {
+		t.Errorf("Value of an unclamped controller = %v, want 0", v)
+	}
+}
@@ -0,0 +1,398 @@
+package rpionewire
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Sink consumes the readings produced by a Poller
+type Sink interface {
+	WriteReadings(readings []Reading) error
+}
+
+// Flusher is implemented by sinks buffering readings. A stopping Poller
+// flushes them so that no reading is lost.
+type Flusher interface {
+	Flush() error
+}
+
+// ErrDrainTimeout is returned by Stop when the poller did not drain
+// within its drain timeout
+var ErrDrainTimeout = errors.New("poller did not drain before the timeout")
+
+// Poller reads a set of devices on a schedule, a regular interval by
+// default, and hands the readings of each cycle to its sinks
+type Poller struct {
+	devices  []*DS1820
+	schedule Schedule
+	// deviceSchedules override schedule for the devices they name
+	deviceSchedules map[string]Schedule
+	// priorities rank the devices they name, higher first
+	priorities map[string]int
+	jitter     time.Duration
+	sinks      []Sink
+	logger     *log.Logger
+	clock      Clock
+	metrics    Metrics
+	tracer     Tracer
+	// aggregates and deltas are computed from latest, the latest reading
+	// of every device, after each cycle, and heatMeters from the deltas
+	aggregates []*zoneAggregate
+	deltas     []*deltaT
+	heatMeters []*HeatMeter
+	latest     map[*DS1820]Reading
+
+	drainTimeout time.Duration
+	mu           sync.Mutex
+	running      bool
+	stop         chan struct{}
+	stopOnce     sync.Once
+	done         chan struct{}
+}
+
+// PollerOption configures a Poller
+type PollerOption func(*Poller)
+
+// WithSinks adds sinks receiving the readings of every cycle
+func WithSinks(sinks ...Sink) PollerOption {
+	return func(p *Poller) {
+		p.sinks = append(p.sinks, sinks...)
+	}
+}
+
+// WithLogger sets the logger the poller reports sink errors to,
+// instead of the standard logger
+func WithLogger(logger *log.Logger) PollerOption {
+	return func(p *Poller) {
+		p.logger = logger
+	}
+}
+
+// WithSchedule makes the poller run its cycles on schedule instead of
+// its interval
+func WithSchedule(schedule Schedule) PollerOption {
+	return func(p *Poller) {
+		p.schedule = schedule
+	}
+}
+
+// WithDeviceSchedule makes the poller read the device named device,
+// by sysfs name or alias, or the devices of the group named device, on
+// their own schedule instead of the schedule of the poller. A schedule
+// given to the device itself wins over those of its groups. Cycles then
+// only read and hand to the sinks the devices that are due.
+func WithDeviceSchedule(device string, schedule Schedule) PollerOption {
+	return func(p *Poller) {
+		if p.deviceSchedules == nil {
+			p.deviceSchedules = map[string]Schedule{}
+		}
+		p.deviceSchedules[device] = schedule
+	}
+}
+
+// WithPriority gives the device named device, by sysfs name or alias,
+// a priority. Each cycle reads its devices by decreasing priority, the
+// devices of a priority level being read concurrently once those of
+// the levels above completed, so that a critical sensor does not wait
+// behind the conversions of the rest of the bus. A priority given to
+// the name of a device wins over one given to its alias. Devices default
+// to priority 0.
+func WithPriority(device string, priority int) PollerOption {
+	return func(p *Poller) {
+		if p.priorities == nil {
+			p.priorities = map[string]int{}
+		}
+		p.priorities[device] = priority
+	}
+}
+
+// WithJitter delays every cycle by a random duration of up to max, so
+// that pollers started together do not hit their sinks in synchronized
+// bursts. The delay does not accumulate: cycles stay on schedule on
+// average.
+func WithJitter(max time.Duration) PollerOption {
+	return func(p *Poller) {
+		p.jitter = max
+	}
+}
+
+// WithPollerClock makes the poller schedule its cycles with clock
+// instead of the system clock
+func WithPollerClock(clock Clock) PollerOption {
+	return func(p *Poller) {
+		p.clock = clock
+	}
+}
+
+// WithPollerMetrics makes the poller report the duration of its cycles
+// and the failures of its sinks to m
+func WithPollerMetrics(m Metrics) PollerOption {
+	return func(p *Poller) {
+		p.metrics = m
+	}
+}
+
+// WithPollerTracer makes the poller wrap its cycles in spans started
+// with t, the reads of the cycle being traced as their children
+func WithPollerTracer(t Tracer) PollerOption {
+	return func(p *Poller) {
+		p.tracer = t
+	}
+}
+
+// WithDrainTimeout sets how long Stop waits for the poller to drain,
+// 10 seconds by default
+func WithDrainTimeout(d time.Duration) PollerOption {
+	return func(p *Poller) {
+		p.drainTimeout = d
+	}
+}
+
+// NewPoller returns a Poller reading devices every interval
+func NewPoller(devices []*DS1820, interval time.Duration, opts ...PollerOption) *Poller {
+	p := &Poller{
+		devices:  devices,
+		schedule: Every(interval),
+		logger:   log.Default(),
+		clock:    SystemClock,
+		metrics:  nopMetrics{},
+		tracer:   nopTracer{},
+
+		drainTimeout: 10 * time.Second,
+		stop:         make(chan struct{}),
+		done:         make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
+}
+
+// Run polls the devices, starting immediately, until ctx is done or
+// Stop is called. Each device is read when its schedule fires, devices
+// due at the same time being read in the same cycle; a cycle running
+// late delays the next one instead of piling up.
+//
+// On the way out, the cycle in progress completes and hands its readings
+// to the sinks, the sinks that are Flushers are flushed, and the channel
+// returned by Done is closed. Run returns nil when stopped by Stop and
+// ctx.Err() otherwise. A Poller runs at most once.
+func (p *Poller) Run(ctx context.Context) error {
+	p.mu.Lock()
+	if p.running {
+		p.mu.Unlock()
+		return errors.New("poller already ran")
+	}
+	p.running = true
+	p.mu.Unlock()
+	defer close(p.done)
+	defer p.flush()
+
+	schedules := make([]Schedule, len(p.devices))
+	next := make([]time.Time, len(p.devices))
+	start := p.clock.Now()
+	for i, d := range p.devices {
+		schedules[i] = p.scheduleOf(d)
+		next[i] = start
+	}
+
+	for {
+		now := p.clock.Now()
+		var due []*DS1820
+		for i, d := range p.devices {
+			if !next[i].IsZero() && !next[i].After(now) {
+				due = append(due, d)
+				next[i] = schedules[i].Next(next[i])
+			}
+		}
+		if len(due) > 0 {
+			if err := p.poll(ctx, due); err != nil {
+				p.logger.Printf("rpionewire: %v", err)
+			}
+		}
+
+		var wake time.Time
+		now = p.clock.Now()
+		for i := range next {
+			if next[i].IsZero() {
+				continue
+			}
+			if next[i].Before(now) {
+				next[i] = now
+			}
+			if wake.IsZero() || next[i].Before(wake) {
+				wake = next[i]
+			}
+		}
+		var timer <-chan time.Time
+		if !wake.IsZero() {
+			timer = p.clock.After(wake.Sub(now) + p.randomJitter())
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-p.stop:
+			return nil
+		case <-timer:
+		}
+	}
+}
+
+// Stop stops a running poller and waits for it to drain, as described
+// in Run, for up to the drain timeout. It returns ErrDrainTimeout if the
+// poller is still draining by then.
+func (p *Poller) Stop() error {
+	p.stopOnce.Do(func() { close(p.stop) })
+	p.mu.Lock()
+	running := p.running
+	p.mu.Unlock()
+	if !running {
+		return nil
+	}
+	select {
+	case <-p.done:
+		return nil
+	case <-p.clock.After(p.drainTimeout):
+		return ErrDrainTimeout
+	}
+}
+
+// Done returns a channel closed once Run returned and the sinks were
+// flushed
+func (p *Poller) Done() <-chan struct{} {
+	return p.done
+}
+
+// flush flushes the sinks buffering readings
+func (p *Poller) flush() {
+	for _, s := range p.sinks {
+		if f, ok := s.(Flusher); ok {
+			if err := f.Flush(); err != nil {
+				p.logger.Printf("rpionewire: %v", err)
+			}
+		}
+	}
+}
+
+// scheduleOf returns the schedule device is read on, the one given to
+// its name winning over the one given to its alias, and both over
+// those of its groups
+func (p *Poller) scheduleOf(d *DS1820) Schedule {
+	if s, ok := p.deviceSchedules[d.Name]; ok {
+		return s
+	}
+	if s, ok := p.deviceSchedules[d.Alias]; ok && d.Alias != "" {
+		return s
+	}
+	for _, g := range d.Groups {
+		if s, ok := p.deviceSchedules[g]; ok {
+			return s
+		}
+	}
+	return p.schedule
+}
+
+// Poll runs a single cycle: it reads every device concurrently and
+// writes the readings to the sinks. The returned error joins the
+// errors of the sinks; read errors are carried by the readings.
+func (p *Poller) Poll() error {
+	return p.poll(context.Background(), p.devices)
+}
+
+func (p *Poller) poll(ctx context.Context, devices []*DS1820) (err error) {
+	ctx, span := p.tracer.Start(ctx, "rpionewire.poll")
+	defer func() { span.End(err) }()
+
+	start := p.clock.Now()
+	readings := make([]Reading, len(devices))
+	for _, level := range p.levels(devices) {
+		group := make([]*DS1820, len(level))
+		for i, j := range level {
+			group[i] = devices[j]
+		}
+		for i, c := range readAsync(ctx, group) {
+			readings[level[i]] = <-c
+		}
+	}
+
+	p.metrics.Histogram("rpionewire_poll_duration_seconds", p.clock.Now().Sub(start).Seconds())
+	if len(p.aggregates) > 0 || len(p.deltas) > 0 || len(p.heatMeters) > 0 {
+		readings = append(readings, p.derive(readings, p.clock.Now())...)
+	}
+
+	var errs []error
+	var transitions []AlertTransition
+	for _, s := range p.sinks {
+		if err := s.WriteReadings(readings); err != nil {
+			p.metrics.Counter("rpionewire_sink_errors_total", 1)
+			errs = append(errs, err)
+		}
+		if a, ok := s.(*Alerter); ok {
+			transitions = append(transitions, a.lastTransitions()...)
+		}
+	}
+	if len(transitions) > 0 {
+		for _, s := range p.sinks {
+			if as, ok := s.(AlertSink); ok {
+				if err := as.WriteTransitions(transitions); err != nil {
+					p.metrics.Counter("rpionewire_sink_errors_total", 1)
+					errs = append(errs, err)
+				}
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// levels groups the indexes of devices by decreasing priority
+func (p *Poller) levels(devices []*DS1820) [][]int {
+	if len(p.priorities) == 0 {
+		all := make([]int, len(devices))
+		for i := range all {
+			all[i] = i
+		}
+		return [][]int{all}
+	}
+
+	byPriority := map[int][]int{}
+	for i, d := range devices {
+		prio := p.priorityOf(d)
+		byPriority[prio] = append(byPriority[prio], i)
+	}
+	prios := make([]int, 0, len(byPriority))
+	for prio := range byPriority {
+		prios = append(prios, prio)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(prios)))
+
+	levels := make([][]int, len(prios))
+	for i, prio := range prios {
+		levels[i] = byPriority[prio]
+	}
+	return levels
+}
+
+// priorityOf returns the priority of device, looked up as scheduleOf
+// does: by its name first, then by its alias
+func (p *Poller) priorityOf(d *DS1820) int {
+	if prio, ok := p.priorities[d.Name]; ok {
+		return prio
+	}
+	if prio, ok := p.priorities[d.Alias]; ok && d.Alias != "" {
+		return prio
+	}
+	return 0
+}
+
+// randomJitter returns the random delay added to the next cycle
+func (p *Poller) randomJitter() time.Duration {
+	if p.jitter <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(p.jitter)))
+}
@@ -0,0 +1,135 @@
+package rpionewire
+
+import (
+	"context"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// cycleSink records the devices of the first cycles cycles, cancelling
+// its context after them. The poller may still run a few cycles before
+// it sees the cancellation, its fake timers being ready at once.
+type cycleSink struct {
+	cycles int
+	cancel context.CancelFunc
+	got    [][]string
+}
+
+func (s *cycleSink) WriteReadings(readings []Reading) error {
+	if len(s.got) == s.cycles {
+		return nil
+	}
+	var names []string
+	for _, r := range readings {
+		names = append(names, r.Device.Name)
+	}
+	s.got = append(s.got, names)
+	if len(s.got) == s.cycles {
+		s.cancel()
+	}
+	return nil
+}
+
+func TestPollerDeviceSchedules(t *testing.T) {
+	clock := newFakeClock()
+	boiler, soil := "28-000000000001", "28-000000000002"
+	backend := &fakeBackend{names: []string{boiler, soil}, temp: 20}
+	devices, err := NewBus(WithBackend(backend), WithClock(clock)).LoadDevices()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sink := &cycleSink{cycles: 4, cancel: cancel}
+	p := NewPoller(devices, 5*time.Second, WithDeviceSchedule(soil, Every(15*time.Second)), WithSinks(sink), WithPollerClock(clock))
+	if err := p.Run(ctx); err != context.Canceled {
+		t.Fatalf("Run returned %v", err)
+	}
+
+	want := [][]string{{boiler, soil}, {boiler}, {boiler}, {boiler, soil}}
+	if !reflect.DeepEqual(sink.got, want) {
+		t.Fatalf("sinks got cycles %v, want %v", sink.got, want)
+	}
+}
+
+func TestPollerGroupSchedules(t *testing.T) {
+	clock := newFakeClock()
+	boiler, soil := "28-000000000001", "28-000000000002"
+	backend := &fakeBackend{names: []string{boiler, soil}, temp: 20}
+	devices, err := NewBus(WithBackend(backend), WithClock(clock)).LoadDevices()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, d := range devices {
+		d.Groups = []string{"garden"}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sink := &cycleSink{cycles: 3, cancel: cancel}
+	opts := []PollerOption{
+		WithDeviceSchedule("garden", Every(15*time.Second)),
+		WithDeviceSchedule(boiler, Every(5*time.Second)),
+		WithSinks(sink), WithPollerClock(clock),
+	}
+	if err := NewPoller(devices, time.Minute, opts...).Run(ctx); err != context.Canceled {
+		t.Fatalf("Run returned %v", err)
+	}
+
+	// The boiler keeps its own schedule, the soil sensor takes the one
+	// of its group
+	want := [][]string{{boiler, soil}, {boiler}, {boiler}}
+	if !reflect.DeepEqual(sink.got, want) {
+		t.Fatalf("sinks got cycles %v, want %v", sink.got, want)
+	}
+}
+
+func TestPollerNameWinsOverAlias(t *testing.T) {
+	boiler := &DS1820{Name: "28-000000000001", Alias: "boiler"}
+	soil := &DS1820{Name: "28-000000000002"}
+	hourly, daily := Every(time.Hour), Every(24*time.Hour)
+	p := NewPoller([]*DS1820{soil, boiler}, time.Minute,
+		WithPriority("boiler", -1), WithPriority(boiler.Name, 1),
+		WithDeviceSchedule("boiler", daily), WithDeviceSchedule(boiler.Name, hourly))
+
+	if got := p.levels(p.devices); !reflect.DeepEqual(got, [][]int{{1}, {0}}) {
+		t.Errorf("levels = %v, want the boiler first by its name", got)
+	}
+	if got := p.scheduleOf(boiler); got != hourly {
+		t.Errorf("boiler read on %v, want the schedule of its name", got)
+	}
+}
+
+func TestPollerHeatMeter(t *testing.T) {
+	flow, ret := &DS1820{Name: "28-000000000001"}, &DS1820{Name: "28-000000000002"}
+	meter := &HeatMeter{DeltaT: "loop"}
+	meter.SetFlow(60)
+	p := NewPoller([]*DS1820{flow, ret}, time.Minute, WithDeltaT(DeltaT{Name: "loop", Hot: flow.Name, Cold: ret.Name}), WithHeatMeter(meter))
+
+	// The first cycle gives the power, the second one the energy
+	// carried since
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i, want := range []struct{ power, energy float64 }{{41.86, 0}, {41.86, 41.86}} {
+		now := start.Add(time.Duration(i) * time.Hour)
+		derived := p.derive([]Reading{{Device: flow, Value: 40, Time: now}, {Device: ret, Value: 30, Time: now}}, now)
+		got := map[string]Reading{}
+		for _, r := range derived {
+			got[r.Device.Name] = r
+		}
+		for name, v := range map[string]Measurement{
+			"loop:power":  {Kind: KindPower, Value: want.power, Unit: "kW"},
+			"loop:energy": {Kind: KindEnergy, Value: want.energy, Unit: "kWh"},
+		} {
+			r, ok := got[name]
+			if !ok || r.Err != nil || r.Flags&FlagDerived == 0 || r.IsTemperature() || r.Value != 0 {
+				t.Fatalf("cycle %v: %v reading %+v, want a derived %v", i, name, r, v.Kind)
+			}
+			if m := r.Measurement; m.Kind != v.Kind || m.Unit != v.Unit || math.Abs(m.Value-v.Value) > 1e-9 {
+				t.Errorf("cycle %v: %v measured %v, want %v", i, name, m, v)
+			}
+		}
+	}
+}
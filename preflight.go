@@ -0,0 +1,216 @@
+package rpionewire
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// PreflightStatus is the outcome of a preflight check
+type PreflightStatus int
+
+const (
+	// PreflightPass means the check found nothing wrong
+	PreflightPass PreflightStatus = iota
+	// PreflightWarn means the check could not conclude, or found
+	// something that may be intended
+	PreflightWarn
+	// PreflightFail means the bus cannot work until fixed
+	PreflightFail
+)
+
+func (s PreflightStatus) String() string {
+	switch s {
+	case PreflightPass:
+		return "pass"
+	case PreflightWarn:
+		return "warn"
+	case PreflightFail:
+		return "fail"
+	}
+	return fmt.Sprintf("PreflightStatus(%d)", int(s))
+}
+
+// PreflightCheck is a check of a PreflightReport
+type PreflightCheck struct {
+	// Name identifies the check: platform, modules, overlay, sysfs,
+	// masters, devices, kernel or access
+	Name   string
+	Status PreflightStatus
+	// Detail explains the outcome, and how to fix a failure
+	Detail string
+}
+
+// PreflightReport is the outcome of Preflight, meant to be shown to
+// users at startup rather than the path errors of a failing bus
+type PreflightReport struct {
+	Checks []PreflightCheck
+}
+
+// OK tells whether no check failed
+func (r PreflightReport) OK() bool {
+	for _, c := range r.Checks {
+		if c.Status == PreflightFail {
+			return false
+		}
+	}
+	return true
+}
+
+// String formats the report a check per line
+func (r PreflightReport) String() string {
+	var sb strings.Builder
+	for _, c := range r.Checks {
+		fmt.Fprintf(&sb, "%-4v  %-8v  %v\n", c.Status, c.Name, c.Detail)
+	}
+	return sb.String()
+}
+
+// bootConfigs are the firmware configuration files enabling overlays,
+// /boot/firmware on recent Raspberry Pi OS releases
+var bootConfigs = []string{"/boot/firmware/config.txt", "/boot/config.txt"}
+
+// Preflight checks that the local sysfs bus is usable, expecting at
+// least expected devices on it, without loading modules nor reading the
+// devices. Checks that cannot run, such as those depending on the
+// sysfs tree when it is missing, are left out.
+func (b *Bus) Preflight(expected int) PreflightReport {
+	var r PreflightReport
+	add := func(name string, status PreflightStatus, format string, args ...interface{}) {
+		r.Checks = append(r.Checks, PreflightCheck{Name: name, Status: status, Detail: fmt.Sprintf(format, args...)})
+	}
+
+	if runtime.GOOS != "linux" {
+		add("platform", PreflightFail, "%v: %v", runtime.GOOS, ErrUnsupportedPlatform)
+		return r
+	}
+	if _, ok := b.backend.(*Sysfs); !ok {
+		add("platform", PreflightPass, "the bus uses a %T backend, not the local sysfs tree", b.backend)
+		return r
+	}
+	add("platform", PreflightPass, "linux")
+
+	// Built in modules without parameters are missing from sysfs
+	present := func(m string) bool {
+		_, err := os.Stat(filepath.Join(b.root, "module", m))
+		return err == nil || moduleBuiltin(m)
+	}
+	var loaded, missing []string
+	for _, m := range masterModules {
+		if present(m) {
+			loaded = append(loaded, m)
+		}
+	}
+	if len(loaded) == 0 {
+		missing = append(missing, modules[0])
+	}
+	usb := present("ds2490")
+	for _, m := range modules[1:] {
+		if present(m) {
+			loaded = append(loaded, m)
+		} else {
+			missing = append(missing, m)
+		}
+	}
+	switch {
+	case len(missing) == 0:
+		add("modules", PreflightPass, "%v loaded", strings.Join(loaded, " and "))
+	case InContainer():
+		add("modules", PreflightFail, "%v not loaded: load them on the host, containers cannot", strings.Join(missing, " and "))
+	default:
+		add("modules", PreflightFail, "%v not loaded: run modprobe %v as root", strings.Join(missing, " and "), strings.Join(missing, " "))
+	}
+
+	if config, enabled, err := overlayEnabled(); usb && !enabled {
+		add("overlay", PreflightPass, "not needed with the ds2490 USB adapter driver")
+	} else if err != nil {
+		add("overlay", PreflightWarn, "no firmware configuration found, not a Raspberry Pi or not mounted")
+	} else if enabled {
+		add("overlay", PreflightPass, "w1-gpio enabled in %v", config)
+	} else {
+		add("overlay", PreflightFail, "w1-gpio not enabled: add dtoverlay=w1-gpio to %v and reboot", config)
+	}
+
+	entries, err := os.ReadDir(b.dir)
+	if err != nil {
+		add("sysfs", PreflightFail, "%v", noSysfs(b.dir))
+		return r
+	}
+	add("sysfs", PreflightPass, "%v readable", b.dir)
+
+	var masters, devices []string
+	for _, e := range entries {
+		switch name := e.Name(); {
+		case strings.HasPrefix(name, "w1_bus_master"):
+			masters = append(masters, name)
+		case IsDeviceName(name):
+			devices = append(devices, name)
+		}
+	}
+	if len(masters) == 0 {
+		add("masters", PreflightFail, "no bus master: is the w1-gpio overlay enabled, or the USB adapter plugged in?")
+	} else {
+		add("masters", PreflightPass, "%v", strings.Join(masters, ", "))
+	}
+
+	devices = b.filter(devices)
+	switch {
+	case len(devices) >= expected && len(devices) > 0:
+		add("devices", PreflightPass, "%v found, %v expected", len(devices), expected)
+	case len(devices) == 0 && expected == 0:
+		add("devices", PreflightWarn, "none found: check the wiring and the pull-up resistor")
+	default:
+		add("devices", PreflightFail, "%v found, %v expected: check the wiring and the pull-up resistor", len(devices), expected)
+	}
+
+	if c, err := b.Capabilities(); err == nil {
+		add("kernel", PreflightPass, "%v", c)
+	}
+
+	var denied []string
+	for _, name := range devices {
+		f, err := os.Open(filepath.Join(b.dir, name, "w1_slave"))
+		if err != nil {
+			if os.IsPermission(err) {
+				denied = append(denied, name)
+			}
+			continue
+		}
+		f.Close()
+	}
+	if len(denied) > 0 {
+		add("access", PreflightFail, "%v not readable by the current user: see rpionewire udev", strings.Join(denied, ", "))
+	} else if len(devices) > 0 {
+		add("access", PreflightPass, "devices readable")
+	}
+	return r
+}
+
+// Preflight checks the default bus, see Bus.Preflight
+func Preflight(expected int) PreflightReport {
+	return defaultBus.Preflight(expected)
+}
+
+// overlayEnabled looks for an uncommented w1-gpio overlay in the
+// firmware configuration, returning the file searched
+func overlayEnabled() (string, bool, error) {
+	for _, path := range bootConfigs {
+		f, err := os.Open(path)
+		if err != nil {
+			continue
+		}
+		defer f.Close()
+		s := bufio.NewScanner(f)
+		for s.Scan() {
+			line := strings.TrimSpace(s.Text())
+			if strings.HasPrefix(line, "dtoverlay=w1-gpio") {
+				return path, true, nil
+			}
+		}
+		return path, false, s.Err()
+	}
+	return "", false, os.ErrNotExist
+}
@@ -0,0 +1,174 @@
+package rpionewire
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Segment is a step of a Profile: a linear ramp of the setpoint to
+// Target over Ramp, then a hold at Target for Hold. A null Ramp steps
+// the setpoint to Target at once.
+type Segment struct {
+	Target float64
+	Ramp   time.Duration
+	Hold   time.Duration
+}
+
+// Profile is a sequence of ramp and hold segments driving a setpoint
+// over time, such as a mash schedule or a kiln firing
+type Profile struct {
+	Name     string
+	Segments []Segment
+}
+
+// Duration returns the total duration of the profile
+func (p Profile) Duration() time.Duration {
+	var d time.Duration
+	for _, s := range p.Segments {
+		d += s.Ramp + s.Hold
+	}
+	return d
+}
+
+// ProfilePhase is the phase of a segment a profile is in
+type ProfilePhase int
+
+const (
+	Ramping ProfilePhase = iota
+	Holding
+	// ProfileDone is the phase of a profile past its last segment, whose
+	// target is held
+	ProfileDone
+)
+
+func (p ProfilePhase) String() string {
+	switch p {
+	case Ramping:
+		return "ramping"
+	case Holding:
+		return "holding"
+	case ProfileDone:
+		return "done"
+	}
+	return fmt.Sprintf("ProfilePhase(%d)", int(p))
+}
+
+// Setpoint returns the setpoint of the profile started at the setpoint
+// start once elapsed has elapsed, with the index of the segment and its
+// phase
+func (p Profile) Setpoint(start float64, elapsed time.Duration) (float64, int, ProfilePhase) {
+	from := start
+	for i, s := range p.Segments {
+		if elapsed < s.Ramp {
+			return from + (s.Target-from)*float64(elapsed)/float64(s.Ramp), i, Ramping
+		}
+		elapsed -= s.Ramp
+		if elapsed < s.Hold {
+			return s.Target, i, Holding
+		}
+		elapsed -= s.Hold
+		from = s.Target
+	}
+	return from, len(p.Segments), ProfileDone
+}
+
+// Setpointer is a controller whose setpoint a ProfileRunner drives, such
+// as a Thermostat or a PID
+type Setpointer interface {
+	SetSetpoint(setpoint float64)
+}
+
+// ProfileProgress reports the progress of a ProfileRunner, published
+// when it enters a segment phase and when it completes
+type ProfileProgress struct {
+	Profile  string
+	Segment  int
+	Phase    ProfilePhase
+	Setpoint float64
+	Elapsed  time.Duration
+	// Remaining is the time left until the end of the profile
+	Remaining time.Duration
+	Time      time.Time
+}
+
+func (p ProfileProgress) String() string {
+	return fmt.Sprintf("%v: segment %d %v at %.2f, %v remaining", p.Profile, p.Segment+1, p.Phase, p.Setpoint, p.Remaining)
+}
+
+// ProfileRunner executes a Profile, updating the setpoint of its targets
+// every Step
+type ProfileRunner struct {
+	// Step is the interval between setpoint updates, 1 second if zero
+	Step time.Duration
+	// Clock times the profile, the system clock if nil
+	Clock Clock
+
+	profile  Profile
+	start    float64
+	targets  []Setpointer
+	progress fanout[ProfileProgress]
+}
+
+// NewProfileRunner returns a ProfileRunner executing profile from the
+// setpoint start, typically the current temperature, on targets
+func NewProfileRunner(profile Profile, start float64, targets ...Setpointer) *ProfileRunner {
+	return &ProfileRunner{profile: profile, start: start, targets: targets}
+}
+
+// Subscribe returns a channel receiving the progress of the runner and a
+// function ending the subscription. Progress is dropped for a subscriber
+// whose buffer of size buffer is full.
+func (r *ProfileRunner) Subscribe(buffer int) (<-chan ProfileProgress, func()) {
+	return r.progress.subscribe(buffer)
+}
+
+// Run executes the profile until it completes, returning nil, or until
+// ctx is done, returning ctx.Err(). The targets keep the last setpoint
+// once Run returns.
+func (r *ProfileRunner) Run(ctx context.Context) error {
+	clock, step := r.Clock, r.Step
+	if clock == nil {
+		clock = SystemClock
+	}
+	if step <= 0 {
+		step = time.Second
+	}
+
+	total := r.profile.Duration()
+	t0 := clock.Now()
+	segment, phase := -1, ProfilePhase(-1)
+	for {
+		now := clock.Now()
+		elapsed := now.Sub(t0)
+		sp, i, ph := r.profile.Setpoint(r.start, elapsed)
+		for _, t := range r.targets {
+			t.SetSetpoint(sp)
+		}
+		if i != segment || ph != phase {
+			segment, phase = i, ph
+			remaining := total - elapsed
+			if remaining < 0 {
+				remaining = 0
+			}
+			r.progress.send(ProfileProgress{
+				Profile:   r.profile.Name,
+				Segment:   i,
+				Phase:     ph,
+				Setpoint:  sp,
+				Elapsed:   elapsed,
+				Remaining: remaining,
+				Time:      now,
+			})
+		}
+		if ph == ProfileDone {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-clock.After(step):
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package rpionewire
+
+import (
+	"io"
+	"os"
+	"sync"
+)
+
+// readBufs recycles the buffers the sysfs files are read into, so that
+// polling does not allocate a buffer per read
+var readBufs = sync.Pool{
+	New: func() interface{} {
+		b := make([]byte, 128)
+		return &b
+	},
+}
+
+// readFile reads the file at path, opened with flag, into a pooled
+// buffer and passes its content to parse. The content is only valid
+// during the call.
+func readFile(path string, flag int, parse func(content []byte)) error {
+	f, err := os.OpenFile(path, flag, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	bp := readBufs.Get().(*[]byte)
+	defer readBufs.Put(bp)
+	content, err := readInto(f, bp)
+	if err != nil {
+		return err
+	}
+	parse(content)
+	return nil
+}
+
+// readInto reads r until EOF into *buf, growing it as needed, and
+// returns the bytes read
+func readInto(r io.Reader, buf *[]byte) ([]byte, error) {
+	b := *buf
+	n := 0
+	for {
+		if n == len(b) {
+			b = append(b[:n], 0)
+			b = b[:cap(b)]
+			*buf = b
+		}
+		m, err := r.Read(b[n:])
+		n += m
+		if err == io.EOF {
+			return b[:n], nil
+		}
+		if err != nil {
+			return b[:n], err
+		}
+	}
+}
+
+// parseInt parses the decimal integer b, surrounding white space
+// ignored, without converting it to a string
+func parseInt(b []byte) (int64, bool) {
+	for len(b) > 0 && isSpace(b[0]) {
+		b = b[1:]
+	}
+	for len(b) > 0 && isSpace(b[len(b)-1]) {
+		b = b[:len(b)-1]
+	}
+	neg := false
+	if len(b) > 0 && (b[0] == '-' || b[0] == '+') {
+		neg = b[0] == '-'
+		b = b[1:]
+	}
+	if len(b) == 0 || len(b) > 18 {
+		return 0, false
+	}
+	var v int64
+	for _, c := range b {
+		if c < '0' || c > '9' {
+			return 0, false
+		}
+		v = v*10 + int64(c-'0')
+	}
+	if neg {
+		v = -v
+	}
+	return v, true
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
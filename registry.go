@@ -0,0 +1,134 @@
+package rpionewire
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// Registry merges the devices of several buses, typically reached
+// through different hosts, into a single set of devices labeled with
+// the host they belong to. A device reachable through several buses,
+// such as a bus wired to two hosts for redundancy, or through several
+// masters of a bus, is listed once, by the first host it was found on;
+// Paths tells every way to reach it. Devices are told apart by their
+// ROM code, their family and serial number.
+type Registry struct {
+	mu      sync.Mutex
+	hosts   []string
+	buses   map[string]*Bus
+	devices []*DS1820
+	// paths are the ways to reach each device, by sysfs name
+	paths map[string][]Path
+}
+
+// Path is a way of reaching a device: the host of its bus and, on a
+// local sysfs bus, the bus masters listing it
+type Path struct {
+	Host string
+	// Masters is empty when the bus is not local
+	Masters []string
+}
+
+// romCode identifies a device wherever it is seen from
+type romCode struct {
+	family string
+	id     uint64
+}
+
+// NewRegistry returns an empty Registry
+func NewRegistry() *Registry {
+	return &Registry{buses: make(map[string]*Bus)}
+}
+
+// Add registers the bus of host, replacing any bus previously added for
+// the same host
+func (r *Registry) Add(host string, b *Bus) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.buses[host]; !ok {
+		r.hosts = append(r.hosts, host)
+	}
+	r.buses[host] = b
+}
+
+// Hosts returns the hosts registered, in the order they were added
+func (r *Registry) Hosts() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.hosts...)
+}
+
+// LoadDevices loads the devices of every bus and sets their Host. A
+// host that cannot be reached does not prevent the others from being
+// loaded: its error is joined in the returned error.
+func (r *Registry) LoadDevices() ([]*DS1820, error) {
+	r.mu.Lock()
+	hosts := append([]string(nil), r.hosts...)
+	buses := make([]*Bus, len(hosts))
+	for i, h := range hosts {
+		buses[i] = r.buses[h]
+	}
+	r.mu.Unlock()
+
+	type result struct {
+		devices []*DS1820
+		err     error
+	}
+	results := make([]result, len(hosts))
+	var wg sync.WaitGroup
+	for i := range hosts {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			devices, err := buses[i].LoadDevices()
+			results[i] = result{devices, err}
+		}(i)
+	}
+	wg.Wait()
+
+	var devices []*DS1820
+	var errs []error
+	// paths are keyed by the name of the device listed, which other
+	// hosts may see under another name
+	paths := map[string][]Path{}
+	listed := map[romCode]*DS1820{}
+	for i, res := range results {
+		masters := buses[i].slaveMasters()
+		for _, d := range res.devices {
+			rom := romCode{d.DeviceType, d.ID}
+			first, dup := listed[rom]
+			if !dup {
+				d.Host = hosts[i]
+				devices = append(devices, d)
+				listed[rom] = d
+				first = d
+			}
+			paths[first.Name] = append(paths[first.Name], Path{Host: hosts[i], Masters: masters[d.Name]})
+		}
+		if res.err != nil {
+			errs = append(errs, fmt.Errorf("%v: %w", hosts[i], res.err))
+		}
+	}
+
+	r.mu.Lock()
+	r.devices = devices
+	r.paths = paths
+	r.mu.Unlock()
+	return devices, errors.Join(errs...)
+}
+
+// Paths returns the ways to reach the device name, by sysfs name, found
+// by the last LoadDevices, the one its DS1820 uses first
+func (r *Registry) Paths(name string) []Path {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Path(nil), r.paths[name]...)
+}
+
+// Devices returns the devices found by the last LoadDevices
+func (r *Registry) Devices() []*DS1820 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]*DS1820(nil), r.devices...)
+}
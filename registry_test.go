@@ -0,0 +1,40 @@
+package rpionewire
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestRegistryPaths(t *testing.T) {
+	// The device is wired to both masters of the cellar and to the
+	// garage, which has a device of its own
+	cellar, garage := t.TempDir(), t.TempDir()
+	cellarDir := filepath.Join(cellar, "bus", "w1", "devices")
+	garageDir := filepath.Join(garage, "bus", "w1", "devices")
+	writeDevice(t, cellarDir, "28-000000000001", nil)
+	writeDevice(t, cellarDir, "w1_bus_master1", map[string]string{"w1_master_slaves": "28-000000000001\n"})
+	writeDevice(t, cellarDir, "w1_bus_master2", map[string]string{"w1_master_slaves": "28-000000000001\n"})
+	writeDevice(t, garageDir, "28-000000000001", nil)
+	writeDevice(t, garageDir, "28-000000000002", nil)
+	writeDevice(t, garageDir, "w1_bus_master1", map[string]string{"w1_master_slaves": "28-000000000001\n28-000000000002\n"})
+
+	r := NewRegistry()
+	r.Add("cellar", NewBus(WithSysfsRoot(cellar)))
+	r.Add("garage", NewBus(WithSysfsRoot(garage)))
+	devices, err := r.LoadDevices()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(devices) != 2 || devices[0].Host != "cellar" || devices[1].Host != "garage" {
+		t.Fatalf("got devices %v, want each device once, on the first host listing it", devices)
+	}
+
+	want := []Path{
+		{Host: "cellar", Masters: []string{"w1_bus_master1", "w1_bus_master2"}},
+		{Host: "garage", Masters: []string{"w1_bus_master1"}},
+	}
+	if paths := r.Paths("28-000000000001"); !reflect.DeepEqual(paths, want) {
+		t.Errorf("got paths %+v, want %+v", paths, want)
+	}
+}
@@ -0,0 +1,227 @@
+// Package remote reads the w1 sysfs tree of another host over SSH, so a
+// central machine can poll the sensors of several Raspberry Pis without
+// deploying an agent on them.
+package remote
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/fredcarle/rpionewire"
+)
+
+// DialTimeout is the timeout of the SSH connections of the configs
+// without one
+const DialTimeout = 10 * time.Second
+
+// Backend is a rpionewire.AttrBackend reading the sysfs tree of a
+// remote host through SFTP. The w1 kernel modules must already be
+// loaded on the remote host. A backend from Dial or Open connects again
+// when its connection is lost.
+type Backend struct {
+	// Dir is the remote w1 devices directory
+	Dir string
+
+	// addr and config dial the SSH connection, addr empty for a backend
+	// from New, which cannot reconnect
+	addr   string
+	config *ssh.ClientConfig
+
+	mu     sync.Mutex
+	ssh    *ssh.Client
+	sftp   *sftp.Client
+	closed bool
+}
+
+// Dial connects to the SSH server at addr, such as "pi-garage:22"
+func Dial(addr string, config *ssh.ClientConfig) (*Backend, error) {
+	b := Open(addr, config)
+	if _, err := b.session(); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// Open returns a Backend connecting to the SSH server at addr on its
+// first use, so that an unreachable host fails its reads rather than
+// the setup of the others
+func Open(addr string, config *ssh.ClientConfig) *Backend {
+	c := *config
+	if c.Timeout == 0 {
+		c.Timeout = DialTimeout
+	}
+	return &Backend{Dir: "/sys/bus/w1/devices", addr: addr, config: &c}
+}
+
+// New returns a Backend using an established SSH connection
+func New(client *ssh.Client) (*Backend, error) {
+	sc, err := sftp.NewClient(client)
+	if err != nil {
+		return nil, err
+	}
+	return &Backend{Dir: "/sys/bus/w1/devices", ssh: client, sftp: sc}, nil
+}
+
+// Close closes the SFTP session and the SSH connection
+func (b *Backend) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	if b.ssh == nil {
+		return nil
+	}
+	b.sftp.Close()
+	err := b.ssh.Close()
+	b.ssh, b.sftp = nil, nil
+	return err
+}
+
+// errClosed is returned once the backend is closed, or lost the
+// connection it got from New
+var errClosed = errors.New("remote: connection closed")
+
+// session returns the SFTP session, connecting first if needed
+func (b *Backend) session() (*sftp.Client, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.sftp != nil {
+		return b.sftp, nil
+	}
+	if b.closed || b.addr == "" {
+		return nil, errClosed
+	}
+	client, err := ssh.Dial("tcp", b.addr, b.config)
+	if err != nil {
+		return nil, err
+	}
+	sc, err := sftp.NewClient(client)
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+	b.ssh, b.sftp = client, sc
+	return sc, nil
+}
+
+// drop closes the session sc after it lost its connection, so that the
+// next call connects again
+func (b *Backend) drop(sc *sftp.Client) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.sftp != sc {
+		return
+	}
+	b.sftp.Close()
+	b.ssh.Close()
+	b.ssh, b.sftp = nil, nil
+}
+
+// lost tells whether err means the connection is lost
+func lost(err error) bool {
+	return errors.Is(err, sftp.ErrSSHFxConnectionLost) || errors.Is(err, io.EOF) || errors.Is(err, net.ErrClosed)
+}
+
+// do runs f on the SFTP session. If f lost the connection, the next
+// call connects again, and f runs once more on a new connection when
+// retry tells it is safe to repeat.
+func (b *Backend) do(retry bool, f func(sc *sftp.Client) error) error {
+	sc, err := b.session()
+	if err != nil {
+		return err
+	}
+	err = f(sc)
+	if !lost(err) {
+		return err
+	}
+	b.drop(sc)
+	if !retry {
+		return err
+	}
+	if sc, err = b.session(); err != nil {
+		return err
+	}
+	return f(sc)
+}
+
+// Devices lists the devices of the remote sysfs tree
+func (b *Backend) Devices() ([]string, error) {
+	var infos []os.FileInfo
+	err := b.do(true, func(sc *sftp.Client) (err error) {
+		infos, err = sc.ReadDir(b.Dir)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, info := range infos {
+		if rpionewire.IsDeviceName(info.Name()) {
+			names = append(names, info.Name())
+		}
+	}
+	return names, nil
+}
+
+// ReadTemperature reads the w1_slave file of the device
+func (b *Backend) ReadTemperature(name string) (float64, error) {
+	raw, err := b.ReadAttr(name, "w1_slave")
+	if err != nil {
+		return 0, err
+	}
+	return rpionewire.ParseW1Slave(bytes.NewReader(raw))
+}
+
+// ReadAttr reads a sysfs attribute of the device. Sysfs files report a
+// fake size, so they are read until EOF rather than by their size.
+func (b *Backend) ReadAttr(name, attr string) ([]byte, error) {
+	var buf bytes.Buffer
+	err := b.do(true, func(sc *sftp.Client) error {
+		buf.Reset()
+		f, err := sc.Open(path.Join(b.Dir, name, attr))
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		chunk := make([]byte, 4096)
+		for {
+			n, err := f.Read(chunk)
+			buf.Write(chunk[:n])
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// WriteAttr writes a sysfs attribute of the device. A write that lost
+// the connection is not repeated, as it may have reached the device.
+func (b *Backend) WriteAttr(name, attr string, value []byte) error {
+	return b.do(false, func(sc *sftp.Client) error {
+		f, err := sc.OpenFile(path.Join(b.Dir, name, attr), os.O_WRONLY)
+		if err != nil {
+			return err
+		}
+		if _, err := f.Write(value); err != nil {
+			f.Close()
+			return err
+		}
+		return f.Close()
+	})
+}
@@ -1,15 +1,17 @@
 package rpionewire
 
 import (
-	"bufio"
-	"encoding/binary"
+	"bytes"
+	"context"
 	"errors"
 	"fmt"
+	"io"
+	"io/fs"
+	"math"
 	"os"
-	"os/exec"
-	"regexp"
 	"strconv"
-	"strings"
+	"sync"
+	"time"
 )
 
 // DS1820 is a structure that stores the relevant information of
@@ -18,91 +20,558 @@ type DS1820 struct {
 	ID         uint64
 	Name       string
 	DeviceType string
-	LastTemp   float64
+	// Alias is a human friendly name given to the device
+	Alias string
+	// Host labels the host the device was loaded from by a Registry,
+	// empty for devices of a single bus
+	Host string
+	// Groups are the names of the groups the device belongs to, see
+	// Group
+	Groups []string
+	// Calibration is applied to every temperature read from the device
+	Calibration Calibration
+	// LastTemp is the temperature of the last successful read of the
+	// device. It is updated by every read, so it must not be used while
+	// the device is being read concurrently.
+	//
+	// Deprecated: use the Reading returned by Read or ReadEach.
+	LastTemp float64
+
+	bus    *Bus
+	branch *branchRef
+	mu     sync.Mutex
+	health Health
+	alarms *alarmThresholds
+	// resolution is the last resolution read or set, 0 if unknown
+	resolution int
+	// seq is the sequence number of the last reading of the device
+	seq uint64
+	// lastConversion is when the device was last read, to measure its
+	// duty cycle
+	lastConversion time.Time
+	// labelsOnce builds attrs and labels, the span attributes and metric
+	// labels of the device, on its first read
+	labelsOnce sync.Once
+	attrs      []Label
+	labels     []Label
+}
+
+// DeviceError associates an error with the device it occurred on
+type DeviceError struct {
+	Name string
+	Err  error
+}
+
+func (e *DeviceError) Error() string {
+	return fmt.Sprintf("%v: %v", e.Name, e.Err)
 }
 
+// Unwrap returns the underlying error
+func (e *DeviceError) Unwrap() error {
+	return e.Err
+}
+
+const devicesDir = "/sys/bus/w1/devices"
+
 const (
 	modelDS18S20 = 0x10
 	modelDS18B20 = 0x28
 )
 
-var _CrcCheckRegex = regexp.MustCompile(`crc=\w+\s(YES|NO)`)
-var _TestSampleRegex = regexp.MustCompile(`.*\st=(\d+)`)
+// knownFamilies are the family codes of the devices discovery reports,
+// other entries of the devices directory being ignored
+var knownFamilies = map[uint8]string{
+	modelDS18S20:  "DS18S20",
+	0x22:          "DS1822",
+	modelDS18B20:  "DS18B20",
+	0x3b:          "DS1825",
+	0x42:          "DS28EA00",
+	familyDS2409:  "DS2409",
+	familyDS2438:  "DS2438",
+	familyDS28E17: "DS28E17",
+	familyDS2890:  "DS2890",
+	familyDS1961S: "DS1961S",
+	familyDS1963S: "DS1963S",
+}
+
+// FamilyName returns the part number of the devices of the one wire
+// family code family, such as DS18B20 for 0x28, or an empty string for
+// a family unknown to the package
+func FamilyName(family uint8) string {
+	return knownFamilies[family]
+}
+
+// IsDeviceName tells whether name is the sysfs name of a device of a
+// known family: its family code and serial number in lowercase hex,
+// such as 28-0316a2794bff. Backends use it to leave out the bus masters
+// and the other entries of the devices directory.
+func IsDeviceName(name string) bool {
+	family, _, err := parseName(name)
+	_, ok := knownFamilies[family]
+	return err == nil && ok
+}
+
+// ErrCRCMismatch is returned when the kernel reports a CRC mismatch on
+// the data read from a device
+var ErrCRCMismatch = errors.New("CRC mismatch on read")
+
+// ErrNoData is returned when a device returns no temperature data
+var ErrNoData = errors.New("EOF without data from w1")
 
-// LoadDevices builds a list of available devices
+// LoadDevices builds a list of available devices. Devices that cannot
+// be opened are left out of the list and the returned error joins the
+// failure of each of them, so the devices that did open remain usable.
 func LoadDevices() ([]*DS1820, error) {
-	names, err := findDevices()
-	if err != nil {
-		return nil, fmt.Errorf("Error finding one wire devices: %v", err)
+	return defaultBus.LoadDevices()
+}
+
+// LoadDevicesContext is LoadDevices stopping early when ctx is done, see
+// Bus.LoadDevicesContext
+func LoadDevicesContext(ctx context.Context) ([]*DS1820, error) {
+	return defaultBus.LoadDevicesContext(ctx)
+}
+
+// ReadDevices reads each device in turn, storing the temperature of the
+// devices read successfully as their LastTemp. The returned error joins
+// a *DeviceError for every device that failed.
+//
+// Deprecated: use ReadEach, which returns the readings.
+func ReadDevices(d []*DS1820) error {
+	_, err := ReadEach(d)
+	return err
+}
+
+// ReadEach reads each device in turn and returns their readings in the
+// same order. A failing device does not stop the sweep: its reading
+// carries its error and the remaining devices are still read. The
+// returned error joins a *DeviceError for every device that failed.
+func ReadEach(d []*DS1820) ([]Reading, error) {
+	readings := make([]Reading, len(d))
+	var errs []error
+	for i, device := range d {
+		var err error
+		if readings[i], err = device.Read(); err != nil {
+			errs = append(errs, &DeviceError{Name: device.Name, Err: err})
+		}
 	}
+	return readings, errors.Join(errs...)
+}
 
-	devices := make([]*DS1820, len(names))
-	for i := range names {
-		devices[i], err = newDS1820(names[i])
-		if err != nil {
-			return nil, fmt.Errorf("Error opening devices %v: %v", devices[i].Name, err)
+// Reading is the result of a temperature read on a device. Readings
+// are values: they are never modified once returned and can be shared
+// freely between goroutines.
+type Reading struct {
+	Device   *DS1820
+	DeviceID uint64
+	// Seq numbers the reads of the device from 1, failed ones included,
+	// so that consumers can detect lost and duplicated readings
+	Seq uint64
+	// Value is the calibrated temperature, zero if the read failed
+	Value Temperature
+	// Raw is the temperature reported by the device before calibration,
+	// in millidegrees Celsius. For the DS18S20 it is computed from the
+	// scratchpad at extended resolution when available.
+	Raw int64
+	// Scratchpad holds the raw scratchpad bytes the temperature was
+	// decoded from, nil if the backend does not expose them. It must
+	// not be modified.
+	Scratchpad []byte
+	// Measurement, if set, is the quantity a synthetic reading carries
+	// instead of a temperature, such as the power of a HeatMeter, Value
+	// then being zero. It is nil for temperature readings.
+	Measurement *Measurement
+	// Time is when the read completed
+	Time  time.Time
+	Flags Flags
+	Err   error
+}
+
+// IsTemperature tells whether the reading carries a temperature in
+// Value, rather than another Measurement
+func (r Reading) IsTemperature() bool {
+	return r.Measurement == nil
+}
+
+// ReadAsync starts reading every device concurrently and returns one
+// channel per device, in the same order as d. Each channel delivers a
+// single Reading once the conversion of its device completes and is
+// then closed.
+func ReadAsync(d []*DS1820) []<-chan Reading {
+	return readAsync(context.Background(), d)
+}
+
+// readAsync is ReadAsync with the reads traced as children of the span
+// carried by ctx
+func readAsync(ctx context.Context, d []*DS1820) []<-chan Reading {
+	results := make([]<-chan Reading, len(d))
+	for i, device := range d {
+		c := make(chan Reading, 1)
+		results[i] = c
+		go func(device *DS1820) {
+			r, _ := device.ReadContext(ctx)
+			c <- r
+			close(c)
+		}(device)
+	}
+	return results
+}
+
+// ReadAll reads every device and returns the readings keyed by device
+// ID. A device that fails to read still gets an entry carrying its
+// error, and the errors of all failed devices are joined in the
+// returned error.
+func ReadAll(d []*DS1820) (map[uint64]Reading, error) {
+	readings := make(map[uint64]Reading, len(d))
+	var errs []error
+	for _, c := range ReadAsync(d) {
+		r := <-c
+		readings[r.Device.ID] = r
+		if r.Err != nil {
+			errs = append(errs, &DeviceError{Name: r.Device.Name, Err: r.Err})
 		}
 	}
 
-	return devices, nil
+	return readings, errors.Join(errs...)
 }
 
-// ReadDevices adds the current temperature read by each devices in
-// their respectice struct as LastTemp
-func ReadDevices(d []*DS1820) error {
-	for _, device := range d {
-		dataFile, err := os.OpenFile(fmt.Sprintf("/sys/bus/w1/devices/%v/w1_slave", device.Name), os.O_RDONLY|os.O_SYNC, 0666)
-		if err != nil {
-			return err
-		}
-		defer dataFile.Close()
-
-		scanner := bufio.NewScanner(dataFile)
-
-		i := 0
-		dataFile.Seek(0, 0)
-		for scanner.Scan() {
-			if i == 0 {
-				if err := scanner.Err(); err != nil {
-					return fmt.Errorf("EOF without data from w1")
-				}
-				line := scanner.Text()
-				matches := _CrcCheckRegex.FindStringSubmatch(string(line))
-				if len(matches) > 0 && matches[1] != "YES" {
-					return fmt.Errorf("CRC mismatch on read")
-				}
-			} else {
-				if err := scanner.Err(); err != nil {
-					return fmt.Errorf("EOF without data from w1")
-				}
-				line := scanner.Text()
-				matches := _TestSampleRegex.FindStringSubmatch(string(line))
-				if len(matches) > 0 {
-					v, err := strconv.ParseInt(matches[1], 10, 64)
-					if err != nil {
-						return err
-					}
-					device.LastTemp = float64(v) / 1000
-				} else {
-					return fmt.Errorf("EOF without data from w1")
-				}
+// Read performs a conversion on the device and returns its reading.
+// The error of a failed read is both returned and carried by the
+// reading.
+func (d *DS1820) Read() (Reading, error) {
+	return d.ReadContext(context.Background())
+}
+
+// ReadContext is Read with the read traced as a child of the span
+// carried by ctx, when the bus has a Tracer
+func (d *DS1820) ReadContext(ctx context.Context) (Reading, error) {
+	ctx, span := d.tracer().Start(ctx, "rpionewire.read", d.spanAttrs()...)
+	r, err := d.read(ctx, d.convert)
+	span.End(err)
+	return r, err
+}
+
+// read reads the device with convert, selecting its coupler branch
+// first, retrying and failing over as configured, and checks, records
+// and reports the outcome
+func (d *DS1820) read(ctx context.Context, convert func(context.Context) (int64, []byte, error)) (Reading, error) {
+	if d.branch != nil {
+		b := d.branch
+		b.coupler.mu.Lock()
+		defer b.coupler.mu.Unlock()
+		if err := b.coupler.selectBranch(b.branch); err != nil {
+			d.recordRead(err)
+			return d.reading(0, nil, 0, err), err
+		}
+	}
+
+	start := d.now()
+	raw, scratchpad, flags, err := d.convertWithRetries(ctx, convert)
+	if d.bus != nil {
+		var retried Flags
+		if errors.Is(err, fs.ErrNotExist) && d.bus.rediscover {
+			if rerr := d.bus.rebind(d); rerr == nil {
+				raw, scratchpad, retried, err = d.convertWithRetries(ctx, convert)
+				flags |= FlagRetried | retried
+			}
+		}
+		if err != nil && d.bus.failoverWait > 0 && d.branch == nil && !errors.Is(err, ErrCRCMismatch) && ctx.Err() == nil {
+			if m, ferr := d.bus.failover(d); ferr == nil {
+				d.bus.publish(Event{Type: MasterFailover, Device: d.Name, Err: err, Master: m.Name})
+				raw, scratchpad, retried, err = d.convertWithRetries(ctx, convert)
+				flags |= FlagRetried | retried
 			}
-			i++
+		}
+	}
+	d.recordRead(err)
+	if d.bus != nil {
+		latency := d.now().Sub(start)
+		if m := d.bus.masterOf(d); m != nil {
+			m.record(latency, err)
+		}
+		labels := d.metricLabels()
+		d.bus.metrics.Counter("rpionewire_reads_total", 1, labels...)
+		d.bus.metrics.Histogram("rpionewire_read_duration_seconds", latency.Seconds(), labels...)
+		if err != nil {
+			d.bus.metrics.Counter("rpionewire_read_failures_total", 1, labels...)
+		}
+	}
+	if err != nil {
+		if d.bus != nil {
+			d.bus.publish(Event{Type: ReadFailed, Device: d.Name, Err: err})
+		}
+		return d.reading(0, nil, flags, err), err
+	}
 
+	if d.DeviceType == "DS18S20" {
+		if v, ok := extendedResolution(scratchpad); ok {
+			raw = v
 		}
+	}
+	r := d.reading(raw, scratchpad, flags, nil)
+	if d.bus != nil {
+		d.bus.metrics.Gauge("rpionewire_temperature_celsius", float64(r.Value), d.metricLabels()...)
+		d.checkAlarms(r.Value)
+	}
+	return r, nil
+}
 
+// convertWithRetries converts the device with convert, retrying the
+// conversions failing the CRC check up to the CRC retries of the bus,
+// and records every conversion in the health of the device
+func (d *DS1820) convertWithRetries(ctx context.Context, convert func(context.Context) (int64, []byte, error)) (int64, []byte, Flags, error) {
+	var flags Flags
+	raw, scratchpad, err := convert(ctx)
+	d.recordConversion(err, false)
+	if d.bus == nil {
+		return raw, scratchpad, flags, err
 	}
-	return nil
+	for i := 0; errors.Is(err, ErrCRCMismatch) && i < d.bus.crcRetries; i++ {
+		d.bus.publish(Event{Type: CRCRetried, Device: d.Name, Err: err})
+		raw, scratchpad, err = convert(ctx)
+		d.recordConversion(err, true)
+		d.bus.metrics.Counter("rpionewire_crc_retries_total", 1, d.metricLabels()...)
+		flags |= FlagRetried
+	}
+	return raw, scratchpad, flags, err
 }
 
-// findDevices scans through the w1 device directory in order to
+// convert performs a single conversion and returns its temperature in
+// millidegrees Celsius, with the scratchpad when the backend exposes it
+func (d *DS1820) convert(ctx context.Context) (int64, []byte, error) {
+	_, span := d.tracer().Start(ctx, "rpionewire.convert", d.spanAttrs()...)
+	raw, scratchpad, err := d.convertRaw()
+	span.End(err)
+	return raw, scratchpad, err
+}
+
+func (d *DS1820) convertRaw() (int64, []byte, error) {
+	b := d.backend()
+	if rb, ok := b.(RawBackend); ok {
+		return rb.ReadRaw(d.Name)
+	}
+	v, err := b.ReadTemperature(d.Name)
+	if err != nil {
+		return 0, nil, err
+	}
+	return int64(math.Round(v * 1000)), nil, nil
+}
+
+// tracer returns the tracer of the bus of the device
+func (d *DS1820) tracer() Tracer {
+	if d.bus != nil {
+		return d.bus.tracer
+	}
+	return defaultBus.tracer
+}
+
+// spanAttrs returns the attributes of the spans of the device, built
+// once
+func (d *DS1820) spanAttrs() []Label {
+	d.labelsOnce.Do(d.buildLabels)
+	return d.attrs
+}
+
+// metricLabels returns the labels of the metrics of the device, built
+// once
+func (d *DS1820) metricLabels() []Label {
+	d.labelsOnce.Do(d.buildLabels)
+	return d.labels
+}
+
+func (d *DS1820) buildLabels() {
+	d.attrs = []Label{{"device.name", d.Name}, {"device.id", fmt.Sprintf("%012x", d.ID)}}
+	d.labels = []Label{{"device", d.Name}}
+}
+
+// reading returns the Reading of a read of the raw temperature raw, in
+// millidegrees, completing now
+func (d *DS1820) reading(raw int64, scratchpad []byte, flags Flags, err error) Reading {
+	r := Reading{Device: d, DeviceID: d.ID, Time: d.now(), Err: err}
+	if err == nil {
+		if raw == powerOnReset {
+			flags |= FlagPowerOnReset
+		}
+		r.Raw, r.Scratchpad = raw, scratchpad
+		r.Value = d.calibrate(float64(raw) / 1000)
+	}
+
+	d.mu.Lock()
+	if err == nil {
+		d.LastTemp = float64(r.Value)
+	}
+	d.seq++
+	r.Seq = d.seq
+	if d.resolution != 0 && d.resolution < 12 {
+		flags |= FlagReducedResolution
+	}
+	d.mu.Unlock()
+	r.Flags = flags
+	return r
+}
+
+// calibrate applies the calibration of the device to the raw
+// temperature v
+func (d *DS1820) calibrate(v float64) Temperature {
+	t := d.Calibration.Apply(v)
+	if d.Calibration.SelfHeating != 0 {
+		t -= d.Calibration.SelfHeating * d.dutyCycle(d.now())
+	}
+	return Temperature(t)
+}
+
+// now returns the time on the clock of the bus of the device
+func (d *DS1820) now() time.Time {
+	if d.bus != nil {
+		return d.bus.clock.Now()
+	}
+	return defaultBus.clock.Now()
+}
+
+// backend returns the backend the device is read through
+func (d *DS1820) backend() Backend {
+	if d.bus != nil {
+		return d.bus.backend
+	}
+	return defaultBus.backend
+}
+
+// readW1Slave reads the w1_slave file at path and returns the
+// temperature it reports in millidegrees Celsius and its scratchpad
+func readW1Slave(path string) (millis int64, scratchpad []byte, err error) {
+	rerr := readFile(path, os.O_RDONLY|os.O_SYNC, func(content []byte) {
+		millis, scratchpad, err = parseW1SlaveBytes(content)
+	})
+	if rerr != nil {
+		return 0, nil, rerr
+	}
+	return millis, scratchpad, err
+}
+
+// ParseW1Slave parses the content of a w1_slave file and returns the
+// temperature it reports in °C
+func ParseW1Slave(r io.Reader) (float64, error) {
+	millis, _, err := parseW1Slave(r)
+	if err != nil {
+		return 0, err
+	}
+	return float64(millis) / 1000, nil
+}
+
+// parseW1Slave parses the content of a w1_slave file and returns the
+// temperature it reports in millidegrees Celsius and the scratchpad
+// bytes it was decoded from
+func parseW1Slave(r io.Reader) (int64, []byte, error) {
+	bp := readBufs.Get().(*[]byte)
+	defer readBufs.Put(bp)
+	content, err := readInto(r, bp)
+	if err != nil {
+		return 0, nil, ErrNoData
+	}
+	return parseW1SlaveBytes(content)
+}
+
+// parseW1SlaveBytes is parseW1Slave over the content of the file. The
+// returned scratchpad is the only allocation.
+//
+// The w1_therm driver writes two lines, the scratchpad followed by the
+// result of its CRC check, then the scratchpad again and the temperature
+// in millidegrees:
+//
+//	72 01 4b 46 7f ff 0e 10 57 : crc=57 YES
+//	72 01 4b 46 7f ff 0e 10 57 t=23125
+//
+// A first line without a CRC check is accepted, as older drivers do not
+// always report it.
+func parseW1SlaveBytes(content []byte) (int64, []byte, error) {
+	line, rest, _ := bytes.Cut(content, []byte("\n"))
+	if len(line) == 0 {
+		return 0, nil, ErrNoData
+	}
+	if crcFailed(line) {
+		return 0, nil, ErrCRCMismatch
+	}
+	scratchpad := parseScratchpad(line)
+
+	sample, _, _ := bytes.Cut(rest, []byte("\n"))
+	i := bytes.LastIndex(sample, []byte("t="))
+	if i <= 0 || !isSpace(sample[i-1]) {
+		return 0, nil, ErrNoData
+	}
+	v, ok := parseInt(sample[i+2:])
+	if !ok {
+		return 0, nil, fmt.Errorf("Error decoding temperature %q: %w", sample[i+2:], ErrNoData)
+	}
+	return v, scratchpad, nil
+}
+
+// crcFailed tells whether the first line of a w1_slave file reports a
+// failed CRC check, its "crc=<hex> NO" field
+func crcFailed(line []byte) bool {
+	i := bytes.Index(line, []byte("crc="))
+	if i < 0 {
+		return false
+	}
+	field := line[i+len("crc="):]
+	j := 0
+	for j < len(field) {
+		if _, ok := unhex(field[j]); !ok {
+			break
+		}
+		j++
+	}
+	if j == 0 || j == len(field) || !isSpace(field[j]) {
+		return false
+	}
+	return bytes.HasPrefix(bytes.TrimLeft(field[j:], " \t"), []byte("NO"))
+}
+
+// parseScratchpad decodes the hex bytes preceding the colon of the
+// first line of a w1_slave file, returning nil if they are malformed
+func parseScratchpad(line []byte) []byte {
+	hexBytes, _, ok := bytes.Cut(line, []byte(":"))
+	if !ok {
+		return nil
+	}
+	scratchpad := make([]byte, 0, 9)
+	for len(hexBytes) > 0 {
+		hexBytes = bytes.TrimLeft(hexBytes, " ")
+		if len(hexBytes) == 0 {
+			break
+		}
+		if len(hexBytes) < 2 || (len(hexBytes) > 2 && hexBytes[2] != ' ') {
+			return nil
+		}
+		hi, ok1 := unhex(hexBytes[0])
+		lo, ok2 := unhex(hexBytes[1])
+		if !ok1 || !ok2 {
+			return nil
+		}
+		scratchpad = append(scratchpad, hi<<4|lo)
+		hexBytes = hexBytes[2:]
+	}
+	return scratchpad
+}
+
+// unhex returns the value of the hex digit c
+func unhex(c byte) (byte, bool) {
+	switch {
+	case '0' <= c && c <= '9':
+		return c - '0', true
+	case 'a' <= c && c <= 'f':
+		return c - 'a' + 10, true
+	case 'A' <= c && c <= 'F':
+		return c - 'A' + 10, true
+	}
+	return 0, false
+}
+
+// findDevices scans through the w1 device directory dir in order to
 // return a list of one wire devices
-func findDevices() ([]string, error) {
-	cmd := exec.Command("modprobe", "w1_gpio", "&&", "modprobe", "w1_therm")
-	if err := cmd.Run(); err != nil {
-		return nil, err
+func findDevices(dirname string) ([]string, error) {
+	dir, err := os.Open(dirname)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, noSysfs(dirname)
 	}
-	dir, err := os.Open("/sys/bus/w1/devices")
 	if err != nil {
 		return nil, err
 	}
@@ -115,60 +584,141 @@ func findDevices() ([]string, error) {
 		return nil, err
 	}
 
-	if len(names) <= 1 {
-		err := errors.New("files in /sys/bus/w1/devies: no devices found")
-		return nil, err
-	}
-	devicelist := make([]string, 0, len(names)-1)
-	for i := range names {
-
-		// We select all the files except w1_bus_master which is not
-		// an actual device
-		if !strings.Contains(names[i], "w1_bus_master") {
-			devicelist = append(devicelist, names[i])
+	// Only the devices are kept, leaving out the bus masters and any
+	// other entry
+	devicelist := make([]string, 0, len(names))
+	for _, name := range names {
+		if IsDeviceName(name) {
+			devicelist = append(devicelist, name)
 		}
 	}
+	if len(devicelist) == 0 {
+		return nil, fmt.Errorf("files in %v: no devices found", dirname)
+	}
 
 	return devicelist, nil
 }
 
-func newDS1820(name string) (*DS1820, error) {
+// newDS1820 identifies the device name from its sysfs name, which
+// encodes its family and serial number, falling back to its id
+// attribute for names that do not follow the w1 convention. Sysfs only
+// lists names following it, other backends may list any name.
+func newDS1820(b Backend, name string) (*DS1820, error) {
 	device := new(DS1820)
 	device.Name = name
 
-	if err := device.getID(); err != nil {
+	family, serial, err := parseName(name)
+	if err != nil {
+		ab, ok := b.(AttrBackend)
+		if !ok {
+			return nil, err
+		}
+		if err := device.getID(ab); err != nil {
+			return nil, err
+		}
+		return device, nil
+	}
+	if err := device.setFamily(family); err != nil {
 		return nil, err
 	}
-
+	device.ID = serial
 	return device, nil
 }
 
-func (d *DS1820) getID() error {
-	fn := fmt.Sprintf("/sys/bus/w1/devices/%v/id", d.Name)
-	idFile, err := os.OpenFile(fn, os.O_RDONLY, 0666)
+// getID identifies the device from its id attribute
+func (d *DS1820) getID(b AttrBackend) error {
+	family, serial, err := readID(b, d.Name)
 	if err != nil {
 		return err
 	}
-	defer idFile.Close()
+	if err := d.setFamily(family); err != nil {
+		return err
+	}
+	d.ID = serial
+	return nil
+}
 
-	var idFileContent uint64
-	err = binary.Read(idFile, binary.LittleEndian, &idFileContent)
+// readID reads the id attribute of the device name, the 8 bytes of its
+// ROM code: the family code, the serial number least significant byte
+// first, and the CRC
+func readID(b AttrBackend, name string) (uint8, uint64, error) {
+	raw, err := b.ReadAttr(name, "id")
 	if err != nil {
-		return fmt.Errorf("Error decoding %v device id: %v", fn, err)
+		return 0, 0, err
+	}
+	if len(raw) < 8 {
+		return 0, 0, fmt.Errorf("Error decoding %v device id: %w", name, io.ErrUnexpectedEOF)
 	}
 
-	devicetype := uint8(idFileContent & 0xff)
+	var serial uint64
+	for i := 6; i >= 1; i-- {
+		serial = serial<<8 | uint64(raw[i])
+	}
+	return raw[0], serial, nil
+}
 
-	switch devicetype {
-	case modelDS18B20:
-		d.DeviceType = "DS18B20"
-	case modelDS18S20:
-		d.DeviceType = "DS18S20"
-	default:
-		return fmt.Errorf("Error decoding %v device id: Unrecognized one wire family code 0x%x", fn, devicetype)
+// setFamily sets the device type from its one wire family code, one of
+// the thermometers of the w1_therm driver
+func (d *DS1820) setFamily(devicetype uint8) error {
+	if !thermFamilies[devicetype] {
+		return fmt.Errorf("Error decoding %v device id: Unrecognized one wire family code 0x%x", d.Name, devicetype)
 	}
+	d.DeviceType = knownFamilies[devicetype]
+	return nil
+}
 
-	d.ID = (idFileContent & 0x00ffffffffffff00) >> 8
+// isThermometer tells whether the device named name may be a
+// thermometer: its family is that of a thermometer, or its name does not
+// follow the w1 convention and its id attribute tells
+func isThermometer(name string) bool {
+	family, _, err := parseName(name)
+	return err != nil || thermFamilies[family]
+}
 
-	return nil
+// parseName splits a device name such as 28-0316a2794bff into its
+// family code and serial number, both in lowercase hex
+func parseName(name string) (uint8, uint64, error) {
+	if len(name) != 15 || name[2] != '-' {
+		return 0, 0, fmt.Errorf("Error decoding device name %q: expected ff-ssssssssssss", name)
+	}
+	var family uint8
+	var serial uint64
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if i == 2 {
+			continue
+		}
+		// The w1 driver names devices in lowercase hex only
+		v, ok := unhex(c)
+		if !ok || 'A' <= c && c <= 'F' {
+			return 0, 0, fmt.Errorf("Error decoding device name %q: %w", name, strconv.ErrSyntax)
+		}
+		if i < 2 {
+			family = family<<4 | v
+		} else {
+			serial = serial<<4 | uint64(v)
+		}
+	}
+	return family, serial, nil
+}
+
+// conversionTime is the conversion time of a device at 12 bit
+// resolution, the worst case for self-heating
+const conversionTime = 750 * time.Millisecond
+
+// dutyCycle returns the fraction of the time since its previous read
+// the device spent converting, and records now as its last read
+func (d *DS1820) dutyCycle(now time.Time) float64 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	prev := d.lastConversion
+	d.lastConversion = now
+	if prev.IsZero() {
+		return 0
+	}
+	elapsed := now.Sub(prev)
+	if elapsed <= conversionTime {
+		return 1
+	}
+	return float64(conversionTime) / float64(elapsed)
 }
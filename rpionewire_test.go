@@ -0,0 +1,213 @@
+package rpionewire
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+var w1SlaveSamples = []struct {
+	name    string
+	content string
+}{
+	{"valid", "72 01 4b 46 7f ff 0e 10 57 : crc=57 YES\n72 01 4b 46 7f ff 0e 10 57 t=23125\n"},
+	{"crc-mismatch", "72 01 4b 46 7f ff 0e 10 57 : crc=57 NO\n72 01 4b 46 7f ff 0e 10 57 t=23125\n"},
+	{"negative", "5e ff 4b 46 7f ff 0c 10 2a : crc=2a YES\n5e ff 4b 46 7f ff 0c 10 2a t=-10125\n"},
+}
+
+var (
+	crcCheckRegex   = regexp.MustCompile(`crc=\w+\s(YES|NO)`)
+	testSampleRegex = regexp.MustCompile(`.*\st=(\d+)`)
+)
+
+// regexpParseW1Slave is the parser parseW1SlaveBytes replaced, kept as
+// the baseline of the benchmark. It fails on negative temperatures.
+func regexpParseW1Slave(content []byte) (int64, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for i := 0; scanner.Scan(); i++ {
+		line := scanner.Text()
+		if i == 0 {
+			matches := crcCheckRegex.FindStringSubmatch(line)
+			if len(matches) > 0 && matches[1] != "YES" {
+				return 0, ErrCRCMismatch
+			}
+			hexBytes, _, _ := strings.Cut(line, ":")
+			for _, f := range strings.Fields(hexBytes) {
+				if _, err := strconv.ParseUint(f, 16, 8); err != nil {
+					break
+				}
+			}
+			continue
+		}
+		matches := testSampleRegex.FindStringSubmatch(line)
+		if len(matches) == 0 {
+			return 0, ErrNoData
+		}
+		return strconv.ParseInt(matches[1], 10, 64)
+	}
+	return 0, ErrNoData
+}
+
+func TestParseW1Slave(t *testing.T) {
+	scratchpad := []byte{0x72, 0x01, 0x4b, 0x46, 0x7f, 0xff, 0x0e, 0x10, 0x57}
+	tests := []struct {
+		name       string
+		content    string
+		millis     int64
+		scratchpad []byte
+		err        error
+	}{
+		{"valid", w1SlaveSamples[0].content, 23125, scratchpad, nil},
+		{"negative", w1SlaveSamples[2].content, -10125, []byte{0x5e, 0xff, 0x4b, 0x46, 0x7f, 0xff, 0x0c, 0x10, 0x2a}, nil},
+		{"crc mismatch", w1SlaveSamples[1].content, 0, nil, ErrCRCMismatch},
+		{"no crc", "72 01 4b 46 7f ff 0e 10 57 :\n72 01 4b 46 7f ff 0e 10 57 t=23125\n", 23125, scratchpad, nil},
+		{"malformed scratchpad", "72 0g 4b : crc=57 YES\n72 0g 4b t=23125\n", 23125, nil, nil},
+		{"no temperature", "72 01 4b 46 7f ff 0e 10 57 : crc=57 YES\n72 01 4b 46 7f ff 0e 10 57\n", 0, nil, ErrNoData},
+		{"empty temperature", "72 01 4b 46 7f ff 0e 10 57 : crc=57 YES\n72 01 4b 46 7f ff 0e 10 57 t=\n", 0, nil, ErrNoData},
+		{"invalid temperature", "72 01 4b 46 7f ff 0e 10 57 : crc=57 YES\n72 01 4b 46 7f ff 0e 10 57 t=2x\n", 0, nil, ErrNoData},
+		{"single line", "72 01 4b 46 7f ff 0e 10 57 : crc=57 YES", 0, nil, ErrNoData},
+		{"truncated", "72 01 4b 46 7f ff 0e 10 57 : crc=57 YES\n72 01 4b", 0, nil, ErrNoData},
+		{"empty", "", 0, nil, ErrNoData},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			millis, sp, err := parseW1SlaveBytes([]byte(tt.content))
+			if !errors.Is(err, tt.err) || millis != tt.millis || !bytes.Equal(sp, tt.scratchpad) {
+				t.Errorf("parseW1SlaveBytes = %v, % x, %v, want %v, % x, %v", millis, sp, err, tt.millis, tt.scratchpad, tt.err)
+			}
+		})
+	}
+}
+
+func TestParseName(t *testing.T) {
+	tests := []struct {
+		name        string
+		family      uint8
+		serial      uint64
+		ok          bool
+		device      bool
+		thermometer bool
+	}{
+		{"28-0316a2794bff", 0x28, 0x0316a2794bff, true, true, true},
+		{"10-000000000001", 0x10, 1, true, true, true},
+		{"26-000000000002", 0x26, 2, true, true, false}, // DS2438
+		{"00-000000000003", 0x00, 3, true, false, false},
+		{"ff-000000000004", 0xff, 4, true, false, false},
+		{"w1_bus_master1", 0, 0, false, false, true},
+		{"28-0316A2794BFF", 0, 0, false, false, true},
+		{"28-0316a2794bf", 0, 0, false, false, true},
+		{"28-0316a2794bff0", 0, 0, false, false, true},
+		{"28_0316a2794bff", 0, 0, false, false, true},
+		{"280316a2794bff", 0, 0, false, false, true},
+		{"2g-0316a2794bff", 0, 0, false, false, true},
+	}
+	for _, tt := range tests {
+		family, serial, err := parseName(tt.name)
+		if family != tt.family || serial != tt.serial || (err == nil) != tt.ok {
+			t.Errorf("parseName(%q) = %x, %x, %v, want %x, %x, ok %v", tt.name, family, serial, err, tt.family, tt.serial, tt.ok)
+		}
+		if got := IsDeviceName(tt.name); got != tt.device {
+			t.Errorf("IsDeviceName(%q) = %v, want %v", tt.name, got, tt.device)
+		}
+		// Names not following the w1 convention may be thermometers,
+		// identified by their id attribute
+		if got := isThermometer(tt.name); got != tt.thermometer {
+			t.Errorf("isThermometer(%q) = %v, want %v", tt.name, got, tt.thermometer)
+		}
+	}
+}
+
+func BenchmarkParseW1Slave(b *testing.B) {
+	for _, s := range w1SlaveSamples {
+		content := []byte(s.content)
+		b.Run("regexp/"+s.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				regexpParseW1Slave(content)
+			}
+		})
+		b.Run("parser/"+s.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				parseW1SlaveBytes(content)
+			}
+		})
+	}
+}
+
+func TestReadDevicesLastTemp(t *testing.T) {
+	backend := &fakeBackend{names: []string{"28-000000000001", "28-000000000002"}, temp: 21.5}
+	devices, err := NewBus(WithBackend(backend)).LoadDevices()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ReadDevices(devices); err != nil {
+		t.Fatal(err)
+	}
+	for _, d := range devices {
+		if d.LastTemp != 21.5 {
+			t.Errorf("%v: LastTemp %v, want 21.5", d.Name, d.LastTemp)
+		}
+	}
+
+	backend.set(0, ErrNoData)
+	readings, err := ReadEach(devices)
+	if err == nil || len(readings) != 2 || readings[0].Err == nil {
+		t.Fatalf("ReadEach = %v, %v, want the failures", readings, err)
+	}
+	if devices[0].LastTemp != 21.5 {
+		t.Errorf("a failed read changed LastTemp to %v", devices[0].LastTemp)
+	}
+}
+
+// aliasBackend lists its devices under names not following the w1
+// convention, identifying them by their id attribute only
+type aliasBackend struct {
+	ids map[string][]byte
+}
+
+func (b *aliasBackend) Devices() ([]string, error) {
+	var names []string
+	for name := range b.ids {
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+func (b *aliasBackend) ReadTemperature(name string) (float64, error) {
+	return 21, nil
+}
+
+func (b *aliasBackend) ReadAttr(name, attr string) ([]byte, error) {
+	if id, ok := b.ids[name]; ok && attr == "id" {
+		return id, nil
+	}
+	return nil, errors.New("no such attribute")
+}
+
+func (b *aliasBackend) WriteAttr(name, attr string, value []byte) error {
+	return errors.New("read only")
+}
+
+func TestLoadDevicesByID(t *testing.T) {
+	backend := &aliasBackend{ids: map[string][]byte{
+		"boiler": {0x28, 0xff, 0x4b, 0x79, 0xa2, 0x16, 0x03, 0x57},
+		"gauge":  {0x26, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x2a}, // DS2438
+	}}
+	devices, err := NewBus(WithBackend(backend)).LoadDevices()
+	var de *DeviceError
+	if !errors.As(err, &de) || de.Name != "gauge" {
+		t.Errorf("LoadDevices = %v, want the gauge not a thermometer", err)
+	}
+	if len(devices) != 1 {
+		t.Fatalf("got %v devices, want the boiler", len(devices))
+	}
+	if d := devices[0]; d.Name != "boiler" || d.ID != 0x0316a2794bff || d.DeviceType != "DS18B20" {
+		t.Errorf("got %v %x, a %v, want boiler 0316a2794bff, a DS18B20", d.Name, d.ID, d.DeviceType)
+	}
+}
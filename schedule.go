@@ -0,0 +1,189 @@
+package rpionewire
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule decides when the cycles of a Poller run
+type Schedule interface {
+	// Next returns the first time after t the schedule fires, or the
+	// zero time if it never fires again
+	Next(t time.Time) time.Time
+}
+
+// Every returns a Schedule firing every d
+func Every(d time.Duration) Schedule {
+	return every(d)
+}
+
+type every time.Duration
+
+func (e every) Next(t time.Time) time.Time {
+	return t.Add(time.Duration(e))
+}
+
+// ParseSchedule parses a schedule, which is either an interval such as
+// "30s" or "@every 30s", or a cron expression with the five standard
+// fields: minute, hour, day of month, month and day of week. Several
+// schedules separated by ";" fire whenever any of them does, so
+// "* 7-22 * * *; */15 23,0-6 * * *" fires every minute during the day
+// and every 15 minutes overnight.
+// Cron expressions are evaluated in the local time zone.
+func ParseSchedule(s string) (Schedule, error) {
+	parts := strings.Split(s, ";")
+	var u union
+	for _, part := range parts {
+		part = strings.TrimSpace(part)
+		sched, err := parseOne(part)
+		if err != nil {
+			return nil, fmt.Errorf("Error parsing schedule %q: %w", part, err)
+		}
+		u = append(u, sched)
+	}
+	if len(u) == 1 {
+		return u[0], nil
+	}
+	return u, nil
+}
+
+func parseOne(s string) (Schedule, error) {
+	if d, ok := strings.CutPrefix(s, "@every "); ok {
+		s = strings.TrimSpace(d)
+	}
+	if d, err := time.ParseDuration(s); err == nil {
+		if d <= 0 {
+			return nil, fmt.Errorf("interval must be positive")
+		}
+		return Every(d), nil
+	}
+	return parseCron(s)
+}
+
+// union fires whenever any of its schedules does
+type union []Schedule
+
+func (u union) Next(t time.Time) time.Time {
+	var next time.Time
+	for _, s := range u {
+		n := s.Next(t)
+		if !n.IsZero() && (next.IsZero() || n.Before(next)) {
+			next = n
+		}
+	}
+	return next
+}
+
+// cron is a parsed cron expression, each field being a bit set of the
+// values it matches
+type cron struct {
+	minute, hour, dom, month, dow uint64
+	// domAll and dowAll are set when the day fields start with "*",
+	// such as * or */2: a day then matches if both fields do rather
+	// than either of them, as in cron
+	domAll, dowAll bool
+}
+
+func parseCron(s string) (*cron, error) {
+	fields := strings.Fields(s)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("expected an interval or 5 cron fields, got %d fields", len(fields))
+	}
+	var c cron
+	var err error
+	if c.minute, err = parseField(fields[0], 0, 59); err != nil {
+		return nil, fmt.Errorf("minute: %w", err)
+	}
+	if c.hour, err = parseField(fields[1], 0, 23); err != nil {
+		return nil, fmt.Errorf("hour: %w", err)
+	}
+	if c.dom, err = parseField(fields[2], 1, 31); err != nil {
+		return nil, fmt.Errorf("day of month: %w", err)
+	}
+	if c.month, err = parseField(fields[3], 1, 12); err != nil {
+		return nil, fmt.Errorf("month: %w", err)
+	}
+	if c.dow, err = parseField(fields[4], 0, 7); err != nil {
+		return nil, fmt.Errorf("day of week: %w", err)
+	}
+	// Sunday is both 0 and 7
+	if c.dow&(1<<7) != 0 {
+		c.dow |= 1
+	}
+	c.domAll = strings.HasPrefix(fields[2], "*")
+	c.dowAll = strings.HasPrefix(fields[4], "*")
+	return &c, nil
+}
+
+// parseField parses a comma separated list of values, ranges such as
+// 1-5 and steps such as */15 or 0-30/10, between min and max. A step
+// after a single value, such as 5/15, runs up to max as in cron.
+func parseField(s string, min, max int) (uint64, error) {
+	var bits uint64
+	for _, item := range strings.Split(s, ",") {
+		rng, step := item, 1
+		if i := strings.IndexByte(item, '/'); i >= 0 {
+			n, err := strconv.Atoi(item[i+1:])
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("invalid step in %q", item)
+			}
+			rng, step = item[:i], n
+		}
+
+		lo, hi := min, max
+		if rng != "*" {
+			from, to, isRange := strings.Cut(rng, "-")
+			var err error
+			if lo, err = strconv.Atoi(from); err != nil {
+				return 0, fmt.Errorf("invalid value %q", item)
+			}
+			switch {
+			case isRange:
+				if hi, err = strconv.Atoi(to); err != nil {
+					return 0, fmt.Errorf("invalid value %q", item)
+				}
+			case rng == item:
+				hi = lo
+			}
+			if lo < min || hi > max || lo > hi {
+				return 0, fmt.Errorf("%q out of range %d-%d", item, min, max)
+			}
+		}
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+func (c *cron) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		y, m, d := t.Date()
+		switch {
+		case c.month&(1<<uint(m)) == 0:
+			t = time.Date(y, m+1, 1, 0, 0, 0, 0, t.Location())
+		case !c.dayMatches(t):
+			t = time.Date(y, m, d+1, 0, 0, 0, 0, t.Location())
+		case c.hour&(1<<uint(t.Hour())) == 0:
+			t = time.Date(y, m, d, t.Hour()+1, 0, 0, 0, t.Location())
+		case c.minute&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+func (c *cron) dayMatches(t time.Time) bool {
+	dom := c.dom&(1<<uint(t.Day())) != 0
+	dow := c.dow&(1<<uint(t.Weekday())) != 0
+	if c.domAll || c.dowAll {
+		return dom && dow
+	}
+	return dom || dow
+}
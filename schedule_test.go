@@ -0,0 +1,93 @@
+package rpionewire
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseSchedule(t *testing.T) {
+	tests := []struct {
+		schedule string
+		valid    bool
+	}{
+		{"30s", true},
+		{"@every 1m", true},
+		{"*/15 * * * *", true},
+		{"5/15 * * * *", true},
+		{"60/15 * * * *", false},
+		{"0 12 13 * 5", true},
+		{"0-30/10 8-18 * 1,6-8 1-5", true},
+		{"* 7-22 * * *; */15 23,0-6 * * *", true},
+		{"0s", false},
+		{"@every -1m", false},
+		{"* * *", false},
+		{"60 * * * *", false},
+		{"* 24 * * *", false},
+		{"* * 0 * *", false},
+		{"* * * 13 *", false},
+		{"* * * * 8", false},
+		{"*/0 * * * *", false},
+		{"5-1 * * * *", false},
+		{"a * * * *", false},
+		{"* 7-22 * * *; often", false},
+	}
+	for _, tt := range tests {
+		_, err := ParseSchedule(tt.schedule)
+		if tt.valid && err != nil {
+			t.Errorf("ParseSchedule(%q): %v", tt.schedule, err)
+		}
+		if !tt.valid && err == nil {
+			t.Errorf("ParseSchedule(%q) accepted an invalid schedule", tt.schedule)
+		}
+	}
+}
+
+func TestScheduleNext(t *testing.T) {
+	at := func(month time.Month, day, hour, min, sec int) time.Time {
+		return time.Date(2024, month, day, hour, min, sec, 0, time.UTC)
+	}
+	dayNight := "* 7-22 * * *; */15 23,0-6 * * *"
+	tests := []struct {
+		name     string
+		schedule string
+		from     time.Time
+		want     time.Time
+	}{
+		{"interval", "30s", at(1, 1, 12, 0, 10), at(1, 1, 12, 0, 40)},
+		{"within a minute", "* * * * *", at(1, 1, 12, 0, 30), at(1, 1, 12, 1, 0)},
+		{"day", dayNight, at(1, 1, 12, 0, 0), at(1, 1, 12, 1, 0)},
+		{"day to night", dayNight, at(1, 1, 22, 59, 0), at(1, 1, 23, 0, 0)},
+		{"night", dayNight, at(1, 1, 23, 0, 0), at(1, 1, 23, 15, 0)},
+		{"past midnight", dayNight, at(1, 1, 23, 45, 0), at(1, 2, 0, 0, 0)},
+		{"night to day", dayNight, at(1, 2, 6, 45, 0), at(1, 2, 7, 0, 0)},
+		{"day of week", "0 0 * * 0", at(1, 1, 0, 0, 0), at(1, 7, 0, 0, 0)},
+		{"sunday as 7", "0 0 * * 7", at(1, 1, 0, 0, 0), at(1, 7, 0, 0, 0)},
+		{"day of month", "0 0 13 * *", at(1, 1, 0, 0, 0), at(1, 13, 0, 0, 0)},
+		// Restricting both day fields matches either of them: the 13th,
+		// a Saturday, or any Friday
+		{"friday before the 13th", "0 12 13 * 5", at(1, 1, 0, 0, 0), at(1, 5, 12, 0, 0)},
+		{"the 13th after a friday", "0 12 13 * 5", at(1, 12, 12, 0, 0), at(1, 13, 12, 0, 0)},
+		{"next month", "30 6 1 * *", at(1, 31, 7, 0, 0), at(2, 1, 6, 30, 0)},
+		{"leap day", "0 0 29 2 *", at(1, 1, 0, 0, 0), at(2, 29, 0, 0, 0)},
+		{"never", "0 0 30 2 *", at(1, 1, 0, 0, 0), time.Time{}},
+		// A step after a single value runs to the end of the range
+		{"step from a value", "5/15 * * * *", at(1, 1, 12, 6, 0), at(1, 1, 12, 20, 0)},
+		{"step from a value to the hour", "5/15 * * * *", at(1, 1, 12, 50, 0), at(1, 1, 13, 5, 0)},
+		// A stepped * day field still counts as unrestricted, so both
+		// day fields must match: odd days that are Mondays, and the 13th
+		// on a Sunday, Tuesday, Thursday or Saturday
+		{"stepped day of month", "0 0 */2 * 1", at(1, 1, 0, 0, 0), at(1, 15, 0, 0, 0)},
+		{"stepped day of week", "0 0 13 * */2", at(1, 14, 0, 0, 0), at(2, 13, 0, 0, 0)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := ParseSchedule(tt.schedule)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := s.Next(tt.from); !got.Equal(tt.want) {
+				t.Errorf("Next(%v) = %v, want %v", tt.from, got, tt.want)
+			}
+		})
+	}
+}
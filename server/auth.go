@@ -0,0 +1,82 @@
+package server
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// Auth protects HTTP handlers with bearer tokens and, optionally, basic
+// authentication, requests presenting neither being answered 401
+type Auth struct {
+	// Tokens are the bearer tokens accepted
+	Tokens []string
+	// Users are the passwords of the users accepted with basic
+	// authentication, by name
+	Users map[string]string
+	// Realm is the realm of the basic authentication challenge,
+	// "rpionewire" if empty
+	Realm string
+	// Public are the paths served without credentials, such as the
+	// health endpoints probed by orchestrators
+	Public []string
+}
+
+// Enabled tells whether a has tokens or users, an Auth with neither
+// letting every request through
+func (a *Auth) Enabled() bool {
+	return a != nil && (len(a.Tokens) > 0 || len(a.Users) > 0)
+}
+
+// Handler returns h protected by a, h itself if a is not enabled
+func (a *Auth) Handler(h http.Handler) http.Handler {
+	if !a.Enabled() {
+		return h
+	}
+	public := map[string]bool{}
+	for _, p := range a.Public {
+		public[p] = true
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if public[r.URL.Path] || a.authorized(r) {
+			h.ServeHTTP(w, r)
+			return
+		}
+		if len(a.Users) > 0 {
+			realm := a.Realm
+			if realm == "" {
+				realm = "rpionewire"
+			}
+			w.Header().Set("WWW-Authenticate", `Basic realm="`+realm+`", charset="UTF-8"`)
+		} else {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+		}
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+	})
+}
+
+// authorized checks the credentials of r in constant time
+func (a *Auth) authorized(r *http.Request) bool {
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		for _, t := range a.Tokens {
+			if t != "" && equal(token, t) {
+				return true
+			}
+		}
+		return false
+	}
+	if user, password, ok := r.BasicAuth(); ok {
+		want, known := a.Users[user]
+		// Compare anyway so that unknown users take as long
+		return equal(password, want) && known
+	}
+	return false
+}
+
+// equal compares a and b in a time independent of their content and
+// length
+func equal(a, b string) bool {
+	ha, hb := sha256.Sum256([]byte(a)), sha256.Sum256([]byte(b))
+	return subtle.ConstantTimeCompare(ha[:], hb[:]) == 1
+}
@@ -0,0 +1,159 @@
+// Package client is a Go client of the HTTP API of rpionewire servers,
+// as specified by their /openapi.json:
+//
+//	c := &client.Client{URL: "http://pi:9100"}
+//	readings, err := c.Readings(ctx)
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/fredcarle/rpionewire/history"
+	"github.com/fredcarle/rpionewire/server"
+)
+
+// ErrNotFound is returned when the device, group or history requested
+// does not exist
+var ErrNotFound = errors.New("not found")
+
+// ErrUnauthorized is returned when the server rejects the credentials
+// of the client
+var ErrUnauthorized = errors.New("unauthorized")
+
+// ErrUnavailable is returned by Health and Ready when the server is not
+// healthy or ready, along with the failed checks
+var ErrUnavailable = errors.New("unavailable")
+
+// Client queries a rpionewire server
+type Client struct {
+	// URL is the base URL of the server, such as http://pi:9100
+	URL string
+	// Client sends the requests, a client with a 10 second timeout if nil
+	Client *http.Client
+	// Token, if set, is the bearer token presented to the server
+	Token string
+	// Username and Password, if set, authenticate to the server with
+	// basic authentication instead
+	Username string
+	Password string
+}
+
+// HistoryQuery selects the history returned by Client.History, the zero
+// value selecting the last 24 hours at the finest resolution kept
+type HistoryQuery struct {
+	From       time.Time
+	To         time.Time
+	Resolution time.Duration
+}
+
+// Readings returns the latest reading of every device
+func (c *Client) Readings(ctx context.Context) ([]server.Reading, error) {
+	var readings []server.Reading
+	return readings, c.get(ctx, "/readings", nil, &readings)
+}
+
+// Reading returns the latest reading of the device name, by sysfs name
+// or alias
+func (c *Client) Reading(ctx context.Context, name string) (server.Reading, error) {
+	var reading server.Reading
+	return reading, c.get(ctx, "/readings/"+url.PathEscape(name), nil, &reading)
+}
+
+// Groups returns the names of the groups of the devices, sorted
+func (c *Client) Groups(ctx context.Context) ([]string, error) {
+	var groups []string
+	return groups, c.get(ctx, "/groups", nil, &groups)
+}
+
+// Group returns the latest readings of the devices of the group name
+func (c *Client) Group(ctx context.Context, name string) ([]server.Reading, error) {
+	var readings []server.Reading
+	return readings, c.get(ctx, "/groups/"+url.PathEscape(name), nil, &readings)
+}
+
+// Masters returns the statistics of the bus masters
+func (c *Client) Masters(ctx context.Context) ([]server.MasterStats, error) {
+	var masters []server.MasterStats
+	return masters, c.get(ctx, "/masters", nil, &masters)
+}
+
+// History returns the history of the device name, by sysfs name or
+// alias, oldest first
+func (c *Client) History(ctx context.Context, name string, q HistoryQuery) ([]history.Bucket, error) {
+	params := url.Values{}
+	if !q.From.IsZero() {
+		params.Set("from", q.From.Format(time.RFC3339))
+	}
+	if !q.To.IsZero() {
+		params.Set("to", q.To.Format(time.RFC3339))
+	}
+	if q.Resolution > 0 {
+		params.Set("resolution", q.Resolution.String())
+	}
+	var buckets []history.Bucket
+	return buckets, c.get(ctx, "/history/"+url.PathEscape(name), params, &buckets)
+}
+
+// Health returns the health of the server, err wrapping ErrUnavailable
+// when unhealthy
+func (c *Client) Health(ctx context.Context) (server.Health, error) {
+	var h server.Health
+	return h, c.get(ctx, "/healthz", nil, &h)
+}
+
+// Ready returns the readiness of the server, err wrapping
+// ErrUnavailable when not ready
+func (c *Client) Ready(ctx context.Context) (server.Health, error) {
+	var h server.Health
+	return h, c.get(ctx, "/readyz", nil, &h)
+}
+
+// get decodes the JSON answered to a GET of path into v
+func (c *Client) get(ctx context.Context, path string, params url.Values, v interface{}) error {
+	u := strings.TrimSuffix(c.URL, "/") + path
+	if len(params) > 0 {
+		u += "?" + params.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	} else if c.Username != "" {
+		req.SetBasicAuth(c.Username, c.Password)
+	}
+
+	client := c.Client
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("Error querying %v: %w", path, err)
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return fmt.Errorf("Error querying %v: %w", path, ErrNotFound)
+	case resp.StatusCode == http.StatusUnauthorized:
+		return fmt.Errorf("Error querying %v: %w", path, ErrUnauthorized)
+	case resp.StatusCode == http.StatusServiceUnavailable && (path == "/healthz" || path == "/readyz"):
+		json.NewDecoder(resp.Body).Decode(v)
+		return fmt.Errorf("Error querying %v: %w", path, ErrUnavailable)
+	case resp.StatusCode != http.StatusOK:
+		return fmt.Errorf("Error querying %v: server answered %v", path, resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("Error decoding %v: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// CORS lets browser pages from other origins query the API of a
+// handler, such as dashboards hosted elsewhere
+type CORS struct {
+	// Origins are the origins allowed, such as https://dash.example.com,
+	// "*" allowing any
+	Origins []string
+	// MaxAge is how long browsers may cache the answer to a preflight
+	// request, 10 minutes if zero
+	MaxAge time.Duration
+}
+
+// Handler returns h answering the requests of the allowed origins with
+// CORS headers, h itself if c allows none. Preflight requests are
+// answered without reaching h, so before any authentication.
+func (c *CORS) Handler(h http.Handler) http.Handler {
+	if c == nil || len(c.Origins) == 0 {
+		return h
+	}
+	maxAge := c.MaxAge
+	if maxAge == 0 {
+		maxAge = 10 * time.Minute
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header := w.Header()
+		header.Add("Vary", "Origin")
+		origin := r.Header.Get("Origin")
+		allowed, wildcard := c.allowed(origin)
+		if !allowed {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		if wildcard {
+			header.Set("Access-Control-Allow-Origin", "*")
+		} else {
+			// Credentials are only allowed for an explicit origin
+			header.Set("Access-Control-Allow-Origin", origin)
+			header.Set("Access-Control-Allow-Credentials", "true")
+		}
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			header.Set("Access-Control-Allow-Methods", "GET, HEAD, OPTIONS")
+			header.Set("Access-Control-Allow-Headers", "Authorization, Content-Type")
+			header.Set("Access-Control-Max-Age", strconv.Itoa(int(maxAge.Seconds())))
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// allowed tells whether origin is allowed, and whether by the "*"
+// wildcard
+func (c *CORS) allowed(origin string) (allowed, wildcard bool) {
+	if origin == "" {
+		return false, false
+	}
+	for _, o := range c.Origins {
+		if o == origin {
+			return true, false
+		}
+	}
+	for _, o := range c.Origins {
+		if o == "*" {
+			return true, true
+		}
+	}
+	return false, false
+}
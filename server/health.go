@@ -0,0 +1,118 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// Health is the JSON form of the answers of /healthz and /readyz
+type Health struct {
+	Status string `json:"status"`
+	// Checks are the results of the checks, "ok" or the error, by name
+	Checks map[string]string `json:"checks"`
+}
+
+// AddCheck adds a check of the readiness of the server, failing
+// /readyz while check returns an error
+func (s *Server) AddCheck(name string, check func() error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.checks == nil {
+		s.checks = map[string]func() error{}
+	}
+	s.checks[name] = check
+}
+
+// SetStaleAfter makes the server unhealthy when its readings were not
+// replaced for d, the poller having stalled. Zero, the default, never
+// considers them stale.
+func (s *Server) SetStaleAfter(d time.Duration) {
+	s.mu.Lock()
+	s.staleAfter = d
+	s.mu.Unlock()
+}
+
+// progress checks that the poller makes progress
+func (s *Server) progress() error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.staleAfter == 0 {
+		return nil
+	}
+	// Before the first readings, the poller is given staleAfter from
+	// the creation of the server
+	since := s.updated
+	if since.IsZero() {
+		since = s.created
+	}
+	if age := time.Since(since); age > s.staleAfter {
+		return fmt.Errorf("no readings for %v", age.Round(time.Second))
+	}
+	return nil
+}
+
+// readable checks that at least one device was read successfully
+func (s *Server) readable() error {
+	readings := s.Readings()
+	if len(readings) == 0 {
+		return errors.New("no devices")
+	}
+	for _, r := range readings {
+		if r.Error == "" {
+			return nil
+		}
+	}
+	return fmt.Errorf("none of the %v devices readable", len(readings))
+}
+
+// handleHealthz answers whether the server is alive: whether its poller
+// makes progress
+func (s *Server) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	writeHealth(w, map[string]error{"poller": s.progress()})
+}
+
+// handleReadyz answers whether the server is ready to serve readings:
+// its poller makes progress, at least one device is readable and the
+// checks added pass
+func (s *Server) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	results := map[string]error{"poller": s.progress(), "devices": s.readable()}
+	s.mu.RLock()
+	checks := make(map[string]func() error, len(s.checks))
+	for name, check := range s.checks {
+		checks[name] = check
+	}
+	s.mu.RUnlock()
+	for name, check := range checks {
+		results[name] = check()
+	}
+	writeHealth(w, results)
+}
+
+// writeHealth answers the results of checks, with 503 if any failed
+func writeHealth(w http.ResponseWriter, results map[string]error) {
+	h := Health{Status: "ok", Checks: map[string]string{}}
+	names := make([]string, 0, len(results))
+	for name := range results {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := results[name]; err != nil {
+			h.Status = "unavailable"
+			h.Checks[name] = err.Error()
+		} else {
+			h.Checks[name] = "ok"
+		}
+	}
+	if h.Status != "ok" {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(h)
+		return
+	}
+	writeJSON(w, h)
+}
@@ -0,0 +1,521 @@
+// Package server serves the readings of rpionewire devices over HTTP,
+// as JSON and in the Prometheus text format.
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fredcarle/rpionewire"
+	"github.com/fredcarle/rpionewire/history"
+)
+
+// Reading is the JSON form of a rpionewire.Reading
+type Reading struct {
+	Name  string `json:"name"`
+	ID    string `json:"id"`
+	Alias string `json:"alias,omitempty"`
+	Host  string `json:"host,omitempty"`
+	// Groups are the groups of the device
+	Groups []string `json:"groups,omitempty"`
+	Seq    uint64   `json:"seq,omitempty"`
+	Temp   *float64 `json:"temp,omitempty"`
+	// Kind, Value and Unit replace Temp for the readings that are not
+	// temperatures, such as the power and energy of a heat meter
+	Kind  string   `json:"kind,omitempty"`
+	Value *float64 `json:"value,omitempty"`
+	Unit  string   `json:"unit,omitempty"`
+	Flags string   `json:"flags,omitempty"`
+	// CRCErrors and CRCRetries are the counters of the device health
+	CRCErrors  uint64    `json:"crc_errors"`
+	CRCRetries uint64    `json:"crc_retries"`
+	Error      string    `json:"error,omitempty"`
+	Time       time.Time `json:"time"`
+}
+
+// NewReading converts r, taken at t, to its JSON form
+func NewReading(r rpionewire.Reading, t time.Time) Reading {
+	info := Reading{Seq: r.Seq, Flags: r.Flags.String(), Time: t}
+	if r.Device != nil {
+		info.Name = r.Device.Name
+		info.ID = fmt.Sprintf("%012x", r.Device.ID)
+		info.Alias = r.Device.Alias
+		info.Host = r.Device.Host
+		info.Groups = r.Device.Groups
+		h := r.Device.Health()
+		info.CRCErrors, info.CRCRetries = h.CRCErrors, h.CRCRetries
+	}
+	if m := r.Measurement; m != nil {
+		info.Kind, info.Unit = m.Kind.String(), m.Unit
+	}
+	switch {
+	case r.Err != nil:
+		info.Error = r.Err.Error()
+	case r.Measurement != nil:
+		v := r.Measurement.Value
+		info.Value = &v
+	default:
+		v := float64(r.Value)
+		info.Temp = &v
+	}
+	return info
+}
+
+// WriteMetrics writes readings in the Prometheus text exposition format
+func WriteMetrics(w io.Writer, readings []Reading) error {
+	var sb strings.Builder
+	sb.WriteString("# HELP rpionewire_temperature_celsius Temperature read by the device.\n")
+	sb.WriteString("# TYPE rpionewire_temperature_celsius gauge\n")
+	for _, r := range readings {
+		if r.Temp != nil {
+			fmt.Fprintf(&sb, "rpionewire_temperature_celsius{%v} %v\n", labels(r), strconv.FormatFloat(*r.Temp, 'f', -1, 64))
+		}
+	}
+	sb.WriteString("# HELP rpionewire_heat_power_kilowatts Thermal power computed by the heat meter.\n")
+	sb.WriteString("# TYPE rpionewire_heat_power_kilowatts gauge\n")
+	for _, r := range readings {
+		if r.Value != nil && r.Kind == rpionewire.KindPower.String() {
+			fmt.Fprintf(&sb, "rpionewire_heat_power_kilowatts{%v} %v\n", labels(r), strconv.FormatFloat(*r.Value, 'f', -1, 64))
+		}
+	}
+	sb.WriteString("# HELP rpionewire_heat_energy_kwh_total Thermal energy accumulated by the heat meter.\n")
+	sb.WriteString("# TYPE rpionewire_heat_energy_kwh_total counter\n")
+	for _, r := range readings {
+		if r.Value != nil && r.Kind == rpionewire.KindEnergy.String() {
+			fmt.Fprintf(&sb, "rpionewire_heat_energy_kwh_total{%v} %v\n", labels(r), strconv.FormatFloat(*r.Value, 'f', -1, 64))
+		}
+	}
+	sb.WriteString("# HELP rpionewire_read_success Whether the last read of the device succeeded.\n")
+	sb.WriteString("# TYPE rpionewire_read_success gauge\n")
+	for _, r := range readings {
+		success := 1
+		if r.Error != "" {
+			success = 0
+		}
+		fmt.Fprintf(&sb, "rpionewire_read_success{%v} %d\n", labels(r), success)
+	}
+	sb.WriteString("# HELP rpionewire_crc_errors_total Conversions of the device rejected because of a CRC mismatch.\n")
+	sb.WriteString("# TYPE rpionewire_crc_errors_total counter\n")
+	for _, r := range readings {
+		fmt.Fprintf(&sb, "rpionewire_crc_errors_total{%v} %d\n", labels(r), r.CRCErrors)
+	}
+	sb.WriteString("# HELP rpionewire_crc_retries_total Conversions of the device retried after a CRC mismatch.\n")
+	sb.WriteString("# TYPE rpionewire_crc_retries_total counter\n")
+	for _, r := range readings {
+		fmt.Fprintf(&sb, "rpionewire_crc_retries_total{%v} %d\n", labels(r), r.CRCRetries)
+	}
+	sb.WriteString("# HELP rpionewire_device_group Membership of the device in a group, always 1.\n")
+	sb.WriteString("# TYPE rpionewire_device_group gauge\n")
+	for _, r := range readings {
+		for _, g := range r.Groups {
+			fmt.Fprintf(&sb, "rpionewire_device_group{%v,group=\"%v\"} 1\n", labels(r), labelValue(g))
+		}
+	}
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// MasterStats is the JSON form of the statistics of a rpionewire.Master
+type MasterStats struct {
+	Name       string  `json:"name"`
+	Driver     string  `json:"driver,omitempty"`
+	Searches   int64   `json:"searches"`
+	Devices    int     `json:"devices"`
+	Reads      uint64  `json:"reads"`
+	Failures   uint64  `json:"failures"`
+	AvgLatency float64 `json:"avg_latency_seconds"`
+	Error      string  `json:"error,omitempty"`
+}
+
+// NewMasterStats returns the statistics of m in their JSON form
+func NewMasterStats(m *rpionewire.Master) MasterStats {
+	stats, err := m.Stats()
+	info := MasterStats{
+		Name:       m.Name,
+		Driver:     stats.Driver,
+		Searches:   stats.Searches,
+		Devices:    stats.Devices,
+		Reads:      stats.Reads,
+		Failures:   stats.Failures,
+		AvgLatency: stats.AvgLatency.Seconds(),
+	}
+	if err != nil {
+		info.Error = err.Error()
+	}
+	return info
+}
+
+// WriteMasterMetrics writes the statistics of bus masters in the
+// Prometheus text exposition format
+func WriteMasterMetrics(w io.Writer, masters []MasterStats) error {
+	metrics := []struct {
+		name, typ, help string
+		value           func(MasterStats) string
+	}{
+		{"rpionewire_master_searches_total", "counter", "Searches performed by the bus master.", func(m MasterStats) string { return strconv.FormatInt(m.Searches, 10) }},
+		{"rpionewire_master_devices", "gauge", "Devices seen by the bus master.", func(m MasterStats) string { return strconv.Itoa(m.Devices) }},
+		{"rpionewire_master_reads_total", "counter", "Reads of the devices of the bus master.", func(m MasterStats) string { return strconv.FormatUint(m.Reads, 10) }},
+		{"rpionewire_master_read_failures_total", "counter", "Failed reads of the devices of the bus master.", func(m MasterStats) string { return strconv.FormatUint(m.Failures, 10) }},
+		{"rpionewire_master_read_latency_seconds", "gauge", "Average duration of the reads of the devices of the bus master.", func(m MasterStats) string { return strconv.FormatFloat(m.AvgLatency, 'f', -1, 64) }},
+	}
+
+	var sb strings.Builder
+	for _, metric := range metrics {
+		fmt.Fprintf(&sb, "# HELP %v %v\n# TYPE %v %v\n", metric.name, metric.help, metric.name, metric.typ)
+		for _, m := range masters {
+			if m.Error == "" {
+				fmt.Fprintf(&sb, "%v{master=\"%v\"} %v\n", metric.name, labelValue(m.Name), metric.value(m))
+			}
+		}
+	}
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// labels returns the Prometheus labels identifying the device of r
+func labels(r Reading) string {
+	l := fmt.Sprintf(`device="%v",id="%v"`, labelValue(r.Name), labelValue(r.ID))
+	if r.Alias != "" {
+		l += fmt.Sprintf(`,alias="%v"`, labelValue(r.Alias))
+	}
+	if r.Host != "" {
+		l += fmt.Sprintf(`,host="%v"`, labelValue(r.Host))
+	}
+	return l
+}
+
+// labelEscaper escapes label values as the Prometheus text format does
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// labelValue returns v escaped to go between the quotes of a label
+func labelValue(v string) string {
+	return labelEscaper.Replace(v)
+}
+
+// Server is an http.Handler serving the latest readings of a poller. It
+// is a rpionewire.Sink to add to the poller sinks. It serves:
+//
+//	GET /readings          the latest reading of every device, as JSON
+//	GET /readings/{name}   the latest reading of a device, by name or alias
+//	GET /groups            the names of the groups of the devices
+//	GET /groups/{name}     the latest readings of the devices of a group
+//	GET /masters           the statistics of the bus masters, as JSON
+//	GET /history/{name}    the history of a device, by name or alias, see
+//	                       handleHistory
+//	GET /healthz           whether the poller makes progress, 503 if not
+//	GET /readyz            whether the devices can be served, 503 if not
+//	GET /openapi.json      the OpenAPI specification of the above
+//	GET <metrics path>     the latest readings and master statistics as
+//	                       Prometheus metrics
+type Server struct {
+	mux *http.ServeMux
+
+	mu       sync.RWMutex
+	readings []Reading
+	masters  []*rpionewire.Master
+	history  *history.Store
+	// updated is when the readings were last replaced, checked against
+	// staleAfter by the health endpoints, as created is before the first
+	created    time.Time
+	updated    time.Time
+	staleAfter time.Duration
+	// expireAfter is how long the reading of a device no longer read is
+	// kept, forever if zero
+	expireAfter time.Duration
+	checks      map[string]func() error
+}
+
+// New returns a Server exposing the Prometheus metrics at metricsPath
+func New(metricsPath string) *Server {
+	s := &Server{mux: http.NewServeMux(), created: time.Now()}
+	s.mux.HandleFunc("/readings", s.handleReadings)
+	s.mux.HandleFunc("/readings/", s.handleReading)
+	s.mux.HandleFunc("/groups", s.handleGroups)
+	s.mux.HandleFunc("/groups/", s.handleGroup)
+	s.mux.HandleFunc("/masters", s.handleMasters)
+	s.mux.HandleFunc("/history/", s.handleHistory)
+	s.mux.HandleFunc("/openapi.json", s.handleOpenAPI)
+	s.mux.HandleFunc("/healthz", s.handleHealthz)
+	s.mux.HandleFunc("/readyz", s.handleReadyz)
+	if metricsPath != "" {
+		s.mux.HandleFunc(metricsPath, s.handleMetrics)
+	}
+	return s
+}
+
+// MergeReadings returns readings with the readings of update replacing
+// those of the same device, by host and name, and the readings of the
+// other devices appended. Neither slice is modified.
+func MergeReadings(readings, update []Reading) []Reading {
+	type key struct{ host, name string }
+	index := make(map[key]int, len(readings))
+	merged := append(make([]Reading, 0, len(readings)+len(update)), readings...)
+	for i, r := range merged {
+		index[key{r.Host, r.Name}] = i
+	}
+	for _, r := range update {
+		k := key{r.Host, r.Name}
+		if i, ok := index[k]; ok {
+			merged[i] = r
+			continue
+		}
+		index[k] = len(merged)
+		merged = append(merged, r)
+	}
+	return merged
+}
+
+// ExpireReadings returns the readings taken at or after since, dropping
+// those of the devices no longer read, such as unplugged sensors.
+// readings is not modified.
+func ExpireReadings(readings []Reading, since time.Time) []Reading {
+	kept := make([]Reading, 0, len(readings))
+	for _, r := range readings {
+		if !r.Time.Before(since) {
+			kept = append(kept, r)
+		}
+	}
+	return kept
+}
+
+// WriteReadings updates the readings served with those of a poll cycle.
+// The devices missing from the cycle, such as those a per-device
+// schedule did not make due, keep their previous reading until it
+// expires, see SetExpireAfter.
+func (s *Server) WriteReadings(rs []rpionewire.Reading) error {
+	now := time.Now()
+	readings := make([]Reading, len(rs))
+	for i, r := range rs {
+		readings[i] = NewReading(r, now)
+	}
+
+	s.mu.Lock()
+	s.readings = MergeReadings(s.readings, readings)
+	if s.expireAfter > 0 {
+		s.readings = ExpireReadings(s.readings, now.Add(-s.expireAfter))
+	}
+	s.updated = time.Now()
+	s.mu.Unlock()
+	return nil
+}
+
+// SetReadings replaces the readings served with readings already in
+// their JSON form, such as those received from remote agents
+func (s *Server) SetReadings(readings []Reading) {
+	s.mu.Lock()
+	s.readings = readings
+	s.updated = time.Now()
+	s.mu.Unlock()
+}
+
+// SetExpireAfter drops the reading of a device from those served once
+// the device was not read for d, as when it was unplugged. Zero, the
+// default, keeps the last reading of every device.
+func (s *Server) SetExpireAfter(d time.Duration) {
+	s.mu.Lock()
+	s.expireAfter = d
+	s.mu.Unlock()
+}
+
+// SetMasters sets the bus masters whose statistics are served
+func (s *Server) SetMasters(masters []*rpionewire.Master) {
+	s.mu.Lock()
+	s.masters = masters
+	s.mu.Unlock()
+}
+
+// SetHistory sets the store the history of the devices is served from
+func (s *Server) SetHistory(store *history.Store) {
+	s.mu.Lock()
+	s.history = store
+	s.mu.Unlock()
+}
+
+// masterStats returns the current statistics of the masters served
+func (s *Server) masterStats() []MasterStats {
+	s.mu.RLock()
+	masters := s.masters
+	s.mu.RUnlock()
+	stats := make([]MasterStats, len(masters))
+	for i, m := range masters {
+		stats[i] = NewMasterStats(m)
+	}
+	return stats
+}
+
+// Readings returns the readings served
+func (s *Server) Readings() []Reading {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.readings
+}
+
+// Handle registers an additional handler on the server
+func (s *Server) Handle(pattern string, h http.Handler) {
+	s.mux.Handle(pattern, h)
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+func (s *Server) handleReadings(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, s.Readings())
+}
+
+func (s *Server) handleReading(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	name := strings.TrimPrefix(r.URL.Path, "/readings/")
+	for _, reading := range s.Readings() {
+		if reading.Name == name || (reading.Alias != "" && reading.Alias == name) {
+			writeJSON(w, reading)
+			return
+		}
+	}
+	http.NotFound(w, r)
+}
+
+func (s *Server) handleGroups(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	seen := map[string]bool{}
+	groups := []string{}
+	for _, reading := range s.Readings() {
+		for _, g := range reading.Groups {
+			if !seen[g] {
+				seen[g] = true
+				groups = append(groups, g)
+			}
+		}
+	}
+	sort.Strings(groups)
+	writeJSON(w, groups)
+}
+
+func (s *Server) handleGroup(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	name := strings.TrimPrefix(r.URL.Path, "/groups/")
+	var members []Reading
+	for _, reading := range s.Readings() {
+		for _, g := range reading.Groups {
+			if g == name {
+				members = append(members, reading)
+				break
+			}
+		}
+	}
+	if members == nil {
+		http.NotFound(w, r)
+		return
+	}
+	writeJSON(w, members)
+}
+
+func (s *Server) handleMasters(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, s.masterStats())
+}
+
+// handleHistory serves the history of a device as a JSON array of
+// history.Bucket, oldest first, with the query parameters:
+//
+//	from        the start, RFC 3339 or a duration before now, 24h by default
+//	to          the end, RFC 3339 or a duration before now, now by default
+//	resolution  the width of the buckets, such as 5m, the finest kept by
+//	            default
+func (s *Server) handleHistory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	s.mu.RLock()
+	store := s.history
+	s.mu.RUnlock()
+	if store == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	now := time.Now()
+	q := r.URL.Query()
+	from, err := parseTime(q.Get("from"), now, now.Add(-24*time.Hour))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid from: %v", err), http.StatusBadRequest)
+		return
+	}
+	to, err := parseTime(q.Get("to"), now, now)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid to: %v", err), http.StatusBadRequest)
+		return
+	}
+	var resolution time.Duration
+	if v := q.Get("resolution"); v != "" {
+		if resolution, err = time.ParseDuration(v); err != nil || resolution < 0 {
+			http.Error(w, fmt.Sprintf("invalid resolution %q", v), http.StatusBadRequest)
+			return
+		}
+	}
+
+	name := strings.TrimPrefix(r.URL.Path, "/history/")
+	for _, reading := range s.Readings() {
+		if reading.Alias != "" && reading.Alias == name {
+			name = reading.Name
+			break
+		}
+	}
+	buckets := store.History(name, from, to, resolution)
+	if buckets == nil {
+		http.NotFound(w, r)
+		return
+	}
+	writeJSON(w, buckets)
+}
+
+// parseTime parses v, a time in RFC 3339 or a duration before now,
+// returning def if v is empty
+func parseTime(v string, now, def time.Time) (time.Time, error) {
+	if v == "" {
+		return def, nil
+	}
+	if d, err := time.ParseDuration(v); err == nil {
+		return now.Add(-d), nil
+	}
+	return time.Parse(time.RFC3339, v)
+}
+
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	WriteMetrics(w, s.Readings())
+	if masters := s.masterStats(); len(masters) > 0 {
+		WriteMasterMetrics(w, masters)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
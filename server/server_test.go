@@ -0,0 +1,96 @@
+package server
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fredcarle/rpionewire"
+)
+
+func TestServerMergesReadings(t *testing.T) {
+	boiler := &rpionewire.DS1820{Name: "28-000000000001"}
+	soil := &rpionewire.DS1820{Name: "28-000000000002"}
+	s := New("")
+	s.WriteReadings([]rpionewire.Reading{{Device: boiler, Value: 60}, {Device: soil, Value: 12}})
+	s.WriteReadings([]rpionewire.Reading{{Device: boiler, Value: 61}})
+
+	got := s.Readings()
+	if len(got) != 2 {
+		t.Fatalf("got %v readings, want both devices", len(got))
+	}
+	if got[0].Name != boiler.Name || *got[0].Temp != 61 {
+		t.Errorf("got %v at %v, want the latest boiler reading", got[0].Name, *got[0].Temp)
+	}
+	if got[1].Name != soil.Name || *got[1].Temp != 12 {
+		t.Errorf("got %v at %v, want the soil reading of the first cycle", got[1].Name, *got[1].Temp)
+	}
+}
+
+func TestMergeReadingsByHost(t *testing.T) {
+	readings := []Reading{{Host: "a", Name: "28-1"}, {Host: "b", Name: "28-1"}}
+	merged := MergeReadings(readings, []Reading{{Host: "b", Name: "28-1", Seq: 2}, {Host: "b", Name: "28-2"}})
+	if len(merged) != 3 || merged[0].Seq != 0 || merged[1].Seq != 2 || merged[2].Name != "28-2" {
+		t.Fatalf("got %+v", merged)
+	}
+	if readings[1].Seq != 0 {
+		t.Fatal("MergeReadings modified its input")
+	}
+}
+
+func TestServerExpiresReadings(t *testing.T) {
+	boiler := &rpionewire.DS1820{Name: "28-000000000001"}
+	s := New("")
+	s.SetExpireAfter(time.Hour)
+	// The soil sensor was unplugged two hours ago
+	s.SetReadings([]Reading{{Name: "28-000000000002", Time: time.Now().Add(-2 * time.Hour)}})
+	s.WriteReadings([]rpionewire.Reading{{Device: boiler, Value: 60}})
+
+	got := s.Readings()
+	if len(got) != 1 || got[0].Name != boiler.Name {
+		t.Fatalf("got %+v, want the boiler reading only", got)
+	}
+}
+
+func TestExpireReadings(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	readings := []Reading{{Name: "28-1", Time: now.Add(-time.Minute)}, {Name: "28-2", Time: now}, {Name: "28-3", Time: now.Add(-time.Second)}}
+	kept := ExpireReadings(readings, now.Add(-time.Second))
+	if len(kept) != 2 || kept[0].Name != "28-2" || kept[1].Name != "28-3" {
+		t.Fatalf("got %+v", kept)
+	}
+	if len(readings) != 3 || readings[0].Name != "28-1" {
+		t.Fatal("ExpireReadings modified its input")
+	}
+}
+
+func TestWriteMetricsHeatMeter(t *testing.T) {
+	power := &rpionewire.DS1820{Name: "loop:power", DeviceType: "power"}
+	energy := &rpionewire.DS1820{Name: "loop:energy", DeviceType: "energy"}
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	readings := []Reading{
+		NewReading(rpionewire.Reading{Device: power, Measurement: &rpionewire.Measurement{Kind: rpionewire.KindPower, Value: 4.5, Unit: "kW"}}, now),
+		NewReading(rpionewire.Reading{Device: energy, Measurement: &rpionewire.Measurement{Kind: rpionewire.KindEnergy, Value: 12, Unit: "kWh"}}, now),
+	}
+	if readings[0].Temp != nil || readings[0].Value == nil || *readings[0].Value != 4.5 || readings[0].Unit != "kW" {
+		t.Fatalf("got %+v, want the power in kW and no temperature", readings[0])
+	}
+
+	var sb strings.Builder
+	if err := WriteMetrics(&sb, readings); err != nil {
+		t.Fatal(err)
+	}
+	got := sb.String()
+	for _, want := range []string{
+		`rpionewire_heat_power_kilowatts{device="loop:power",id="000000000000"} 4.5`,
+		`rpionewire_heat_energy_kwh_total{device="loop:energy",id="000000000000"} 12`,
+		`rpionewire_read_success{device="loop:power",id="000000000000"} 1`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("metrics miss %v:\n%v", want, got)
+		}
+	}
+	if strings.Contains(got, "rpionewire_temperature_celsius{") {
+		t.Errorf("metrics export the heat meter as temperatures:\n%v", got)
+	}
+}
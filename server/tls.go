@@ -0,0 +1,80 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// TLS configures the TLS of a listener from PEM files
+type TLS struct {
+	// CertFile and KeyFile are the certificate and key of the server
+	CertFile string
+	KeyFile  string
+	// ClientCAFile, if set, holds the certificates of the CAs clients
+	// must present a certificate from, requiring mutual TLS
+	ClientCAFile string
+}
+
+// Config loads the certificates and returns the TLS configuration of
+// the listener
+func (t *TLS) Config() (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("Error loading the server certificate: %w", err)
+	}
+	c := &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+	if t.ClientCAFile != "" {
+		if c.ClientCAs, err = loadPool(t.ClientCAFile); err != nil {
+			return nil, err
+		}
+		c.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return c, nil
+}
+
+// ClientTLS configures the TLS of a client from PEM files
+type ClientTLS struct {
+	// CAFile, if set, holds the certificates of the CAs the server
+	// certificate must come from, instead of the system ones
+	CAFile string
+	// CertFile and KeyFile, if set, are the certificate and key
+	// presented to servers requiring mutual TLS
+	CertFile string
+	KeyFile  string
+}
+
+// Config loads the certificates and returns the TLS configuration of
+// the client
+func (t *ClientTLS) Config() (*tls.Config, error) {
+	c := &tls.Config{MinVersion: tls.VersionTLS12}
+	var err error
+	if t.CAFile != "" {
+		if c.RootCAs, err = loadPool(t.CAFile); err != nil {
+			return nil, err
+		}
+	}
+	if t.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("Error loading the client certificate: %w", err)
+		}
+		c.Certificates = []tls.Certificate{cert}
+	}
+	return c, nil
+}
+
+// loadPool returns a pool of the PEM certificates of the file at path
+func loadPool(path string) (*x509.CertPool, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("Error loading CA certificates: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(b) {
+		return nil, fmt.Errorf("Error loading CA certificates from %v: %w", path, errors.New("no PEM certificate found"))
+	}
+	return pool, nil
+}
@@ -0,0 +1,225 @@
+package sim
+
+import (
+	"fmt"
+	"io/fs"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/fredcarle/rpionewire"
+)
+
+// Faults is a rpionewire.Backend injecting the misbehaviors of real
+// buses into the reads of another backend, virtual or not, so that
+// applications can check how they cope with them:
+//
+//	faults := &sim.Faults{Backend: sim.NewBackend(50), CRCRate: 0.01, DropRate: 0.001, DropDuration: time.Minute}
+//	bus := rpionewire.NewBus(rpionewire.WithBackend(faults), rpionewire.WithCRCRetries(2))
+//
+// Random faults strike each read independently with their rate; tests
+// wanting a given fault at a given time use Drop and FailNext instead.
+// The sysfs attributes and raw reads of the wrapped backend are
+// forwarded, ErrUnsupported being returned for those it lacks.
+type Faults struct {
+	Backend rpionewire.Backend
+	// CRCRate is the probability of a read failing its CRC check
+	CRCRate float64
+	// SlowRate is the probability of a read taking SlowDelay longer
+	SlowRate  float64
+	SlowDelay time.Duration
+	// DropRate is the probability of a read finding its device gone
+	// from the bus, where it stays for DropDuration, missing from the
+	// discoveries and failing its reads as a disconnected device does
+	DropRate     float64
+	DropDuration time.Duration
+	// Seed seeds the random faults, the current time if zero
+	Seed int64
+	// Clock is the source of time of the delays and drops, the system
+	// clock if nil
+	Clock rpionewire.Clock
+
+	mu      sync.Mutex
+	rand    *rand.Rand
+	dropped map[string]time.Time
+	fails   map[string][]error
+}
+
+// Drop makes the device name disappear from the bus for d
+func (f *Faults) Drop(name string, d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.drop(name, d)
+}
+
+// FailNext makes the next n reads of the device name fail with err,
+// such as rpionewire.ErrCRCMismatch
+func (f *Faults) FailNext(name string, n int, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.fails == nil {
+		f.fails = map[string][]error{}
+	}
+	for i := 0; i < n; i++ {
+		f.fails[name] = append(f.fails[name], err)
+	}
+}
+
+// Devices returns the devices of the wrapped backend, leaving out
+// those dropped
+func (f *Faults) Devices() ([]string, error) {
+	names, err := f.Backend.Devices()
+	if err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	kept := names[:0:0]
+	for _, name := range names {
+		if !f.isDropped(name) {
+			kept = append(kept, name)
+		}
+	}
+	return kept, nil
+}
+
+// ReadTemperature reads the device name through the wrapped backend,
+// unless a fault strikes first
+func (f *Faults) ReadTemperature(name string) (float64, error) {
+	crc, err := f.strike(name)
+	if err != nil {
+		return 0, err
+	}
+	v, err := f.Backend.ReadTemperature(name)
+	if err == nil && crc {
+		return 0, fmt.Errorf("Error reading %v: %w", name, rpionewire.ErrCRCMismatch)
+	}
+	return v, err
+}
+
+// ReadRaw reads the device name through the wrapped backend, as
+// ReadTemperature does, with its scratchpad if the backend is a
+// rpionewire.RawBackend
+func (f *Faults) ReadRaw(name string) (int64, []byte, error) {
+	crc, err := f.strike(name)
+	if err != nil {
+		return 0, nil, err
+	}
+	var raw int64
+	var scratchpad []byte
+	if rb, ok := f.Backend.(rpionewire.RawBackend); ok {
+		raw, scratchpad, err = rb.ReadRaw(name)
+	} else {
+		var v float64
+		v, err = f.Backend.ReadTemperature(name)
+		raw = int64(math.Round(v * 1000))
+	}
+	if err == nil && crc {
+		return 0, nil, fmt.Errorf("Error reading %v: %w", name, rpionewire.ErrCRCMismatch)
+	}
+	return raw, scratchpad, err
+}
+
+// ReadAttr reads an attribute of the device name through the wrapped
+// backend, failing while the device is dropped
+func (f *Faults) ReadAttr(name, attr string) ([]byte, error) {
+	ab, err := f.attrBackend(name)
+	if err != nil {
+		return nil, err
+	}
+	return ab.ReadAttr(name, attr)
+}
+
+// WriteAttr writes an attribute of the device name through the wrapped
+// backend, failing while the device is dropped
+func (f *Faults) WriteAttr(name, attr string, value []byte) error {
+	ab, err := f.attrBackend(name)
+	if err != nil {
+		return err
+	}
+	return ab.WriteAttr(name, attr, value)
+}
+
+// attrBackend returns the wrapped backend to reach the attributes of
+// name through
+func (f *Faults) attrBackend(name string) (rpionewire.AttrBackend, error) {
+	ab, ok := f.Backend.(rpionewire.AttrBackend)
+	if !ok {
+		return nil, rpionewire.ErrUnsupported
+	}
+	f.mu.Lock()
+	dropped := f.isDropped(name)
+	f.mu.Unlock()
+	if dropped {
+		return nil, fmt.Errorf("Error reading %v: %w", name, fs.ErrNotExist)
+	}
+	return ab, nil
+}
+
+// strike draws the faults of a read of the device name, returning the
+// error the read fails with before reaching the wrapped backend, or
+// whether it fails its CRC check once read
+func (f *Faults) strike(name string) (bool, error) {
+	f.mu.Lock()
+	var forced error
+	if errs := f.fails[name]; len(errs) > 0 {
+		forced, f.fails[name] = errs[0], errs[1:]
+	}
+	if f.DropRate > 0 && f.random() < f.DropRate {
+		f.drop(name, f.DropDuration)
+	}
+	dropped := f.isDropped(name)
+	crc := f.CRCRate > 0 && f.random() < f.CRCRate
+	slow := f.SlowRate > 0 && f.random() < f.SlowRate
+	f.mu.Unlock()
+
+	switch {
+	case forced != nil:
+		return false, fmt.Errorf("Error reading %v: %w", name, forced)
+	case dropped:
+		return false, fmt.Errorf("Error reading %v: %w", name, fs.ErrNotExist)
+	}
+	if slow {
+		f.clock().Sleep(f.SlowDelay)
+	}
+	return crc, nil
+}
+
+// drop drops name for d. The lock must be held.
+func (f *Faults) drop(name string, d time.Duration) {
+	if f.dropped == nil {
+		f.dropped = map[string]time.Time{}
+	}
+	f.dropped[name] = f.clock().Now().Add(d)
+}
+
+// isDropped tells whether name is dropped, forgetting drops that ended.
+// The lock must be held.
+func (f *Faults) isDropped(name string) bool {
+	until, ok := f.dropped[name]
+	if ok && !f.clock().Now().Before(until) {
+		delete(f.dropped, name)
+		return false
+	}
+	return ok
+}
+
+// random returns a random number in [0, 1). The lock must be held.
+func (f *Faults) random() float64 {
+	if f.rand == nil {
+		seed := f.Seed
+		if seed == 0 {
+			seed = time.Now().UnixNano()
+		}
+		f.rand = rand.New(rand.NewSource(seed))
+	}
+	return f.rand.Float64()
+}
+
+func (f *Faults) clock() rpionewire.Clock {
+	if f.Clock != nil {
+		return f.Clock
+	}
+	return rpionewire.SystemClock
+}
@@ -0,0 +1,146 @@
+package sim
+
+import (
+	"errors"
+	"io/fs"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fredcarle/rpionewire"
+)
+
+// manualClock is a Clock only moving when told to
+type manualClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *manualClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *manualClock) After(d time.Duration) <-chan time.Time {
+	c.Sleep(d)
+	ch := make(chan time.Time, 1)
+	ch <- c.Now()
+	return ch
+}
+
+func (c *manualClock) Sleep(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func TestFaultsFailNext(t *testing.T) {
+	f := &Faults{Backend: NewBackend(2)}
+	f.FailNext(Name(0), 2, rpionewire.ErrCRCMismatch)
+
+	for i := 0; i < 2; i++ {
+		if _, err := f.ReadTemperature(Name(0)); !errors.Is(err, rpionewire.ErrCRCMismatch) {
+			t.Fatalf("read %d: got %v, want a CRC mismatch", i, err)
+		}
+	}
+	if _, err := f.ReadTemperature(Name(0)); err != nil {
+		t.Fatalf("read after the failures: %v", err)
+	}
+	if _, err := f.ReadTemperature(Name(1)); err != nil {
+		t.Fatalf("read of another device: %v", err)
+	}
+}
+
+func TestFaultsDrop(t *testing.T) {
+	clock := &manualClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	f := &Faults{Backend: NewBackend(2), Clock: clock}
+	f.Drop(Name(1), time.Minute)
+
+	names, err := f.Devices()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 1 || names[0] != Name(0) {
+		t.Fatalf("got devices %v while %v is dropped", names, Name(1))
+	}
+	if _, err := f.ReadTemperature(Name(1)); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("got %v reading a dropped device, want fs.ErrNotExist", err)
+	}
+
+	clock.Sleep(time.Minute)
+	if names, _ := f.Devices(); len(names) != 2 {
+		t.Fatalf("got devices %v once the drop ended", names)
+	}
+	if _, err := f.ReadTemperature(Name(1)); err != nil {
+		t.Fatalf("read once the drop ended: %v", err)
+	}
+}
+
+func TestFaultsSeed(t *testing.T) {
+	failures := func() []bool {
+		f := &Faults{Backend: NewBackend(1), CRCRate: 0.3, Seed: 42}
+		var failed []bool
+		for i := 0; i < 200; i++ {
+			_, err := f.ReadTemperature(Name(0))
+			failed = append(failed, errors.Is(err, rpionewire.ErrCRCMismatch))
+		}
+		return failed
+	}
+
+	a, b := failures(), failures()
+	n := 0
+	for i := range a {
+		if a[i] != b[i] {
+			t.Fatalf("read %d: failures differ with the same seed", i)
+		}
+		if a[i] {
+			n++
+		}
+	}
+	if n == 0 || n == len(a) {
+		t.Fatalf("got %d CRC failures out of %d reads at a rate of 0.3", n, len(a))
+	}
+}
+
+// attrBackend is a Backend with sysfs attributes
+type attrBackend struct {
+	*Backend
+	attrs map[string][]byte
+}
+
+func (b *attrBackend) ReadAttr(name, attr string) ([]byte, error) {
+	v, ok := b.attrs[name+"/"+attr]
+	if !ok {
+		return nil, fs.ErrNotExist
+	}
+	return v, nil
+}
+
+func (b *attrBackend) WriteAttr(name, attr string, value []byte) error {
+	b.attrs[name+"/"+attr] = value
+	return nil
+}
+
+func TestFaultsForward(t *testing.T) {
+	f := &Faults{Backend: &attrBackend{Backend: NewBackend(1), attrs: map[string][]byte{}}}
+	if err := f.WriteAttr(Name(0), "resolution", []byte("10")); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := f.ReadAttr(Name(0), "resolution"); err != nil || string(v) != "10" {
+		t.Fatalf("got %q, %v reading back the attribute", v, err)
+	}
+	f.Drop(Name(0), time.Minute)
+	if _, err := f.ReadAttr(Name(0), "resolution"); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("got %v reading an attribute of a dropped device, want fs.ErrNotExist", err)
+	}
+
+	f = &Faults{Backend: NewBackend(1)}
+	if _, err := f.ReadAttr(Name(0), "resolution"); !errors.Is(err, rpionewire.ErrUnsupported) {
+		t.Fatalf("got %v reading an attribute the backend lacks, want ErrUnsupported", err)
+	}
+	raw, scratchpad, err := f.ReadRaw(Name(0))
+	if err != nil || scratchpad != nil || raw < 10000 || raw > 30000 {
+		t.Fatalf("got %v, %v, %v reading raw through a backend without raw reads", raw, scratchpad, err)
+	}
+}
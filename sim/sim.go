@@ -0,0 +1,121 @@
+// Package sim simulates a bus of DS18B20 sensors, so that sinks, the
+// history store and the systems downstream of them can be load tested
+// without hardware. A Backend gives any number of virtual sensors to a
+// rpionewire.Bus:
+//
+//	bus := rpionewire.NewBus(rpionewire.WithBackend(sim.NewBackend(500)))
+//	devices, _ := bus.LoadDevices()
+//	p := rpionewire.NewPoller(devices, time.Second, rpionewire.WithSinks(sink))
+//
+// Each sensor follows a daily cycle of its own, offset from the others,
+// with some noise, quantized to the 1/16 °C of a 12 bit conversion.
+// Faults wraps a backend to inject the failures of real buses.
+package sim
+
+import (
+	"fmt"
+	"io/fs"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fredcarle/rpionewire"
+)
+
+// serialBase marks the serial numbers of the virtual sensors, numbered
+// from 1 above it
+const serialBase = 0xee0000000000
+
+// Backend is a rpionewire.Backend of virtual DS18B20 sensors
+type Backend struct {
+	// Sensors is the number of virtual sensors
+	Sensors int
+	// Mean is the average temperature of the sensors in °C, Swing the
+	// amplitude of their cycle over Period
+	Mean   float64
+	Swing  float64
+	Period time.Duration
+	// Noise is the standard deviation of the noise added to every
+	// reading, in °C
+	Noise float64
+	// Latency is how long a conversion takes, 750ms on real 12 bit
+	// sensors; zero converts instantly, to stress the sinks
+	Latency time.Duration
+	// Clock is the source of time of the cycles and conversions, the
+	// system clock if nil
+	Clock rpionewire.Clock
+
+	mu   sync.Mutex
+	rand *rand.Rand
+}
+
+// NewBackend returns a Backend of n sensors around 20 °C, swinging by
+// 5 °C over a day with 0.1 °C of noise, converting instantly
+func NewBackend(n int) *Backend {
+	return &Backend{Sensors: n, Mean: 20, Swing: 5, Period: 24 * time.Hour, Noise: 0.1}
+}
+
+// Name returns the sysfs name of the virtual sensor i, from 0
+func Name(i int) string {
+	return fmt.Sprintf("%02x-%012x", 0x28, serialBase+i+1)
+}
+
+// Devices returns the names of the virtual sensors
+func (b *Backend) Devices() ([]string, error) {
+	names := make([]string, b.Sensors)
+	for i := range names {
+		names[i] = Name(i)
+	}
+	return names, nil
+}
+
+// ReadTemperature converts the virtual sensor name
+func (b *Backend) ReadTemperature(name string) (float64, error) {
+	i, err := b.index(name)
+	if err != nil {
+		return 0, err
+	}
+	clock := b.clock()
+	if b.Latency > 0 {
+		clock.Sleep(b.Latency)
+	}
+	return b.temperature(i, clock.Now()), nil
+}
+
+// temperature returns the temperature of the sensor i at t
+func (b *Backend) temperature(i int, t time.Time) float64 {
+	v := b.Mean
+	if b.Period > 0 {
+		phase := float64(t.UnixNano()%int64(b.Period))/float64(b.Period) + float64(i)/float64(b.Sensors)
+		v += b.Swing * math.Sin(2*math.Pi*phase)
+	}
+	if b.Noise > 0 {
+		b.mu.Lock()
+		if b.rand == nil {
+			b.rand = rand.New(rand.NewSource(time.Now().UnixNano()))
+		}
+		v += b.rand.NormFloat64() * b.Noise
+		b.mu.Unlock()
+	}
+	return math.Round(v*16) / 16
+}
+
+// index returns the number of the virtual sensor name
+func (b *Backend) index(name string) (int, error) {
+	serial, err := strconv.ParseUint(strings.TrimPrefix(name, "28-"), 16, 64)
+	i := int(serial) - serialBase - 1
+	if err != nil || !strings.HasPrefix(name, "28-") || i < 0 || i >= b.Sensors {
+		return 0, fmt.Errorf("Error reading %v: no such virtual sensor: %w", name, fs.ErrNotExist)
+	}
+	return i, nil
+}
+
+func (b *Backend) clock() rpionewire.Clock {
+	if b.Clock != nil {
+		return b.Clock
+	}
+	return rpionewire.SystemClock
+}
@@ -0,0 +1,103 @@
+package rpionewire
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// Unit is a temperature scale
+type Unit int
+
+const (
+	Celsius Unit = iota
+	Fahrenheit
+	Kelvin
+)
+
+// Symbol returns the symbol of the unit, such as "°C"
+func (u Unit) Symbol() string {
+	switch u {
+	case Celsius:
+		return "°C"
+	case Fahrenheit:
+		return "°F"
+	case Kelvin:
+		return "K"
+	}
+	return fmt.Sprintf("Unit(%d)", int(u))
+}
+
+func (u Unit) String() string {
+	return u.Symbol()
+}
+
+// Temperature is a temperature in degrees Celsius
+type Temperature float64
+
+// In returns the temperature expressed in unit u
+func (t Temperature) In(u Unit) float64 {
+	switch u {
+	case Fahrenheit:
+		return float64(t)*9/5 + 32
+	case Kelvin:
+		return float64(t) + 273.15
+	}
+	return float64(t)
+}
+
+// Format returns the temperature in unit u with precision decimals
+// followed by the unit symbol, such as "70.5 °F"
+func (t Temperature) Format(u Unit, precision int) string {
+	return strconv.FormatFloat(t.In(u), 'f', precision, 64) + " " + u.Symbol()
+}
+
+// String returns the temperature in Celsius with one decimal, such as
+// "21.4 °C"
+func (t Temperature) String() string {
+	return t.Format(Celsius, 1)
+}
+
+// Calibration corrects the temperatures read from a device as
+// raw*Scale + Offset. The zero value leaves temperatures unchanged.
+type Calibration struct {
+	Offset float64
+	Scale  float64
+	// SelfHeating compensates the heating of a device read often at
+	// high resolution: it is the temperature rise in °C the device
+	// would show if converting continuously, and is subtracted in
+	// proportion to the measured conversion duty cycle. Zero disables
+	// the compensation.
+	SelfHeating float64
+}
+
+// Apply returns the calibrated value of the raw temperature t
+func (c Calibration) Apply(t float64) float64 {
+	scale := c.Scale
+	if scale == 0 {
+		scale = 1
+	}
+	return t*scale + c.Offset
+}
+
+// Format returns the temperature of the reading formatted like
+// Temperature.Format, or the error of the reading if it failed. The
+// Measurement of a reading that is not a temperature is formatted in
+// its own unit, u being ignored.
+func (r Reading) Format(u Unit, precision int) string {
+	if r.Err != nil {
+		return "error: " + r.Err.Error()
+	}
+	if m := r.Measurement; m != nil {
+		return strconv.FormatFloat(m.Value, 'f', precision, 64) + " " + m.Unit
+	}
+	return r.Value.Format(u, precision)
+}
+
+// String returns the device name followed by its formatted value
+func (r Reading) String() string {
+	name := ""
+	if r.Device != nil {
+		name = r.Device.Name
+	}
+	return name + ": " + r.Format(Celsius, 1)
+}
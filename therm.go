@@ -0,0 +1,155 @@
+package rpionewire
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// PowerMode is how a device is powered
+type PowerMode int
+
+const (
+	// PowerParasite devices draw their power from the data line
+	PowerParasite PowerMode = iota
+	// PowerExternal devices have their VDD pin supplied
+	PowerExternal
+)
+
+func (m PowerMode) String() string {
+	switch m {
+	case PowerParasite:
+		return "parasite"
+	case PowerExternal:
+		return "external"
+	}
+	return fmt.Sprintf("PowerMode(%d)", int(m))
+}
+
+// Features are the options of the w1_therm driver for a device, set
+// through its features attribute on kernels that have it, see
+// Capabilities
+type Features int
+
+const (
+	// FeatureCheckConversion makes the kernel check that a conversion
+	// took place, rejecting the 85°C power-on value of a device that
+	// lost power instead of returning it
+	FeatureCheckConversion Features = 1 << iota
+	// FeaturePollCompletion makes the kernel poll the data line for the
+	// end of conversions instead of waiting for the worst case duration.
+	// It speeds up reads on externally powered devices but leaves
+	// parasite powered ones without a strong pull-up.
+	FeaturePollCompletion
+)
+
+var featureNames = []string{"check-conversion", "poll-completion"}
+
+func (f Features) String() string {
+	var names []string
+	for i, name := range featureNames {
+		if f&(1<<i) != 0 {
+			names = append(names, name)
+		}
+	}
+	if f&^(1<<len(featureNames)-1) != 0 {
+		names = append(names, fmt.Sprintf("0x%x", int(f&^(1<<len(featureNames)-1))))
+	}
+	if len(names) == 0 {
+		return "none"
+	}
+	return strings.Join(names, ",")
+}
+
+// ParseFeatures parses features formatted by Features.String, a comma
+// separated list of names or none
+func ParseFeatures(s string) (Features, error) {
+	var f Features
+	if s == "none" || s == "" {
+		return 0, nil
+	}
+	for _, name := range strings.Split(s, ",") {
+		found := false
+		for i, n := range featureNames {
+			if strings.TrimSpace(name) == n {
+				f |= 1 << i
+				found = true
+			}
+		}
+		if !found {
+			return 0, fmt.Errorf("unknown feature %q, expected %v or none", name, strings.Join(featureNames, ", "))
+		}
+	}
+	return f, nil
+}
+
+// Features returns the w1_therm features enabled for the device, the
+// read failing on kernels without the features attribute
+func (d *DS1820) Features() (Features, error) {
+	v, err := readAttr(d.backend(), d.Name, "features")
+	if err != nil {
+		return 0, err
+	}
+	return Features(v), nil
+}
+
+// SetFeatures replaces the w1_therm features enabled for the device.
+// Both default to off; they trade the safety of the default reads for
+// speed and should only be changed on buses known to be clean. The
+// setting is kept by the kernel until the device is removed.
+func (d *DS1820) SetFeatures(f Features) error {
+	if err := writeAttr(d.backend(), d.Name, "features", strconv.Itoa(int(f))); err != nil {
+		return fmt.Errorf("Error setting features of %v: %w", d.Name, err)
+	}
+	return nil
+}
+
+// Resolution returns the resolution of the device temperature
+// conversions in bits, from 9 to 12
+func (d *DS1820) Resolution() (int, error) {
+	v, err := readAttr(d.backend(), d.Name, "resolution")
+	if err != nil {
+		return 0, err
+	}
+	d.mu.Lock()
+	d.resolution = int(v)
+	d.mu.Unlock()
+	return int(v), nil
+}
+
+// PowerMode returns how the device is powered
+func (d *DS1820) PowerMode() (PowerMode, error) {
+	v, err := readAttr(d.backend(), d.Name, "ext_power")
+	if err != nil {
+		return 0, err
+	}
+	if v == 0 {
+		return PowerParasite, nil
+	}
+	return PowerExternal, nil
+}
+
+// SetResolution sets the resolution of the device temperature
+// conversions, from 9 to 12 bits. The setting is lost when the device
+// is powered off unless SaveEEPROM is called.
+func (d *DS1820) SetResolution(bits int) error {
+	if bits < 9 || bits > 12 {
+		return fmt.Errorf("Error setting resolution of %v: %v bits out of the 9 to 12 range", d.Name, bits)
+	}
+	if err := writeAttr(d.backend(), d.Name, "resolution", strconv.Itoa(bits)); err != nil {
+		return fmt.Errorf("Error setting resolution of %v: %w", d.Name, err)
+	}
+	d.mu.Lock()
+	d.resolution = bits
+	d.mu.Unlock()
+	return nil
+}
+
+// SaveEEPROM copies the resolution and alarm thresholds of the device
+// to its EEPROM, so they survive a power cycle
+func (d *DS1820) SaveEEPROM() error {
+	if err := writeAttr(d.backend(), d.Name, "eeprom_cmd", "save"); err != nil {
+		return fmt.Errorf("Error saving EEPROM of %v: %w", d.Name, err)
+	}
+	return nil
+}
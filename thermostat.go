@@ -0,0 +1,137 @@
+package rpionewire
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Output is a switched actuator, such as the relay of a heater or of a
+// fridge compressor
+type Output interface {
+	Set(on bool) error
+}
+
+// OutputFunc adapts a function to the Output interface
+type OutputFunc func(on bool) error
+
+// Set calls f(on)
+func (f OutputFunc) Set(on bool) error {
+	return f(on)
+}
+
+// ThermostatMode tells whether a Thermostat drives a heater or a cooler
+type ThermostatMode int
+
+const (
+	// Heating switches the output on below the setpoint
+	Heating ThermostatMode = iota
+	// Cooling switches the output on above the setpoint
+	Cooling
+)
+
+func (m ThermostatMode) String() string {
+	switch m {
+	case Heating:
+		return "heating"
+	case Cooling:
+		return "cooling"
+	}
+	return fmt.Sprintf("ThermostatMode(%d)", int(m))
+}
+
+// Thermostat is an on/off controller keeping the temperature of a
+// device or zone at a setpoint by switching an output, the gpio
+// subpackage providing outputs driving GPIO lines.
+//
+// A heating thermostat switches its output on once the temperature
+// drops under Setpoint minus Hysteresis and off once it rises above
+// Setpoint plus Hysteresis; a cooling one does the opposite. It is a
+// Sink to add to the poller sinks. A failed reading of its device
+// switches the output off, so that a lost sensor does not leave a
+// heater running.
+type Thermostat struct {
+	// Device is the device or zone watched, by sysfs name, alias or
+	// name of a derived reading such as greenhouse:mean
+	Device     string
+	Setpoint   float64
+	Hysteresis float64
+	Mode       ThermostatMode
+	Output     Output
+	// MinCycle is the minimum time between two switches of the output,
+	// protecting compressors from short cycling, failed readings
+	// excepted
+	MinCycle time.Duration
+
+	mu       sync.Mutex
+	target   *float64
+	on       bool
+	switched time.Time
+}
+
+// WriteReadings switches the output according to the reading of the
+// device, if readings has one
+func (t *Thermostat) WriteReadings(readings []Reading) error {
+	for _, r := range readings {
+		if r.Device == nil || !r.IsTemperature() || (r.Device.Name != t.Device && (r.Device.Alias == "" || r.Device.Alias != t.Device)) {
+			continue
+		}
+		return t.update(r)
+	}
+	return nil
+}
+
+// update switches the output according to r
+func (t *Thermostat) update(r Reading) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	on := t.on
+	if r.Err != nil {
+		on = false
+	} else {
+		v := float64(r.Value)
+		low, high := t.setpoint()-t.Hysteresis, t.setpoint()+t.Hysteresis
+		switch {
+		case v < low:
+			on = t.Mode == Heating
+		case v > high:
+			on = t.Mode == Cooling
+		}
+		if on != t.on && !t.switched.IsZero() && r.Time.Sub(t.switched) < t.MinCycle {
+			on = t.on
+		}
+	}
+	if on == t.on && !t.switched.IsZero() {
+		return nil
+	}
+
+	if err := t.Output.Set(on); err != nil {
+		return fmt.Errorf("Error switching the output of the %v thermostat: %w", t.Device, err)
+	}
+	t.on, t.switched = on, r.Time
+	return nil
+}
+
+// SetSetpoint changes the setpoint, such as from a ProfileRunner. Once
+// called, it overrides the Setpoint field.
+func (t *Thermostat) SetSetpoint(setpoint float64) {
+	t.mu.Lock()
+	t.target = &setpoint
+	t.mu.Unlock()
+}
+
+// setpoint returns the setpoint in effect, t.mu being held
+func (t *Thermostat) setpoint() float64 {
+	if t.target != nil {
+		return *t.target
+	}
+	return t.Setpoint
+}
+
+// On tells whether the output is switched on
+func (t *Thermostat) On() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.on
+}
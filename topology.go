@@ -0,0 +1,177 @@
+package rpionewire
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// NodeKind is the kind of a node of the bus topology
+type NodeKind int
+
+const (
+	NodeMaster NodeKind = iota
+	NodeCoupler
+	NodeBranch
+	NodeDevice
+)
+
+func (k NodeKind) String() string {
+	switch k {
+	case NodeMaster:
+		return "master"
+	case NodeCoupler:
+		return "coupler"
+	case NodeBranch:
+		return "branch"
+	case NodeDevice:
+		return "device"
+	}
+	return fmt.Sprintf("NodeKind(%d)", int(k))
+}
+
+// Node is an element of the bus topology: a master, a coupler, one of
+// its branches or a device
+type Node struct {
+	Kind     NodeKind
+	Name     string
+	Children []*Node
+}
+
+// String renders the subtree rooted at n, one node per line indented
+// by depth
+func (n *Node) String() string {
+	var sb strings.Builder
+	n.write(&sb, 0)
+	return sb.String()
+}
+
+func (n *Node) write(sb *strings.Builder, depth int) {
+	fmt.Fprintf(sb, "%v%v %v\n", strings.Repeat("  ", depth), n.Kind, n.Name)
+	for _, c := range n.Children {
+		c.write(sb, depth+1)
+	}
+}
+
+// Topology maps the bus: each master with the devices wired directly to
+// it and, for each DS2409 coupler, the devices found behind each of its
+// branches. Branches are switched on one at a time and searched for
+// wait before being switched off again.
+func (b *Bus) Topology(wait time.Duration) ([]*Node, error) {
+	masters, err := filepath.Glob(filepath.Join(b.dir, "w1_bus_master*"))
+	if err != nil {
+		return nil, err
+	}
+	couplers, err := b.LoadCouplers()
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range couplers {
+		if err := c.Off(); err != nil {
+			return nil, err
+		}
+	}
+	if len(couplers) > 0 {
+		if err := triggerSearch(b.dir); err != nil {
+			return nil, err
+		}
+		<-b.clock.After(wait)
+	}
+
+	nodes := make([]*Node, 0, len(masters))
+	for _, m := range masters {
+		name := filepath.Base(m)
+		trunk, err := masterSlaves(b.dir, name)
+		if err != nil {
+			return nil, err
+		}
+
+		master := &Node{Kind: NodeMaster, Name: name}
+		for _, slave := range trunk {
+			var coupler *Coupler
+			for _, c := range couplers {
+				if c.Name == slave {
+					coupler = c
+				}
+			}
+			if coupler == nil {
+				master.Children = append(master.Children, &Node{Kind: NodeDevice, Name: slave})
+				continue
+			}
+
+			cn := &Node{Kind: NodeCoupler, Name: slave}
+			for _, br := range []Branch{BranchMain, BranchAux} {
+				names, err := b.branchSlaves(coupler, br, name, trunk, wait)
+				if err != nil {
+					return nil, err
+				}
+				bn := &Node{Kind: NodeBranch, Name: br.String()}
+				for _, n := range names {
+					kind := NodeDevice
+					if strings.HasPrefix(n, fmt.Sprintf("%02x-", familyDS2409)) {
+						kind = NodeCoupler
+					}
+					bn.Children = append(bn.Children, &Node{Kind: kind, Name: n})
+				}
+				cn.Children = append(cn.Children, bn)
+			}
+			master.Children = append(master.Children, cn)
+		}
+		nodes = append(nodes, master)
+	}
+
+	return nodes, nil
+}
+
+// branchSlaves returns the devices of master that appear when branch br
+// of c is on and that are not part of trunk
+func (b *Bus) branchSlaves(c *Coupler, br Branch, master string, trunk []string, wait time.Duration) ([]string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	defer c.allOff()
+
+	if err := c.selectBranch(br); err != nil {
+		return nil, err
+	}
+	if err := triggerSearch(b.dir); err != nil {
+		return nil, err
+	}
+	<-b.clock.After(wait)
+
+	slaves, err := masterSlaves(b.dir, master)
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool, len(trunk))
+	for _, n := range trunk {
+		seen[n] = true
+	}
+	var names []string
+	for _, n := range slaves {
+		if !seen[n] {
+			names = append(names, n)
+		}
+	}
+	return names, nil
+}
+
+// masterSlaves returns the sorted names of the devices the master of
+// the devices directory dir currently sees
+func masterSlaves(dir, master string) ([]string, error) {
+	b, err := os.ReadFile(filepath.Join(dir, master, "w1_master_slaves"))
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, line := range strings.Split(string(b), "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && line != "not found." {
+			names = append(names, line)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
@@ -0,0 +1,43 @@
+package rpionewire
+
+import "context"
+
+// Tracer wraps the discovery, poll, read and conversion operations of the
+// package in spans, so that slow reads and retries show up in the traces
+// of the application. The tracing subpackage implements it with
+// OpenTelemetry.
+//
+// Reads are wrapped in "rpionewire.read" spans and each conversion they
+// attempt, retries included, in "rpionewire.convert" child spans, both
+// carrying the device.name and device.id attributes. Discoveries and
+// poll cycles are wrapped in "rpionewire.discover" and
+// "rpionewire.poll" spans.
+type Tracer interface {
+	// Start starts a span named name, as a child of the span carried by
+	// ctx, and returns a context carrying the new span
+	Start(ctx context.Context, name string, attrs ...Label) (context.Context, Span)
+}
+
+// Span is an operation started by a Tracer
+type Span interface {
+	// End ends the span, marking it as failed if err is not nil
+	End(err error)
+}
+
+// nopTracer starts spans that record nothing
+type nopTracer struct{}
+
+func (nopTracer) Start(ctx context.Context, _ string, _ ...Label) (context.Context, Span) {
+	return ctx, nopSpan{}
+}
+
+type nopSpan struct{}
+
+func (nopSpan) End(error) {}
+
+// WithTracer makes the bus trace its discoveries and reads with t
+func WithTracer(t Tracer) Option {
+	return func(b *Bus) {
+		b.tracer = t
+	}
+}
@@ -0,0 +1,50 @@
+// Package tracing traces rpionewire operations with OpenTelemetry.
+//
+//	bus := rpionewire.NewBus(rpionewire.WithTracer(tracing.New(otel.GetTracerProvider())))
+package tracing
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/fredcarle/rpionewire"
+)
+
+// InstrumentationName identifies the spans of rpionewire
+const InstrumentationName = "github.com/fredcarle/rpionewire"
+
+// Tracer is a rpionewire.Tracer starting OpenTelemetry spans
+type Tracer struct {
+	tracer trace.Tracer
+}
+
+// New returns a Tracer starting its spans with a tracer of tp
+func New(tp trace.TracerProvider) *Tracer {
+	return &Tracer{tracer: tp.Tracer(InstrumentationName)}
+}
+
+// Start starts a span carrying attrs as string attributes
+func (t *Tracer) Start(ctx context.Context, name string, attrs ...rpionewire.Label) (context.Context, rpionewire.Span) {
+	kvs := make([]attribute.KeyValue, len(attrs))
+	for i, a := range attrs {
+		kvs[i] = attribute.String(a.Name, a.Value)
+	}
+	ctx, span := t.tracer.Start(ctx, name, trace.WithAttributes(kvs...))
+	return ctx, spanEnder{span}
+}
+
+// spanEnder is a rpionewire.Span ending an OpenTelemetry span
+type spanEnder struct {
+	span trace.Span
+}
+
+func (s spanEnder) End(err error) {
+	if err != nil {
+		s.span.RecordError(err)
+		s.span.SetStatus(codes.Error, err.Error())
+	}
+	s.span.End()
+}
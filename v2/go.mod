@@ -0,0 +1,3 @@
+module github.com/fredcarle/rpionewire/v2
+
+go 1.21
@@ -0,0 +1,269 @@
+// Package rpionewire reads DS18x20 family one wire temperature
+// sensors attached to a Raspberry Pi through the kernel w1 subsystem.
+//
+// This is version 2 of the package, imported as
+// github.com/fredcarle/rpionewire/v2. Version 1 stays available for
+// existing users. Compared to it:
+//
+//   - DS1820 is renamed DS18X20 and reports its Family, since the same
+//     type handles the DS18S20, DS1822, DS18B20 and DS1825
+//   - reads return an immutable Reading instead of updating LastTemp
+//   - discovery no longer runs modprobe; call LoadModules explicitly
+//     when the kernel modules are not loaded at boot
+//
+// Version 2 only covers reading local sensors. It deliberately lacks
+// the features version 1 gained since, such as the pluggable backends,
+// the poller and its sinks, calibration and bus master failover; use
+// version 1 for those.
+package rpionewire
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultDir is where the kernel exposes the w1 devices
+const DefaultDir = "/sys/bus/w1/devices"
+
+// Family is the one wire family code of a device
+type Family uint8
+
+const (
+	FamilyDS18S20 Family = 0x10
+	FamilyDS1822  Family = 0x22
+	FamilyDS18B20 Family = 0x28
+	FamilyDS1825  Family = 0x3b
+)
+
+func (f Family) String() string {
+	switch f {
+	case FamilyDS18S20:
+		return "DS18S20"
+	case FamilyDS1822:
+		return "DS1822"
+	case FamilyDS18B20:
+		return "DS18B20"
+	case FamilyDS1825:
+		return "DS1825"
+	}
+	return fmt.Sprintf("Family(0x%02x)", uint8(f))
+}
+
+// ErrCRCMismatch is returned when the kernel reports a CRC mismatch on
+// the data read from a device
+var ErrCRCMismatch = errors.New("CRC mismatch on read")
+
+// ErrNoData is returned when a device returns no temperature data
+var ErrNoData = errors.New("EOF without data from w1")
+
+// Temperature is a temperature in degrees Celsius
+type Temperature float64
+
+// Fahrenheit returns the temperature in degrees Fahrenheit
+func (t Temperature) Fahrenheit() float64 {
+	return float64(t)*9/5 + 32
+}
+
+// String returns the temperature with one decimal, such as "21.4 °C"
+func (t Temperature) String() string {
+	return strconv.FormatFloat(float64(t), 'f', 1, 64) + " °C"
+}
+
+// Reading is the result of a read of a device
+type Reading struct {
+	DeviceID uint64
+	Name     string
+	Temp     Temperature
+	Time     time.Time
+	// Err is the error of a failed read, Temp being zero then
+	Err error
+}
+
+// Clock is the source of time of the readings. It is the Clock of
+// version 1, so the clocks written for it can be given to WithClock.
+type Clock interface {
+	Now() time.Time
+	// After returns a channel receiving the time once d has elapsed
+	After(d time.Duration) <-chan time.Time
+	Sleep(d time.Duration)
+}
+
+// SystemClock is the Clock backed by the time package
+var SystemClock Clock = systemClock{}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time                         { return time.Now() }
+func (systemClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+func (systemClock) Sleep(d time.Duration)                  { time.Sleep(d) }
+
+// DS18X20 is a temperature sensor of the DS18x20 family
+type DS18X20 struct {
+	ID     uint64
+	Name   string
+	Family Family
+
+	dir   string
+	clock Clock
+}
+
+// Bus gives access to the devices of a w1 sysfs tree
+type Bus struct {
+	dir   string
+	clock Clock
+}
+
+// Option configures a Bus
+type Option func(*Bus)
+
+// WithClock makes the devices of the bus time their readings with
+// clock instead of SystemClock
+func WithClock(clock Clock) Option {
+	return func(b *Bus) {
+		b.clock = clock
+	}
+}
+
+// NewBus returns the Bus of the sysfs tree at dir, DefaultDir if empty,
+// configured with opts
+func NewBus(dir string, opts ...Option) *Bus {
+	if dir == "" {
+		dir = DefaultDir
+	}
+	b := &Bus{dir: dir, clock: SystemClock}
+	for _, opt := range opts {
+		opt(b)
+	}
+	return b
+}
+
+// parseName splits a device name such as 28-0316a2794bff into its
+// family code and serial number, reporting whether it is one: the
+// bus masters and the other entries of the devices directory are not
+func parseName(name string) (Family, uint64, bool) {
+	if len(name) != 15 || name[2] != '-' {
+		return 0, 0, false
+	}
+	var family uint8
+	var id uint64
+	for i := 0; i < len(name); i++ {
+		if i == 2 {
+			continue
+		}
+		c := name[i]
+		var v byte
+		switch {
+		case '0' <= c && c <= '9':
+			v = c - '0'
+		case 'a' <= c && c <= 'f':
+			v = c - 'a' + 10
+		default:
+			return 0, 0, false
+		}
+		if i < 2 {
+			family = family<<4 | v
+		} else {
+			id = id<<4 | uint64(v)
+		}
+	}
+	return Family(family), id, true
+}
+
+// Devices returns the DS18x20 devices present on the bus. Devices of
+// other families are ignored.
+func (b *Bus) Devices() ([]*DS18X20, error) {
+	entries, err := os.ReadDir(b.dir)
+	if err != nil {
+		return nil, fmt.Errorf("Error finding one wire devices: %w", err)
+	}
+
+	var devices []*DS18X20
+	for _, e := range entries {
+		f, id, ok := parseName(e.Name())
+		if !ok {
+			continue
+		}
+		switch f {
+		case FamilyDS18S20, FamilyDS1822, FamilyDS18B20, FamilyDS1825:
+			devices = append(devices, &DS18X20{ID: id, Name: e.Name(), Family: f, dir: b.dir, clock: b.clock})
+		}
+	}
+	return devices, nil
+}
+
+// Read performs a conversion and returns its Reading. A failed read
+// returns a Reading carrying the error too.
+func (d *DS18X20) Read() (Reading, error) {
+	clock := d.clock
+	if clock == nil {
+		clock = SystemClock
+	}
+	r := Reading{DeviceID: d.ID, Name: d.Name, Time: clock.Now()}
+	raw, err := os.ReadFile(filepath.Join(d.dir, d.Name, "w1_slave"))
+	if err == nil {
+		r.Temp, err = parseW1Slave(string(raw))
+		if err != nil {
+			err = fmt.Errorf("%v: %w", d.Name, err)
+		}
+	}
+	if err != nil {
+		r.Temp, r.Err = 0, err
+	}
+	return r, err
+}
+
+// ReadAll reads every device and returns their readings in the same
+// order. A failing device does not stop the sweep: its reading carries
+// its error, and the returned error joins those of every device that
+// failed.
+func ReadAll(devices []*DS18X20) ([]Reading, error) {
+	readings := make([]Reading, len(devices))
+	var errs []error
+	for i, d := range devices {
+		var err error
+		if readings[i], err = d.Read(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return readings, errors.Join(errs...)
+}
+
+// parseW1Slave parses the two lines of a w1_slave file:
+//
+//	72 01 4b 46 7f ff 0e 10 57 : crc=57 YES
+//	72 01 4b 46 7f ff 0e 10 57 t=23125
+func parseW1Slave(s string) (Temperature, error) {
+	crc, data, ok := strings.Cut(s, "\n")
+	if !ok {
+		return 0, ErrNoData
+	}
+	if !strings.HasSuffix(strings.TrimSpace(crc), "YES") {
+		return 0, ErrCRCMismatch
+	}
+	i := strings.LastIndex(data, "t=")
+	if i < 0 {
+		return 0, ErrNoData
+	}
+	v, err := strconv.Atoi(strings.TrimSpace(data[i+2:]))
+	if err != nil {
+		return 0, ErrNoData
+	}
+	return Temperature(v) / 1000, nil
+}
+
+// LoadModules loads the w1-gpio and w1-therm kernel modules with
+// modprobe, which needs root privileges
+func LoadModules() error {
+	for _, m := range []string{"w1_gpio", "w1_therm"} {
+		if out, err := exec.Command("modprobe", m).CombinedOutput(); err != nil {
+			return fmt.Errorf("Error loading module %v: %v %s", m, err, out)
+		}
+	}
+	return nil
+}
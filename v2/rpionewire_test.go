@@ -0,0 +1,158 @@
+package rpionewire
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// fixedClock is a Clock stopped at a given time
+type fixedClock struct {
+	now time.Time
+}
+
+func (c fixedClock) Now() time.Time { return c.now }
+
+func (c fixedClock) After(d time.Duration) <-chan time.Time {
+	ch := make(chan time.Time, 1)
+	ch <- c.now.Add(d)
+	return ch
+}
+
+func (c fixedClock) Sleep(d time.Duration) {}
+
+// writeDevice creates the device name in the sysfs tree at dir, with its
+// w1_slave file holding content unless it is empty
+func writeDevice(t *testing.T, dir, name, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Join(dir, name), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if content == "" {
+		return
+	}
+	if err := os.WriteFile(filepath.Join(dir, name, "w1_slave"), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestParseW1Slave(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    Temperature
+		err     error
+	}{
+		{"valid", "72 01 4b 46 7f ff 0e 10 57 : crc=57 YES\n72 01 4b 46 7f ff 0e 10 57 t=23125\n", 23.125, nil},
+		{"negative", "5e ff 4b 46 7f ff 0c 10 2a : crc=2a YES\n5e ff 4b 46 7f ff 0c 10 2a t=-10125\n", -10.125, nil},
+		{"crc mismatch", "72 01 4b 46 7f ff 0e 10 57 : crc=57 NO\n72 01 4b 46 7f ff 0e 10 57 t=23125\n", 0, ErrCRCMismatch},
+		{"single line", "72 01 4b 46 7f ff 0e 10 57 : crc=57 YES", 0, ErrNoData},
+		{"no temperature", "72 01 4b 46 7f ff 0e 10 57 : crc=57 YES\n72 01 4b 46 7f ff 0e 10 57\n", 0, ErrNoData},
+		{"invalid temperature", "72 01 4b 46 7f ff 0e 10 57 : crc=57 YES\n72 01 4b 46 7f ff 0e 10 57 t=2x\n", 0, ErrNoData},
+		{"empty", "", 0, ErrNoData},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseW1Slave(tt.content)
+			if !errors.Is(err, tt.err) || got != tt.want {
+				t.Errorf("parseW1Slave = %v, %v, want %v, %v", got, err, tt.want, tt.err)
+			}
+		})
+	}
+}
+
+func TestParseName(t *testing.T) {
+	tests := []struct {
+		name   string
+		family Family
+		id     uint64
+		ok     bool
+	}{
+		{"28-0316a2794bff", FamilyDS18B20, 0x0316a2794bff, true},
+		{"10-000000000001", FamilyDS18S20, 1, true},
+		{"w1_bus_master1", 0, 0, false},
+		{"28-0316A2794BFF", 0, 0, false},
+		{"28-0316a2794bf", 0, 0, false},
+		{"28_0316a2794bff", 0, 0, false},
+		{"2g-0316a2794bff", 0, 0, false},
+	}
+	for _, tt := range tests {
+		family, id, ok := parseName(tt.name)
+		if family != tt.family || id != tt.id || ok != tt.ok {
+			t.Errorf("parseName(%q) = %v, %x, %v, want %v, %x, %v", tt.name, family, id, ok, tt.family, tt.id, tt.ok)
+		}
+	}
+}
+
+func TestDevices(t *testing.T) {
+	dir := t.TempDir()
+	writeDevice(t, dir, "28-0316a2794bff", "")
+	writeDevice(t, dir, "10-000000000001", "")
+	writeDevice(t, dir, "3b-000000000002", "")
+	writeDevice(t, dir, "26-000000000003", "") // DS2438
+	writeDevice(t, dir, "w1_bus_master1", "")
+
+	devices, err := NewBus(dir).Devices()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]Family{
+		"28-0316a2794bff": FamilyDS18B20,
+		"10-000000000001": FamilyDS18S20,
+		"3b-000000000002": FamilyDS1825,
+	}
+	if len(devices) != len(want) {
+		t.Fatalf("got %v devices, want %v", len(devices), len(want))
+	}
+	for _, d := range devices {
+		if f, ok := want[d.Name]; !ok || d.Family != f {
+			t.Errorf("got device %v of family %v", d.Name, d.Family)
+		}
+	}
+
+	if _, err := NewBus(filepath.Join(dir, "missing")).Devices(); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Devices of a missing tree = %v, want fs.ErrNotExist", err)
+	}
+}
+
+func TestReadAll(t *testing.T) {
+	dir := t.TempDir()
+	writeDevice(t, dir, "28-000000000001", "72 01 4b 46 7f ff 0e 10 57 : crc=57 YES\n72 01 4b 46 7f ff 0e 10 57 t=23125\n")
+	writeDevice(t, dir, "28-000000000002", "72 01 4b 46 7f ff 0e 10 57 : crc=57 NO\n72 01 4b 46 7f ff 0e 10 57 t=23125\n")
+	writeDevice(t, dir, "28-000000000003", "")
+
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	devices, err := NewBus(dir, WithClock(fixedClock{now})).Devices()
+	if err != nil {
+		t.Fatal(err)
+	}
+	readings, err := ReadAll(devices)
+	if !errors.Is(err, ErrCRCMismatch) || !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("ReadAll = %v, want the CRC mismatch and the missing file", err)
+	}
+	if len(readings) != len(devices) {
+		t.Fatalf("got %v readings, want one for each of the %v devices", len(readings), len(devices))
+	}
+	for i, r := range readings {
+		if r.Name != devices[i].Name || !r.Time.Equal(now) {
+			t.Errorf("reading %v of %v at %v, want %v at %v", i, r.Name, r.Time, devices[i].Name, now)
+		}
+		switch r.Name {
+		case "28-000000000001":
+			if r.Err != nil || r.Temp != 23.125 {
+				t.Errorf("%v read %v, %v, want 23.125", r.Name, r.Temp, r.Err)
+			}
+		case "28-000000000002":
+			if !errors.Is(r.Err, ErrCRCMismatch) {
+				t.Errorf("%v read %v, want a CRC mismatch", r.Name, r.Err)
+			}
+		case "28-000000000003":
+			if !errors.Is(r.Err, fs.ErrNotExist) {
+				t.Errorf("%v read %v, want fs.ErrNotExist", r.Name, r.Err)
+			}
+		}
+	}
+}
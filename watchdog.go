@@ -0,0 +1,206 @@
+package rpionewire
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// RecoveryAction is what a Watchdog does when it finds the bus wedged
+type RecoveryAction int
+
+const (
+	// RecoverLogOnly only logs that the bus is wedged
+	RecoverLogOnly RecoveryAction = iota
+	// RecoverReloadModules unloads and reloads the w1 kernel modules,
+	// with the parameters given to WithModuleLoading
+	RecoverReloadModules
+	// RecoverToggleMaster unbinds and rebinds the bus masters from
+	// their driver
+	RecoverToggleMaster
+)
+
+func (a RecoveryAction) String() string {
+	switch a {
+	case RecoverLogOnly:
+		return "log only"
+	case RecoverReloadModules:
+		return "reload modules"
+	case RecoverToggleMaster:
+		return "toggle master"
+	}
+	return fmt.Sprintf("RecoveryAction(%d)", int(a))
+}
+
+// Watchdog detects a wedged bus, where every device has been failing
+// for longer than a timeout, and attempts to recover it. It relies on
+// the health recorded by the reads the application performs.
+type Watchdog struct {
+	devices []*DS1820
+	timeout time.Duration
+	action  RecoveryAction
+	logger  *log.Logger
+
+	mu sync.Mutex
+	// since is when the watchdog started or last recovered the bus
+	since time.Time
+}
+
+// NewWatchdog returns a Watchdog over devices which takes action once
+// all of them failed for timeout. A nil logger uses the standard logger.
+// The watchdog runs on the clock of the bus of the devices, the one
+// timing their health.
+func NewWatchdog(devices []*DS1820, timeout time.Duration, action RecoveryAction, logger *log.Logger) *Watchdog {
+	if logger == nil {
+		logger = log.Default()
+	}
+	w := &Watchdog{
+		devices: devices,
+		timeout: timeout,
+		action:  action,
+		logger:  logger,
+	}
+	w.since = w.clock().Now()
+	return w
+}
+
+// clock returns the clock of the bus of the devices
+func (w *Watchdog) clock() Clock {
+	if len(w.devices) > 0 && w.devices[0].bus != nil {
+		return w.devices[0].bus.clock
+	}
+	return defaultBus.clock
+}
+
+// Run checks the bus every interval until ctx is done
+func (w *Watchdog) Run(ctx context.Context, interval time.Duration) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-w.clock().After(interval):
+			w.Check()
+		}
+	}
+}
+
+// Check recovers the bus if it is wedged. It reports whether a recovery
+// was attempted and the error of the recovery action.
+func (w *Watchdog) Check() (bool, error) {
+	now := w.clock().Now()
+	w.mu.Lock()
+	if !w.wedged(now) {
+		w.mu.Unlock()
+		return false, nil
+	}
+	w.since = now
+	w.mu.Unlock()
+
+	w.logger.Printf("rpionewire: all %v devices failing for over %v, recovering bus: %v", len(w.devices), w.timeout, w.action)
+
+	var err error
+	switch w.action {
+	case RecoverReloadModules:
+		l := w.modules()
+		if err = l.Unload(); err == nil {
+			err = l.Load()
+		}
+	case RecoverToggleMaster:
+		err = toggleMasters(w.dir())
+	}
+	if err != nil {
+		w.logger.Printf("rpionewire: bus recovery failed: %v", err)
+		return true, err
+	}
+	if w.action != RecoverLogOnly {
+		w.logger.Printf("rpionewire: bus recovery done")
+	}
+	return true, nil
+}
+
+// wedged reports whether every device failed its reads, without a
+// single success, since at least timeout before now. The watchdog lock
+// must be held.
+func (w *Watchdog) wedged(now time.Time) bool {
+	if len(w.devices) == 0 || now.Sub(w.since) < w.timeout {
+		return false
+	}
+	for _, d := range w.devices {
+		h := d.Health()
+		if h.ConsecutiveFailures == 0 || now.Sub(h.LastSuccess) < w.timeout {
+			return false
+		}
+	}
+	return true
+}
+
+// dir returns the devices directory of the bus of the devices
+func (w *Watchdog) dir() string {
+	for _, d := range w.devices {
+		if d.bus != nil {
+			return d.bus.dir
+		}
+	}
+	return devicesDir
+}
+
+// modules returns the module loader of the bus of the devices, loading
+// the modules without parameters if the bus has none
+func (w *Watchdog) modules() *ModuleLoader {
+	for _, d := range w.devices {
+		if d.bus != nil && d.bus.modules != nil {
+			return d.bus.modules
+		}
+	}
+	return &ModuleLoader{}
+}
+
+// toggleMasters unbinds every bus master's platform device of the
+// devices directory dir from its driver and binds it again, resetting
+// the master. Every master must have a platform device bound to a
+// driver, checked before any is unbound.
+func toggleMasters(dir string) error {
+	masters, err := filepath.Glob(filepath.Join(dir, "w1_bus_master*"))
+	if err != nil {
+		return err
+	}
+	if len(masters) == 0 {
+		return errors.New("Error toggling master: no bus master found")
+	}
+
+	type binding struct{ name, driver string }
+	bindings := make([]binding, len(masters))
+	for i, m := range masters {
+		path, err := filepath.EvalSymlinks(m)
+		if err != nil {
+			return fmt.Errorf("Error toggling %v: %w", filepath.Base(m), err)
+		}
+		parent := filepath.Dir(path)
+		driver, err := filepath.EvalSymlinks(filepath.Join(parent, "driver"))
+		if errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("Error toggling %v: %v is not bound to a driver", filepath.Base(m), parent)
+		}
+		if err != nil {
+			return fmt.Errorf("Error toggling %v: %w", filepath.Base(m), err)
+		}
+		bindings[i] = binding{filepath.Base(parent), driver}
+	}
+
+	for _, b := range bindings {
+		name, driver := b.name, b.driver
+		if err := os.WriteFile(filepath.Join(driver, "unbind"), []byte(name), 0200); err != nil {
+			return fmt.Errorf("Error unbinding %v: %w", name, err)
+		}
+		if err := os.WriteFile(filepath.Join(driver, "bind"), []byte(name), 0200); err != nil {
+			return fmt.Errorf("Error binding %v: %w", name, err)
+		}
+	}
+
+	return nil
+}
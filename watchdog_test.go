@@ -0,0 +1,72 @@
+package rpionewire
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWatchdogFakeClock(t *testing.T) {
+	clock := newFakeClock()
+	backend := &fakeBackend{names: []string{"28-000000000001", "28-000000000002"}}
+	devices, err := NewBus(WithBackend(backend), WithClock(clock)).LoadDevices()
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := NewWatchdog(devices, time.Minute, RecoverLogOnly, log.New(io.Discard, "", 0))
+	p := NewPoller(devices, time.Minute, WithPollerClock(clock))
+
+	backend.set(0, errors.New("bus wedged"))
+	p.Poll()
+	if recovered, _ := w.Check(); recovered {
+		t.Fatal("recovered before the timeout")
+	}
+	clock.Sleep(2 * time.Minute)
+	p.Poll()
+	if recovered, _ := w.Check(); !recovered {
+		t.Fatal("did not recover once every device failed for the timeout")
+	}
+}
+
+func TestWatchdogRunAndCheck(t *testing.T) {
+	clock := newFakeClock()
+	backend := &fakeBackend{names: []string{"28-000000000001"}}
+	devices, err := NewBus(WithBackend(backend), WithClock(clock)).LoadDevices()
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := NewWatchdog(devices, time.Minute, RecoverLogOnly, log.New(io.Discard, "", 0))
+	backend.set(0, errors.New("bus wedged"))
+	devices[0].Read()
+
+	// Run checks in its own goroutine while the application checks too,
+	// which the race detector must accept
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		w.Run(ctx, time.Minute)
+		close(done)
+	}()
+	for i := 0; i < 100; i++ {
+		w.Check()
+	}
+	cancel()
+	<-done
+}
+
+func TestToggleMastersWithoutDriver(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "w1_bus_master1"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	err := toggleMasters(dir)
+	if err == nil || !strings.Contains(err.Error(), "not bound to a driver") {
+		t.Errorf("toggleMasters = %v, want the missing driver", err)
+	}
+}
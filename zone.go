@@ -0,0 +1,122 @@
+package rpionewire
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Aggregation is a function computing the value of a zone, a group of
+// devices, from the temperatures of its devices
+type Aggregation int
+
+const (
+	Mean Aggregation = iota
+	Min
+	Max
+	Median
+)
+
+func (a Aggregation) String() string {
+	switch a {
+	case Mean:
+		return "mean"
+	case Min:
+		return "min"
+	case Max:
+		return "max"
+	case Median:
+		return "median"
+	}
+	return fmt.Sprintf("Aggregation(%d)", int(a))
+}
+
+// ParseAggregation returns the Aggregation named name: mean, min, max or
+// median
+func ParseAggregation(name string) (Aggregation, error) {
+	for _, a := range []Aggregation{Mean, Min, Max, Median} {
+		if a.String() == name {
+			return a, nil
+		}
+	}
+	return 0, fmt.Errorf("Error parsing aggregation %q: expected mean, min, max or median", name)
+}
+
+// apply computes the aggregation of values, which must not be empty
+func (a Aggregation) apply(values []float64) float64 {
+	switch a {
+	case Min, Max:
+		v := values[0]
+		for _, x := range values[1:] {
+			if (a == Min && x < v) || (a == Max && x > v) {
+				v = x
+			}
+		}
+		return v
+	case Median:
+		sorted := append([]float64(nil), values...)
+		sort.Float64s(sorted)
+		n := len(sorted)
+		if n%2 == 1 {
+			return sorted[n/2]
+		}
+		return (sorted[n/2-1] + sorted[n/2]) / 2
+	}
+	sum := 0.0
+	for _, x := range values {
+		sum += x
+	}
+	return sum / float64(len(values))
+}
+
+// ErrEmptyZone is the error of the aggregate of a zone none of whose
+// devices has a valid reading
+var ErrEmptyZone = errors.New("no valid reading in the zone")
+
+// zoneAggregate is an aggregate computed by a Poller
+type zoneAggregate struct {
+	group string
+	fn    Aggregation
+	// device stands for the aggregate in its readings
+	device *DS1820
+}
+
+// WithZoneAggregates makes the poller compute aggregates of the group
+// named group, such as its mean, after every cycle and hand them to the
+// sinks along with the readings of the devices. Each aggregate is a
+// synthetic reading flagged FlagDerived, of a device of type "zone"
+// named after the group and the aggregation, such as greenhouse:mean,
+// computed from the latest valid reading of every device of the group.
+func WithZoneAggregates(group string, fns ...Aggregation) PollerOption {
+	return func(p *Poller) {
+		for _, fn := range fns {
+			p.aggregates = append(p.aggregates, &zoneAggregate{
+				group:  group,
+				fn:     fn,
+				device: &DS1820{Name: group + ":" + fn.String(), DeviceType: "zone"},
+			})
+		}
+	}
+}
+
+// aggregate returns the readings of the zone aggregates, p.mu being held
+func (p *Poller) aggregate(now time.Time) []Reading {
+	aggregates := make([]Reading, 0, len(p.aggregates))
+	for _, a := range p.aggregates {
+		var values []float64
+		for _, d := range p.devices {
+			if r, ok := p.latest[d]; ok && r.Err == nil && d.InGroup(a.group) {
+				values = append(values, float64(r.Value))
+			}
+		}
+		r := Reading{Device: a.device, Time: now, Flags: FlagDerived}
+		if len(values) == 0 {
+			r.Err = ErrEmptyZone
+		} else {
+			r.Value = Temperature(a.fn.apply(values))
+		}
+		aggregates = append(aggregates, r)
+	}
+	return aggregates
+}